@@ -71,10 +71,10 @@ func mergeWomen(keepID, removeID uint, actorID int64) error {
 	// Медиа
 	keep.MediaIDs = append(keep.MediaIDs, rem.MediaIDs...)
 	// Сохраняем
-	if err := womanManager.UpdateWoman(keep); err != nil {
+	if err := womanManager.UpdateWomanBy(keep, actorID, fmt.Sprintf("merge %d", rem.ID)); err != nil {
 		return err
 	}
-	if err := womanManager.DeleteWoman(rem.ID); err != nil {
+	if err := womanManager.TrashMerged(rem.ID, keep.ID, actorID); err != nil {
 		return err
 	}
 	womanManager.LogChange(actorID, keep.ID, "merge", fmt.Sprintf("merged %d", rem.ID), "ok")
@@ -161,7 +161,7 @@ func bulkTagUpdate(tag string, filters SearchFilters, add bool, actorID int64) (
 			}
 			w.Tags = normalizeTags(nt)
 		}
-		if err := womanManager.UpdateWoman(&w); err != nil {
+		if err := womanManager.UpdateWomanBy(&w, actorID, "tags"); err != nil {
 			continue
 		}
 		newVal := strings.Join(w.Tags, ", ")
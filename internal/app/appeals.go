@@ -0,0 +1,377 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// АПЕЛЛЯЦИИ НА БАН
+// ==========================================
+
+// Забаненный пишет боту в личку /appeal — одна апелляция на каждый бан.
+// Апелляция уходит в очередь модераторов вместе с удаленным сообщением,
+// причиной и историей нарушений; решение пересылается пользователю.
+
+const (
+	AppealPending  = "pending"
+	AppealAccepted = "accepted"
+	AppealRejected = "rejected"
+
+	cbAppealPrefix = "appeal_"
+	maxAppealText  = 1000
+)
+
+var (
+	errAppealExists  = errors.New("апелляция на этот бан уже подана")
+	errAppealDecided = errors.New("апелляция уже рассмотрена")
+)
+
+type BanAppeal struct {
+	ID           uint  `gorm:"primaryKey"`
+	PunishmentID uint  `gorm:"uniqueIndex"` // одна апелляция на бан
+	ChatID       int64 `gorm:"index"`
+	UserID       int64 `gorm:"index"`
+	Text         string
+	Status       string `gorm:"size:16;index"`
+	ReviewerID   int64
+	Reply        string
+	CreatedAt    time.Time
+	DecidedAt    *time.Time
+}
+
+// Кто что пишет в личку: пользователь — текст апелляции, модератор — ответ на отказ
+var (
+	appealDrafts  = make(map[int64]uint) // user → ModerationPunishment.ID, под adminStatesMu
+	appealReplies = make(map[int64]uint) // staff → BanAppeal.ID, под adminStatesMu
+)
+
+// ------------------------------------------
+// Хранилище
+// ------------------------------------------
+
+// appealableBans — действующие баны пользователя, на которые еще нет апелляции.
+func appealableBans(db *gorm.DB, userID int64, now time.Time) []ModerationPunishment {
+	var bans []ModerationPunishment
+	db.Where("user_id = ? AND action = ? AND lifted = ?", userID, ActionBan, false).
+		Where("until IS NULL OR until > ?", now).
+		Where("id NOT IN (?)", db.Model(&BanAppeal{}).Select("punishment_id")).
+		Order("created_at DESC").
+		Find(&bans)
+	return bans
+}
+
+func fileAppeal(db *gorm.DB, p ModerationPunishment, text string, now time.Time) (*BanAppeal, error) {
+	var n int64
+	db.Model(&BanAppeal{}).Where("punishment_id = ?", p.ID).Count(&n)
+	if n > 0 {
+		return nil, errAppealExists
+	}
+	a := BanAppeal{PunishmentID: p.ID, ChatID: p.ChatID, UserID: p.UserID, Text: shorten(strings.TrimSpace(text), maxAppealText), Status: AppealPending, CreatedAt: now}
+	if err := db.Create(&a).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// decideAppeal переводит апелляцию из очереди в итоговый статус ровно один раз.
+func decideAppeal(db *gorm.DB, id uint, reviewerID int64, accept bool, reply string, now time.Time) (*BanAppeal, error) {
+	status := AppealRejected
+	if accept {
+		status = AppealAccepted
+	}
+	res := db.Model(&BanAppeal{}).Where("id = ? AND status = ?", id, AppealPending).
+		Updates(map[string]any{"status": status, "reviewer_id": reviewerID, "reply": shorten(reply, maxAppealText), "decided_at": now})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errAppealDecided
+	}
+	var a BanAppeal
+	if err := db.First(&a, id).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ------------------------------------------
+// Пользователь
+// ------------------------------------------
+
+func chatTitle(chatID int64) string {
+	if name := formatChatName(chatID); name != "" {
+		return name
+	}
+	return strconv.FormatInt(chatID, 10)
+}
+
+func describeBan(p ModerationPunishment) string {
+	until := "бессрочно"
+	if p.Until != nil {
+		until = "до " + p.Until.Format("02.01.2006 15:04")
+	}
+	return fmt.Sprintf("бан в «%s» %s", chatTitle(p.ChatID), until)
+}
+
+// notifyBanned сообщает о бане в личку (если пользователь запускал бота).
+func notifyBanned(bot *tele.Bot, chatID int64, user *tele.User, step EscalationStep, reason string) {
+	text := fmt.Sprintf("🚫 Вы получили %s в чате «%s».\nПричина: %s\n\nЕсли считаете это ошибкой, отправьте /appeal.",
+		describeStep(step), html.EscapeString(chatTitle(chatID)), html.EscapeString(reason))
+	_, _ = bot.Send(&tele.User{ID: user.ID}, text, tele.ModeHTML)
+}
+
+func promptAppeal(c tele.Context, p ModerationPunishment) error {
+	userID := c.Sender().ID
+	adminStatesMu.Lock()
+	appealDrafts[userID] = p.ID
+	adminStatesMu.Unlock()
+	setAdminState(userID, STATE_WAITING_APPEAL)
+	menu := &tele.ReplyMarkup{}
+	menu.Inline(menu.Row(menu.Data("Отмена", cbAppealPrefix+"cancel")))
+	text := fmt.Sprintf("⚖️ Апелляция: %s.\nПричина: %s\n\nОпишите одним сообщением, почему бан стоит снять. Апелляцию на этот бан можно подать только один раз.",
+		html.EscapeString(describeBan(p)), html.EscapeString(p.Reason))
+	return c.Send(text, menu, tele.ModeHTML)
+}
+
+// isAppealUpdate — шаги апелляции в личке (/appeal, кнопки, текст апелляции).
+// Их пропускают мимо капчи: забаненный до прохождения проверки иначе не смог бы
+// обжаловать бан, ведь Middleware удаляет все сообщения непроверенных, кроме /start.
+func isAppealUpdate(c tele.Context) bool {
+	if c.Chat() == nil || c.Chat().Type != tele.ChatPrivate || c.Sender() == nil {
+		return false
+	}
+	if cb := c.Callback(); cb != nil {
+		return strings.HasPrefix(callbackRouteKey(cb), cbAppealPrefix)
+	}
+	msg := c.Message()
+	if msg == nil {
+		return false
+	}
+	if cmd := strings.Fields(msg.Text); len(cmd) > 0 && (cmd[0] == "/appeal" || strings.HasPrefix(cmd[0], "/appeal@")) {
+		return true
+	}
+	return getAdminState(c.Sender().ID) == STATE_WAITING_APPEAL
+}
+
+func HandleAppeal(c tele.Context) error {
+	if c.Sender() == nil || womanManager == nil {
+		return nil
+	}
+	if c.Chat().Type != tele.ChatPrivate {
+		return c.Reply("Апелляции принимаются в личных сообщениях бота.")
+	}
+	bans := appealableBans(womanManager.DB, c.Sender().ID, time.Now())
+	switch len(bans) {
+	case 0:
+		return c.Send("Действующих банов без апелляции не найдено.")
+	case 1:
+		return promptAppeal(c, bans[0])
+	}
+	menu := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	for _, p := range bans {
+		rows = append(rows, menu.Row(menu.Data(shorten(describeBan(p), 60), fmt.Sprintf("%spick_%d", cbAppealPrefix, p.ID))))
+	}
+	menu.Inline(rows...)
+	return c.Send("Какой бан вы хотите обжаловать?", menu)
+}
+
+func submitAppeal(c tele.Context, text string) error {
+	userID := c.Sender().ID
+	adminStatesMu.Lock()
+	pid, ok := appealDrafts[userID]
+	delete(appealDrafts, userID)
+	adminStatesMu.Unlock()
+	setAdminState(userID, STATE_IDLE)
+	if !ok || strings.TrimSpace(text) == "" {
+		return c.Send("Сессия истекла. Отправьте /appeal еще раз.")
+	}
+	var p ModerationPunishment
+	if err := womanManager.DB.First(&p, pid).Error; err != nil || p.UserID != userID {
+		return c.Send("Бан не найден.")
+	}
+	a, err := fileAppeal(womanManager.DB, p, text, time.Now())
+	if errors.Is(err, errAppealExists) {
+		return c.Send("⚠️ Апелляция на этот бан уже подана.")
+	}
+	if err != nil {
+		log.Printf("⚠️ Не удалось сохранить апелляцию: %v", err)
+		return c.Send("Ошибка сохранения апелляции.")
+	}
+	logModAction(userID, "appeal_filed", strconv.FormatInt(userID, 10), fmt.Sprintf("appeal=%d punishment=%d chat=%d", a.ID, p.ID, p.ChatID))
+	sendAppealToStaff(c.Bot(), *a, p, c.Sender())
+	return c.Send("✅ Апелляция отправлена модераторам. Ответ придет сюда.")
+}
+
+// ------------------------------------------
+// Модераторы
+// ------------------------------------------
+
+func appealCardText(a BanAppeal, p ModerationPunishment, user *tele.User) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⚖️ <b>Апелляция #%d</b>\n👤 %s (ID: %d)\n⛔ %s\n❓ %s\n",
+		a.ID, mentionUser(user), a.UserID, html.EscapeString(describeBan(p)), html.EscapeString(p.Reason)))
+	if p.Content != "" {
+		sb.WriteString("📄 <i>" + html.EscapeString(shorten(p.Content, 500)) + "</i>\n")
+	}
+	var history []ViolationRecord
+	womanManager.DB.Where("chat_id = ? AND user_id = ?", a.ChatID, a.UserID).Order("created_at DESC").Limit(10).Find(&history)
+	if len(history) > 0 {
+		sb.WriteString("\n<b>История нарушений:</b>\n")
+		for _, r := range history {
+			mark := ""
+			if r.Pardoned {
+				mark = " (снято)"
+			}
+			sb.WriteString(fmt.Sprintf("• %s — %s (%s)%s\n", r.CreatedAt.Format("02.01 15:04"), html.EscapeString(r.Reason), r.Type, mark))
+		}
+	}
+	sb.WriteString("\n💬 " + html.EscapeString(a.Text))
+	return sb.String()
+}
+
+func buildAppealMenu(id uint) *tele.ReplyMarkup {
+	menu := &tele.ReplyMarkup{}
+	menu.Inline(menu.Row(
+		menu.Data("✅ Разбанить", fmt.Sprintf("%sok_%d", cbAppealPrefix, id)),
+		menu.Data("❌ Отклонить", fmt.Sprintf("%sno_%d", cbAppealPrefix, id)),
+	))
+	return menu
+}
+
+func sendAppealToStaff(bot *tele.Bot, a BanAppeal, p ModerationPunishment, user *tele.User) {
+	text := appealCardText(a, p, user)
+	for _, id := range moderationReviewers() {
+		if _, err := bot.Send(&tele.User{ID: id}, text, buildAppealMenu(a.ID), tele.ModeHTML); err != nil {
+			log.Printf("⚠️ Не удалось отправить апелляцию %d: %v", id, err)
+		}
+	}
+}
+
+// HandleAppeals — очередь нерассмотренных апелляций.
+func HandleAppeals(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermModerate) || womanManager == nil {
+		return nil
+	}
+	var pending []BanAppeal
+	womanManager.DB.Where("status = ?", AppealPending).Order("created_at").Limit(10).Find(&pending)
+	if len(pending) == 0 {
+		return c.Send("Очередь апелляций пуста.")
+	}
+	for _, a := range pending {
+		var p ModerationPunishment
+		womanManager.DB.First(&p, a.PunishmentID)
+		c.Send(appealCardText(a, p, &tele.User{ID: a.UserID}), buildAppealMenu(a.ID), tele.ModeHTML)
+	}
+	return nil
+}
+
+func acceptAppeal(c tele.Context, id uint) error {
+	reviewer := c.Sender().ID
+	a, err := decideAppeal(womanManager.DB, id, reviewer, true, "", time.Now())
+	if err != nil {
+		return c.Respond(&tele.CallbackResponse{Text: err.Error()})
+	}
+	var p ModerationPunishment
+	lifted := 0
+	if womanManager.DB.First(&p, a.PunishmentID).Error == nil && !p.Lifted {
+		if err := liftPunishment(c.Bot(), p); err != nil {
+			log.Printf("⚠️ Не удалось снять бан %d: %v", a.UserID, err)
+		} else {
+			lifted = 1
+		}
+	}
+	n, _ := pardonViolations(womanManager.DB, a.ChatID, a.UserID, true)
+	if statsManager != nil {
+		statsManager.ClearViolations(a.UserID)
+	}
+	logModAction(reviewer, "appeal_accept", strconv.FormatInt(a.UserID, 10), fmt.Sprintf("appeal=%d chat=%d lifted=%d pardoned=%d", a.ID, a.ChatID, lifted, n))
+	_, _ = c.Bot().Send(&tele.User{ID: a.UserID}, fmt.Sprintf("✅ Ваша апелляция удовлетворена, бан в «%s» снят.", html.EscapeString(chatTitle(a.ChatID))), tele.ModeHTML)
+	c.Respond(&tele.CallbackResponse{Text: "Бан снят."})
+	if msg := c.Message(); msg != nil {
+		_, _ = c.Bot().Edit(msg, msg.Text+"\n\n✅ Принята", tele.NoPreview)
+	}
+	return nil
+}
+
+func rejectAppealWithReply(c tele.Context, text string) error {
+	reviewer := c.Sender().ID
+	adminStatesMu.Lock()
+	id, ok := appealReplies[reviewer]
+	delete(appealReplies, reviewer)
+	adminStatesMu.Unlock()
+	setAdminState(reviewer, STATE_IDLE)
+	if !ok {
+		return c.Send("Ошибка идентификатора.")
+	}
+	reply := strings.TrimSpace(text)
+	if reply == "-" {
+		reply = ""
+	}
+	a, err := decideAppeal(womanManager.DB, id, reviewer, false, reply, time.Now())
+	if err != nil {
+		return c.Send("⚠️ " + err.Error())
+	}
+	logModAction(reviewer, "appeal_reject", strconv.FormatInt(a.UserID, 10), fmt.Sprintf("appeal=%d chat=%d reply=%s", a.ID, a.ChatID, reply))
+	msg := fmt.Sprintf("❌ Ваша апелляция на бан в «%s» отклонена.", html.EscapeString(chatTitle(a.ChatID)))
+	if reply != "" {
+		msg += "\nОтвет модератора: " + html.EscapeString(reply)
+	}
+	_, _ = c.Bot().Send(&tele.User{ID: a.UserID}, msg, tele.ModeHTML)
+	return c.Send(fmt.Sprintf("Апелляция #%d отклонена, ответ отправлен.", a.ID))
+}
+
+func handleAppealCallback(c tele.Context, data string) error {
+	rest := strings.TrimPrefix(data, cbAppealPrefix)
+	userID := c.Sender().ID
+	if rest == "cancel" {
+		adminStatesMu.Lock()
+		delete(appealDrafts, userID)
+		adminStatesMu.Unlock()
+		setAdminState(userID, STATE_IDLE)
+		c.Respond()
+		return tryEdit(c, "Апелляция отменена.")
+	}
+	action, idStr, _ := strings.Cut(rest, "_")
+	id64, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil || womanManager == nil {
+		return c.Respond()
+	}
+	id := uint(id64)
+	switch action {
+	case "pick":
+		var p ModerationPunishment
+		if womanManager.DB.First(&p, id).Error != nil || p.UserID != userID {
+			return c.Respond(&tele.CallbackResponse{Text: "Бан не найден."})
+		}
+		c.Respond()
+		return promptAppeal(c, p)
+	case "ok", "no":
+		if !hasPermission(userID, PermModerate) {
+			return c.Respond(&tele.CallbackResponse{Text: "Недостаточно прав."})
+		}
+		if action == "ok" {
+			return acceptAppeal(c, id)
+		}
+		var a BanAppeal
+		if womanManager.DB.First(&a, id).Error != nil || a.Status != AppealPending {
+			return c.Respond(&tele.CallbackResponse{Text: errAppealDecided.Error()})
+		}
+		adminStatesMu.Lock()
+		appealReplies[userID] = id
+		adminStatesMu.Unlock()
+		setAdminState(userID, STATE_WAITING_APPEAL_REPLY)
+		c.Respond()
+		return c.Send(fmt.Sprintf("Напишите ответ пользователю по апелляции #%d (или '-' без комментария):", id), buildCancelEditMenu())
+	}
+	return c.Respond()
+}
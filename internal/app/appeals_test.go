@@ -0,0 +1,94 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestBanAppealLifecycle(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&ModerationPunishment{}, &BanAppeal{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	recordPunishment(db, -100, 1, ActionBan, 0, now, "ссылка", "http://spam")
+	recordPunishment(db, -200, 1, ActionBan, time.Hour, now, "телефон", "")
+	recordPunishment(db, -100, 1, ActionMute, time.Hour, now, "мат", "")
+	db.Create(&ModerationPunishment{ChatID: -300, UserID: 1, Action: ActionBan, Until: &past})
+	db.Create(&ModerationPunishment{ChatID: -400, UserID: 1, Action: ActionBan, Lifted: true})
+
+	bans := appealableBans(db, 1, now)
+	if len(bans) != 2 {
+		t.Fatalf("expected 2 active bans, got %+v", bans)
+	}
+	var first ModerationPunishment
+	db.Where("chat_id = ? AND action = ?", -100, ActionBan).First(&first)
+	if first.Content != "http://spam" || first.Reason != "ссылка" {
+		t.Fatalf("punishment must keep reason and content: %+v", first)
+	}
+
+	a, err := fileAppeal(db, first, "  это был не спам  ", now)
+	if err != nil || a.Status != AppealPending || a.Text != "это был не спам" {
+		t.Fatalf("fileAppeal: %+v %v", a, err)
+	}
+	if _, err := fileAppeal(db, first, "еще раз", now); !errors.Is(err, errAppealExists) {
+		t.Fatalf("second appeal for the same ban must fail, got %v", err)
+	}
+	if bans := appealableBans(db, 1, now); len(bans) != 1 || bans[0].ChatID != -200 {
+		t.Fatalf("appealed ban must leave the list: %+v", bans)
+	}
+
+	decided, err := decideAppeal(db, a.ID, 42, false, "нет", now)
+	if err != nil || decided.Status != AppealRejected || decided.ReviewerID != 42 || decided.Reply != "нет" {
+		t.Fatalf("decideAppeal: %+v %v", decided, err)
+	}
+	if _, err := decideAppeal(db, a.ID, 43, true, "", now); !errors.Is(err, errAppealDecided) {
+		t.Fatalf("appeal must be decided only once, got %v", err)
+	}
+}
+
+func TestUnverifiedBannedUserCanAppeal(t *testing.T) {
+	wm := newTestWomanManager(t)
+	saved := womanManager
+	womanManager = wm
+	t.Cleanup(func() { womanManager = saved })
+	const userID = 501
+	recordPunishment(wm.DB, -100, userID, ActionBan, 0, time.Now(), "ссылка", "")
+
+	bot, calls := newRecordingBot(t)
+	user := &tele.User{ID: userID, FirstName: "Banned"}
+	dm := &tele.Chat{ID: userID, Type: tele.ChatPrivate}
+	send := func(text string, h tele.HandlerFunc) {
+		userLastReqMu.Lock()
+		delete(userLastReq, userID)
+		userLastReqMu.Unlock()
+		c := bot.NewContext(tele.Update{Message: &tele.Message{ID: 1, Chat: dm, Sender: user, Text: text}})
+		if err := Middleware()(h)(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { setAdminState(userID, STATE_IDLE) })
+
+	send("/appeal", HandleAppeal)
+	got := calls()
+	if len(got) != 1 || !strings.Contains(got[0].Params["text"].(string), "Апелляция") {
+		t.Fatalf("/appeal must reach the handler past the captcha gate: %+v", got)
+	}
+	reached := false
+	send("это был не спам", func(tele.Context) error { reached = true; return nil })
+	if !reached {
+		t.Fatal("appeal text must pass the captcha gate")
+	}
+
+	setAdminState(userID, STATE_IDLE)
+	reached = false
+	send("привет", func(tele.Context) error { reached = true; return nil })
+	if reached {
+		t.Fatal("other messages of unverified users stay behind the captcha")
+	}
+}
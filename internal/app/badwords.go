@@ -0,0 +1,387 @@
+package app
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ==========================================
+// ЗАПРЕЩЕННЫЕ СЛОВА: НОРМАЛИЗАЦИЯ И ШАБЛОНЫ
+// ==========================================
+
+// Перед сравнением и текст, и слова из words.json проходят одну и ту же
+// нормализацию: латинские/греческие двойники → кириллица, цифры и символы
+// вместо букв (leetspeak) → буквы, повторы схлопываются, а слова,
+// разбитые на отдельные буквы ("с а й т"), склеиваются.
+//
+// Форматы записей в words.json:
+//   слово        — точное совпадение или корень (для длины >= 4) с хвостом до 4 символов
+//   два слова    — фраза: слова идут подряд
+//   казин*, ст?вка — шаблон на одно слово: * — любые буквы, ? — одна буква
+//   re:выраж     — регулярное выражение (без учета регистра) по исходному
+//                  и нормализованному тексту; /выраж/ — то же самое
+
+// Двойники, которые приводятся к кириллице
+var confusables = map[rune]rune{
+	'a': 'а', 'b': 'в', 'c': 'с', 'e': 'е', 'h': 'н', 'k': 'к', 'm': 'м',
+	'o': 'о', 'p': 'р', 't': 'т', 'x': 'х', 'y': 'у', 'ё': 'е',
+	'α': 'а', 'β': 'в', 'ε': 'е', 'η': 'н', 'κ': 'к', 'μ': 'м', 'ο': 'о',
+	'ρ': 'р', 'τ': 'т', 'χ': 'х', 'υ': 'у',
+	'і': 'и', 'ї': 'и', 'є': 'е', // украинские
+}
+
+// Цифры и символы вместо букв (только внутри слов с буквами)
+var leetspeak = map[rune]rune{
+	'0': 'о', '3': 'з', '4': 'ч', '6': 'б', '8': 'в', '@': 'а', '$': 'с',
+}
+
+// minSplitLetters — сколько одиночных букв подряд считаются разбитым словом
+const minSplitLetters = 3
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '@' || r == '$'
+}
+
+// normalizeToken приводит одно слово к канонической форме.
+func normalizeToken(tok string) string {
+	hasLetter := false
+	for _, r := range tok {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+			break
+		}
+	}
+	var sb strings.Builder
+	var prev rune
+	for _, r := range strings.ToLower(tok) {
+		if hasLetter {
+			if m, ok := leetspeak[r]; ok {
+				r = m
+			}
+		} else if r == '@' || r == '$' {
+			continue
+		}
+		if m, ok := confusables[r]; ok {
+			r = m
+		}
+		if hasLetter && r == prev {
+			continue
+		}
+		sb.WriteRune(r)
+		prev = r
+	}
+	return sb.String()
+}
+
+// normalizeWords разбивает текст на нормализованные слова.
+func normalizeWords(text string) []string {
+	raw := strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) })
+	out := make([]string, 0, len(raw))
+	var run []string
+	flush := func() {
+		if len(run) >= minSplitLetters {
+			out = append(out, normalizeToken(strings.Join(run, "")))
+		} else {
+			for _, t := range run {
+				if n := normalizeToken(t); n != "" {
+					out = append(out, n)
+				}
+			}
+		}
+		run = run[:0]
+	}
+	for _, tok := range raw {
+		if len([]rune(tok)) == 1 && !unicode.IsDigit([]rune(tok)[0]) {
+			run = append(run, tok)
+			continue
+		}
+		flush()
+		if n := normalizeToken(tok); n != "" {
+			out = append(out, n)
+		}
+	}
+	flush()
+	return out
+}
+
+func normalizeText(text string) string {
+	return strings.Join(normalizeWords(text), " ")
+}
+
+// ------------------------------------------
+// Скомпилированный список
+// ------------------------------------------
+
+type wordMatcher struct {
+	exact    map[string]string // нормализованное слово → запись списка
+	roots    map[string]string // корни длиной >= 4 → запись списка
+	phrases  []wordRule        // фразы из нескольких слов, через пробел
+	patterns []wordRule        // шаблоны с * и ?, на одно слово
+	regexes  []wordRule        // re:, по всему тексту
+}
+
+type wordRule struct {
+	needle string
+	re     *regexp.Regexp
+	entry  string
+}
+
+func isRegexEntry(entry string) (string, bool) {
+	entry = strings.TrimSpace(entry)
+	if strings.HasPrefix(entry, "re:") {
+		return strings.TrimSpace(entry[3:]), true
+	}
+	if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		return entry[1 : len(entry)-1], true
+	}
+	return "", false
+}
+
+// shadowPrefix помечает запись, которая работает в теневом режиме (см. shadow_mode.go).
+const shadowPrefix = "shadow:"
+
+func isShadowEntry(entry string) (string, bool) {
+	entry = strings.TrimSpace(entry)
+	if strings.HasPrefix(entry, shadowPrefix) {
+		return strings.TrimSpace(entry[len(shadowPrefix):]), true
+	}
+	return entry, false
+}
+
+// normalizeWordEntry готовит запись для words.json: регулярки не трогаем.
+func normalizeWordEntry(entry string) string {
+	entry, shadow := isShadowEntry(entry)
+	if _, ok := isRegexEntry(entry); !ok {
+		entry = strings.ToLower(entry)
+	}
+	if shadow {
+		return shadowPrefix + entry
+	}
+	return entry
+}
+
+// wildcardRegex превращает "казин*" в ^казин\pL*$ над нормализованным словом.
+func wildcardRegex(entry string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	lit := strings.Builder{}
+	flushLit := func() {
+		if lit.Len() > 0 {
+			sb.WriteString(regexp.QuoteMeta(normalizeToken(lit.String())))
+			lit.Reset()
+		}
+	}
+	for _, r := range entry {
+		switch r {
+		case '*':
+			flushLit()
+			sb.WriteString(`[\pL\pN]*`)
+		case '?':
+			flushLit()
+			sb.WriteString(`[\pL\pN]`)
+		default:
+			lit.WriteRune(r)
+		}
+	}
+	flushLit()
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func compileWordMatcher(words []string) *wordMatcher {
+	m := &wordMatcher{exact: make(map[string]string), roots: make(map[string]string)}
+	for _, entry := range words {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if expr, ok := isRegexEntry(entry); ok {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				log.Printf("⚠️ Неверное выражение в списке слов %q: %v", entry, err)
+				continue
+			}
+			m.regexes = append(m.regexes, wordRule{re: re, entry: entry})
+			continue
+		}
+		if strings.ContainsAny(entry, "*?") {
+			re, err := wildcardRegex(strings.ToLower(entry))
+			if err != nil {
+				log.Printf("⚠️ Неверный шаблон в списке слов %q: %v", entry, err)
+				continue
+			}
+			m.patterns = append(m.patterns, wordRule{re: re, entry: entry})
+			continue
+		}
+		parts := normalizeWords(entry)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) > 1 {
+			m.phrases = append(m.phrases, wordRule{needle: " " + strings.Join(parts, " ") + " ", entry: entry})
+			continue
+		}
+		norm := parts[0]
+		m.exact[norm] = entry
+		if len([]rune(norm)) >= 4 {
+			m.roots[norm] = entry
+		}
+	}
+	return m
+}
+
+func (m *wordMatcher) empty() bool {
+	return len(m.exact) == 0 && len(m.phrases) == 0 && len(m.patterns) == 0 && len(m.regexes) == 0
+}
+
+// findWords проверяет уже нормализованные слова.
+// Защита от ложных срабатываний: root-check только для корней длиной >= 4
+// и с хвостом/префиксом до 4 символов. Вместо перебора всего списка
+// проверяются подстроки слова нужной длины — поиск не зависит от размера списка.
+func (m *wordMatcher) findWords(words []string) (string, bool) {
+	for _, w := range words {
+		if entry, ok := m.exact[w]; ok {
+			return entry, true
+		}
+		if len(m.roots) > 0 {
+			if entry, ok := m.findRoot([]rune(w)); ok {
+				return entry, true
+			}
+		}
+		for _, r := range m.patterns {
+			if r.re.MatchString(w) {
+				return r.entry, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (m *wordMatcher) findRoot(w []rune) (string, bool) {
+	for l := len(w) - 1; l >= 4 && len(w)-l <= 4; l-- {
+		for i := 0; i+l <= len(w); i++ {
+			if entry, ok := m.roots[string(w[i:i+l])]; ok {
+				return entry, true
+			}
+		}
+	}
+	return "", false
+}
+
+// find возвращает запись списка, которая сработала на тексте.
+func (m *wordMatcher) find(text string, words []string) (string, bool) {
+	if entry, ok := m.findWords(words); ok {
+		return entry, true
+	}
+	if len(m.phrases) == 0 && len(m.regexes) == 0 {
+		return "", false
+	}
+	norm := strings.Join(words, " ")
+	padded := " " + norm + " "
+	for _, p := range m.phrases {
+		if strings.Contains(padded, p.needle) {
+			return p.entry, true
+		}
+	}
+	lower := strings.ToLower(text)
+	for _, r := range m.regexes {
+		if r.re.MatchString(lower) || r.re.MatchString(norm) {
+			return r.entry, true
+		}
+	}
+	return "", false
+}
+
+func (m *wordMatcher) match(text string, words []string) bool {
+	_, ok := m.find(text, words)
+	return ok
+}
+
+// wordMatchers — боевые и теневые записи одного списка.
+type wordMatchers struct {
+	enforce *wordMatcher
+	shadow  *wordMatcher
+}
+
+func compileWordMatchers(words []string) wordMatchers {
+	var enforce, shadow []string
+	for _, w := range words {
+		if entry, ok := isShadowEntry(w); ok {
+			shadow = append(shadow, entry)
+		} else {
+			enforce = append(enforce, w)
+		}
+	}
+	return wordMatchers{enforce: compileWordMatcher(enforce), shadow: compileWordMatcher(shadow)}
+}
+
+// ------------------------------------------
+// Кэш
+// ------------------------------------------
+
+var (
+	badWordsMatchers *wordMatchers // под wordsMu; nil — пересобрать
+
+	extraMatchersMu sync.Mutex
+	extraMatchers   = make(map[string]wordMatchers) // слова профилей чатов
+)
+
+const maxExtraMatchers = 256
+
+// invalidateBadWords вызывается под wordsMu.Lock после изменения badWords.
+func invalidateBadWords() { badWordsMatchers = nil }
+
+func currentBadWordsMatchers() wordMatchers {
+	wordsMu.RLock()
+	m := badWordsMatchers
+	wordsMu.RUnlock()
+	if m != nil {
+		return *m
+	}
+	wordsMu.Lock()
+	defer wordsMu.Unlock()
+	if badWordsMatchers == nil {
+		compiled := compileWordMatchers(badWords)
+		badWordsMatchers = &compiled
+	}
+	return *badWordsMatchers
+}
+
+func extraWordsMatchers(extra []string) wordMatchers {
+	key := strings.Join(extra, "\n")
+	extraMatchersMu.Lock()
+	defer extraMatchersMu.Unlock()
+	if m, ok := extraMatchers[key]; ok {
+		return m
+	}
+	if len(extraMatchers) >= maxExtraMatchers {
+		extraMatchers = make(map[string]wordMatchers)
+	}
+	m := compileWordMatchers(extra)
+	extraMatchers[key] = m
+	return m
+}
+
+// badWordHits проверяет текст по общему списку и словам профиля чата.
+// enforced — сработавшая боевая запись, shadow — сработавшие теневые.
+func badWordHits(text string, extra ...string) (enforced string, hit bool, shadow []string) {
+	words := normalizeWords(text)
+	sets := []wordMatchers{currentBadWordsMatchers()}
+	if len(extra) > 0 {
+		sets = append(sets, extraWordsMatchers(extra))
+	}
+	for _, set := range sets {
+		if !hit && !set.enforce.empty() {
+			enforced, hit = set.enforce.find(text, words)
+		}
+		if !set.shadow.empty() {
+			if entry, ok := set.shadow.find(text, words); ok {
+				shadow = append(shadow, entry)
+			}
+		}
+	}
+	return enforced, hit, shadow
+}
@@ -0,0 +1,103 @@
+package app
+
+import "testing"
+
+func TestBadWordMatcherBypasses(t *testing.T) {
+	m := compileWordMatcher([]string{"сайт", "казино", "ставк*", "бот?", "re:заработ\\S* от \\d+", "/t\\.me/", "мат", "free money"})
+
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"plain", "заходите на сайт", true},
+		{"latin homoglyph", "заходите на сaйт", true},
+		{"mixed scripts", "KAЗИНО без депозита", true},
+		{"greek omicron", "казинο", true},
+		{"leetspeak", "к4зин0 и к@зино", true},
+		{"digit for letter", "ка3ино", true},
+		{"repeated letters", "саааайййт", true},
+		{"spaced letters", "с а й т", true},
+		{"dotted letters", "к.а.з.и.н.о", true},
+		{"root with suffix", "казиношка", true},
+		{"wildcard suffix", "ставочки? нет, ставками", true},
+		{"wildcard single", "боты", true},
+		{"regex raw", "заработок от 1000 в день", true},
+		{"regex normalized", "пиши в t.me/spam", true},
+		{"phrase joined", "FREE MONEY here", true},
+		{"short word exact only", "матрица и математика", false},
+		{"short word exact", "это мат", true},
+		{"clean text", "Мария Кюри получила две Нобелевские премии", false},
+		{"numbers stay numbers", "родилась в 1867 году", false},
+		{"far root", "сайтостроительство", false},
+		{"two single letters", "я и ты", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.match(tt.text, normalizeWords(tt.text)); got != tt.want {
+				t.Fatalf("match(%q) = %v, want %v (normalized: %q)", tt.text, got, tt.want, normalizeText(tt.text))
+			}
+		})
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := map[string]string{
+		"Сaйт":         "сайт",
+		"к0т  ёж":      "кот еж",
+		"п р и в е т!": "привет",
+		"ааа 1000":     "а 1000",
+		"@user и $100": "аusеr и 100",
+		"ЗАРАБОТОК!!!": "заработок",
+	}
+	for in, want := range tests {
+		if got := normalizeText(in); got != want {
+			t.Errorf("normalizeText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestContainsBadWordUsesCompiledList(t *testing.T) {
+	wordsMu.Lock()
+	saved := badWords
+	badWords = []string{"спам"}
+	invalidateBadWords()
+	wordsMu.Unlock()
+	t.Cleanup(func() {
+		wordsMu.Lock()
+		badWords = saved
+		invalidateBadWords()
+		wordsMu.Unlock()
+	})
+
+	if !containsBadWord("тут cпaм") {
+		t.Fatal("homoglyph spam must match the global list")
+	}
+	if containsBadWord("тут реклама") {
+		t.Fatal("extra words must not leak into the global list")
+	}
+	if !containsBadWord("тут р е к л а м а", "реклама") {
+		t.Fatal("chat extra words must be matched with the same normalisation")
+	}
+
+	wordsMu.Lock()
+	badWords = append(badWords, "реклам*")
+	invalidateBadWords()
+	wordsMu.Unlock()
+	if !containsBadWord("рекламка") {
+		t.Fatal("matcher must be rebuilt after the list changes")
+	}
+}
+
+func BenchmarkContainsBadWord(b *testing.B) {
+	words := make([]string, 0, 500)
+	for i := 0; i < 500; i++ {
+		words = append(words, "запрет"+string(rune('а'+i%32))+"слово")
+	}
+	m := compileWordMatcher(words)
+	text := "Обычное сообщение в чате про историю науки и великих женщин, без всякого спама"
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.match(text, normalizeWords(text))
+	}
+}
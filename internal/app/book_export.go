@@ -0,0 +1,580 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	tele "gopkg.in/telebot.v3"
+)
+
+// ==========================================
+// ЭКСПОРТ ПОДБОРКИ В КНИГУ (EPUB, HTML/MARKDOWN)
+// ==========================================
+
+// Подборка (коллекция или любые фильтры поиска) собирается в самодостаточный
+// EPUB 3 и zip с index.html, book.md и папкой images/. В каждой карточке — фото
+// (WebImageURL или первое медиа из Telegram через кэш CMS), эпоха, теги и полная биография.
+
+const (
+	maxBookCards      = 500
+	maxBookImageSize  = 8 << 20
+	bookImageTimeout  = 15 * time.Second
+	bookDefaultTitle  = "Архив Офелии"
+	bookFormatEPUB    = "epub"
+	bookFormatZip     = "zip"
+	bookExportTimeout = 5 * time.Minute
+)
+
+var bookImageTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+type bookCard struct {
+	Woman     Woman
+	Image     []byte
+	ImageName string // images/<id>.<ext>
+}
+
+type book struct {
+	Title       string
+	Description string
+	Cards       []bookCard
+	Created     time.Time
+}
+
+// bookImageLoader достает фото карточки; подменяется в тестах.
+var bookImageLoader = loadBookImage
+
+// buildBook выбирает карточки по фильтрам (в хронологическом порядке) и загружает фото.
+func buildBook(ctx context.Context, title, description string, f SearchFilters) book {
+	f.Limit = 0
+	women := womanManager.SearchWomenAdvanced(f)
+	sort.SliceStable(women, func(i, j int) bool {
+		a, b := women[i].YearFrom, women[j].YearFrom
+		if (a == 0) != (b == 0) {
+			return b == 0
+		}
+		if a != b {
+			return a < b
+		}
+		return women[i].Name < women[j].Name
+	})
+	if len(women) > maxBookCards {
+		women = women[:maxBookCards]
+	}
+	b := book{Title: title, Description: description, Created: time.Now()}
+	if b.Title == "" {
+		b.Title = bookDefaultTitle
+	}
+	for _, w := range women {
+		card := bookCard{Woman: w}
+		if data, ext := bookImageLoader(ctx, &w); len(data) > 0 {
+			card.Image = data
+			card.ImageName = fmt.Sprintf("images/%d%s", w.ID, ext)
+		}
+		b.Cards = append(b.Cards, card)
+	}
+	return b
+}
+
+// loadBookImage: локальный файл из uploads, внешний URL или Telegram-файл через кэш CMS.
+func loadBookImage(ctx context.Context, w *Woman) ([]byte, string) {
+	candidates := []string{strings.TrimSpace(w.WebImageURL)}
+	candidates = append(candidates, w.MediaIDs...)
+	for _, raw := range candidates {
+		if raw == "" {
+			continue
+		}
+		var data []byte
+		var name string
+		switch {
+		case strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://"):
+			data, name = fetchBookImage(ctx, raw), raw
+		case looksLikeTelegramFileID(raw):
+			if cmsService == nil {
+				continue
+			}
+			local, err := cmsService.downloadTelegramMediaToUpload(ctx, raw)
+			if err != nil {
+				log.Printf("⚠️ Книга: не удалось получить фото ID %d: %v", w.ID, err)
+				continue
+			}
+			data, name = readBookImage(local), local
+		default:
+			data, name = readBookImage(localUploadPath(raw)), raw
+		}
+		ext := strings.ToLower(path.Ext(strings.SplitN(name, "?", 2)[0]))
+		if _, ok := bookImageTypes[ext]; ok && len(data) > 0 {
+			return data, ext
+		}
+	}
+	return nil, ""
+}
+
+// localUploadPath переводит путь вида /uploads/x.jpg в файл внутри cmsUploadsDir.
+func localUploadPath(raw string) string {
+	rel := strings.TrimPrefix(strings.TrimPrefix(filepath.ToSlash(raw), "./"), "/")
+	if !strings.HasPrefix(rel, "uploads/") {
+		return ""
+	}
+	base := filepath.Clean(cmsUploadsDir)
+	p := filepath.Join(base, filepath.FromSlash(strings.TrimPrefix(rel, "uploads/")))
+	if !strings.HasPrefix(p, base+string(os.PathSeparator)) {
+		return ""
+	}
+	return p
+}
+
+func readBookImage(p string) []byte {
+	if p == "" {
+		return nil
+	}
+	info, err := os.Stat(p)
+	if err != nil || info.IsDir() || info.Size() > maxBookImageSize {
+		return nil
+	}
+	data, _ := os.ReadFile(p)
+	return data
+}
+
+func fetchBookImage(ctx context.Context, u string) []byte {
+	ctx, cancel := context.WithTimeout(ctx, bookImageTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBookImageSize+1))
+	if err != nil || len(data) > maxBookImageSize {
+		return nil
+	}
+	return data
+}
+
+// ------------------------------------------
+// Разметка
+// ------------------------------------------
+
+func bookCardEra(w *Woman) string {
+	parts := []string{}
+	if w.Year != "" {
+		parts = append(parts, w.Year)
+	}
+	if era := formatEra(w.YearFrom, w.YearTo); era != "" {
+		parts = append(parts, era)
+	}
+	return strings.Join(parts, " · ")
+}
+
+func bookParagraphs(text string) []string {
+	var out []string
+	for _, p := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// cardHTML — тело карточки; картинки лежат в images/ рядом со страницей.
+func (c bookCard) cardHTML(sb *strings.Builder) {
+	w := c.Woman
+	sb.WriteString(fmt.Sprintf("<section class=\"card\" id=\"card-%d\">\n<h2>%s</h2>\n", w.ID, html.EscapeString(w.Name)))
+	if c.ImageName != "" {
+		sb.WriteString(fmt.Sprintf("<p class=\"photo\"><img src=\"%s\" alt=\"%s\"/></p>\n", c.ImageName, html.EscapeString(w.Name)))
+	}
+	var meta []string
+	if era := bookCardEra(&w); era != "" {
+		meta = append(meta, html.EscapeString(era))
+	}
+	if w.Field != "" {
+		meta = append(meta, html.EscapeString(w.Field))
+	}
+	if len(meta) > 0 {
+		sb.WriteString("<p class=\"meta\">" + strings.Join(meta, " — ") + "</p>\n")
+	}
+	if len(w.Tags) > 0 {
+		tags := make([]string, 0, len(w.Tags))
+		for _, t := range w.Tags {
+			tags = append(tags, "#"+html.EscapeString(t))
+		}
+		sb.WriteString("<p class=\"tags\">" + strings.Join(tags, " ") + "</p>\n")
+	}
+	for _, p := range bookParagraphs(w.Info) {
+		sb.WriteString("<p>" + html.EscapeString(p) + "</p>\n")
+	}
+	sb.WriteString("</section>\n")
+}
+
+const bookCSS = `body { font-family: Georgia, serif; line-height: 1.5; margin: 0 auto; max-width: 42em; padding: 1em; }
+h1, h2 { font-family: Helvetica, Arial, sans-serif; }
+.photo { text-align: center; }
+.photo img { max-width: 100%; max-height: 30em; }
+.meta { font-style: italic; }
+.tags { color: #666; font-size: 0.9em; }
+.card { page-break-before: always; }
+`
+
+func xhtmlPage(title, body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="ru" xml:lang="ru">
+<head><meta charset="UTF-8"/><title>` + html.EscapeString(title) + `</title><link rel="stylesheet" type="text/css" href="style.css"/></head>
+<body>
+` + body + `</body>
+</html>
+`
+}
+
+// ------------------------------------------
+// EPUB
+// ------------------------------------------
+
+func (b book) writeEPUB(out io.Writer) error {
+	zw := zip.NewWriter(out)
+	// mimetype — первым и без сжатия
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write([]byte("application/epub+zip")); err != nil {
+		return err
+	}
+	files := map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>
+`,
+		"OEBPS/style.css": bookCSS,
+	}
+
+	var manifest, spine, nav strings.Builder
+	manifest.WriteString(`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="css" href="style.css" media-type="text/css"/>
+<item id="title" href="title.xhtml" media-type="application/xhtml+xml"/>
+`)
+	spine.WriteString(`<itemref idref="title"/>
+`)
+	var title strings.Builder
+	title.WriteString("<h1>" + html.EscapeString(b.Title) + "</h1>\n")
+	for _, p := range bookParagraphs(b.Description) {
+		title.WriteString("<p>" + html.EscapeString(p) + "</p>\n")
+	}
+	title.WriteString(fmt.Sprintf("<p>Карточек: %d. Собрано %s.</p>\n", len(b.Cards), b.Created.Format("02.01.2006")))
+	files["OEBPS/title.xhtml"] = xhtmlPage(b.Title, title.String())
+
+	nav.WriteString("<nav epub:type=\"toc\" id=\"toc\"><h1>Содержание</h1>\n<ol>\n")
+	for _, c := range b.Cards {
+		id := fmt.Sprintf("card%d", c.Woman.ID)
+		page := id + ".xhtml"
+		var body strings.Builder
+		c.cardHTML(&body)
+		files["OEBPS/"+page] = xhtmlPage(c.Woman.Name, body.String())
+		manifest.WriteString(fmt.Sprintf("<item id=\"%s\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", id, page))
+		spine.WriteString(fmt.Sprintf("<itemref idref=\"%s\"/>\n", id))
+		nav.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a></li>\n", page, html.EscapeString(c.Woman.Name)))
+		if c.ImageName != "" {
+			manifest.WriteString(fmt.Sprintf("<item id=\"img%d\" href=\"%s\" media-type=\"%s\"/>\n", c.Woman.ID, c.ImageName, bookImageTypes[path.Ext(c.ImageName)]))
+		}
+	}
+	nav.WriteString("</ol>\n</nav>\n")
+	files["OEBPS/nav.xhtml"] = xhtmlPage("Содержание", nav.String())
+
+	files["OEBPS/content.opf"] = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="ru">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="bookid">urn:uuid:` + uuid.NewString() + `</dc:identifier>
+<dc:title>` + html.EscapeString(b.Title) + `</dc:title>
+<dc:language>ru</dc:language>
+<meta property="dcterms:modified">` + b.Created.UTC().Format("2006-01-02T15:04:05Z") + `</meta>
+</metadata>
+<manifest>
+` + manifest.String() + `</manifest>
+<spine>
+` + spine.String() + `</spine>
+</package>
+`
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeZipFile(zw, name, []byte(files[name])); err != nil {
+			return err
+		}
+	}
+	if err := b.writeImages(zw, "OEBPS/"); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (b book) writeImages(zw *zip.Writer, prefix string) error {
+	for _, c := range b.Cards {
+		if c.ImageName == "" {
+			continue
+		}
+		if err := writeZipFile(zw, prefix+c.ImageName, c.Image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ------------------------------------------
+// HTML + Markdown
+// ------------------------------------------
+
+func (b book) writeSiteZip(out io.Writer) error {
+	zw := zip.NewWriter(out)
+
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html lang=\"ru\">\n<head><meta charset=\"UTF-8\"/><title>" + html.EscapeString(b.Title) + "</title>\n<style>\n" + bookCSS + "</style></head>\n<body>\n")
+	page.WriteString("<h1>" + html.EscapeString(b.Title) + "</h1>\n")
+	for _, p := range bookParagraphs(b.Description) {
+		page.WriteString("<p>" + html.EscapeString(p) + "</p>\n")
+	}
+	page.WriteString("<nav><ol>\n")
+	for _, c := range b.Cards {
+		page.WriteString(fmt.Sprintf("<li><a href=\"#card-%d\">%s</a></li>\n", c.Woman.ID, html.EscapeString(c.Woman.Name)))
+	}
+	page.WriteString("</ol></nav>\n")
+	for _, c := range b.Cards {
+		c.cardHTML(&page)
+	}
+	page.WriteString("</body>\n</html>\n")
+	if err := writeZipFile(zw, "index.html", []byte(page.String())); err != nil {
+		return err
+	}
+
+	var md strings.Builder
+	md.WriteString("# " + b.Title + "\n\n")
+	for _, p := range bookParagraphs(b.Description) {
+		md.WriteString(p + "\n\n")
+	}
+	for _, c := range b.Cards {
+		w := c.Woman
+		md.WriteString("## " + w.Name + "\n\n")
+		if c.ImageName != "" {
+			md.WriteString(fmt.Sprintf("![%s](%s)\n\n", w.Name, c.ImageName))
+		}
+		var meta []string
+		if era := bookCardEra(&w); era != "" {
+			meta = append(meta, era)
+		}
+		if w.Field != "" {
+			meta = append(meta, w.Field)
+		}
+		if len(meta) > 0 {
+			md.WriteString("*" + strings.Join(meta, " — ") + "*\n\n")
+		}
+		if len(w.Tags) > 0 {
+			md.WriteString("Теги: #" + strings.Join(w.Tags, " #") + "\n\n")
+		}
+		for _, p := range bookParagraphs(w.Info) {
+			md.WriteString(p + "\n\n")
+		}
+	}
+	if err := writeZipFile(zw, "book.md", []byte(md.String())); err != nil {
+		return err
+	}
+	if err := b.writeImages(zw, ""); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// render возвращает файл книги в нужном формате и его имя.
+func (b book) render(format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	var err error
+	name := bookFileName(b.Title)
+	switch format {
+	case bookFormatEPUB:
+		err = b.writeEPUB(&buf)
+		name += ".epub"
+	case bookFormatZip:
+		err = b.writeSiteZip(&buf)
+		name += ".zip"
+	default:
+		return nil, "", fmt.Errorf("неизвестный формат %q", format)
+	}
+	return buf.Bytes(), name, err
+}
+
+func bookFileName(title string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'а' && r <= 'я', r == 'ё', r >= '0' && r <= '9':
+			sb.WriteRune(r)
+		case sb.Len() > 0 && !strings.HasSuffix(sb.String(), "_"):
+			sb.WriteRune('_')
+		}
+	}
+	name := strings.Trim(sb.String(), "_")
+	if name == "" {
+		name = "book"
+	}
+	return shorten(name, 60)
+}
+
+// bookSource — коллекция по ID или фильтры поиска. Возвращает название, описание и фильтры.
+func bookSource(collectionID uint, f SearchFilters) (string, string, SearchFilters, error) {
+	if collectionID == 0 {
+		f.PublishedOnly = true
+		return "", "", f, nil
+	}
+	col, err := womanManager.GetCollection(collectionID)
+	if err != nil || col == nil {
+		return "", "", f, fmt.Errorf("коллекция #%d не найдена", collectionID)
+	}
+	return col.Name, col.Description, collectionToFilters(col), nil
+}
+
+// ------------------------------------------
+// Бот и HTTP
+// ------------------------------------------
+
+// HandleBook: /book <id коллекции | фильтры как в /find> [epub|zip]
+func HandleBook(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermCollections) {
+		return nil
+	}
+	args := c.Args()
+	formats := []string{bookFormatEPUB, bookFormatZip}
+	if n := len(args); n > 0 && (args[n-1] == bookFormatEPUB || args[n-1] == bookFormatZip) {
+		formats = []string{args[n-1]}
+		args = args[:n-1]
+	}
+	if len(args) == 0 {
+		return c.Reply("Используйте: /book <code>&lt;id коллекции&gt;</code> или /book <code>tag:наука century:19</code>, в конце можно указать epub или zip", tele.ModeHTML)
+	}
+	var colID uint
+	f := SearchFilters{}
+	if id, err := strconv.ParseUint(args[0], 10, 64); err == nil && len(args) == 1 {
+		colID = uint(id)
+	} else {
+		var errMsg string
+		if f, errMsg = parseSearchFilters(tokenizeSearchArgs(strings.Join(args, " "))); errMsg != "" {
+			return c.Reply(errMsg, tele.ModeHTML)
+		}
+	}
+	if ok, wait := checkAdminCooldown(c.Sender().ID, "book", time.Minute); !ok {
+		return c.Reply(fmt.Sprintf("Подождите %s перед новой выгрузкой.", formatDuration(wait)), tele.ModeHTML)
+	}
+	title, desc, f, err := bookSource(colID, f)
+	if err != nil {
+		return c.Reply("❌ " + html.EscapeString(err.Error()))
+	}
+	_ = c.Reply("📚 Собираю книгу…")
+	ctx, cancel := context.WithTimeout(context.Background(), bookExportTimeout)
+	defer cancel()
+	b := buildBook(ctx, title, desc, f)
+	if len(b.Cards) == 0 {
+		return c.Reply("По этим условиям карточек нет.")
+	}
+	for _, format := range formats {
+		data, name, err := b.render(format)
+		if err != nil {
+			log.Printf("⚠️ Ошибка сборки книги: %v", err)
+			return c.Reply("Не удалось собрать книгу.")
+		}
+		doc := &tele.Document{File: tele.FromReader(bytes.NewReader(data)), FileName: name}
+		if _, err := c.Bot().Send(c.Sender(), doc); err != nil {
+			return c.Reply("Ошибка отправки файла.")
+		}
+	}
+	logModAction(c.Sender().ID, "book_export", strconv.FormatUint(uint64(colID), 10), fmt.Sprintf("cards %d", len(b.Cards)))
+	return nil
+}
+
+// ExportBook: GET /cms/women/book?collection=ID&format=epub|zip (или фильтры как в /api/women).
+func (s *CMSService) ExportBook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeCMSError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if womanManager == nil || womanManager.DB == nil {
+		writeCMSError(w, http.StatusInternalServerError, "women database is not initialized")
+		return
+	}
+	format := strings.TrimSpace(r.URL.Query().Get("format"))
+	if format == "" {
+		format = bookFormatEPUB
+	}
+	if format != bookFormatEPUB && format != bookFormatZip {
+		writeCMSError(w, http.StatusBadRequest, "format must be epub or zip")
+		return
+	}
+	filters, err := parseWomenSearchFilters(r)
+	if err != nil {
+		writeCMSError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var colID uint
+	if raw := strings.TrimSpace(r.URL.Query().Get("collection")); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			writeCMSError(w, http.StatusBadRequest, "collection must be an integer")
+			return
+		}
+		colID = uint(id)
+	}
+	title, desc, filters, err := bookSource(colID, filters)
+	if err != nil {
+		writeCMSError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	b := buildBook(r.Context(), title, desc, filters)
+	data, name, err := b.render(format)
+	if err != nil {
+		writeCMSError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	contentType := "application/zip"
+	if format == bookFormatEPUB {
+		contentType = "application/epub+zip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBookExport(t *testing.T) {
+	wm := newTestWomanManager(t)
+	saved := womanManager
+	womanManager = wm
+	savedLoader := bookImageLoader
+	bookImageLoader = func(_ context.Context, w *Woman) ([]byte, string) {
+		if w.WebImageURL == "" {
+			return nil, ""
+		}
+		return []byte("png"), ".png"
+	}
+	t.Cleanup(func() {
+		womanManager = saved
+		bookImageLoader = savedLoader
+	})
+
+	longInfo := "Первый абзац <важный>.\n\n" + strings.Repeat("а", 700)
+	cards := []*Woman{
+		{Name: "Мария Кюри", Field: "физика", Year: "1867–1934", Info: longInfo, Tags: []string{"наука"}, WebImageURL: "/uploads/curie.png", IsPublished: true},
+		{Name: "Ада Лавлейс", Field: "математика", Year: "1815–1852", Tags: []string{"наука"}, IsPublished: true},
+		{Name: "Скрытая", Tags: []string{"наука"}},
+		{Name: "Другая", Tags: []string{"искусство"}, IsPublished: true},
+	}
+	for _, w := range cards {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	col := &Collection{Name: "Женщины науки", Description: "Подборка", Tags: []string{"наука"}}
+	if err := wm.CreateCollection(col); err != nil {
+		t.Fatal(err)
+	}
+
+	title, desc, f, err := bookSource(col.ID, SearchFilters{})
+	if err != nil || title != col.Name || desc != "Подборка" {
+		t.Fatalf("source: %q %q %v", title, desc, err)
+	}
+	b := buildBook(context.Background(), title, desc, f)
+	if len(b.Cards) != 2 || b.Cards[0].Woman.Name != "Ада Лавлейс" || b.Cards[1].ImageName == "" {
+		t.Fatalf("book must hold published cards in chronological order: %+v", b.Cards)
+	}
+	if _, _, _, err := bookSource(999, SearchFilters{}); err == nil {
+		t.Fatal("missing collection must fail")
+	}
+
+	data, name, err := b.render(bookFormatEPUB)
+	if err != nil || name != "женщины_науки.epub" {
+		t.Fatalf("epub: %q %v", name, err)
+	}
+	files := readZip(t, data)
+	if files["mimetype"] != "application/epub+zip" {
+		t.Fatal("epub must start with mimetype")
+	}
+	curie := files["OEBPS/card1.xhtml"]
+	if !strings.Contains(curie, strings.Repeat("а", 700)) || !strings.Contains(curie, "&lt;важный&gt;") || !strings.Contains(curie, "1867–1934 · XIX–XX век — физика") {
+		t.Fatalf("card page must hold full escaped bio and era:\n%s", curie)
+	}
+	opf := files["OEBPS/content.opf"]
+	if !strings.Contains(opf, `href="images/1.png" media-type="image/png"`) || files["OEBPS/images/1.png"] != "png" {
+		t.Fatalf("image must be packed and listed:\n%s", opf)
+	}
+	if !strings.Contains(files["OEBPS/nav.xhtml"], "card2.xhtml") {
+		t.Fatal("nav must list cards")
+	}
+
+	data, name, err = b.render(bookFormatZip)
+	if err != nil || !strings.HasSuffix(name, ".zip") {
+		t.Fatalf("zip: %q %v", name, err)
+	}
+	files = readZip(t, data)
+	if !strings.Contains(files["index.html"], `src="images/1.png"`) || !strings.Contains(files["book.md"], "## Мария Кюри\n\n![Мария Кюри](images/1.png)") || files["images/1.png"] != "png" {
+		t.Fatalf("site zip is incomplete: %v", files)
+	}
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]string{}
+	for i, f := range zr.File {
+		if i == 0 && f.Name == "mimetype" && f.Method != zip.Store {
+			t.Fatal("mimetype must be stored")
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		out[f.Name] = string(b)
+	}
+	return out
+}
@@ -0,0 +1,535 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	mrand "math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==========================================
+// КАПЧА
+// ==========================================
+
+// Каждое задание хранится на сервере: в кнопках только одноразовый nonce и номер
+// варианта, порядок вариантов случайный для каждого пользователя. В группе
+// непройденная к сроку проверка заканчивается киком.
+
+const (
+	defaultCaptchaTimeout = 3 * time.Minute
+	captchaMaxAttempts    = 3
+)
+
+type captchaTask struct {
+	Question string
+	PhotoID  string // для заданий с картинкой
+	Options  []string
+	Correct  int
+}
+
+type CaptchaChallenge interface {
+	Kind() string
+	New(rng *mrand.Rand) (captchaTask, error)
+}
+
+// CaptchaQuestion — вопрос о теме чата из конфига.
+type CaptchaQuestion struct {
+	Question string   `json:"question"`
+	Answer   string   `json:"answer"`
+	Wrong    []string `json:"wrong"`
+}
+
+// shuffleTask перемешивает варианты, сохраняя правильный ответ.
+func shuffleTask(rng *mrand.Rand, question, correct string, wrong []string) captchaTask {
+	opts := append([]string{correct}, wrong...)
+	rng.Shuffle(len(opts), func(i, j int) { opts[i], opts[j] = opts[j], opts[i] })
+	t := captchaTask{Question: question, Options: opts}
+	for i, o := range opts {
+		if o == correct {
+			t.Correct = i
+		}
+	}
+	return t
+}
+
+// ------------------------------------------
+// Задания
+// ------------------------------------------
+
+type arithmeticChallenge struct{}
+
+func (arithmeticChallenge) Kind() string { return "arithmetic" }
+
+func (arithmeticChallenge) New(rng *mrand.Rand) (captchaTask, error) {
+	a, b := rng.Intn(9)+1, rng.Intn(9)+1
+	res := a + b
+	seen := map[int]bool{res: true}
+	var wrong []string
+	for len(wrong) < 3 {
+		v := res + rng.Intn(7) - 3
+		if v > 0 && !seen[v] {
+			seen[v] = true
+			wrong = append(wrong, strconv.Itoa(v))
+		}
+	}
+	return shuffleTask(rng, fmt.Sprintf("Решите пример: %d + %d = ?", a, b), strconv.Itoa(res), wrong), nil
+}
+
+type emojiChallenge struct{}
+
+// В вопросе только слово, на кнопках только эмодзи
+var captchaEmoji = []struct{ Emoji, Name string }{
+	{"🍎", "яблоко"}, {"🐱", "кошку"}, {"🚗", "машину"}, {"🌙", "луну"}, {"📚", "книги"},
+	{"🎈", "воздушный шар"}, {"🐟", "рыбу"}, {"☂️", "зонт"}, {"🔑", "ключ"}, {"🌻", "подсолнух"},
+	{"🎻", "скрипку"}, {"🕯", "свечу"},
+}
+
+func (emojiChallenge) Kind() string { return "emoji" }
+
+func (emojiChallenge) New(rng *mrand.Rand) (captchaTask, error) {
+	idx := rng.Perm(len(captchaEmoji))[:5]
+	target := captchaEmoji[idx[0]]
+	var wrong []string
+	for _, i := range idx[1:] {
+		wrong = append(wrong, captchaEmoji[i].Emoji)
+	}
+	return shuffleTask(rng, "Нажмите на "+target.Name, target.Emoji, wrong), nil
+}
+
+// portraitChallenge показывает портрет из архива. Подсказка — область, варианты —
+// только имена (у всех разные области): связать подсказку с именем может человек,
+// а не бот, сравнивающий строки.
+type portraitChallenge struct{}
+
+func (portraitChallenge) Kind() string { return "portrait" }
+
+func (portraitChallenge) New(rng *mrand.Rand) (captchaTask, error) {
+	if womanManager == nil {
+		return captchaTask{}, errors.New("архив недоступен")
+	}
+	var pick *Woman
+	fields := map[string]bool{}
+	var others []Woman
+	for _, w := range womanManager.GetRandomWomen(12) {
+		w := w
+		field := strings.TrimSpace(w.Field)
+		if field == "" || fields[field] {
+			continue
+		}
+		if pick == nil && len(w.MediaIDs) > 0 {
+			pick = &w
+		} else if len(others) < 3 {
+			others = append(others, w)
+		}
+		fields[field] = true
+	}
+	if pick == nil || len(others) < 2 {
+		return captchaTask{}, errors.New("в архиве мало портретов")
+	}
+	label := func(w Woman) string { return shorten(w.Name, 28) }
+	var wrong []string
+	for _, w := range others {
+		wrong = append(wrong, label(w))
+	}
+	t := shuffleTask(rng, fmt.Sprintf("Чей это портрет? Подсказка: %s.", strings.ToLower(pick.Field)), label(*pick), wrong)
+	t.PhotoID = pick.MediaIDs[0]
+	return t, nil
+}
+
+type topicChallenge struct{}
+
+var defaultCaptchaQuestions = []CaptchaQuestion{
+	{Question: "Чему посвящен этот чат?", Answer: "Истории великих женщин", Wrong: []string{"Ставкам на спорт", "Криптовалюте", "Продаже автомобилей"}},
+}
+
+func (topicChallenge) Kind() string { return "topic" }
+
+func (topicChallenge) New(rng *mrand.Rand) (captchaTask, error) {
+	qs := config.CaptchaQuestions
+	if len(qs) == 0 {
+		qs = defaultCaptchaQuestions
+	}
+	q := qs[rng.Intn(len(qs))]
+	if q.Answer == "" || len(q.Wrong) == 0 {
+		return captchaTask{}, errors.New("вопрос без вариантов")
+	}
+	return shuffleTask(rng, q.Question, q.Answer, q.Wrong), nil
+}
+
+var captchaChallenges = []CaptchaChallenge{arithmeticChallenge{}, emojiChallenge{}, portraitChallenge{}, topicChallenge{}}
+
+// newCaptchaTask выбирает случайный включенный тип; при ошибке — арифметика.
+func newCaptchaTask(rng *mrand.Rand) (string, captchaTask) {
+	var enabled []CaptchaChallenge
+	for _, ch := range captchaChallenges {
+		if len(config.CaptchaKinds) == 0 || containsString(config.CaptchaKinds, ch.Kind()) {
+			enabled = append(enabled, ch)
+		}
+	}
+	if len(enabled) > 0 {
+		ch := enabled[rng.Intn(len(enabled))]
+		t, err := ch.New(rng)
+		if err == nil {
+			return ch.Kind(), t
+		}
+		log.Printf("⚠️ Капча %s недоступна: %v", ch.Kind(), err)
+	}
+	t, _ := arithmeticChallenge{}.New(rng)
+	return arithmeticChallenge{}.Kind(), t
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(strings.TrimSpace(s), v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------------------
+// Сессии
+// ------------------------------------------
+
+type captchaSession struct {
+	Nonce    string
+	UserID   int64
+	ChatID   int64 // чат, где пользователь должен пройти проверку (личка — его ID)
+	Group    bool
+	Kind     string
+	Task     captchaTask
+	Deadline time.Time
+	Attempts int
+	Message  *tele.Message
+}
+
+type captchaResult int
+
+const (
+	captchaUnknown captchaResult = iota
+	captchaForeign               // кнопку нажал не тот пользователь
+	captchaPassed
+	captchaRetry
+	captchaFailed // попытки кончились
+)
+
+type captchaStore struct {
+	mu       sync.Mutex
+	sessions map[string]*captchaSession
+	byUser   map[chatUserKey]string
+}
+
+var captchas = newCaptchaStore()
+
+func newCaptchaStore() *captchaStore {
+	return &captchaStore{sessions: make(map[string]*captchaSession), byUser: make(map[chatUserKey]string)}
+}
+
+func newCaptchaNonce() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// put заводит сессию, заменяя прежнюю для этого пользователя в этом чате.
+func (s *captchaStore) put(sess *captchaSession) (replaced *captchaSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := chatUserKey{ChatID: sess.ChatID, UserID: sess.UserID}
+	if old, ok := s.byUser[key]; ok {
+		replaced = s.sessions[old]
+		delete(s.sessions, old)
+	}
+	s.sessions[sess.Nonce] = sess
+	s.byUser[key] = sess.Nonce
+	return replaced
+}
+
+func (s *captchaStore) pending(chatID, userID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.byUser[chatUserKey{ChatID: chatID, UserID: userID}]
+	return ok
+}
+
+func (s *captchaStore) removeLocked(sess *captchaSession) {
+	delete(s.sessions, sess.Nonce)
+	key := chatUserKey{ChatID: sess.ChatID, UserID: sess.UserID}
+	if s.byUser[key] == sess.Nonce {
+		delete(s.byUser, key)
+	}
+}
+
+// answer проверяет ответ. Сессия удаляется при успехе и исчерпании попыток.
+func (s *captchaStore) answer(nonce string, userID int64, option int) (captchaResult, *captchaSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[nonce]
+	if !ok {
+		return captchaUnknown, nil
+	}
+	if sess.UserID != userID {
+		return captchaForeign, sess
+	}
+	if option == sess.Task.Correct {
+		s.removeLocked(sess)
+		return captchaPassed, sess
+	}
+	sess.Attempts++
+	if sess.Attempts >= captchaMaxAttempts {
+		s.removeLocked(sess)
+		return captchaFailed, sess
+	}
+	return captchaRetry, sess
+}
+
+// expired забирает просроченные сессии.
+func (s *captchaStore) expired(now time.Time) []*captchaSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*captchaSession
+	for _, sess := range s.sessions {
+		if now.After(sess.Deadline) {
+			s.removeLocked(sess)
+			out = append(out, sess)
+		}
+	}
+	return out
+}
+
+// ------------------------------------------
+// Статистика
+// ------------------------------------------
+
+type CaptchaStat struct {
+	Kind    string `gorm:"primaryKey;size:32"`
+	Passed  int64
+	Failed  int64
+	Expired int64
+}
+
+func recordCaptchaResult(db *gorm.DB, kind, column string) {
+	if db == nil {
+		return
+	}
+	row := CaptchaStat{Kind: kind}
+	switch column {
+	case "passed":
+		row.Passed = 1
+	case "failed":
+		row.Failed = 1
+	case "expired":
+		row.Expired = 1
+	default:
+		return
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}},
+		DoUpdates: clause.Assignments(map[string]any{column: gorm.Expr("captcha_stats." + column + " + 1")}),
+	}).Create(&row).Error
+	if err != nil {
+		log.Printf("⚠️ Не удалось записать статистику капчи: %v", err)
+	}
+}
+
+// captchaStatsLine — строка для диагностики.
+func captchaStatsLine() string {
+	if womanManager == nil {
+		return "—"
+	}
+	var rows []CaptchaStat
+	womanManager.DB.Order("kind").Find(&rows)
+	if len(rows) == 0 {
+		return "нет данных"
+	}
+	var total CaptchaStat
+	var parts []string
+	for _, r := range rows {
+		total.Passed += r.Passed
+		total.Failed += r.Failed
+		total.Expired += r.Expired
+		parts = append(parts, fmt.Sprintf("%s %d/%d/%d", r.Kind, r.Passed, r.Failed, r.Expired))
+	}
+	return fmt.Sprintf("<b>%d</b> пройдено | <b>%d</b> ошибок | <b>%d</b> по таймауту\n   (%s)", total.Passed, total.Failed, total.Expired, strings.Join(parts, ", "))
+}
+
+// ------------------------------------------
+// Отправка и обработка
+// ------------------------------------------
+
+func captchaTimeout() time.Duration {
+	if config.CaptchaTimeoutSeconds > 0 {
+		return time.Duration(config.CaptchaTimeoutSeconds) * time.Second
+	}
+	return defaultCaptchaTimeout
+}
+
+var captchaRng = mrand.New(mrand.NewSource(time.Now().UnixNano()))
+var captchaRngMu sync.Mutex
+
+func buildCaptchaMenu(sess *captchaSession) *tele.ReplyMarkup {
+	menu := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	var row []tele.Btn
+	perRow := 3
+	if sess.Kind == "portrait" || sess.Kind == "topic" {
+		perRow = 1
+	}
+	for i, opt := range sess.Task.Options {
+		row = append(row, menu.Data(opt, fmt.Sprintf("captcha_%s_%d", sess.Nonce, i)))
+		if len(row) == perRow {
+			rows = append(rows, menu.Row(row...))
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, menu.Row(row...))
+	}
+	menu.Inline(rows...)
+	return menu
+}
+
+// startCaptcha выдает пользователю новое задание в чате (в группе — с упоминанием и сроком).
+func startCaptcha(bot *tele.Bot, chat *tele.Chat, user *tele.User) error {
+	captchaRngMu.Lock()
+	kind, task := newCaptchaTask(captchaRng)
+	captchaRngMu.Unlock()
+
+	group := chat.Type != tele.ChatPrivate
+	sess := &captchaSession{Nonce: newCaptchaNonce(), UserID: user.ID, ChatID: chat.ID, Group: group, Kind: kind, Task: task, Deadline: time.Now().Add(captchaTimeout())}
+	if old := captchas.put(sess); old != nil {
+		sess.Attempts = old.Attempts
+		if old.Group {
+			sess.Deadline = old.Deadline // новое задание не продлевает срок
+		}
+		if old.Message != nil {
+			_ = bot.Delete(old.Message)
+		}
+	}
+
+	text := "🛡 <b>Проверка на человечность.</b>\n" + html.EscapeString(task.Question)
+	if group {
+		text = fmt.Sprintf("👋 %s, подтвердите, что вы не бот (осталось %s).\n%s", mentionUser(user), formatDuration(time.Until(sess.Deadline).Round(time.Second)), html.EscapeString(task.Question))
+	}
+	var what interface{} = text
+	if task.PhotoID != "" {
+		what = &tele.Photo{File: tele.File{FileID: task.PhotoID}, Caption: text}
+	}
+	msg, err := bot.Send(chat, what, buildCaptchaMenu(sess), tele.ModeHTML)
+	if err != nil {
+		return err
+	}
+	captchas.mu.Lock()
+	sess.Message = msg
+	captchas.mu.Unlock()
+	return nil
+}
+
+func sendCaptcha(c tele.Context) error {
+	return startCaptcha(c.Bot(), c.Chat(), c.Sender())
+}
+
+// kickUser удаляет пользователя из группы, не блокируя повторный вход.
+func kickUser(bot *tele.Bot, chatID, userID int64) error {
+	chat, user := &tele.Chat{ID: chatID}, &tele.User{ID: userID}
+	if err := bot.Ban(chat, &tele.ChatMember{User: user}); err != nil {
+		return err
+	}
+	return bot.Unban(chat, user)
+}
+
+func handleCaptchaCallback(c tele.Context, data string) error {
+	parts := strings.Split(strings.TrimPrefix(data, "captcha_"), "_")
+	if len(parts) != 2 {
+		return c.Respond()
+	}
+	option, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return c.Respond()
+	}
+	user := c.Sender()
+	db := (*gorm.DB)(nil)
+	if womanManager != nil {
+		db = womanManager.DB
+	}
+	result, sess := captchas.answer(parts[0], user.ID, option)
+	switch result {
+	case captchaUnknown:
+		c.Respond(&tele.CallbackResponse{Text: "Проверка устарела."})
+		c.Delete()
+		if c.Chat() != nil && c.Chat().Type == tele.ChatPrivate {
+			return sendCaptcha(c)
+		}
+		return nil
+	case captchaForeign:
+		return c.Respond(&tele.CallbackResponse{Text: "Это проверка для другого участника."})
+	case captchaPassed:
+		recordCaptchaResult(db, sess.Kind, "passed")
+		womanManager.SetUserVerified(user.ID)
+		c.Delete()
+		c.Respond(&tele.CallbackResponse{Text: "Доступ разрешен."})
+		if !sess.Group {
+			return HandleStart(c) // Запускаем нормальный старт
+		}
+		return nil
+	case captchaRetry:
+		recordCaptchaResult(db, sess.Kind, "failed")
+		c.Respond(&tele.CallbackResponse{Text: fmt.Sprintf("Ошибка. Осталось попыток: %d.", captchaMaxAttempts-sess.Attempts)})
+		return startCaptcha(c.Bot(), c.Chat(), user)
+	case captchaFailed:
+		recordCaptchaResult(db, sess.Kind, "failed")
+		c.Delete()
+		if !sess.Group {
+			// В личке кикать некуда — просто начинаем заново
+			c.Respond(&tele.CallbackResponse{Text: "Попытки закончились. Вот новое задание."})
+			return sendCaptcha(c)
+		}
+		c.Respond(&tele.CallbackResponse{Text: "Проверка не пройдена."})
+		if err := kickUser(c.Bot(), sess.ChatID, user.ID); err != nil {
+			log.Printf("⚠️ Не удалось исключить %d: %v", user.ID, err)
+		}
+		logModAction(0, "captcha_kick", strconv.FormatInt(user.ID, 10), fmt.Sprintf("chat=%d kind=%s reason=attempts", sess.ChatID, sess.Kind))
+	}
+	return nil
+}
+
+// ExpireCaptchas исключает из групп тех, кто не успел пройти проверку.
+func ExpireCaptchas(bot *tele.Bot, now time.Time) {
+	for _, sess := range captchas.expired(now) {
+		if womanManager != nil {
+			recordCaptchaResult(womanManager.DB, sess.Kind, "expired")
+		}
+		if sess.Message != nil {
+			_ = bot.Delete(sess.Message)
+		}
+		if !sess.Group {
+			continue
+		}
+		if err := kickUser(bot, sess.ChatID, sess.UserID); err != nil {
+			log.Printf("⚠️ Не удалось исключить %d по таймауту капчи: %v", sess.UserID, err)
+			continue
+		}
+		logModAction(0, "captcha_kick", strconv.FormatInt(sess.UserID, 10), fmt.Sprintf("chat=%d kind=%s reason=timeout", sess.ChatID, sess.Kind))
+	}
+}
+
+func StartCaptchaLoop(bot *tele.Bot) {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		ExpireCaptchas(bot, time.Now())
+	}
+}
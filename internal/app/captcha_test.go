@@ -0,0 +1,130 @@
+package app
+
+import (
+	mrand "math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptchaChallengesShuffleOptions(t *testing.T) {
+	for _, ch := range []CaptchaChallenge{arithmeticChallenge{}, emojiChallenge{}, topicChallenge{}} {
+		positions := map[int]bool{}
+		for seed := int64(0); seed < 40; seed++ {
+			task, err := ch.New(mrand.New(mrand.NewSource(seed)))
+			if err != nil {
+				t.Fatalf("%s: %v", ch.Kind(), err)
+			}
+			if task.Correct < 0 || task.Correct >= len(task.Options) || len(task.Options) < 3 {
+				t.Fatalf("%s: bad task %+v", ch.Kind(), task)
+			}
+			seen := map[string]bool{}
+			for _, o := range task.Options {
+				if seen[o] {
+					t.Fatalf("%s: duplicate option in %+v", ch.Kind(), task)
+				}
+				seen[o] = true
+			}
+			positions[task.Correct] = true
+		}
+		if len(positions) < 2 {
+			t.Fatalf("%s: correct answer is always at the same position", ch.Kind())
+		}
+	}
+
+	task, _ := arithmeticChallenge{}.New(mrand.New(mrand.NewSource(7)))
+	var a, b int
+	fields := strings.Fields(strings.TrimPrefix(task.Question, "Решите пример: "))
+	a, _ = strconv.Atoi(fields[0])
+	b, _ = strconv.Atoi(fields[2])
+	if task.Options[task.Correct] != strconv.Itoa(a+b) {
+		t.Fatalf("arithmetic answer mismatch: %+v", task)
+	}
+}
+
+func TestCaptchaStoreFlow(t *testing.T) {
+	s := newCaptchaStore()
+	now := time.Now()
+	sess := &captchaSession{Nonce: "n1", UserID: 1, ChatID: -100, Group: true, Task: captchaTask{Options: []string{"a", "b", "c"}, Correct: 2}, Deadline: now.Add(time.Minute)}
+	s.put(sess)
+
+	if res, _ := s.answer("n1", 2, 2); res != captchaForeign {
+		t.Fatalf("foreign press: got %v", res)
+	}
+	if res, _ := s.answer("n1", 1, 0); res != captchaRetry {
+		t.Fatalf("first wrong answer: got %v", res)
+	}
+	if res, _ := s.answer("n1", 1, 2); res != captchaPassed {
+		t.Fatalf("correct answer: got %v", res)
+	}
+	if res, _ := s.answer("n1", 1, 2); res != captchaUnknown || s.pending(-100, 1) {
+		t.Fatal("passed session must be removed")
+	}
+
+	s.put(&captchaSession{Nonce: "n2", UserID: 1, ChatID: -100, Task: captchaTask{Options: []string{"a", "b"}, Correct: 1}, Deadline: now.Add(time.Minute)})
+	var res captchaResult
+	for i := 0; i < captchaMaxAttempts; i++ {
+		res, _ = s.answer("n2", 1, 0)
+	}
+	if res != captchaFailed || s.pending(-100, 1) {
+		t.Fatalf("attempts exhausted: got %v", res)
+	}
+
+	s.put(&captchaSession{Nonce: "n3", UserID: 1, ChatID: -100, Deadline: now.Add(time.Minute)})
+	if old := s.put(&captchaSession{Nonce: "n4", UserID: 1, ChatID: -100, Deadline: now.Add(-time.Second)}); old == nil || old.Nonce != "n3" {
+		t.Fatal("new challenge must replace the previous one")
+	}
+	expired := s.expired(now)
+	if len(expired) != 1 || expired[0].Nonce != "n4" || len(s.sessions) != 0 {
+		t.Fatalf("expired: %+v", expired)
+	}
+}
+
+func TestRecordCaptchaResult(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&CaptchaStat{}); err != nil {
+		t.Fatal(err)
+	}
+	recordCaptchaResult(db, "emoji", "passed")
+	recordCaptchaResult(db, "emoji", "passed")
+	recordCaptchaResult(db, "emoji", "failed")
+	recordCaptchaResult(db, "emoji", "expired")
+
+	var row CaptchaStat
+	db.First(&row, "kind = ?", "emoji")
+	if row.Passed != 2 || row.Failed != 1 || row.Expired != 1 {
+		t.Fatalf("unexpected stats: %+v", row)
+	}
+}
+
+func TestPortraitChallengeHidesHint(t *testing.T) {
+	wm := newTestWomanManager(t)
+	saved := womanManager
+	womanManager = wm
+	t.Cleanup(func() { womanManager = saved })
+	for _, w := range []*Woman{
+		{Name: "Мария Кюри", Field: "Физика", MediaIDs: []string{"photo1"}, IsPublished: true},
+		{Name: "Ада Лавлейс", Field: "Математика", IsPublished: true},
+		{Name: "Анна Ахматова", Field: "Поэзия", IsPublished: true},
+	} {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	task, err := portraitChallenge{}.New(mrand.New(mrand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hint := strings.TrimSuffix(task.Question[strings.Index(task.Question, "Подсказка: ")+len("Подсказка: "):], ".")
+	if hint != "физика" || task.Options[task.Correct] != "Мария Кюри" || task.PhotoID != "photo1" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+	for _, o := range task.Options {
+		for _, field := range []string{"физика", "математика", "поэзия"} {
+			if strings.Contains(strings.ToLower(o), field) {
+				t.Fatalf("option %q gives away the field", o)
+			}
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// ==========================================
+// МАССОВЫЙ ИМПОРТ КАРТОЧЕК (CSV / JSON)
+// ==========================================
+
+// CSV — те же колонки, что пишет exportCSV (id, name, field, year, tags через ";",
+// info, published), плюс необязательные media_ids (через ";") и web_image_url.
+// JSON — массив объектов с теми же полями; media_ids и tags — массивы.
+// Запись сопоставляется с карточкой по ID, а без ID — по нормализованному имени.
+// Пустые поля файла карточку не меняют. Сначала строится план (dry-run),
+// применяется он только после подтверждения.
+
+const (
+	cbCardImport         = "card_import"
+	maxCardImportSize    = 10 << 20
+	importReportMaxLines = 40
+)
+
+type importRecord struct {
+	Row         int      `json:"-"`
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Field       string   `json:"field"`
+	Year        string   `json:"year"`
+	Info        string   `json:"info"`
+	Tags        []string `json:"tags"`
+	MediaIDs    []string `json:"media_ids"`
+	WebImageURL string   `json:"web_image_url"`
+	Published   *bool    `json:"published"`
+}
+
+type importAction int
+
+const (
+	importCreate importAction = iota
+	importUpdate
+	importUnchanged
+	importConflict
+)
+
+type importItem struct {
+	Row     int
+	Action  importAction
+	Woman   *Woman
+	Changes []fieldDiff
+	Reason  string
+}
+
+type importPlan struct {
+	Items                                  []importItem
+	Creates, Updates, Unchanged, Conflicts int
+}
+
+// ------------------------------------------
+// Разбор файла
+// ------------------------------------------
+
+func parseImportFile(name string, data []byte) ([]importRecord, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return parseImportJSON(data)
+	case ".csv":
+		return parseImportCSV(data)
+	}
+	if t := bytes.TrimSpace(data); len(t) > 0 && (t[0] == '[' || t[0] == '{') {
+		return parseImportJSON(data)
+	}
+	return parseImportCSV(data)
+}
+
+func parseImportJSON(data []byte) ([]importRecord, error) {
+	var recs []importRecord
+	if err := json.Unmarshal(data, &recs); err != nil {
+		// Допускаем и {"women": [...]}
+		var wrapped struct {
+			Women []importRecord `json:"women"`
+		}
+		if err2 := json.Unmarshal(data, &wrapped); err2 != nil || wrapped.Women == nil {
+			return nil, fmt.Errorf("JSON: %w", err)
+		}
+		recs = wrapped.Women
+	}
+	for i := range recs {
+		recs[i].Row = i + 1
+	}
+	return recs, nil
+}
+
+func parseImportCSV(data []byte) ([]importRecord, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV: %w", err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := cols["name"]; !ok {
+		if _, ok := cols["id"]; !ok {
+			return nil, errors.New("CSV: нужна колонка name или id")
+		}
+	}
+	var recs []importRecord
+	for row := 2; ; row++ {
+		line, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV, строка %d: %w", row, err)
+		}
+		if strings.TrimSpace(strings.Join(line, "")) == "" {
+			continue
+		}
+		get := func(col string) string {
+			if i, ok := cols[col]; ok && i < len(line) {
+				return strings.TrimSpace(line[i])
+			}
+			return ""
+		}
+		rec := importRecord{Row: row, Name: get("name"), Field: get("field"), Year: get("year"), Info: get("info"),
+			Tags: splitImportList(get("tags")), MediaIDs: splitImportList(get("media_ids")), WebImageURL: get("web_image_url")}
+		if s := get("id"); s != "" {
+			id, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("CSV, строка %d: неверный id %q", row, s)
+			}
+			rec.ID = uint(id)
+		}
+		if s := get("published"); s != "" {
+			v := parseImportBool(s)
+			rec.Published = &v
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func splitImportList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ";") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func parseImportBool(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "1", "yes", "да", "+":
+		return true
+	}
+	return false
+}
+
+// ------------------------------------------
+// План
+// ------------------------------------------
+
+// apply переносит непустые поля записи в карточку.
+func (r importRecord) apply(w *Woman) {
+	// Имя, совпавшее после нормализации, не переписывается (регистр, пробелы)
+	if r.Name != "" && normalizeNameForDup(r.Name) != normalizeNameForDup(w.Name) {
+		w.Name = r.Name
+	}
+	if r.Field != "" {
+		w.Field = r.Field
+	}
+	if r.Year != "" {
+		w.Year = r.Year
+	}
+	// exportCSV обрезает биографию до 500 символов: обрезанный текст не затирает полный
+	if r.Info != "" && !(strings.HasSuffix(r.Info, "...") && strings.HasPrefix(w.Info, strings.TrimSuffix(r.Info, "..."))) {
+		w.Info = r.Info
+	}
+	if len(r.Tags) > 0 {
+		w.Tags = append([]string(nil), r.Tags...)
+	}
+	if len(r.MediaIDs) > 0 {
+		w.MediaIDs = append([]string(nil), r.MediaIDs...)
+	}
+	if r.WebImageURL != "" {
+		w.WebImageURL = r.WebImageURL
+	}
+	if r.Published != nil {
+		w.IsPublished = *r.Published
+	}
+}
+
+func (wm *WomanManager) planImport(recs []importRecord) importPlan {
+	var all []Woman
+	wm.DB.Find(&all)
+	byID := make(map[uint]*Woman, len(all))
+	byName := map[string][]*Woman{}
+	for i := range all {
+		w := &all[i]
+		byID[w.ID] = w
+		key := normalizeNameForDup(w.Name)
+		byName[key] = append(byName[key], w)
+	}
+
+	var plan importPlan
+	seen := map[string]int{}
+	for _, rec := range recs {
+		item := importItem{Row: rec.Row}
+		nameKey := normalizeNameForDup(rec.Name)
+		var target *Woman
+		switch {
+		case rec.ID != 0:
+			target = byID[rec.ID]
+			if target == nil {
+				item.Reason = fmt.Sprintf("карточки #%d нет", rec.ID)
+			} else if others := byName[nameKey]; nameKey != "" && nameKey != normalizeNameForDup(target.Name) && len(others) > 0 {
+				item.Reason = fmt.Sprintf("имя «%s» уже занято карточкой #%d", rec.Name, others[0].ID)
+			}
+		case nameKey == "":
+			item.Reason = "нет ни id, ни имени"
+		default:
+			switch matches := byName[nameKey]; len(matches) {
+			case 0:
+			case 1:
+				target = matches[0]
+			default:
+				item.Reason = fmt.Sprintf("имя «%s» совпадает у %d карточек, укажите id", rec.Name, len(matches))
+			}
+		}
+		key := "name:" + nameKey
+		if target != nil {
+			key = fmt.Sprintf("id:%d", target.ID)
+		}
+		if prev, ok := seen[key]; ok && item.Reason == "" {
+			item.Reason = fmt.Sprintf("та же карточка уже в №%d", prev)
+		}
+		seen[key] = rec.Row
+
+		switch {
+		case item.Reason != "":
+			item.Action = importConflict
+			plan.Conflicts++
+		case target == nil:
+			w := &Woman{}
+			rec.apply(w)
+			normalizeWoman(w)
+			item.Action, item.Woman = importCreate, w
+			plan.Creates++
+		default:
+			w := *target
+			rec.apply(&w)
+			normalizeWoman(&w)
+			item.Woman = &w
+			if item.Changes = diffSnapshots(snapshotWoman(target), snapshotWoman(&w)); len(item.Changes) == 0 {
+				item.Action = importUnchanged
+				plan.Unchanged++
+			} else {
+				item.Action = importUpdate
+				plan.Updates++
+			}
+		}
+		plan.Items = append(plan.Items, item)
+	}
+	return plan
+}
+
+// Report — текст dry-run отчета (без разметки).
+func (p importPlan) Report() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("➕ Новых: %d, ✏️ Изменений: %d, ⏸ Без изменений: %d, ⚠️ Конфликтов: %d\n", p.Creates, p.Updates, p.Unchanged, p.Conflicts))
+	lines := 0
+	for _, it := range p.Items {
+		if it.Action == importUnchanged {
+			continue
+		}
+		if lines == importReportMaxLines {
+			sb.WriteString("…\n")
+			break
+		}
+		lines++
+		switch it.Action {
+		case importCreate:
+			sb.WriteString(fmt.Sprintf("➕ №%d: %s\n", it.Row, it.Woman.Name))
+		case importUpdate:
+			var fields []string
+			for _, d := range it.Changes {
+				fields = append(fields, d.Field.Title)
+			}
+			sb.WriteString(fmt.Sprintf("✏️ №%d: #%d %s — %s\n", it.Row, it.Woman.ID, it.Woman.Name, strings.Join(fields, ", ")))
+		case importConflict:
+			sb.WriteString(fmt.Sprintf("⚠️ №%d: %s\n", it.Row, it.Reason))
+		}
+	}
+	return sb.String()
+}
+
+// applyImport сохраняет новые и измененные карточки плана; конфликты пропускаются.
+func (wm *WomanManager) applyImport(p importPlan, actorID int64) (created, updated int, err error) {
+	for _, it := range p.Items {
+		if it.Action != importCreate && it.Action != importUpdate {
+			continue
+		}
+		if err := wm.UpdateWomanBy(it.Woman, actorID, "import"); err != nil {
+			return created, updated, fmt.Errorf("№%d: %w", it.Row, err)
+		}
+		if it.Action == importCreate {
+			created++
+			wm.LogChange(actorID, it.Woman.ID, "import", "", "create")
+		} else {
+			updated++
+			wm.LogChange(actorID, it.Woman.ID, "import", "", "update")
+		}
+	}
+	return created, updated, nil
+}
+
+func (wm *WomanManager) planImportFile(path string) (importPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return importPlan{}, err
+	}
+	recs, err := parseImportFile(path, data)
+	if err != nil {
+		return importPlan{}, err
+	}
+	if len(recs) == 0 {
+		return importPlan{}, errors.New("в файле нет записей")
+	}
+	return wm.planImport(recs), nil
+}
+
+// runImportCommand: import <файл.csv|файл.json> [--apply]. Без --apply только печатает план.
+func runImportCommand(args []string) error {
+	var path string
+	apply := false
+	for _, a := range args {
+		if a == "--apply" {
+			apply = true
+		} else if path == "" {
+			path = a
+		}
+	}
+	if path == "" {
+		return errors.New("usage: import <file.csv|file.json> [--apply]")
+	}
+	womanManager = NewWomanManager(resolveDBDSN(config))
+	defer womanManager.CloseDB()
+	plan, err := womanManager.planImportFile(path)
+	if err != nil {
+		return err
+	}
+	fmt.Print(plan.Report())
+	if !apply {
+		fmt.Println("Dry-run: ничего не сохранено. Для применения добавьте --apply.")
+		return nil
+	}
+	created, updated, err := womanManager.applyImport(plan, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Импорт выполнен: создано %d, обновлено %d\n", created, updated)
+	return nil
+}
+
+// ------------------------------------------
+// Бот
+// ------------------------------------------
+
+func HandleCardImport(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermImportDB) || c.Chat().Type != tele.ChatPrivate {
+		return nil
+	}
+	setAdminState(c.Sender().ID, STATE_WAITING_CARD_IMPORT)
+	return c.Send("Пришлите файл .csv (колонки как в /export) или .json с карточками.\nСначала покажу, что изменится.", buildCancelEditMenu(), tele.ModeHTML)
+}
+
+// handleCardImportDocument строит dry-run план по присланному файлу и просит подтверждение.
+func handleCardImportDocument(c tele.Context) error {
+	userID := c.Sender().ID
+	doc := c.Message().Document
+	ext := strings.ToLower(filepath.Ext(doc.FileName))
+	if ext != ".csv" && ext != ".json" {
+		return c.Send("Нужен файл .csv или .json.")
+	}
+	if doc.FileSize > maxCardImportSize {
+		return c.Send("Файл слишком большой.")
+	}
+	tempName := filepath.Join(dirTmp, fmt.Sprintf("cards_import_%d%s", userID, ext))
+	if err := c.Bot().Download(&doc.File, tempName); err != nil {
+		log.Printf("⚠️ Ошибка загрузки файла импорта: %v", err)
+		return c.Send("Не удалось загрузить файл.")
+	}
+	plan, err := womanManager.planImportFile(tempName)
+	if err != nil {
+		_ = os.Remove(tempName)
+		return c.Send("❌ Не удалось разобрать файл: " + html.EscapeString(err.Error()))
+	}
+	report := "📥 <b>Импорт карточек — проверка</b>\n" + html.EscapeString(plan.Report())
+	if plan.Creates+plan.Updates == 0 {
+		_ = os.Remove(tempName)
+		setAdminState(userID, STATE_IDLE)
+		return c.Send(report+"\nПрименять нечего.", tele.ModeHTML)
+	}
+	setPendingAction(userID, pendingAction{Action: cbCardImport, FilePath: tempName})
+	setAdminState(userID, STATE_WAITING_CONFIRM)
+	return c.Send(report+"\nПрименить? Конфликтные записи будут пропущены.", buildConfirmMenu(), tele.ModeHTML)
+}
+
+// confirmCardImport заново строит план (база могла измениться) и применяет его.
+func confirmCardImport(c tele.Context, act pendingAction) error {
+	userID := c.Sender().ID
+	if act.FilePath == "" {
+		return c.Send("Не найден файл для импорта.")
+	}
+	defer os.Remove(act.FilePath)
+	plan, err := womanManager.planImportFile(act.FilePath)
+	if err != nil {
+		return c.Send("❌ Не удалось разобрать файл: " + html.EscapeString(err.Error()))
+	}
+	created, updated, err := womanManager.applyImport(plan, userID)
+	logModAction(userID, cbCardImport, "", fmt.Sprintf("created %d updated %d conflicts %d", created, updated, plan.Conflicts))
+	if err != nil {
+		return c.Send(fmt.Sprintf("❌ Импорт прерван (создано %d, обновлено %d): %s", created, updated, html.EscapeString(err.Error())), tele.ModeHTML)
+	}
+	return c.Send(fmt.Sprintf("✅ Импорт выполнен: создано %d, обновлено %d, пропущено конфликтов %d.", created, updated, plan.Conflicts), buildStaffPanelMenuForContext(c), tele.ModeHTML)
+}
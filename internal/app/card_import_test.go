@@ -0,0 +1,96 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseImportFile(t *testing.T) {
+	csvData := "\xef\xbb\xbfid,name,field,year,tags,info,published,media_ids\n" +
+		"7,Ада Лавлейс,математика,1815–1852,математика;программирование,Первая программа,true,a;b\n" +
+		",,,,,,,\n" +
+		",Мария Кюри,физика,,,,,\n"
+	recs, err := parseImportFile("cards.csv", []byte(csvData))
+	if err != nil || len(recs) != 2 {
+		t.Fatalf("csv: %+v %v", recs, err)
+	}
+	if r := recs[0]; r.ID != 7 || r.Row != 2 || len(r.Tags) != 2 || len(r.MediaIDs) != 2 || r.Published == nil || !*r.Published {
+		t.Fatalf("unexpected csv record: %+v", r)
+	}
+	if r := recs[1]; r.Row != 4 || r.Published != nil || r.Name != "Мария Кюри" {
+		t.Fatalf("unexpected csv record: %+v", r)
+	}
+
+	jsonData := `{"women": [{"name": "Ада", "media_ids": ["x"], "web_image_url": "https://example.org/a.jpg", "published": false}]}`
+	recs, err = parseImportFile("upload", []byte(jsonData))
+	if err != nil || len(recs) != 1 || recs[0].WebImageURL == "" || recs[0].Published == nil || *recs[0].Published {
+		t.Fatalf("json: %+v %v", recs, err)
+	}
+	if _, err := parseImportFile("cards.csv", []byte("title\nx\n")); err == nil {
+		t.Fatal("csv without name or id must fail")
+	}
+}
+
+func TestPlanAndApplyImport(t *testing.T) {
+	wm := newTestWomanManager(t)
+	longInfo := strings.Repeat("б", 600)
+	ada := &Woman{Name: "Ада Лавлейс", Field: "математика", Info: longInfo, IsPublished: true}
+	twinA := &Woman{Name: "Елена", Field: "физика"}
+	twinB := &Woman{Name: "елена", Field: "химия"}
+	for _, w := range []*Woman{ada, twinA, twinB} {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	published := false
+	recs := []importRecord{
+		{Row: 1, Name: "  ада   лавлейс ", Field: "информатика"},
+		{Row: 2, ID: ada.ID, Info: shorten(longInfo, 500)},
+		{Row: 3, Name: "Софья Ковалевская", Year: "1850–1891", Published: &published},
+		{Row: 4, Name: "Елена"},
+		{Row: 5, ID: 999},
+		{Row: 6, ID: twinA.ID, Name: "Ада Лавлейс"},
+		{Row: 7},
+		{Row: 8, ID: twinB.ID, Field: "химия"},
+	}
+	plan := wm.planImport(recs)
+	if plan.Creates != 1 || plan.Updates != 1 || plan.Unchanged != 1 || plan.Conflicts != 5 {
+		t.Fatalf("unexpected plan: %+v\n%s", plan, plan.Report())
+	}
+	want := []importAction{importUpdate, importConflict, importCreate, importConflict, importConflict, importConflict, importConflict, importUnchanged}
+	for i, it := range plan.Items {
+		if it.Action != want[i] {
+			t.Errorf("row %d: action %d, want %d (%s)", it.Row, it.Action, want[i], it.Reason)
+		}
+	}
+	if d := plan.Items[0].Changes; len(d) != 1 || d[0].Field.Key != "field" {
+		t.Fatalf("update must touch only the field: %+v", d)
+	}
+	if !strings.Contains(plan.Report(), "№2: та же карточка уже в №1") {
+		t.Fatalf("report must explain conflicts:\n%s", plan.Report())
+	}
+
+	created, updated, err := wm.applyImport(plan, 5)
+	if err != nil || created != 1 || updated != 1 {
+		t.Fatalf("apply: %d %d %v", created, updated, err)
+	}
+	got, _ := wm.GetWomanByID(ada.ID)
+	if got.Field != "информатика" || got.Info != longInfo {
+		t.Fatalf("update not applied: %+v", got)
+	}
+	var sofia Woman
+	wm.DB.Where("name = ?", "Софья Ковалевская").First(&sofia)
+	if sofia.ID == 0 || sofia.IsPublished || sofia.YearFrom != 1850 {
+		t.Fatalf("create not applied: %+v", sofia)
+	}
+	if last, _ := latestRevision(wm.DB, sofia.ID); last.Action != "import" || last.UserID != 5 {
+		t.Fatalf("import must be a revision: %+v", last)
+	}
+
+	// Повторный импорт ничего не меняет, обрезанная экспортом биография не затирает полную
+	for _, part := range [][]importRecord{recs[:1], recs[1:3]} {
+		if again := wm.planImport(part); again.Creates != 0 || again.Updates != 0 || again.Conflicts != 0 {
+			t.Fatalf("re-import must be a no-op: %s", again.Report())
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm/clause"
+)
+
+// ==========================================
+// ПРОФИЛИ МОДЕРАЦИИ ЧАТОВ
+// ==========================================
+
+// ChatModerationProfile — настройки модерации одного чата из KnownChat.
+// Для чатов без записи действует defaultChatProfile: проверки текста, подписей
+// и правок в целевом чате и только проверка ников в остальных. Пересылки, inline-боты,
+// контакты, скрытые ссылки и кнопки админы включают сами в /chats.
+type ChatModerationProfile struct {
+	ChatID         int64 `gorm:"primaryKey;autoIncrement:false"`
+	Enabled        bool
+	CheckLinks     bool
+	CheckPhones    bool
+	CheckCards     bool
+	CheckBadWords  bool
+	CheckNicknames bool
+
+	// Проверки помимо текста (message_moderation.go)
+	CheckCaptions    bool // подписи к фото, видео и документам
+	CheckEntityLinks bool // ссылки, спрятанные под текстом (text_link)
+	CheckButtons     bool // URL-кнопки под сообщением
+	CheckForwards    bool // пересылки из каналов
+	CheckViaBots     bool // сообщения через inline-ботов
+	CheckContacts    bool // контакты и геопозиции
+	CheckEdits       bool // правки проверяются как новые сообщения
+
+	AllowedDomains []string `gorm:"serializer:json"` // ссылки на эти домены (и поддомены) не считаются нарушением
+	ExtraWords     []string `gorm:"serializer:json"` // запрещенные слова в дополнение к words.json
+	Whitelist      []int64  `gorm:"serializer:json"` // полностью освобождены от проверок в этом чате
+	// Доверенным участникам разрешены ссылки
+	TrustVerified bool // верифицированные (/verify)
+	TrustMinDays  int  // бот видит участника в чате не меньше N дней (0 — выкл)
+	UpdatedAt     time.Time
+}
+
+// ChatMemberSeen — когда бот впервые увидел участника в чате (для TrustMinDays).
+type ChatMemberSeen struct {
+	ChatID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	UserID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	FirstSeen time.Time
+}
+
+type chatUserKey struct {
+	ChatID int64
+	UserID int64
+}
+
+var (
+	chatProfilesMu sync.RWMutex
+	chatProfiles   = make(map[int64]ChatModerationProfile)
+
+	memberSeenMu sync.Mutex
+	memberSeen   = make(map[chatUserKey]time.Time)
+
+	// Домен в ссылке: схема и www необязательны, путь отбрасывается
+	linkHostRegex = regexp.MustCompile(`(?i)(?:https?://)?(?:www\.)?((?:[a-z0-9-]+\.)+[a-z]{2,})(?:[/?#]\S*)?`)
+)
+
+func defaultChatProfile(chatID int64) ChatModerationProfile {
+	if chatID == config.TargetChatID {
+		return ChatModerationProfile{ChatID: chatID, Enabled: true, CheckLinks: true, CheckPhones: true, CheckCards: true, CheckBadWords: true, CheckNicknames: true,
+			CheckCaptions: true, CheckEdits: true}
+	}
+	return ChatModerationProfile{ChatID: chatID, Enabled: true, CheckNicknames: true}
+}
+
+// getChatProfile возвращает профиль чата (из кэша, БД или по умолчанию).
+func getChatProfile(chatID int64) ChatModerationProfile {
+	chatProfilesMu.RLock()
+	p, ok := chatProfiles[chatID]
+	chatProfilesMu.RUnlock()
+	if ok {
+		return p
+	}
+	p = defaultChatProfile(chatID)
+	if womanManager != nil {
+		var row ChatModerationProfile
+		if err := womanManager.DB.Where("chat_id = ?", chatID).Limit(1).Find(&row).Error; err == nil && row.ChatID != 0 {
+			p = row
+		}
+	}
+	chatProfilesMu.Lock()
+	chatProfiles[chatID] = p
+	chatProfilesMu.Unlock()
+	return p
+}
+
+func saveChatProfile(p ChatModerationProfile) error {
+	if err := womanManager.DB.Save(&p).Error; err != nil {
+		return err
+	}
+	chatProfilesMu.Lock()
+	chatProfiles[p.ChatID] = p
+	chatProfilesMu.Unlock()
+	return nil
+}
+
+func resetChatProfileCache() {
+	chatProfilesMu.Lock()
+	chatProfiles = make(map[int64]ChatModerationProfile)
+	chatProfilesMu.Unlock()
+	memberSeenMu.Lock()
+	memberSeen = make(map[chatUserKey]time.Time)
+	memberSeenMu.Unlock()
+}
+
+// ------------------------------------------
+// Проверки
+// ------------------------------------------
+
+func (p ChatModerationProfile) whitelisted(userID int64) bool {
+	for _, id := range p.Whitelist {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// trusted — участнику разрешены ссылки (верифицирован или давно в чате).
+func (p ChatModerationProfile) trusted(userID int64) bool {
+	if p.TrustVerified && womanManager != nil && womanManager.IsUserVerified(userID) {
+		return true
+	}
+	if p.TrustMinDays > 0 {
+		since := memberSince(p.ChatID, userID, time.Now())
+		return time.Since(since) >= time.Duration(p.TrustMinDays)*24*time.Hour
+	}
+	return false
+}
+
+// domainAllowed — host совпадает с разрешенным доменом или является его поддоменом.
+func (p ChatModerationProfile) domainAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimPrefix(host, "www."))
+	for _, d := range p.AllowedDomains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripAllowedLinks вырезает из текста ссылки на разрешенные домены.
+func (p ChatModerationProfile) stripAllowedLinks(text string) string {
+	if len(p.AllowedDomains) == 0 {
+		return text
+	}
+	return linkHostRegex.ReplaceAllStringFunc(text, func(m string) string {
+		if sub := linkHostRegex.FindStringSubmatch(m); len(sub) > 1 && p.domainAllowed(sub[1]) {
+			return " "
+		}
+		return m
+	})
+}
+
+// checkText — проверка сообщения по правилам чата.
+func (p ChatModerationProfile) checkText(text string, userID int64) (bool, ViolationType, string) {
+	v := p.evaluateText(text, userID)
+	return v.Spam, v.Type, v.Reason
+}
+
+// evaluateText проверяет сообщение с учетом теневых правил: они не останавливают
+// проверку, а попадают в v.Shadow.
+func (p ChatModerationProfile) evaluateText(text string, userID int64) textVerdict {
+	var v textVerdict
+	if !p.Enabled || text == "" || p.whitelisted(userID) {
+		return v
+	}
+	policy := currentModerationPolicy()
+	if p.CheckLinks {
+		if linkRegex.MatchString(p.stripAllowedLinks(text)) && !p.trusted(userID) && v.decide(policy, ViolationLink, "🔗 Ссылка или @") {
+			return v
+		}
+	}
+	if p.CheckPhones && isPhoneSpam(text) && v.decide(policy, ViolationPhone, "📞 Номер телефона") {
+		return v
+	}
+	if p.CheckCards && isCardSpam(text) && v.decide(policy, ViolationCard, "💳 Номер карты") {
+		return v
+	}
+	if p.CheckBadWords {
+		_, hit, shadow := badWordHits(text, p.ExtraWords...)
+		v.addShadowWords(shadow, "📝 Запрещенное слово")
+		if hit {
+			v.decide(policy, ViolationBadWord, "📝 Запрещенное слово")
+		}
+	}
+	return v
+}
+
+func (p ChatModerationProfile) checkNickname(user *tele.User) (bool, string) {
+	v := p.evaluateNickname(user)
+	return v.Spam, v.Reason
+}
+
+func (p ChatModerationProfile) evaluateNickname(user *tele.User) textVerdict {
+	if !p.Enabled || !p.CheckNicknames || p.whitelisted(user.ID) {
+		return textVerdict{}
+	}
+	return evaluateNickname(user, p.ExtraWords...)
+}
+
+// memberSince возвращает время первого появления участника в чате, запоминая его при первом вызове.
+func memberSince(chatID, userID int64, now time.Time) time.Time {
+	key := chatUserKey{ChatID: chatID, UserID: userID}
+	memberSeenMu.Lock()
+	t, ok := memberSeen[key]
+	memberSeenMu.Unlock()
+	if ok {
+		return t
+	}
+	t = now
+	if womanManager != nil {
+		row := ChatMemberSeen{ChatID: chatID, UserID: userID, FirstSeen: now}
+		womanManager.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+		var stored ChatMemberSeen
+		if err := womanManager.DB.Where("chat_id = ? AND user_id = ?", chatID, userID).Limit(1).Find(&stored).Error; err == nil && !stored.FirstSeen.IsZero() {
+			t = stored.FirstSeen
+		}
+	}
+	memberSeenMu.Lock()
+	memberSeen[key] = t
+	memberSeenMu.Unlock()
+	return t
+}
+
+// ==========================================
+// АДМИН-ПАНЕЛЬ
+// ==========================================
+
+const cbChatModPrefix = "chatmod_"
+
+// Поля профиля, которые переключаются кнопкой
+var chatProfileToggles = []struct {
+	Key   string
+	Title string
+	Get   func(*ChatModerationProfile) *bool
+}{
+	{"on", "Модерация", func(p *ChatModerationProfile) *bool { return &p.Enabled }},
+	{"links", "Ссылки", func(p *ChatModerationProfile) *bool { return &p.CheckLinks }},
+	{"phones", "Телефоны", func(p *ChatModerationProfile) *bool { return &p.CheckPhones }},
+	{"cards", "Карты", func(p *ChatModerationProfile) *bool { return &p.CheckCards }},
+	{"words", "Слова", func(p *ChatModerationProfile) *bool { return &p.CheckBadWords }},
+	{"nick", "Ники", func(p *ChatModerationProfile) *bool { return &p.CheckNicknames }},
+	{"caps", "Подписи к медиа", func(p *ChatModerationProfile) *bool { return &p.CheckCaptions }},
+	{"tlinks", "Скрытые ссылки", func(p *ChatModerationProfile) *bool { return &p.CheckEntityLinks }},
+	{"btns", "Кнопки-ссылки", func(p *ChatModerationProfile) *bool { return &p.CheckButtons }},
+	{"fwd", "Пересылки из каналов", func(p *ChatModerationProfile) *bool { return &p.CheckForwards }},
+	{"via", "Inline-боты", func(p *ChatModerationProfile) *bool { return &p.CheckViaBots }},
+	{"contact", "Контакты и гео", func(p *ChatModerationProfile) *bool { return &p.CheckContacts }},
+	{"edits", "Правки", func(p *ChatModerationProfile) *bool { return &p.CheckEdits }},
+	{"verified", "Ссылки верифицированным", func(p *ChatModerationProfile) *bool { return &p.TrustVerified }},
+}
+
+// Поля профиля, которые вводятся текстом
+var chatProfileInputs = map[string]string{
+	"domains": "Разрешенные домены через запятую (например: wikipedia.org, youtube.com) или '-' чтобы очистить:",
+	"extra":   "Дополнительные запрещенные слова через запятую или '-' чтобы очистить:",
+	"wl":      "ID участников для белого списка чата через запятую или '-' чтобы очистить:",
+	"days":    "Через сколько дней в чате участнику разрешены ссылки (0 — выключить):",
+}
+
+type chatModEdit struct {
+	ChatID int64
+	Field  string
+}
+
+var chatModEdits = make(map[int64]chatModEdit) // под adminStatesMu
+
+func onOff(v bool) string {
+	if v {
+		return "✅"
+	}
+	return "▫️"
+}
+
+func joinInt64s(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sendChatProfile(c tele.Context, chatID int64, edit bool) error {
+	p := getChatProfile(chatID)
+	name := formatChatName(chatID)
+	if name == "" {
+		name = strconv.FormatInt(chatID, 10)
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🛡 <b>Модерация: %s</b>\nID: <code>%d</code>\n\n", html.EscapeString(name), chatID))
+	none := func(s string) string {
+		if s == "" {
+			return "—"
+		}
+		return html.EscapeString(s)
+	}
+	sb.WriteString(fmt.Sprintf("🌐 Разрешенные домены: %s\n", none(strings.Join(p.AllowedDomains, ", "))))
+	sb.WriteString(fmt.Sprintf("📝 Доп. слова: %s\n", none(strings.Join(p.ExtraWords, ", "))))
+	sb.WriteString(fmt.Sprintf("👥 Белый список чата: %s\n", none(joinInt64s(p.Whitelist))))
+	days := "выкл"
+	if p.TrustMinDays > 0 {
+		days = fmt.Sprintf("%d дн.", p.TrustMinDays)
+	}
+	sb.WriteString(fmt.Sprintf("⏳ Ссылки старожилам: %s\n", days))
+
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	var row []tele.Btn
+	for _, t := range chatProfileToggles {
+		row = append(row, m.Data(onOff(*t.Get(&p))+" "+t.Title, fmt.Sprintf("%st_%s_%d", cbChatModPrefix, t.Key, chatID)))
+		if len(row) == 2 {
+			rows = append(rows, m.Row(row...))
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, m.Row(row...))
+	}
+	rows = append(rows,
+		m.Row(m.Data("🌐 Домены", fmt.Sprintf("%se_domains_%d", cbChatModPrefix, chatID)), m.Data("📝 Слова", fmt.Sprintf("%se_extra_%d", cbChatModPrefix, chatID))),
+		m.Row(m.Data("👥 Белый список", fmt.Sprintf("%se_wl_%d", cbChatModPrefix, chatID)), m.Data("⏳ Старожилы", fmt.Sprintf("%se_days_%d", cbChatModPrefix, chatID))),
+		m.Row(m.Data("🔙 К чатам", cbAdminChats)),
+	)
+	m.Inline(rows...)
+	if edit {
+		return tryEdit(c, sb.String(), m, tele.ModeHTML)
+	}
+	return c.Send(sb.String(), m, tele.ModeHTML)
+}
+
+// handleChatModCallback разбирает chatmod_<id>, chatmod_t_<поле>_<id>, chatmod_e_<поле>_<id>.
+func handleChatModCallback(c tele.Context, data string) error {
+	userID := c.Sender().ID
+	if !isAdmin(userID) {
+		return c.Respond()
+	}
+	rest := strings.TrimPrefix(data, cbChatModPrefix)
+	kind, field := "", ""
+	if strings.HasPrefix(rest, "t_") || strings.HasPrefix(rest, "e_") {
+		kind = rest[:1]
+		parts := strings.SplitN(rest[2:], "_", 2)
+		if len(parts) != 2 {
+			return c.Respond()
+		}
+		field, rest = parts[0], parts[1]
+	}
+	chatID, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || chatID == 0 {
+		return c.Respond()
+	}
+	switch kind {
+	case "t":
+		p := getChatProfile(chatID)
+		for _, t := range chatProfileToggles {
+			if t.Key == field {
+				v := t.Get(&p)
+				*v = !*v
+				if err := saveChatProfile(p); err != nil {
+					return c.Respond(&tele.CallbackResponse{Text: "Ошибка сохранения"})
+				}
+				logModAction(userID, "chat_profile", strconv.FormatInt(chatID, 10), fmt.Sprintf("%s=%t", field, *v))
+				break
+			}
+		}
+	case "e":
+		prompt, ok := chatProfileInputs[field]
+		if !ok {
+			return c.Respond()
+		}
+		adminStatesMu.Lock()
+		chatModEdits[userID] = chatModEdit{ChatID: chatID, Field: field}
+		adminStatesMu.Unlock()
+		setAdminState(userID, STATE_WAITING_CHATMOD)
+		return tryEdit(c, prompt, buildCancelEditMenu(), tele.ModeHTML)
+	}
+	return sendChatProfile(c, chatID, true)
+}
+
+func splitProfileList(text string) []string {
+	text = strings.TrimSpace(text)
+	if text == "-" || text == "" {
+		return nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, part := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' || r == ';' }) {
+		v := strings.ToLower(strings.TrimSpace(part))
+		if v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// normalizeDomain приводит "https://www.Example.org/path" к "example.org".
+func normalizeDomain(s string) string {
+	if m := linkHostRegex.FindStringSubmatch(s); len(m) > 1 {
+		return strings.ToLower(m[1])
+	}
+	return ""
+}
+
+// applyChatModInput сохраняет значение, введенное админом для поля профиля.
+func applyChatModInput(c tele.Context, text string) error {
+	userID := c.Sender().ID
+	adminStatesMu.Lock()
+	target, ok := chatModEdits[userID]
+	delete(chatModEdits, userID)
+	adminStatesMu.Unlock()
+	setAdminState(userID, STATE_IDLE)
+	if !ok {
+		return c.Send("Сессия истекла.", tele.ModeHTML)
+	}
+	p := getChatProfile(target.ChatID)
+	switch target.Field {
+	case "domains":
+		p.AllowedDomains = nil
+		for _, d := range splitProfileList(text) {
+			if d = normalizeDomain(d); d != "" {
+				p.AllowedDomains = append(p.AllowedDomains, d)
+			}
+		}
+	case "extra":
+		p.ExtraWords = splitProfileList(text)
+	case "wl":
+		p.Whitelist = nil
+		for _, v := range splitProfileList(text) {
+			if id := extractID(v); id != 0 {
+				p.Whitelist = append(p.Whitelist, id)
+			}
+		}
+	case "days":
+		n, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil || n < 0 {
+			setAdminState(userID, STATE_WAITING_CHATMOD)
+			adminStatesMu.Lock()
+			chatModEdits[userID] = target
+			adminStatesMu.Unlock()
+			return c.Send("Нужно неотрицательное число дней.", buildCancelEditMenu(), tele.ModeHTML)
+		}
+		p.TrustMinDays = n
+	}
+	if err := saveChatProfile(p); err != nil {
+		return c.Send("Ошибка сохранения: "+html.EscapeString(err.Error()), tele.ModeHTML)
+	}
+	logModAction(userID, "chat_profile", strconv.FormatInt(target.ChatID, 10), target.Field+"="+shorten(text, 200))
+	return sendChatProfile(c, target.ChatID, false)
+}
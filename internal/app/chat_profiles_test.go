@@ -0,0 +1,88 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestChatProfileChecks(t *testing.T) {
+	oldTarget := config.TargetChatID
+	config.TargetChatID = -100
+	t.Cleanup(func() { config.TargetChatID = oldTarget; resetChatProfileCache() })
+
+	if p := defaultChatProfile(-100); !p.CheckLinks || !p.CheckBadWords || !p.CheckCaptions || !p.CheckEdits {
+		t.Fatal("target chat must keep the text checks by default")
+	}
+	if spam, _, _ := defaultChatProfile(-200).checkText("https://spam.example", 1); spam {
+		t.Fatal("other chats must not filter texts by default")
+	}
+
+	discussion := ChatModerationProfile{ChatID: -300, Enabled: true, CheckLinks: true, CheckBadWords: true,
+		AllowedDomains: []string{"wikipedia.org"}, ExtraWords: []string{"флуд"}, Whitelist: []int64{42}, TrustMinDays: 30}
+	cases := []struct {
+		text   string
+		user   int64
+		spam   bool
+		reason ViolationType
+	}{
+		{"см. https://ru.wikipedia.org/wiki/Кюри", 1, false, ""},
+		{"www.wikipedia.org и evil.com", 1, true, ViolationLink},
+		{"notwikipedia.org", 1, true, ViolationLink},
+		{"хватит флуда", 1, true, ViolationBadWord},
+		{"evil.com", 42, false, ""},
+		{"evil.com", 7, false, ""}, // старожил
+	}
+	memberSeenMu.Lock()
+	memberSeen[chatUserKey{ChatID: -300, UserID: 7}] = time.Now().AddDate(0, 0, -60)
+	memberSeenMu.Unlock()
+	for _, tc := range cases {
+		spam, vt, _ := discussion.checkText(tc.text, tc.user)
+		if spam != tc.spam || vt != tc.reason {
+			t.Errorf("%q from %d: got %v/%s, want %v/%s", tc.text, tc.user, spam, vt, tc.spam, tc.reason)
+		}
+	}
+
+	discussion.Enabled = false
+	if spam, _, _ := discussion.checkText("evil.com", 1); spam {
+		t.Fatal("disabled profile must not flag anything")
+	}
+}
+
+// База до профилей чатов: целевой чат получает профиль по умолчанию,
+// и новые наказания в нем выключены, пока их не включат в /chats.
+func TestTargetChatProfileAfterUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "women.db")
+	old, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.AutoMigrate(&Woman{}, &BotSettings{}, &BotUser{}, &KnownChat{}, &UserFavorite{}, &UserView{}); err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := old.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	wm := NewWomanManager(path)
+	savedWM, savedTarget := womanManager, config.TargetChatID
+	womanManager, config.TargetChatID = wm, -100
+	resetChatProfileCache()
+	t.Cleanup(func() {
+		_ = wm.CloseDB()
+		womanManager, config.TargetChatID = savedWM, savedTarget
+		resetChatProfileCache()
+	})
+
+	p := getChatProfile(-100)
+	if !p.Enabled || !p.CheckLinks || !p.CheckCaptions {
+		t.Fatalf("target chat must keep its text checks: %+v", p)
+	}
+	if p.CheckForwards || p.CheckViaBots || p.CheckContacts || p.CheckEntityLinks || p.CheckButtons {
+		t.Fatalf("new punitive checks must be opt-in: %+v", p)
+	}
+}
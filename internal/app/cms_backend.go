@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ==========================================
+// ВЫБОР ХРАНИЛИЩА CMS
+// ==========================================
+
+const (
+	cmsBackendSQLite   = "sqlite"
+	cmsBackendPostgres = "postgres"
+	cmsBackendMongo    = "mongo"
+
+	defaultCMSMongoDB = "ophelia_cms"
+)
+
+// normalizeCMSBackend приводит значение cms_backend к одному из поддерживаемых.
+// Пустое значение означает sqlite (таблицы CMS живут в основной БД, каким бы ни был ее диалект).
+func normalizeCMSBackend(raw string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", cmsBackendSQLite:
+		return cmsBackendSQLite, nil
+	case cmsBackendPostgres, "postgresql", "pg":
+		return cmsBackendPostgres, nil
+	case cmsBackendMongo, "mongodb":
+		return cmsBackendMongo, nil
+	}
+	return "", fmt.Errorf("unknown cms backend %q (expected sqlite, postgres or mongo)", raw)
+}
+
+// openCMSRepository создает репозиторий для выбранного бэкенда и вызывает его Init*.
+// sqlite использует основную БД бота, mongo открывает отдельное подключение.
+// postgres без cms_postgres_dsn переиспользует основную БД, если она сама на Postgres.
+// Возвращаемая функция закрывает подключение, если оно было открыто.
+func openCMSRepository(ctx context.Context, cfg Config, db *gorm.DB) (Repository, func(context.Context) error, error) {
+	backend, err := normalizeCMSBackend(cfg.CMSBackend)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch backend {
+	case cmsBackendMongo:
+		uri := strings.TrimSpace(cfg.CMSMongoURI)
+		if uri == "" {
+			return nil, nil, errors.New("cms_mongo_uri is required for mongo backend")
+		}
+		dbName := strings.TrimSpace(cfg.CMSMongoDB)
+		if dbName == "" {
+			dbName = defaultCMSMongoDB
+		}
+		connectCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		defer cancel()
+		client, err := mongo.Connect(connectCtx, options.Client().ApplyURI(uri))
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect mongo: %w", err)
+		}
+		if err := client.Ping(connectCtx, nil); err != nil {
+			_ = client.Disconnect(ctx)
+			return nil, nil, fmt.Errorf("ping mongo: %w", err)
+		}
+		repo := NewMongoRepository(client.Database(dbName))
+		if err := repo.InitMongoDB(connectCtx); err != nil {
+			_ = client.Disconnect(ctx)
+			return nil, nil, err
+		}
+		return repo, client.Disconnect, nil
+	case cmsBackendPostgres:
+		dsn := strings.TrimSpace(cfg.CMSPostgresDSN)
+		if dsn == "" {
+			if db == nil || db.Dialector.Name() != dialectPostgres {
+				return nil, nil, errors.New("cms_postgres_dsn is required when the main database is not postgres")
+			}
+			repo := NewPostgreSQLRepository(db)
+			if err := repo.InitPostgreSQL(ctx); err != nil {
+				return nil, nil, err
+			}
+			return repo, func(context.Context) error { return nil }, nil
+		}
+		pg, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect postgres: %w", err)
+		}
+		sqlDB, err := pg.DB()
+		if err != nil {
+			return nil, nil, err
+		}
+		repo := NewPostgreSQLRepository(pg)
+		if err := repo.InitPostgreSQL(ctx); err != nil {
+			_ = sqlDB.Close()
+			return nil, nil, err
+		}
+		return repo, func(context.Context) error { return sqlDB.Close() }, nil
+	default:
+		if db == nil {
+			return nil, nil, errors.New("main database is not initialized")
+		}
+		repo := NewPostgreSQLRepository(db)
+		if err := repo.InitPostgreSQL(ctx); err != nil {
+			return nil, nil, err
+		}
+		return repo, func(context.Context) error { return nil }, nil
+	}
+}
+
+// ==========================================
+// МИГРАЦИЯ МЕЖДУ ХРАНИЛИЩАМИ
+// ==========================================
+
+type cmsMigrationReport struct {
+	Posts    int
+	Projects int
+	Events   int
+	Settings bool
+}
+
+func (r cmsMigrationReport) String() string {
+	settings := "нет"
+	if r.Settings {
+		settings = "да"
+	}
+	return fmt.Sprintf("посты: %d, проекты: %d, события: %d, настройки сайта: %s", r.Posts, r.Projects, r.Events, settings)
+}
+
+// migrateCMS копирует посты, проекты, события (вместе с участниками) и настройки сайта.
+// Уже существующие в приемнике записи перезаписываются, поэтому повторный запуск безопасен.
+func migrateCMS(ctx context.Context, src, dst Repository) (cmsMigrationReport, error) {
+	var report cmsMigrationReport
+
+	posts, err := src.ListPosts(ctx, true)
+	if err != nil {
+		return report, fmt.Errorf("list posts: %w", err)
+	}
+	for i := range posts {
+		p := posts[i]
+		if _, err := dst.GetPostByID(ctx, p.ID); err == nil {
+			err = dst.UpdatePost(ctx, &p)
+		} else if errors.Is(err, ErrCMSNotFound) {
+			err = dst.CreatePost(ctx, &p)
+		}
+		if err != nil {
+			return report, fmt.Errorf("copy post %s: %w", p.ID, err)
+		}
+		report.Posts++
+	}
+
+	projects, err := src.ListProjects(ctx)
+	if err != nil {
+		return report, fmt.Errorf("list projects: %w", err)
+	}
+	for i := range projects {
+		p := projects[i]
+		if _, err := dst.GetProjectByID(ctx, p.ID); err == nil {
+			err = dst.UpdateProject(ctx, &p)
+		} else if errors.Is(err, ErrCMSNotFound) {
+			err = dst.CreateProject(ctx, &p)
+		}
+		if err != nil {
+			return report, fmt.Errorf("copy project %s: %w", p.ID, err)
+		}
+		report.Projects++
+	}
+
+	events, err := src.ListEvents(ctx)
+	if err != nil {
+		return report, fmt.Errorf("list events: %w", err)
+	}
+	for i := range events {
+		e := events[i]
+		if _, err := dst.GetEventByID(ctx, e.ID); err == nil {
+			err = dst.UpdateEvent(ctx, &e)
+		} else if errors.Is(err, ErrCMSNotFound) {
+			err = dst.CreateEvent(ctx, &e)
+		}
+		if err != nil {
+			return report, fmt.Errorf("copy event %s: %w", e.ID, err)
+		}
+		report.Events++
+	}
+
+	settings, err := src.GetSiteSettings(ctx)
+	if err != nil && !errors.Is(err, ErrCMSNotFound) {
+		return report, fmt.Errorf("get site settings: %w", err)
+	}
+	if settings != nil {
+		if err := dst.UpdateSiteSettings(ctx, settings); err != nil {
+			return report, fmt.Errorf("copy site settings: %w", err)
+		}
+		report.Settings = true
+	}
+
+	return report, nil
+}
+
+// runCMSMigrateCommand — разовая команда: ophelia cms-migrate <from> <to>.
+// Параметры подключения берутся из конфига, меняется только выбор бэкенда.
+func runCMSMigrateCommand(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: cms-migrate <sqlite|postgres|mongo> <sqlite|postgres|mongo>")
+	}
+	from, err := normalizeCMSBackend(args[0])
+	if err != nil {
+		return err
+	}
+	to, err := normalizeCMSBackend(args[1])
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return fmt.Errorf("source and destination are the same backend (%s)", from)
+	}
+
+	ctx := context.Background()
+	var db *gorm.DB
+	if from != cmsBackendMongo || to != cmsBackendMongo {
+		womanManager = NewWomanManager(resolveDBDSN(config))
+		defer womanManager.CloseDB()
+		db = womanManager.DB
+	}
+
+	srcCfg := config
+	srcCfg.CMSBackend = from
+	src, closeSrc, err := openCMSRepository(ctx, srcCfg, db)
+	if err != nil {
+		return fmt.Errorf("open source %s: %w", from, err)
+	}
+	defer closeSrc(ctx)
+
+	dstCfg := config
+	dstCfg.CMSBackend = to
+	dst, closeDst, err := openCMSRepository(ctx, dstCfg, db)
+	if err != nil {
+		return fmt.Errorf("open destination %s: %w", to, err)
+	}
+	defer closeDst(ctx)
+
+	report, err := migrateCMS(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ CMS перенесена %s → %s: %s\n", from, to, report)
+	return nil
+}
@@ -0,0 +1,428 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// memoryCMSRepository — хранилище CMS в памяти для тестов.
+type memoryCMSRepository struct {
+	mu       sync.Mutex
+	posts    map[string]Post
+	projects map[string]Project
+	events   map[string]Event
+	settings *SiteSettings
+}
+
+func newMemoryCMSRepository() *memoryCMSRepository {
+	return &memoryCMSRepository{
+		posts:    map[string]Post{},
+		projects: map[string]Project{},
+		events:   map[string]Event{},
+	}
+}
+
+func (r *memoryCMSRepository) InitPostgreSQL(context.Context) error { return nil }
+func (r *memoryCMSRepository) InitMongoDB(context.Context) error    { return nil }
+
+func (r *memoryCMSRepository) CreatePost(_ context.Context, p *Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ensurePostDefaults(p)
+	r.posts[p.ID] = *p
+	return nil
+}
+
+func (r *memoryCMSRepository) GetPostByID(_ context.Context, id string) (*Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.posts[id]
+	if !ok {
+		return nil, ErrCMSNotFound
+	}
+	return &p, nil
+}
+
+func (r *memoryCMSRepository) ListPosts(_ context.Context, includeHidden bool) ([]Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Post
+	for _, p := range r.posts {
+		if p.IsHidden && !includeHidden {
+			continue
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (r *memoryCMSRepository) UpdatePost(_ context.Context, p *Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.posts[p.ID]; !ok {
+		return ErrCMSNotFound
+	}
+	r.posts[p.ID] = *p
+	return nil
+}
+
+func (r *memoryCMSRepository) DeletePost(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.posts[id]; !ok {
+		return ErrCMSNotFound
+	}
+	delete(r.posts, id)
+	return nil
+}
+
+func (r *memoryCMSRepository) CreateSiteSettings(_ context.Context, s *SiteSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ensureSiteSettingsDefaults(s)
+	cp := *s
+	r.settings = &cp
+	return nil
+}
+
+func (r *memoryCMSRepository) GetSiteSettings(context.Context) (*SiteSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.settings == nil {
+		return nil, ErrCMSNotFound
+	}
+	cp := *r.settings
+	return &cp, nil
+}
+
+func (r *memoryCMSRepository) UpdateSiteSettings(ctx context.Context, s *SiteSettings) error {
+	return r.CreateSiteSettings(ctx, s)
+}
+
+func (r *memoryCMSRepository) DeleteSiteSettings(context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.settings == nil {
+		return ErrCMSNotFound
+	}
+	r.settings = nil
+	return nil
+}
+
+func (r *memoryCMSRepository) CreateProject(_ context.Context, p *Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ensureProjectDefaults(p)
+	r.projects[p.ID] = *p
+	return nil
+}
+
+func (r *memoryCMSRepository) GetProjectByID(_ context.Context, id string) (*Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.projects[id]
+	if !ok {
+		return nil, ErrCMSNotFound
+	}
+	return &p, nil
+}
+
+func (r *memoryCMSRepository) ListProjects(context.Context) ([]Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Project
+	for _, p := range r.projects {
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (r *memoryCMSRepository) UpdateProject(_ context.Context, p *Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.projects[p.ID]; !ok {
+		return ErrCMSNotFound
+	}
+	r.projects[p.ID] = *p
+	return nil
+}
+
+func (r *memoryCMSRepository) DeleteProject(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.projects[id]; !ok {
+		return ErrCMSNotFound
+	}
+	delete(r.projects, id)
+	return nil
+}
+
+func (r *memoryCMSRepository) CreateEvent(_ context.Context, e *Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ensureEventDefaults(e)
+	r.events[e.ID] = *e
+	return nil
+}
+
+func (r *memoryCMSRepository) GetEventByID(_ context.Context, id string) (*Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.events[id]
+	if !ok {
+		return nil, ErrCMSNotFound
+	}
+	return &e, nil
+}
+
+func (r *memoryCMSRepository) ListEvents(context.Context) ([]Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Event
+	for _, e := range r.events {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	return out, nil
+}
+
+func (r *memoryCMSRepository) UpdateEvent(_ context.Context, e *Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.events[e.ID]; !ok {
+		return ErrCMSNotFound
+	}
+	ensureEventDefaults(e)
+	r.events[e.ID] = *e
+	return nil
+}
+
+func (r *memoryCMSRepository) DeleteEvent(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.events[id]; !ok {
+		return ErrCMSNotFound
+	}
+	delete(r.events, id)
+	return nil
+}
+
+func (r *memoryCMSRepository) AddEventParticipant(_ context.Context, eventID string, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.events[eventID]
+	if !ok {
+		return ErrCMSNotFound
+	}
+	if containsParticipant(e.CurrentParticipants, userID) {
+		return nil
+	}
+	if e.MaxParticipants > 0 && len(e.CurrentParticipants) >= e.MaxParticipants {
+		return ErrEventIsFull
+	}
+	e.CurrentParticipants = append(e.CurrentParticipants, userID)
+	r.events[eventID] = e
+	return nil
+}
+
+func (r *memoryCMSRepository) RemoveEventParticipant(_ context.Context, eventID string, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.events[eventID]
+	if !ok {
+		return ErrCMSNotFound
+	}
+	e.CurrentParticipants = removeParticipant(e.CurrentParticipants, userID)
+	r.events[eventID] = e
+	return nil
+}
+
+func newTestSQLiteCMSRepository(t *testing.T) Repository {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cms.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	repo := NewPostgreSQLRepository(db)
+	if err := repo.InitPostgreSQL(context.Background()); err != nil {
+		t.Fatalf("init sqlite repo: %v", err)
+	}
+	return repo
+}
+
+// newTestMongoCMSRepository подключается к mongod из OPHELIA_TEST_MONGO_URI,
+// а без него — к fakeMongo в памяти (cms_mongo_fake_test.go).
+func newTestMongoCMSRepository(t *testing.T) Repository {
+	t.Helper()
+	uri := os.Getenv("OPHELIA_TEST_MONGO_URI")
+	if uri == "" {
+		uri = startFakeMongo(t)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect mongo: %v", err)
+	}
+	db := client.Database("ophelia_test_" + time.Now().Format("150405.000000"))
+	t.Cleanup(func() {
+		_ = db.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	})
+	repo := NewMongoRepository(db)
+	if err := repo.InitMongoDB(ctx); err != nil {
+		t.Fatalf("init mongo repo: %v", err)
+	}
+	return repo
+}
+
+func seedCMS(t *testing.T, repo Repository) {
+	t.Helper()
+	ctx := context.Background()
+	day := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	if err := repo.CreatePost(ctx, &Post{ID: "p1", Title: "Видимый", Content: "текст", CreatedAt: day}); err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	if err := repo.CreatePost(ctx, &Post{ID: "p2", Title: "Скрытый", Content: "текст", IsHidden: true, CreatedAt: day.Add(time.Hour)}); err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	if err := repo.CreateProject(ctx, &Project{ID: "pr1", Title: "Проект"}); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	if err := repo.CreateEvent(ctx, &Event{ID: "e1", Title: "Встреча", Date: day, MaxParticipants: 2}); err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	for _, uid := range []int64{10, 20} {
+		if err := repo.AddEventParticipant(ctx, "e1", uid); err != nil {
+			t.Fatalf("add participant: %v", err)
+		}
+	}
+	if err := repo.UpdateSiteSettings(ctx, &SiteSettings{AboutText: "О нас", ContactEmail: "hi@example.com"}); err != nil {
+		t.Fatalf("update settings: %v", err)
+	}
+}
+
+func checkCMSCopy(t *testing.T, repo Repository) {
+	t.Helper()
+	ctx := context.Background()
+	posts, err := repo.ListPosts(ctx, true)
+	if err != nil || len(posts) != 2 {
+		t.Fatalf("ListPosts = %d, %v; want 2 posts", len(posts), err)
+	}
+	if p, err := repo.GetPostByID(ctx, "p2"); err != nil || !p.IsHidden {
+		t.Fatalf("hidden post not preserved: %+v, %v", p, err)
+	}
+	if _, err := repo.GetProjectByID(ctx, "pr1"); err != nil {
+		t.Fatalf("project not copied: %v", err)
+	}
+	e, err := repo.GetEventByID(ctx, "e1")
+	if err != nil {
+		t.Fatalf("event not copied: %v", err)
+	}
+	if len(e.CurrentParticipants) != 2 || !containsParticipant(e.CurrentParticipants, 10) || !containsParticipant(e.CurrentParticipants, 20) {
+		t.Fatalf("participants not copied: %v", e.CurrentParticipants)
+	}
+	if err := repo.AddEventParticipant(ctx, "e1", 30); !errors.Is(err, ErrEventIsFull) {
+		t.Fatalf("AddEventParticipant on full event = %v; want ErrEventIsFull", err)
+	}
+	s, err := repo.GetSiteSettings(ctx)
+	if err != nil || s.AboutText != "О нас" || s.ContactEmail != "hi@example.com" {
+		t.Fatalf("settings not copied: %+v, %v", s, err)
+	}
+}
+
+func TestMigrateCMS(t *testing.T) {
+	backends := map[string]func(*testing.T) Repository{
+		"sqlite": newTestSQLiteCMSRepository,
+		"mongo":  newTestMongoCMSRepository,
+	}
+	for name, open := range backends {
+		t.Run(name+"_to_memory", func(t *testing.T) {
+			src := open(t)
+			seedCMS(t, src)
+			dst := newMemoryCMSRepository()
+			report, err := migrateCMS(context.Background(), src, dst)
+			if err != nil {
+				t.Fatalf("migrateCMS: %v", err)
+			}
+			if report.Posts != 2 || report.Projects != 1 || report.Events != 1 || !report.Settings {
+				t.Fatalf("unexpected report: %+v", report)
+			}
+			checkCMSCopy(t, dst)
+		})
+		t.Run("memory_to_"+name, func(t *testing.T) {
+			src := newMemoryCMSRepository()
+			seedCMS(t, src)
+			dst := open(t)
+			if _, err := migrateCMS(context.Background(), src, dst); err != nil {
+				t.Fatalf("migrateCMS: %v", err)
+			}
+			// Повторный запуск не должен падать на существующих записях
+			if _, err := migrateCMS(context.Background(), src, dst); err != nil {
+				t.Fatalf("second migrateCMS: %v", err)
+			}
+			checkCMSCopy(t, dst)
+		})
+	}
+}
+
+func TestNormalizeCMSBackend(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", cmsBackendSQLite},
+		{"SQLite", cmsBackendSQLite},
+		{"postgresql", cmsBackendPostgres},
+		{" mongodb ", cmsBackendMongo},
+	}
+	for _, tt := range tests {
+		got, err := normalizeCMSBackend(tt.in)
+		if err != nil || got != tt.want {
+			t.Fatalf("normalizeCMSBackend(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := normalizeCMSBackend("redis"); err == nil {
+		t.Fatalf("normalizeCMSBackend(redis) should fail")
+	}
+}
+
+func TestOpenCMSRepositoryMongo(t *testing.T) {
+	uri := os.Getenv("OPHELIA_TEST_MONGO_URI")
+	if uri == "" {
+		uri = startFakeMongo(t)
+	}
+	ctx := context.Background()
+	cfg := Config{CMSBackend: "mongodb", CMSMongoURI: uri, CMSMongoDB: "ophelia_open_" + time.Now().Format("150405.000000")}
+	repo, closeRepo, err := openCMSRepository(ctx, cfg, nil)
+	if err != nil {
+		t.Fatalf("openCMSRepository: %v", err)
+	}
+	t.Cleanup(func() { _ = closeRepo(ctx) })
+	if _, ok := repo.(*MongoRepository); !ok {
+		t.Fatalf("repository = %T; want *MongoRepository", repo)
+	}
+	// InitMongoDB создает синглтон настроек, повторная инициализация его не ломает
+	if err := repo.InitMongoDB(ctx); err != nil {
+		t.Fatalf("second InitMongoDB: %v", err)
+	}
+	if s, err := repo.GetSiteSettings(ctx); err != nil || s.ID != siteSettingsSingletonID {
+		t.Fatalf("settings singleton: %+v, %v", s, err)
+	}
+	if _, _, err := openCMSRepository(ctx, Config{CMSBackend: "mongo"}, nil); err == nil {
+		t.Fatal("mongo backend without uri must fail")
+	}
+}
@@ -0,0 +1,514 @@
+package app
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ==========================================
+// MONGOD В ПАМЯТИ ДЛЯ ТЕСТОВ
+// ==========================================
+
+// fakeMongo понимает проводной протокол MongoDB (OP_QUERY для первого hello,
+// дальше OP_MSG) и ровно те команды, которые шлет драйвер из MongoRepository:
+// hello, ping, listCollections, create, createIndexes, insert, find, update
+// ($set, $addToSet, $pull и замена документа, в т.ч. upsert), delete, dropDatabase.
+// Фильтры — только равенство полей верхнего уровня, сортировка — по одному полю.
+// Так MongoRepository и migrateCMS проверяются настоящим драйвером без mongod.
+
+const (
+	opReply = 1
+	opQuery = 2004
+	opMsg   = 2013
+)
+
+type fakeMongo struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	dbs   map[string]map[string][]bson.D // база -> коллекция -> документы
+	conns map[net.Conn]bool
+}
+
+// startFakeMongo запускает сервер и возвращает URI для mongo.Connect.
+func startFakeMongo(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeMongo{ln: ln, dbs: map[string]map[string][]bson.D{}, conns: map[net.Conn]bool{}}
+	go s.serve()
+	t.Cleanup(s.close)
+	return "mongodb://" + ln.Addr().String() + "/?directConnection=true"
+}
+
+func (s *fakeMongo) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeMongo) close() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *fakeMongo) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		var header [16]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return
+		}
+		size := int(binary.LittleEndian.Uint32(header[0:]))
+		requestID := binary.LittleEndian.Uint32(header[4:])
+		opCode := binary.LittleEndian.Uint32(header[12:])
+		body := make([]byte, size-16)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+		var reply []byte
+		switch opCode {
+		case opQuery:
+			cmd, err := parseOpQuery(body)
+			if err != nil {
+				return
+			}
+			reply = wireReply(requestID, opReply, s.command(cmd), true)
+		case opMsg:
+			cmd, err := parseOpMsg(body)
+			if err != nil {
+				return
+			}
+			reply = wireReply(requestID, opMsg, s.command(cmd), false)
+		default:
+			return
+		}
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// parseOpQuery разбирает OP_QUERY: flags, имя коллекции, skip, return, запрос.
+func parseOpQuery(body []byte) (bson.D, error) {
+	end := 4
+	for end < len(body) && body[end] != 0 {
+		end++
+	}
+	doc := body[end+1+8:]
+	var cmd bson.D
+	if err := bson.Unmarshal(bson.Raw(doc[:binary.LittleEndian.Uint32(doc)]), &cmd); err != nil {
+		return nil, err
+	}
+	if len(cmd) > 0 && cmd[0].Key == "$query" {
+		if inner, ok := cmd[0].Value.(bson.D); ok {
+			return inner, nil
+		}
+	}
+	return cmd, nil
+}
+
+// parseOpMsg разбирает OP_MSG: тело (секция 0) и последовательности документов
+// (секция 1: documents, updates, deletes) — они добавляются в команду массивами.
+func parseOpMsg(body []byte) (bson.D, error) {
+	flags := binary.LittleEndian.Uint32(body)
+	if flags&1 != 0 {
+		body = body[:len(body)-4] // контрольная сумма
+	}
+	var cmd bson.D
+	var seqs bson.D
+	for p := 4; p < len(body); {
+		kind := body[p]
+		p++
+		size := int(binary.LittleEndian.Uint32(body[p:]))
+		switch kind {
+		case 0:
+			if err := bson.Unmarshal(bson.Raw(body[p:p+size]), &cmd); err != nil {
+				return nil, err
+			}
+			p += size
+		case 1:
+			sec := body[p+4 : p+size]
+			nameEnd := 0
+			for sec[nameEnd] != 0 {
+				nameEnd++
+			}
+			name := string(sec[:nameEnd])
+			var docs primitive.A
+			for q := nameEnd + 1; q < len(sec); {
+				n := int(binary.LittleEndian.Uint32(sec[q:]))
+				var d bson.D
+				if err := bson.Unmarshal(bson.Raw(sec[q:q+n]), &d); err != nil {
+					return nil, err
+				}
+				docs = append(docs, d)
+				q += n
+			}
+			seqs = append(seqs, bson.E{Key: name, Value: docs})
+			p += size
+		default:
+			return nil, fmt.Errorf("unknown OP_MSG section %d", kind)
+		}
+	}
+	return append(cmd, seqs...), nil
+}
+
+func wireReply(responseTo uint32, opCode int, doc bson.D, legacy bool) []byte {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+	var payload []byte
+	if legacy {
+		payload = make([]byte, 20) // flags, cursorID, startingFrom, numberReturned
+		binary.LittleEndian.PutUint32(payload[16:], 1)
+	} else {
+		payload = []byte{0, 0, 0, 0, 0} // flags и секция 0
+	}
+	payload = append(payload, raw...)
+	msg := make([]byte, 16, 16+len(payload))
+	binary.LittleEndian.PutUint32(msg[0:], uint32(16+len(payload)))
+	binary.LittleEndian.PutUint32(msg[8:], responseTo)
+	binary.LittleEndian.PutUint32(msg[12:], uint32(opCode))
+	return append(msg, payload...)
+}
+
+// ------------------------------------------
+// Команды
+// ------------------------------------------
+
+func docGet(d bson.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func docSet(d bson.D, key string, v interface{}) bson.D {
+	for i, e := range d {
+		if e.Key == key {
+			d[i].Value = v
+			return d
+		}
+	}
+	return append(d, bson.E{Key: key, Value: v})
+}
+
+func docList(v interface{}) []bson.D {
+	arr, _ := v.(primitive.A)
+	out := make([]bson.D, 0, len(arr))
+	for _, x := range arr {
+		if d, ok := x.(bson.D); ok {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func docInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func matches(doc, filter bson.D) bool {
+	for _, f := range filter {
+		v, ok := docGet(doc, f.Key)
+		if !ok || !reflect.DeepEqual(v, f.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func lessValue(a, b interface{}) bool {
+	switch x := a.(type) {
+	case primitive.DateTime:
+		y, _ := b.(primitive.DateTime)
+		return x < y
+	case string:
+		y, _ := b.(string)
+		return x < y
+	}
+	return docInt(a) < docInt(b)
+}
+
+func cloneDoc(d bson.D) bson.D {
+	raw, _ := bson.Marshal(d)
+	var out bson.D
+	_ = bson.Unmarshal(raw, &out)
+	return out
+}
+
+func cmdError(code int, format string, args ...interface{}) bson.D {
+	return bson.D{{Key: "ok", Value: 0.0}, {Key: "code", Value: int32(code)}, {Key: "errmsg", Value: fmt.Sprintf(format, args...)}}
+}
+
+func (s *fakeMongo) command(cmd bson.D) bson.D {
+	if len(cmd) == 0 {
+		return cmdError(59, "empty command")
+	}
+	name := cmd[0].Key
+	dbName, _ := docGet(cmd, "$db")
+	db, _ := dbName.(string)
+	coll, _ := cmd[0].Value.(string)
+	ok := bson.E{Key: "ok", Value: 1.0}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dbs[db] == nil {
+		s.dbs[db] = map[string][]bson.D{}
+	}
+	colls := s.dbs[db]
+
+	switch strings.ToLower(name) {
+	case "hello", "ismaster":
+		return bson.D{
+			{Key: "ismaster", Value: true}, {Key: "isWritablePrimary", Value: true}, {Key: "helloOk", Value: true},
+			{Key: "maxBsonObjectSize", Value: int32(16 * 1024 * 1024)}, {Key: "maxMessageSizeBytes", Value: int32(48000000)},
+			{Key: "maxWriteBatchSize", Value: int32(100000)}, {Key: "minWireVersion", Value: int32(0)},
+			{Key: "maxWireVersion", Value: int32(17)}, ok,
+		}
+	case "ping", "endsessions", "createindexes":
+		return bson.D{ok}
+	case "create":
+		if _, exists := colls[coll]; exists {
+			return cmdError(48, "collection %s already exists", coll)
+		}
+		colls[coll] = []bson.D{}
+		return bson.D{ok}
+	case "dropdatabase":
+		delete(s.dbs, db)
+		return bson.D{ok}
+	case "listcollections":
+		names := make([]string, 0, len(colls))
+		for n := range colls {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		batch := primitive.A{}
+		for _, n := range names {
+			batch = append(batch, bson.D{{Key: "name", Value: n}, {Key: "type", Value: "collection"}})
+		}
+		return cursorReply(db+".$cmd.listCollections", batch)
+	case "insert":
+		var errs primitive.A
+		n := 0
+		for i, d := range docList(mustGet(cmd, "documents")) {
+			id, _ := docGet(d, "_id")
+			dup := false
+			for _, existing := range colls[coll] {
+				if v, _ := docGet(existing, "_id"); reflect.DeepEqual(v, id) {
+					dup = true
+				}
+			}
+			if dup {
+				errs = append(errs, bson.D{{Key: "index", Value: int32(i)}, {Key: "code", Value: int32(11000)}, {Key: "errmsg", Value: "duplicate key"}})
+				continue
+			}
+			colls[coll] = append(colls[coll], cloneDoc(d))
+			n++
+		}
+		out := bson.D{{Key: "n", Value: int32(n)}}
+		if len(errs) > 0 {
+			out = append(out, bson.E{Key: "writeErrors", Value: errs})
+		}
+		return append(out, ok)
+	case "find":
+		filter, _ := docGet(cmd, "filter")
+		fd, _ := filter.(bson.D)
+		var found []bson.D
+		for _, d := range colls[coll] {
+			if matches(d, fd) {
+				found = append(found, cloneDoc(d))
+			}
+		}
+		if sv, ok := docGet(cmd, "sort"); ok {
+			if sd, _ := sv.(bson.D); len(sd) > 0 {
+				key, dir := sd[0].Key, docInt(sd[0].Value)
+				sort.SliceStable(found, func(i, j int) bool {
+					a, _ := docGet(found[i], key)
+					b, _ := docGet(found[j], key)
+					if dir < 0 {
+						return lessValue(b, a)
+					}
+					return lessValue(a, b)
+				})
+			}
+		}
+		if lim, ok := docGet(cmd, "limit"); ok {
+			if l := docInt(lim); l > 0 && int64(len(found)) > l {
+				found = found[:l]
+			}
+		}
+		batch := primitive.A{}
+		for _, d := range found {
+			batch = append(batch, d)
+		}
+		return cursorReply(db+"."+coll, batch)
+	case "update":
+		matched, modified := 0, 0
+		var upserted primitive.A
+		for i, u := range docList(mustGet(cmd, "updates")) {
+			q, _ := mustGet(u, "q").(bson.D)
+			spec, _ := mustGet(u, "u").(bson.D)
+			upsert, _ := docGet(u, "upsert")
+			hit := false
+			for j, d := range colls[coll] {
+				if !matches(d, q) {
+					continue
+				}
+				hit = true
+				matched++
+				next, err := applyUpdate(d, spec)
+				if err != nil {
+					return cmdError(9, "%v", err)
+				}
+				if !reflect.DeepEqual(next, d) {
+					modified++
+				}
+				colls[coll][j] = next
+				break
+			}
+			if !hit && upsert == true {
+				doc := bson.D{}
+				if id, ok := docGet(q, "_id"); ok {
+					doc = bson.D{{Key: "_id", Value: id}}
+				}
+				next, err := applyUpdate(doc, spec)
+				if err != nil {
+					return cmdError(9, "%v", err)
+				}
+				colls[coll] = append(colls[coll], next)
+				id, _ := docGet(next, "_id")
+				upserted = append(upserted, bson.D{{Key: "index", Value: int32(i)}, {Key: "_id", Value: id}})
+				matched++
+			}
+		}
+		out := bson.D{{Key: "n", Value: int32(matched)}, {Key: "nModified", Value: int32(modified)}}
+		if len(upserted) > 0 {
+			out = append(out, bson.E{Key: "upserted", Value: upserted})
+		}
+		return append(out, ok)
+	case "delete":
+		n := 0
+		for _, del := range docList(mustGet(cmd, "deletes")) {
+			q, _ := mustGet(del, "q").(bson.D)
+			limit := docInt(mustGet(del, "limit"))
+			kept := colls[coll][:0]
+			for _, d := range colls[coll] {
+				if matches(d, q) && (limit == 0 || int64(n) < limit) {
+					n++
+					continue
+				}
+				kept = append(kept, d)
+			}
+			colls[coll] = kept
+		}
+		return bson.D{{Key: "n", Value: int32(n)}, ok}
+	}
+	return cmdError(59, "no such command: '%s'", name)
+}
+
+func mustGet(d bson.D, key string) interface{} {
+	v, _ := docGet(d, key)
+	return v
+}
+
+func cursorReply(ns string, batch primitive.A) bson.D {
+	return bson.D{
+		{Key: "cursor", Value: bson.D{{Key: "firstBatch", Value: batch}, {Key: "id", Value: int64(0)}, {Key: "ns", Value: ns}}},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+// applyUpdate применяет операторы ($set, $addToSet, $pull) или заменяет документ целиком, сохраняя _id.
+func applyUpdate(doc, spec bson.D) (bson.D, error) {
+	if len(spec) == 0 || !strings.HasPrefix(spec[0].Key, "$") {
+		next := cloneDoc(spec)
+		if id, ok := docGet(doc, "_id"); ok {
+			next = append(bson.D{{Key: "_id", Value: id}}, withoutKey(next, "_id")...)
+		}
+		return next, nil
+	}
+	next := cloneDoc(doc)
+	for _, op := range spec {
+		fields, _ := op.Value.(bson.D)
+		for _, f := range fields {
+			cur, _ := docGet(next, f.Key)
+			arr, _ := cur.(primitive.A)
+			switch op.Key {
+			case "$set":
+				next = docSet(next, f.Key, f.Value)
+			case "$addToSet":
+				present := false
+				for _, x := range arr {
+					present = present || reflect.DeepEqual(x, f.Value)
+				}
+				if !present {
+					arr = append(arr, f.Value)
+				}
+				next = docSet(next, f.Key, arr)
+			case "$pull":
+				kept := primitive.A{}
+				for _, x := range arr {
+					if !reflect.DeepEqual(x, f.Value) {
+						kept = append(kept, x)
+					}
+				}
+				next = docSet(next, f.Key, kept)
+			default:
+				return nil, errors.New("unsupported update operator " + op.Key)
+			}
+		}
+	}
+	return next, nil
+}
+
+func withoutKey(d bson.D, key string) bson.D {
+	out := make(bson.D, 0, len(d))
+	for _, e := range d {
+		if e.Key != key {
+			out = append(out, e)
+		}
+	}
+	return out
+}
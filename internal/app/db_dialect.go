@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// ДИАЛЕКТЫ БД (SQLITE / POSTGRES)
+// ==========================================
+
+// Все запросы, которые пишутся по-разному в SQLite и Postgres, живут здесь.
+// Остальной код работает через gorm и не знает, какая БД под ним.
+
+const (
+	dialectSQLite   = "sqlite"
+	dialectPostgres = "postgres"
+)
+
+type dbDialect interface {
+	Name() string
+	Open() gorm.Dialector
+	// RandomOrder — выражение для ORDER BY в случайном порядке.
+	RandomOrder() string
+	// Like — оператор регистронезависимого поиска по подстроке.
+	Like() string
+	SupportsFTS5() bool
+	Vacuum(db *gorm.DB) error
+	// Backup пишет полную копию БД в файл dest.
+	Backup(db *gorm.DB, dest string) error
+	BackupExt() string
+}
+
+// newDBDialect выбирает диалект по DSN: postgres:// и key=value строки — Postgres,
+// всё остальное считается путем к файлу SQLite.
+func newDBDialect(dsn string) dbDialect {
+	dsn = strings.TrimSpace(dsn)
+	low := strings.ToLower(dsn)
+	if strings.HasPrefix(low, "postgres://") || strings.HasPrefix(low, "postgresql://") || strings.Contains(low, "host=") {
+		return postgresDialect{dsn: dsn}
+	}
+	path := strings.TrimPrefix(dsn, "sqlite://")
+	if path == "" {
+		path = dbFilePath
+	}
+	return sqliteDialect{path: path}
+}
+
+// resolveDBDSN возвращает строку подключения основной БД: OPHELIA_DB_DSN, затем db_dsn из конфига.
+func resolveDBDSN(cfg Config) string {
+	if v := strings.TrimSpace(os.Getenv("OPHELIA_DB_DSN")); v != "" {
+		return v
+	}
+	if v := strings.TrimSpace(cfg.DBDSN); v != "" {
+		return v
+	}
+	return dbFilePath
+}
+
+// ------------------------------------------
+// SQLite
+// ------------------------------------------
+
+type sqliteDialect struct {
+	path string
+}
+
+func (d sqliteDialect) Name() string { return dialectSQLite }
+
+func (d sqliteDialect) Open() gorm.Dialector {
+	return sqlite.Open(fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)", d.path))
+}
+
+func (d sqliteDialect) RandomOrder() string { return "RANDOM()" }
+
+func (d sqliteDialect) Like() string { return "LIKE" }
+
+func (d sqliteDialect) SupportsFTS5() bool { return true }
+
+func (d sqliteDialect) Vacuum(db *gorm.DB) error {
+	return db.Exec("VACUUM").Error
+}
+
+// Backup делает VACUUM INTO: согласованная и сжатая копия с учетом WAL.
+func (d sqliteDialect) Backup(db *gorm.DB, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return db.Exec("VACUUM INTO ?", dest).Error
+}
+
+func (d sqliteDialect) BackupExt() string { return ".db" }
+
+// ------------------------------------------
+// Postgres
+// ------------------------------------------
+
+type postgresDialect struct {
+	dsn string
+}
+
+func (d postgresDialect) Name() string { return dialectPostgres }
+
+func (d postgresDialect) Open() gorm.Dialector { return postgres.Open(d.dsn) }
+
+func (d postgresDialect) RandomOrder() string { return "random()" }
+
+func (d postgresDialect) Like() string { return "ILIKE" }
+
+func (d postgresDialect) SupportsFTS5() bool { return false }
+
+func (d postgresDialect) Vacuum(db *gorm.DB) error {
+	return db.Exec("VACUUM ANALYZE").Error
+}
+
+// Backup вызывает pg_dump в custom-формате (восстановление через pg_restore).
+func (d postgresDialect) Backup(_ *gorm.DB, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "pg_dump", "--format=custom", "--no-owner", "--file="+dest, "--dbname="+d.dsn).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pg_dump: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (d postgresDialect) BackupExt() string { return ".dump" }
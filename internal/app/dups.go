@@ -0,0 +1,318 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// ==========================================
+// НЕЧЕТКИЙ ПОИСК ДУБЛИКАТОВ
+// ==========================================
+
+// Имена сравниваются по «фонетическим ключам»: слова переводятся в латиницу
+// (judgeTokens), затем сглаживаются различия написания (c/k, w/v, ie/ya,
+// окончания на гласную). Так «Мария Кюри», «Мария Склодовская-Кюри» и
+// «Marie Curie» сходятся. Оценка складывается из доли общих частей имени,
+// расстояния Левенштейна между ключами и пересечения годов жизни.
+
+const (
+	cbDupPrefix      = "dup_"
+	dupThreshold     = 0.7
+	dupListLimit     = 10
+	dupSuggestLimit  = 3
+	dupPhoneticShort = 3
+)
+
+type dupMatch struct {
+	A, B    Woman
+	Score   float64
+	Reasons []string
+}
+
+// порядок важен: сначала длинные сочетания
+var dupPhoneticReplacer = strings.NewReplacer(
+	"shch", "sh", "sch", "sh", "ph", "f", "ck", "k", "kh", "h", "x", "ks",
+	"yu", "u", "ya", "a", "yo", "o", "ye", "e", "ie", "i", "ee", "i", "ou", "u",
+	"c", "k", "q", "k", "w", "v", "y", "i", "j", "i",
+)
+
+// phoneticKey сглаживает варианты латинского написания одного и того же имени.
+func phoneticKey(word string) string {
+	s := dupPhoneticReplacer.Replace(word)
+	var sb strings.Builder
+	var prev rune
+	for _, r := range s {
+		if r != prev {
+			sb.WriteRune(r)
+		}
+		prev = r
+	}
+	out := sb.String()
+	for len(out) > dupPhoneticShort && strings.ContainsRune("aeiou", rune(out[len(out)-1])) {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+func nameKeys(name string) []string {
+	var out []string
+	for _, t := range judgeTokens(name) {
+		if k := phoneticKey(t); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// dupSimilarity — оценка 0..1 того, что a и b — один человек, и ее объяснение.
+func dupSimilarity(a, b *Woman) (float64, []string) {
+	return keysSimilarity(nameKeys(a.Name), nameKeys(b.Name), a, b)
+}
+
+func keysSimilarity(ka, kb []string, a, b *Woman) (float64, []string) {
+	if len(ka) == 0 || len(kb) == 0 {
+		return 0, nil
+	}
+	var reasons []string
+	used := make([]bool, len(kb))
+	matched := 0
+	for _, x := range ka {
+		for j, y := range kb {
+			if !used[j] && (x == y || (runeLen(x) > dupPhoneticShort && fuzzyEqual(x, y))) {
+				used[j] = true
+				matched++
+				break
+			}
+		}
+	}
+	short, long := len(ka), len(kb)
+	if short > long {
+		short, long = long, short
+	}
+	overlap := (float64(matched)/float64(short) + float64(matched)/float64(long)) / 2
+	if matched > 0 {
+		reasons = append(reasons, fmt.Sprintf("общие части имени %d/%d", matched, long))
+	}
+
+	sa, sb := append([]string(nil), ka...), append([]string(nil), kb...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	ja, jb := strings.Join(sa, " "), strings.Join(sb, " ")
+	maxLen := runeLen(ja)
+	if n := runeLen(jb); n > maxLen {
+		maxLen = n
+	}
+	edit := 1 - float64(levenshtein(ja, jb))/float64(maxLen)
+	if ja == jb && normalizeNameForDup(a.Name) != normalizeNameForDup(b.Name) {
+		reasons = append(reasons, "то же имя в другом написании")
+	}
+
+	score := 0.7*overlap + 0.3*edit
+	if a.YearFrom != 0 && b.YearFrom != 0 {
+		switch {
+		case a.YearFrom == b.YearFrom && a.YearTo == b.YearTo:
+			score += 0.15
+			reasons = append(reasons, "годы совпадают")
+		case yearsOf(a).overlaps(yearsOf(b)):
+			score += 0.05
+			reasons = append(reasons, "годы пересекаются")
+		default:
+			score -= 0.4
+			reasons = append(reasons, "годы не пересекаются")
+		}
+	}
+	if score > 1 {
+		score = 1
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score, reasons
+}
+
+type yearSpan struct{ From, To int }
+
+func yearsOf(w *Woman) yearSpan {
+	s := yearSpan{w.YearFrom, w.YearTo}
+	if s.To == 0 {
+		s.To = s.From
+	}
+	return s
+}
+
+func (s yearSpan) overlaps(o yearSpan) bool {
+	return s.From <= o.To && o.From <= s.To
+}
+
+// findDuplicatePairs сравнивает карточки с общим началом хотя бы одного ключа
+// и возвращает пары с оценкой не ниже порога, лучшие — первыми.
+func findDuplicatePairs(women []Woman, limit int) []dupMatch {
+	keys := make([][]string, len(women))
+	blocks := map[string][]int{}
+	for i := range women {
+		keys[i] = nameKeys(women[i].Name)
+		seen := map[string]bool{}
+		for _, k := range keys[i] {
+			p := k
+			if r := []rune(k); len(r) > dupPhoneticShort {
+				p = string(r[:dupPhoneticShort])
+			}
+			if !seen[p] {
+				seen[p] = true
+				blocks[p] = append(blocks[p], i)
+			}
+		}
+	}
+	type pair struct{ i, j int }
+	checked := map[pair]bool{}
+	var out []dupMatch
+	for _, idx := range blocks {
+		for x := 0; x < len(idx); x++ {
+			for y := x + 1; y < len(idx); y++ {
+				p := pair{idx[x], idx[y]}
+				if checked[p] {
+					continue
+				}
+				checked[p] = true
+				a, b := &women[p.i], &women[p.j]
+				if score, reasons := keysSimilarity(keys[p.i], keys[p.j], a, b); score >= dupThreshold {
+					if a.ID > b.ID {
+						a, b = b, a
+					}
+					out = append(out, dupMatch{A: *a, B: *b, Score: score, Reasons: reasons})
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].A.ID < out[j].A.ID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// findSimilarWomen — карточки, похожие на вводимое имя (B в результате — найденная карточка).
+func (wm *WomanManager) findSimilarWomen(name string, publishedOnly bool, limit int) []dupMatch {
+	probe := Woman{Name: name}
+	keys := nameKeys(name)
+	if len(keys) == 0 {
+		return nil
+	}
+	var women []Woman
+	q := wm.DB.Select("id", "name", "year", "year_from", "year_to", "field", "is_published")
+	if publishedOnly {
+		q = q.Where("is_published = ?", true)
+	}
+	q.Find(&women)
+	var out []dupMatch
+	for i := range women {
+		if score, reasons := keysSimilarity(keys, nameKeys(women[i].Name), &probe, &women[i]); score >= dupThreshold {
+			out = append(out, dupMatch{A: probe, B: women[i], Score: score, Reasons: reasons})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// ------------------------------------------
+// Бот
+// ------------------------------------------
+
+func dupWomanLabel(w Woman) string {
+	s := fmt.Sprintf("#%d %s", w.ID, html.EscapeString(w.Name))
+	if w.Year != "" {
+		s += " (" + html.EscapeString(w.Year) + ")"
+	}
+	return s
+}
+
+func HandleDuplicates(c tele.Context) error {
+	if c.Sender() == nil || !isAdmin(c.Sender().ID) {
+		return nil
+	}
+	var women []Woman
+	womanManager.DB.Select("id", "name", "year", "year_from", "year_to", "field").Find(&women)
+	if len(women) == 0 {
+		return c.Reply("Записей нет.", tele.ModeHTML)
+	}
+	pairs := findDuplicatePairs(women, dupListLimit)
+	if len(pairs) == 0 {
+		return c.Reply("Дубликатов не найдено.", tele.ModeHTML)
+	}
+	var sb strings.Builder
+	sb.WriteString("🔁 <b>Возможные дубликаты</b>\nКнопка оставляет указанную карточку, вторая уходит в корзину.\n\n")
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	for i, p := range pairs {
+		sb.WriteString(fmt.Sprintf("%d. %s\n   %s\n   %.0f%%: %s\n", i+1, dupWomanLabel(p.A), dupWomanLabel(p.B), p.Score*100, strings.Join(p.Reasons, ", ")))
+		rows = append(rows, m.Row(
+			m.Data(fmt.Sprintf("%d. ⬅️ #%d", i+1, p.A.ID), fmt.Sprintf("%smerge_%d_%d", cbDupPrefix, p.A.ID, p.B.ID)),
+			m.Data(fmt.Sprintf("%d. ➡️ #%d", i+1, p.B.ID), fmt.Sprintf("%smerge_%d_%d", cbDupPrefix, p.B.ID, p.A.ID)),
+		))
+	}
+	m.Inline(rows...)
+	return c.Reply(sb.String(), m, tele.ModeHTML)
+}
+
+// handleDupCallback: dup_merge_<keep>_<remove> — слияние в одно касание (отменяется через /restore).
+func handleDupCallback(c tele.Context, data string) error {
+	userID := c.Sender().ID
+	if !isAdmin(userID) {
+		return c.Respond()
+	}
+	parts := strings.Split(strings.TrimPrefix(data, cbDupPrefix), "_")
+	if len(parts) != 3 || parts[0] != "merge" {
+		return c.Respond()
+	}
+	keepID, _ := strconv.ParseUint(parts[1], 10, 64)
+	removeID, _ := strconv.ParseUint(parts[2], 10, 64)
+	if keepID == 0 || removeID == 0 || keepID == removeID {
+		return c.Respond()
+	}
+	if err := mergeWomen(uint(keepID), uint(removeID), userID); err != nil {
+		return c.Respond(&tele.CallbackResponse{Text: "Ошибка слияния: " + err.Error(), ShowAlert: true})
+	}
+	logModAction(userID, "merge", fmt.Sprintf("%d/%d", keepID, removeID), "dups")
+	c.Respond(&tele.CallbackResponse{Text: "Слияние завершено."})
+	return c.Send(fmt.Sprintf("🔗 #%d слита в #%d. Вернуть: /restore %d", removeID, keepID, removeID), tele.ModeHTML)
+}
+
+// warnSimilarNames показывает похожие карточки на шаге ввода имени.
+// Участнику — только опубликованные, персоналу — все, с кнопкой открыть карточку.
+func warnSimilarNames(c tele.Context, name string) {
+	staff := isStaff(c.Sender().ID)
+	matches := womanManager.findSimilarWomen(name, !staff, dupSuggestLimit)
+	if len(matches) == 0 {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("⚠️ Похожие записи уже есть в архиве:\n")
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	for _, p := range matches {
+		sb.WriteString(fmt.Sprintf("• %s — %.0f%%\n", dupWomanLabel(p.B), p.Score*100))
+		if staff {
+			rows = append(rows, m.Row(m.Data(fmt.Sprintf("✏️ Открыть #%d", p.B.ID), fmt.Sprintf("select_edit_%d", p.B.ID))))
+		}
+	}
+	sb.WriteString("Если это тот же человек, лучше дополнить существующую запись.")
+	if len(rows) == 0 {
+		_ = c.Send(sb.String(), tele.ModeHTML)
+		return
+	}
+	m.Inline(rows...)
+	_ = c.Send(sb.String(), m, tele.ModeHTML)
+}
@@ -0,0 +1,57 @@
+package app
+
+import "testing"
+
+func TestDupSimilarity(t *testing.T) {
+	curie := &Woman{Name: "Мария Кюри", YearFrom: 1867, YearTo: 1934}
+	cases := []struct {
+		other *Woman
+		dup   bool
+	}{
+		{&Woman{Name: "Marie Curie"}, true},
+		{&Woman{Name: "Мария Склодовская-Кюри", YearFrom: 1867, YearTo: 1934}, true},
+		{&Woman{Name: "Мари Кюри"}, true},
+		{&Woman{Name: "Мария Кюри", YearFrom: 1940, YearTo: 1990}, false},
+		{&Woman{Name: "Мария Каллас"}, false},
+		{&Woman{Name: "Мария"}, false},
+		{&Woman{Name: "Ирен Жолио-Кюри", YearFrom: 1897, YearTo: 1956}, false},
+	}
+	for _, tc := range cases {
+		score, reasons := dupSimilarity(curie, tc.other)
+		if (score >= dupThreshold) != tc.dup {
+			t.Errorf("%s: score %.2f (%v), want dup=%v", tc.other.Name, score, reasons, tc.dup)
+		}
+	}
+	if phoneticKey("sklodowska") != phoneticKey("sklodovskaya") {
+		t.Fatal("spelling variants must share a key")
+	}
+}
+
+func TestFindDuplicatePairs(t *testing.T) {
+	wm := newTestWomanManager(t)
+	women := []*Woman{
+		{Name: "Мария Кюри", Year: "1867–1934", IsPublished: true},
+		{Name: "Ада Лавлейс", IsPublished: true},
+		{Name: "Marie Curie", Year: "1867–1934"},
+		{Name: "Мария Склодовская-Кюри", IsPublished: true},
+	}
+	for _, w := range women {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var all []Woman
+	wm.DB.Find(&all)
+	pairs := findDuplicatePairs(all, 0)
+	if len(pairs) != 3 {
+		t.Fatalf("expected 3 pairs among the Curie cards, got %+v", pairs)
+	}
+	if p := pairs[0]; p.A.ID != women[0].ID || p.B.ID != women[2].ID {
+		t.Fatalf("same name with same years must rank first: %+v", p)
+	}
+
+	similar := wm.findSimilarWomen("мари кюри", true, 5)
+	if len(similar) != 2 {
+		t.Fatalf("published lookalikes only: %+v", similar)
+	}
+}
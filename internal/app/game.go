@@ -1,34 +1,18 @@
 package app
 
 import (
-	"bytes"
+	"context"
 	"crypto/rand"
-	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"html"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	tele "gopkg.in/telebot.v3"
-)
-
-// ==========================================
-// КОНФИГУРАЦИЯ GIGACHAT
-// ==========================================
-
-const (
-	GigaAuthURL = "https://ngw.devices.sberbank.ru:9443/api/v2/oauth"
-	GigaChatURL = "https://gigachat.devices.sberbank.ru/api/v1/chat/completions"
-	Scope       = "GIGACHAT_API_PERS"
+	"gorm.io/gorm"
 )
 
 // ==========================================
@@ -39,6 +23,8 @@ type GlobalGameStats struct {
 	Leaderboard map[int64]int    `json:"leaderboard"`
 	PlayerNames map[int64]string `json:"player_names"`
 	History     []RiddleHistory  `json:"history"`
+	// ChatLeaderboard — победы по чатам: chatID -> userID -> число побед
+	ChatLeaderboard map[int64]map[int64]int `json:"chat_leaderboard"`
 }
 
 type RiddleHistory struct {
@@ -47,79 +33,63 @@ type RiddleHistory struct {
 	Description string `json:"description"`
 	WinnerName  string `json:"winner_name"`
 	WinnerID    int64  `json:"winner_id"`
+	ChatID      int64  `json:"chat_id,omitempty"`
 }
 
+// GameState — одна игра в одном чате. Пока админ настраивает игру, она лежит
+// в черновиках (по ID админа), после старта — в Sessions (по ID чата).
 type GameState struct {
+	ChatID      int64
 	IsActive    bool
 	Mode        string
 	PhotoID     string
 	Answer      string
 	Description string // В режиме Картина - это скрытый контекст. В Цитатах/Описании - это текст загадки.
 	StartTime   time.Time
+	Timeout     time.Duration
+	StartedBy   int64
 }
 
-type GameManager struct {
-	mu           sync.Mutex
-	State        GameState
-	Stats        GlobalGameStats
-	AuthKey      string
-	AccessToken  string
-	TokenExpires time.Time
-	HttpClient   *http.Client
-}
-
-type GigaChatRequest struct {
-	Model       string    `json:"model"`
-	Messages    []GigaMsg `json:"messages"`
-	Temperature float64   `json:"temperature"`
+// Expired — истекло ли время на отгадку.
+func (s GameState) Expired(now time.Time) bool {
+	return s.IsActive && s.Timeout > 0 && now.Sub(s.StartTime) >= s.Timeout
 }
 
-type GigaMsg struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
+const defaultGameTimeout = 30 * time.Minute
 
-type GigaChatResponse struct {
-	Choices []struct {
-		Message GigaMsg `json:"message"`
-	} `json:"choices"`
-}
-
-type GigaTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	ExpiresAt   int64  `json:"expires_at"`
+type GameManager struct {
+	mu       sync.Mutex
+	Sessions map[int64]*GameState // активные игры по ID чата
+	drafts   map[int64]*GameState // настраиваемые игры по ID админа
+	Stats    GlobalGameStats
+	// Judge проверяет неточные ответы (GigaChat, OpenAI-совместимый API или офлайн).
+	Judge GuessJudge
+
+	// Запись в БД пачками (см. stats_store.go)
+	db             *gorm.DB
+	dirtyScores    map[scoreKey]bool
+	pendingRiddles []RiddleRecord
 }
 
 // ==========================================
 // ИНИЦИАЛИЗАЦИЯ
 // ==========================================
 
-func InitGame(apiKey string) (*GameManager, error) {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// InitGame создает менеджер игр. db == nil — статистика только в памяти.
+func InitGame(judge GuessJudge, db *gorm.DB) *GameManager {
+	if judge == nil {
+		judge = offlineJudge{}
 	}
-	client := &http.Client{Transport: tr, Timeout: 60 * time.Second}
-
 	gm := &GameManager{
-		AuthKey:    apiKey,
-		HttpClient: client,
-		Stats: GlobalGameStats{
-			Leaderboard: make(map[int64]int),
-			PlayerNames: make(map[int64]string),
-			History:     make([]RiddleHistory, 0),
-		},
+		Judge:       judge,
+		Sessions:    make(map[int64]*GameState),
+		drafts:      make(map[int64]*GameState),
+		Stats:       newGlobalGameStats(),
+		db:          db,
+		dirtyScores: make(map[scoreKey]bool),
 	}
-
-	var initErr error
-	if apiKey == "" {
-		initErr = fmt.Errorf("GigaChat API ключ не задан")
-	} else if err := gm.refreshToken(); err != nil {
-		initErr = err
-		log.Printf("⚠️ Ошибка авторизации GigaChat при старте (повторим позже): %v", err)
-	}
-
 	gm.loadStats()
-	return gm, initErr
+	return gm
 }
 
 func generateUUID() string {
@@ -130,286 +100,264 @@ func generateUUID() string {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
 
-func (gm *GameManager) refreshToken() error {
-	// Если токен есть и не истек, не обновляем
-	if gm.AccessToken != "" && time.Now().Before(gm.TokenExpires) {
-		return nil
-	}
-	if strings.TrimSpace(gm.AuthKey) == "" {
-		return fmt.Errorf("GigaChat API ключ не задан")
-	}
-
-	payload := url.Values{}
-	payload.Set("scope", Scope)
-
-	req, err := http.NewRequest("POST", GigaAuthURL, strings.NewReader(payload.Encode()))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("RqUID", generateUUID())
-	req.Header.Set("Authorization", "Basic "+gm.AuthKey)
-
-	resp, err := gm.HttpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var tokenResp GigaTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return err
-	}
-
-	gm.AccessToken = tokenResp.AccessToken
-	gm.TokenExpires = time.Unix(tokenResp.ExpiresAt/1000, 0).Add(-1 * time.Minute)
-	return nil
-}
-
 // ==========================================
-// НАСТРОЙКА ИГРЫ
+// НАСТРОЙКА ИГРЫ (ЧЕРНОВИК АДМИНА)
 // ==========================================
 
-func (gm *GameManager) SetupGameMode(mode string) {
+func (gm *GameManager) SetupGameMode(adminID int64, mode string) {
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
-	gm.State = GameState{IsActive: false, Mode: mode}
+	gm.drafts[adminID] = &GameState{Mode: mode, Timeout: defaultGameTimeout, StartedBy: adminID}
 }
 
-func (gm *GameManager) SetGamePhoto(fileID string) {
+func (gm *GameManager) withDraft(adminID int64, fn func(d *GameState)) bool {
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
-	gm.State.PhotoID = fileID
+	d, ok := gm.drafts[adminID]
+	if !ok {
+		return false
+	}
+	fn(d)
+	return true
 }
 
-func (gm *GameManager) SetGameAnswer(answer string) {
-	gm.mu.Lock()
-	defer gm.mu.Unlock()
-	gm.State.Answer = strings.TrimSpace(answer)
+func (gm *GameManager) SetGamePhoto(adminID int64, fileID string) bool {
+	return gm.withDraft(adminID, func(d *GameState) { d.PhotoID = fileID })
 }
 
-func (gm *GameManager) SetGameContext(context string) {
-	gm.mu.Lock()
-	defer gm.mu.Unlock()
-	gm.State.Description = context
+func (gm *GameManager) SetGameAnswer(adminID int64, answer string) bool {
+	return gm.withDraft(adminID, func(d *GameState) { d.Answer = strings.TrimSpace(answer) })
+}
+
+func (gm *GameManager) SetGameContext(adminID int64, context string) bool {
+	return gm.withDraft(adminID, func(d *GameState) { d.Description = context })
+}
+
+func (gm *GameManager) SetGameTimeout(adminID int64, timeout time.Duration) bool {
+	return gm.withDraft(adminID, func(d *GameState) { d.Timeout = timeout })
 }
 
 // ==========================================
 // СТАРТ ИГРЫ
 // ==========================================
 
-func (gm *GameManager) StartGameFromState(bot *tele.Bot, targetChatID int64) error {
+// StartGame запускает черновик админа в чате targetChatID. В одном чате — одна игра.
+func (gm *GameManager) StartGame(bot *tele.Bot, adminID, targetChatID int64) error {
+	// Под блокировкой только проверяем и занимаем чат: сетевые вызовы к Telegram
+	// не должны держать gm.mu и тормозить игры во всех остальных чатах.
 	gm.mu.Lock()
-	defer gm.mu.Unlock()
-
-	if gm.State.Mode == "" {
+	draft, ok := gm.drafts[adminID]
+	if !ok || draft.Mode == "" {
+		gm.mu.Unlock()
 		return fmt.Errorf("режим игры не установлен")
 	}
+	if cur, ok := gm.Sessions[targetChatID]; ok && cur.IsActive && !cur.Expired(time.Now()) {
+		gm.mu.Unlock()
+		return fmt.Errorf("в этом чате уже идет игра")
+	}
+	if draft.Mode == "painting" && draft.PhotoID == "" {
+		gm.mu.Unlock()
+		return fmt.Errorf("фото не загружено")
+	}
 
-	gm.State.IsActive = true
-	gm.State.StartTime = time.Now()
-
-	targetChat := &tele.Chat{ID: targetChatID}
-	var err error
+	game := *draft
+	game.ChatID = targetChatID
+	game.IsActive = true
+	game.StartTime = time.Now()
+	gm.Sessions[targetChatID] = &game
+	delete(gm.drafts, adminID)
+	gm.mu.Unlock()
 
-	switch gm.State.Mode {
+	var what interface{}
+	switch game.Mode {
 	case "painting":
-		if gm.State.PhotoID != "" {
-			photo := &tele.Photo{
-				File:    tele.File{FileID: gm.State.PhotoID},
-				Caption: "🖼 <b>Внимание, знатоки!</b>\n\nОфелия открывает глаза...\nУгадайте, что изображено на этой картине?",
-			}
-			_, err = bot.Send(targetChat, photo, tele.ModeHTML)
-		} else {
-			err = fmt.Errorf("фото не загружено")
+		what = &tele.Photo{
+			File:    tele.File{FileID: game.PhotoID},
+			Caption: "🖼 <b>Внимание, знатоки!</b>\n\nОфелия открывает глаза...\nУгадайте, что изображено на этой картине?",
 		}
-
 	case "mode_quotes":
-		text := fmt.Sprintf("💬 <b>Чья это цитата?</b>\n\n<i>«%s»</i>\n\nУгадайте автора или произведение.", html.EscapeString(gm.State.Description))
-		_, err = bot.Send(targetChat, text, tele.ModeHTML)
-
+		what = fmt.Sprintf("💬 <b>Чья это цитата?</b>\n\n<i>«%s»</i>\n\nУгадайте автора или произведение.", html.EscapeString(game.Description))
 	case "mode_desc":
-		text := fmt.Sprintf("📝 <b>Загадка от Офелии:</b>\n\n%s\n\nЧто или кто это?", html.EscapeString(gm.State.Description))
-		_, err = bot.Send(targetChat, text, tele.ModeHTML)
-
+		what = fmt.Sprintf("📝 <b>Загадка от Офелии:</b>\n\n%s\n\nЧто или кто это?", html.EscapeString(game.Description))
 	default:
-		_, err = bot.Send(targetChat, "🎭 <b>Внимание!</b>\nЯ загадала новую загадку.", tele.ModeHTML)
+		what = "🎭 <b>Внимание!</b>\nЯ загадала новую загадку."
 	}
 
-	if err != nil {
+	targetChat := &tele.Chat{ID: targetChatID}
+	if _, err := bot.Send(targetChat, what, tele.ModeHTML); err != nil {
 		log.Printf("Ошибка отправки старта: %v", err)
+		// Освобождаем чат и возвращаем черновик, если их никто не успел занять
+		gm.mu.Lock()
+		if gm.Sessions[targetChatID] == &game {
+			delete(gm.Sessions, targetChatID)
+		}
+		if _, ok := gm.drafts[adminID]; !ok {
+			gm.drafts[adminID] = draft
+		}
+		gm.mu.Unlock()
 		return err
 	}
 
 	taskText := "<i>Вы можете задавать вопросы или предлагать ответы.\nПобедит тот, кто первым назовет верный ответ.</i>"
+	if game.Timeout > 0 {
+		taskText += fmt.Sprintf("\n<i>На отгадку: %s.</i>", formatDuration(game.Timeout))
+	}
 	bot.Send(targetChat, taskText, tele.ModeHTML)
 
 	return nil
 }
 
-func (gm *GameManager) StopGame() {
+// StopGame останавливает игру в чате и возвращает ее состояние.
+func (gm *GameManager) StopGame(chatID int64) (GameState, bool) {
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
-	gm.State.IsActive = false
+	game, ok := gm.Sessions[chatID]
+	if !ok || !game.IsActive {
+		return GameState{}, false
+	}
+	delete(gm.Sessions, chatID)
+	game.IsActive = false
+	return *game, true
 }
 
-func (gm *GameManager) IsActive() bool {
+func (gm *GameManager) IsActive(chatID int64) bool {
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
-	return gm.State.IsActive
+	game, ok := gm.Sessions[chatID]
+	return ok && game.IsActive && !game.Expired(time.Now())
 }
 
-func (gm *GameManager) Snapshot() GameState {
+func (gm *GameManager) Snapshot(chatID int64) GameState {
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
-	return gm.State
+	if game, ok := gm.Sessions[chatID]; ok {
+		return *game
+	}
+	return GameState{}
 }
 
-// ==========================================
-// ПРОВЕРКА ОТВЕТА (С ГИБРИДНОЙ ЛОГИКОЙ)
-// ==========================================
-
-func (gm *GameManager) CheckGuess(userGuess string, user *tele.User) (bool, string, error) {
+// ActiveGames возвращает копии активных игр, отсортированные по времени старта.
+func (gm *GameManager) ActiveGames() []GameState {
 	gm.mu.Lock()
-	// Делаем копии данных, чтобы не держать лок во время запроса
-	correctAnswer := gm.State.Answer
-	adminContext := gm.State.Description
-	isActive := gm.State.IsActive
-	currentMode := gm.State.Mode
-
-	// 1. БЫСТРАЯ ПРОВЕРКА (БЕЗ НЕЙРОСЕТИ)
-	// Если игрок ввел точный ответ (регистр не важен), засчитываем победу сразу.
-	// Это решает 90% проблем с тем, что AI "тупит".
-	if isActive && strings.EqualFold(strings.TrimSpace(userGuess), correctAnswer) {
-		gm.mu.Unlock() // Разблокируем перед записью победы (recordWin сам возьмет лок)
-		return gm.recordWin(user, correctAnswer, adminContext, "Великолепно! Абсолютно точный ответ.")
+	defer gm.mu.Unlock()
+	out := make([]GameState, 0, len(gm.Sessions))
+	for _, game := range gm.Sessions {
+		if game.IsActive {
+			out = append(out, *game)
+		}
 	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartTime.Before(out[j].StartTime) })
+	return out
+}
 
-	// Обновляем токен
-	if err := gm.refreshToken(); err != nil {
-		gm.mu.Unlock()
-		return false, "⚠️ Мозг Офелии затуманен (ошибка сети)...", err
+// ExpireGames закрывает игры с истекшим временем и объявляет ответ в чате.
+func (gm *GameManager) ExpireGames(bot *tele.Bot) {
+	now := time.Now()
+	var expired []GameState
+	gm.mu.Lock()
+	for chatID, game := range gm.Sessions {
+		if game.Expired(now) {
+			expired = append(expired, *game)
+			delete(gm.Sessions, chatID)
+		}
 	}
-	token := gm.AccessToken
 	gm.mu.Unlock()
 
-	if !isActive {
-		return false, "", nil
+	for _, game := range expired {
+		log.Printf("⌛ Игра в чате %d завершена по таймауту", game.ChatID)
+		if bot == nil {
+			continue
+		}
+		text := fmt.Sprintf("⌛ <b>Время вышло.</b>\nНикто не разгадал загадку. Ответ: <b>%s</b>", html.EscapeString(game.Answer))
+		if _, err := bot.Send(&tele.Chat{ID: game.ChatID}, text, tele.ModeHTML); err != nil {
+			log.Printf("⚠️ Ошибка отправки итогов игры в чат %d: %v", game.ChatID, err)
+		}
 	}
+}
 
-	// 2. ПРОВЕРКА ЧЕРЕЗ GIGACHAT (Для неточных ответов и синонимов)
-	systemPrompt := fmt.Sprintf(`
-    ТВОЯ РОЛЬ: Ты Офелия, ведущая викторины. Твой стиль: загадочный, немного меланхоличный, но дружелюбный.
-    
-    ИГРОВОЙ КОНТЕКСТ: "%s"
-    ПРАВИЛЬНЫЙ ОТВЕТ: "%s"
-    РЕЖИМ: %s
-    ГИПОТЕЗА ИГРОКА: "%s"
-
-    ИНСТРУКЦИЯ:
-    1. Если Гипотеза совпадает с Правильным ответом по смыслу, является синонимом, частью имени или содержит ключевые слова -> ВЕРНИ STATUS: WIN. (НЕ БУДЬ ДУШНИЛОЙ! Если близко - засчитывай).
-    2. Если Гипотеза неверна, но близка -> ВЕРНИ STATUS: HINT и дай подсказку.
-    3. Если совсем мимо -> ВЕРНИ STATUS: WRONG.
-    4. Если это не ответ, а просто болтовня -> ВЕРНИ STATUS: CHAT.
-
-    ФОРМАТ ОТВЕТА:
-    STATUS: [WIN | WRONG | HINT | CHAT]
-    REPLY: [Твой текст]
-    `, adminContext, correctAnswer, currentMode, userGuess)
-
-	reqBody := GigaChatRequest{
-		Model:       "GigaChat",
-		Messages:    []GigaMsg{{Role: "user", Content: systemPrompt}},
-		Temperature: 0.4, // Повышаем температуру, чтобы модель была гибче
+// StartGameTimeoutLoop раз в минуту закрывает просроченные игры.
+func (gm *GameManager) StartGameTimeoutLoop(bot *tele.Bot) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		gm.ExpireGames(bot)
 	}
+}
 
-	jsonBody, _ := json.Marshal(reqBody)
-	req, _ := http.NewRequest("POST", GigaChatURL, bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
+// ==========================================
+// ПРОВЕРКА ОТВЕТА (С ГИБРИДНОЙ ЛОГИКОЙ)
+// ==========================================
 
-	resp, err := gm.HttpClient.Do(req)
-	if err != nil {
-		return false, "", err
+func (gm *GameManager) CheckGuess(chatID int64, userGuess string, user *tele.User) (bool, string, error) {
+	gm.mu.Lock()
+	game, ok := gm.Sessions[chatID]
+	if !ok || !game.IsActive || game.Expired(time.Now()) {
+		gm.mu.Unlock()
+		return false, "", nil
 	}
-	defer resp.Body.Close()
+	// Делаем копии данных, чтобы не держать лок во время запроса
+	correctAnswer := game.Answer
+	adminContext := game.Description
+	currentMode := game.Mode
+	judge := gm.Judge
+	gm.mu.Unlock()
 
-	var gigaResp GigaChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&gigaResp); err != nil {
-		return false, "", err
+	// 1. БЫСТРАЯ ПРОВЕРКА (БЕЗ НЕЙРОСЕТИ)
+	// Если игрок ввел точный ответ (регистр не важен), засчитываем победу сразу.
+	// Это решает 90% проблем с тем, что AI "тупит".
+	if strings.EqualFold(strings.TrimSpace(userGuess), correctAnswer) {
+		return gm.recordWin(chatID, user, correctAnswer, adminContext, "Великолепно! Абсолютно точный ответ.")
 	}
 
-	if len(gigaResp.Choices) == 0 {
-		return false, "", nil
+	// 2. ПРОВЕРКА ЧЕРЕЗ СУДЬЮ (Для неточных ответов и синонимов)
+	query := GuessQuery{Answer: correctAnswer, Context: adminContext, Mode: currentMode, Guess: userGuess}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	verdict, err := judge.Judge(ctx, query)
+	if err != nil {
+		// Сеть или модель недоступны — не оставляем игроков без ответа, решаем офлайн
+		log.Printf("⚠️ Судья %s недоступен, проверяю офлайн: %v", judge.Name(), err)
+		verdict, _ = offlineJudge{}.Judge(ctx, query)
 	}
 
-	aiRaw := strings.TrimSpace(gigaResp.Choices[0].Message.Content)
-
 	// ЛОГИРОВАНИЕ ДЛЯ ОТЛАДКИ (Смотрите в консоль!)
-	log.Printf("🤖 GigaChat Check:\nAnswer: %s\nGuess: %s\nAI Response: %s", correctAnswer, userGuess, aiRaw)
-
-	// Парсинг ответа
-	status := "CHAT"
-	reply := aiRaw
-
-	lines := strings.Split(aiRaw, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		upper := strings.ToUpper(line)
-
-		if strings.HasPrefix(upper, "STATUS:") {
-			// Убираем возможные звездочки (**STATUS**) или точки
-			cleanStatus := strings.TrimPrefix(upper, "STATUS:")
-			cleanStatus = strings.Trim(cleanStatus, " .*,!-_")
-			status = cleanStatus
-		} else if strings.HasPrefix(upper, "REPLY:") {
-			reply = strings.TrimSpace(strings.TrimPrefix(line, "REPLY:"))
-			if strings.HasPrefix(strings.ToUpper(reply), "REPLY:") {
-				reply = strings.TrimSpace(reply[6:])
-			}
-		} else if !strings.HasPrefix(upper, "STATUS:") && line != "" {
-			if reply == aiRaw {
-				reply = ""
-			}
-			reply += " " + line
-		}
-	}
-	reply = strings.TrimSpace(reply)
-	if reply == "" {
-		reply = "..."
-	}
+	log.Printf("🤖 Guess Check (%s, чат %d):\nAnswer: %s\nGuess: %s\nVerdict: %s %s", judge.Name(), chatID, correctAnswer, userGuess, verdict.Status, verdict.Reply)
 
 	// Обработка статусов
-	if strings.Contains(status, "WIN") {
-		return gm.recordWin(user, correctAnswer, adminContext, reply)
-	}
-
-	if strings.Contains(status, "WRONG") {
-		return false, fmt.Sprintf("🥀 %s", reply), nil
+	switch {
+	case verdict.Status == VerdictWin:
+		reply := "..."
+		if verdict.Reply != "" {
+			reply = html.EscapeString(verdict.Reply)
+		}
+		return gm.recordWin(chatID, user, correctAnswer, adminContext, reply)
+	case verdict.Reply == "":
+		return false, "", nil
+	case verdict.Status == VerdictWrong:
+		return false, fmt.Sprintf("🥀 %s", html.EscapeString(verdict.Reply)), nil
 	}
 
 	// CHAT / HINT
-	return false, fmt.Sprintf("🌊 %s", reply), nil
+	return false, fmt.Sprintf("🌊 %s", html.EscapeString(verdict.Reply)), nil
 }
 
 // Вспомогательная функция записи победы (вынесена, чтобы вызывать и из быстрой проверки)
-func (gm *GameManager) recordWin(user *tele.User, answer, context, reply string) (bool, string, error) {
+func (gm *GameManager) recordWin(chatID int64, user *tele.User, answer, context, reply string) (bool, string, error) {
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
 
-	if !gm.State.IsActive {
+	// Игра могла закончиться, пока судья думал: побеждает только первый
+	game, ok := gm.Sessions[chatID]
+	if !ok || !game.IsActive || game.Answer != answer {
 		return false, "", nil
 	}
 
-	gm.State.IsActive = false
+	delete(gm.Sessions, chatID)
 	gm.Stats.Leaderboard[user.ID]++
+	if gm.Stats.ChatLeaderboard[chatID] == nil {
+		gm.Stats.ChatLeaderboard[chatID] = make(map[int64]int)
+	}
+	gm.Stats.ChatLeaderboard[chatID][user.ID]++
 
 	displayName := "<Ник не задан>"
 	if user.Username != "" {
@@ -417,10 +365,13 @@ func (gm *GameManager) recordWin(user *tele.User, answer, context, reply string)
 	}
 	gm.Stats.PlayerNames[user.ID] = displayName
 
-	gm.Stats.History = append(gm.Stats.History, RiddleHistory{
-		Date: time.Now().Format("02.01 15:04"), Answer: answer, Description: context, WinnerName: user.FirstName, WinnerID: user.ID,
-	})
-	gm.saveStats()
+	record := RiddleHistory{
+		Date: time.Now().Format("02.01 15:04"), Answer: answer, Description: context, WinnerName: user.FirstName, WinnerID: user.ID, ChatID: chatID,
+	}
+	gm.Stats.History = append(gm.Stats.History, record)
+	gm.pendingRiddles = append(gm.pendingRiddles, riddleRecord(record))
+	gm.dirtyScores[scoreKey{UserID: user.ID}] = true
+	gm.dirtyScores[scoreKey{ChatID: chatID, UserID: user.ID}] = true
 
 	return true, reply, nil
 }
@@ -434,16 +385,23 @@ type PlayerScore struct {
 	Score int
 }
 
-func (gm *GameManager) GetTopPlayers() string {
+// GetTopPlayers возвращает топ чата chatID или общий топ, если chatID == 0.
+func (gm *GameManager) GetTopPlayers(chatID int64) string {
 	gm.mu.Lock()
 	defer gm.mu.Unlock()
 
-	if len(gm.Stats.Leaderboard) == 0 {
+	board := gm.Stats.Leaderboard
+	title := "🏆 <b>Топ знатоков:</b>\n\n"
+	if chatID != 0 {
+		board = gm.Stats.ChatLeaderboard[chatID]
+		title = "🏆 <b>Топ знатоков этого чата:</b>\n\n"
+	}
+	if len(board) == 0 {
 		return "Пока никто не спас Офелию."
 	}
 
 	var scores []PlayerScore
-	for id, score := range gm.Stats.Leaderboard {
+	for id, score := range board {
 		name, ok := gm.Stats.PlayerNames[id]
 		if !ok || name == "" {
 			name = fmt.Sprintf("ID %d", id)
@@ -455,7 +413,7 @@ func (gm *GameManager) GetTopPlayers() string {
 		return scores[i].Score > scores[j].Score
 	})
 
-	text := "🏆 <b>Топ знатоков:</b>\n\n"
+	text := title
 	for i, p := range scores {
 		if i >= 10 {
 			break
@@ -475,34 +433,52 @@ func (gm *GameManager) GetTopPlayers() string {
 	return text
 }
 
-func (gm *GameManager) loadStats() {
-	file, err := os.ReadFile(gameStatsFilePath)
-	if err != nil {
-		return
+func newGlobalGameStats() GlobalGameStats {
+	return GlobalGameStats{
+		Leaderboard:     make(map[int64]int),
+		PlayerNames:     make(map[int64]string),
+		History:         make([]RiddleHistory, 0),
+		ChatLeaderboard: make(map[int64]map[int64]int),
+	}
+}
+
+func (g *GlobalGameStats) ensureMaps() {
+	if g.Leaderboard == nil {
+		g.Leaderboard = make(map[int64]int)
 	}
-	json.Unmarshal(file, &gm.Stats)
-	if gm.Stats.Leaderboard == nil {
-		gm.Stats.Leaderboard = make(map[int64]int)
+	if g.PlayerNames == nil {
+		g.PlayerNames = make(map[int64]string)
 	}
-	if gm.Stats.PlayerNames == nil {
-		gm.Stats.PlayerNames = make(map[int64]string)
+	if g.ChatLeaderboard == nil {
+		g.ChatLeaderboard = make(map[int64]map[int64]int)
+		// До появления игр по чатам все игры шли в основном чате
+		if config.TargetChatID != 0 && len(g.Leaderboard) > 0 {
+			board := make(map[int64]int, len(g.Leaderboard))
+			for id, score := range g.Leaderboard {
+				board[id] = score
+			}
+			g.ChatLeaderboard[config.TargetChatID] = board
+		}
 	}
 }
 
-func (gm *GameManager) saveStats() {
-	// Ensure directory exists
-	dir := filepath.Dir(gameStatsFilePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		log.Printf("⚠️ Ошибка создания директории для статистики: %v", err)
+// loadStats читает статистику игры из БД; при пустых таблицах переносит туда gamestats.json.
+func (gm *GameManager) loadStats() {
+	if gm.db == nil {
 		return
 	}
-
-	data, _ := json.MarshalIndent(gm.Stats, "", "  ")
-	if err := os.WriteFile(gameStatsFilePath+".tmp", data, 0644); err != nil {
-		log.Printf("⚠️ Ошибка сохранения game stats: %v", err)
-		return
+	if err := migrateStatsTables(gm.db); err != nil {
+		log.Printf("⚠️ Ошибка миграции таблиц статистики: %v", err)
 	}
-	if err := os.Rename(gameStatsFilePath+".tmp", gameStatsFilePath); err != nil {
-		log.Printf("⚠️ Ошибка сохранения game stats (rename): %v", err)
+	gm.mu.Lock()
+	loaded := gm.loadFromDB()
+	imported := !loaded && gm.importLegacyJSON(gameStatsFilePath)
+	gm.mu.Unlock()
+	if imported {
+		if err := gm.Flush(); err != nil {
+			log.Printf("⚠️ Ошибка импорта статистики игры: %v", err)
+			return
+		}
+		markLegacyImported(gameStatsFilePath)
 	}
 }
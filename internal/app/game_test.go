@@ -0,0 +1,95 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// startTestGame кладет игру прямо в Sessions, минуя отправку в Telegram.
+func startTestGame(gm *GameManager, chatID int64, answer string) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.Sessions[chatID] = &GameState{ChatID: chatID, IsActive: true, Mode: "mode_desc", Answer: answer, StartTime: time.Now(), Timeout: defaultGameTimeout}
+}
+
+func TestGamesPerChat(t *testing.T) {
+	gm := InitGame(offlineJudge{}, nil)
+	startTestGame(gm, -100, "Мария Кюри")
+	startTestGame(gm, -200, "Ада Лавлейс")
+
+	alice := &tele.User{ID: 1, FirstName: "Alice"}
+	if win, _, _ := gm.CheckGuess(-200, "Кюри", alice); win {
+		t.Fatal("guess must be checked against the game of its own chat")
+	}
+	if win, _, _ := gm.CheckGuess(-100, "Кюри", alice); !win {
+		t.Fatal("expected a win in chat -100")
+	}
+	if gm.IsActive(-100) || !gm.IsActive(-200) {
+		t.Fatal("only the won game must stop")
+	}
+	if gm.Stats.ChatLeaderboard[-100][1] != 1 || gm.Stats.Leaderboard[1] != 1 || len(gm.Stats.ChatLeaderboard[-200]) != 0 {
+		t.Fatalf("unexpected leaderboards: %+v", gm.Stats)
+	}
+
+	gm.mu.Lock()
+	gm.Sessions[-200].StartTime = time.Now().Add(-2 * defaultGameTimeout)
+	gm.mu.Unlock()
+	if gm.IsActive(-200) {
+		t.Fatal("expired game must not accept guesses")
+	}
+	gm.ExpireGames(nil)
+	if len(gm.ActiveGames()) != 0 {
+		t.Fatal("expired game must be removed")
+	}
+}
+
+func TestStartGameSendsWithoutLock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+	}))
+	defer srv.Close()
+	bot, err := tele.NewBot(tele.Settings{Token: "test", URL: srv.URL, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gm := InitGame(offlineJudge{}, nil)
+	startTestGame(gm, -100, "Мария Кюри")
+	gm.SetupGameMode(1, "mode_desc")
+	gm.SetGameAnswer(1, "Ада Лавлейс")
+	done := make(chan error, 1)
+	go func() { done <- gm.StartGame(bot, 1, -200) }()
+
+	// Пока Telegram «думает», другие чаты не ждут блокировку
+	deadline := time.Now().Add(time.Second)
+	for !gm.IsActive(-200) {
+		if time.Now().After(deadline) {
+			t.Fatal("chat must be reserved before sending")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !gm.IsActive(-100) {
+		t.Fatal("other games must stay reachable")
+	}
+	gm.SetupGameMode(2, "mode_desc")
+	if err := gm.StartGame(bot, 2, -200); err == nil {
+		t.Fatal("second start in a reserved chat must fail")
+	}
+	close(release)
+
+	if err := <-done; err == nil {
+		t.Fatal("send error must be returned")
+	}
+	if gm.IsActive(-200) {
+		t.Fatal("failed start must free the chat")
+	}
+	if !gm.withDraft(1, func(*GameState) {}) {
+		t.Fatal("failed start must keep the draft")
+	}
+}
@@ -0,0 +1,497 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ==========================================
+// СУДЬИ ИГРЫ-ЗАГАДКИ
+// ==========================================
+
+// GuessJudge решает, засчитать ли ответ игрока. Реализации: GigaChat,
+// любой OpenAI-совместимый API (в т.ч. локальные llama.cpp / Ollama) и офлайн-судья.
+type GuessJudge interface {
+	Name() string
+	Judge(ctx context.Context, q GuessQuery) (GuessVerdict, error)
+}
+
+type GuessQuery struct {
+	Answer  string
+	Context string
+	Mode    string
+	Guess   string
+}
+
+const (
+	VerdictWin   = "WIN"
+	VerdictWrong = "WRONG"
+	VerdictHint  = "HINT"
+	VerdictChat  = "CHAT"
+)
+
+type GuessVerdict struct {
+	Status string
+	Reply  string
+}
+
+const (
+	judgeGigaChat = "gigachat"
+	judgeOpenAI   = "openai"
+	judgeOffline  = "offline"
+
+	GigaAuthURL = "https://ngw.devices.sberbank.ru:9443/api/v2/oauth"
+	GigaChatURL = "https://gigachat.devices.sberbank.ru/api/v1/chat/completions"
+	Scope       = "GIGACHAT_API_PERS"
+
+	defaultGigaChatModel    = "GigaChat"
+	defaultJudgeTemperature = 0.4
+)
+
+// newGuessJudge собирает судью по конфигу. Без явного game_judge используется
+// GigaChat при заданном ключе, иначе офлайн-судья.
+func newGuessJudge(cfg Config) (GuessJudge, error) {
+	provider := strings.ToLower(strings.TrimSpace(cfg.GameJudge))
+	if provider == "" {
+		provider = judgeOffline
+		if strings.TrimSpace(cfg.GoogleAPI) != "" {
+			provider = judgeGigaChat
+		}
+	}
+	temperature := defaultJudgeTemperature
+	if cfg.GameJudgeTemperature != nil {
+		temperature = *cfg.GameJudgeTemperature
+	}
+	// Сертификат GigaChat выдан НУЦ Минцифры и обычно отсутствует в системном хранилище,
+	// поэтому для него проверка TLS по умолчанию выключена (как и раньше).
+	insecure := provider == judgeGigaChat
+	if cfg.GameJudgeInsecureTLS != nil {
+		insecure = *cfg.GameJudgeInsecureTLS
+	}
+	client := newJudgeHTTPClient(insecure)
+
+	switch provider {
+	case judgeGigaChat, "giga", "sber":
+		key := strings.TrimSpace(cfg.GameJudgeAPIKey)
+		if key == "" {
+			key = strings.TrimSpace(cfg.GoogleAPI)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("GigaChat API ключ не задан")
+		}
+		j := newGigaChatJudge(key, client)
+		j.temperature = temperature
+		if m := strings.TrimSpace(cfg.GameJudgeModel); m != "" {
+			j.model = m
+		}
+		if u := strings.TrimSpace(cfg.GameJudgeURL); u != "" {
+			j.chatURL = u
+		}
+		return j, nil
+	case judgeOpenAI, "openai-compatible", "ollama", "llamacpp", "llama.cpp":
+		base := strings.TrimSpace(cfg.GameJudgeURL)
+		if base == "" {
+			return nil, fmt.Errorf("не задан game_judge_url для OpenAI-совместимого судьи")
+		}
+		model := strings.TrimSpace(cfg.GameJudgeModel)
+		if model == "" {
+			return nil, fmt.Errorf("не задана модель game_judge_model")
+		}
+		return &openAIJudge{
+			baseURL:     strings.TrimRight(base, "/"),
+			apiKey:      strings.TrimSpace(cfg.GameJudgeAPIKey),
+			model:       model,
+			temperature: temperature,
+			client:      client,
+		}, nil
+	case judgeOffline, "mock", "fuzzy":
+		return offlineJudge{}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный судья игры: %s", provider)
+	}
+}
+
+func newJudgeHTTPClient(insecure bool) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: tr, Timeout: 60 * time.Second}
+}
+
+// ==========================================
+// ПРОМПТ И РАЗБОР ОТВЕТА МОДЕЛИ
+// ==========================================
+
+func buildJudgePrompt(q GuessQuery) string {
+	return fmt.Sprintf(`
+    ТВОЯ РОЛЬ: Ты Офелия, ведущая викторины. Твой стиль: загадочный, немного меланхоличный, но дружелюбный.
+
+    ИГРОВОЙ КОНТЕКСТ: "%s"
+    ПРАВИЛЬНЫЙ ОТВЕТ: "%s"
+    РЕЖИМ: %s
+    ГИПОТЕЗА ИГРОКА: "%s"
+
+    ИНСТРУКЦИЯ:
+    1. Если Гипотеза совпадает с Правильным ответом по смыслу, является синонимом, частью имени или содержит ключевые слова -> ВЕРНИ STATUS: WIN. (НЕ БУДЬ ДУШНИЛОЙ! Если близко - засчитывай).
+    2. Если Гипотеза неверна, но близка -> ВЕРНИ STATUS: HINT и дай подсказку.
+    3. Если совсем мимо -> ВЕРНИ STATUS: WRONG.
+    4. Если это не ответ, а просто болтовня -> ВЕРНИ STATUS: CHAT.
+
+    ФОРМАТ ОТВЕТА:
+    STATUS: [WIN | WRONG | HINT | CHAT]
+    REPLY: [Твой текст]
+    `, q.Context, q.Answer, q.Mode, q.Guess)
+}
+
+// parseJudgeReply разбирает ответ в формате STATUS/REPLY. Модели часто добавляют
+// звездочки и лишние строки, поэтому разбор терпимый.
+func parseJudgeReply(aiRaw string) GuessVerdict {
+	aiRaw = strings.TrimSpace(aiRaw)
+	status := VerdictChat
+	reply := aiRaw
+
+	for _, line := range strings.Split(aiRaw, "\n") {
+		line = strings.TrimSpace(line)
+		upper := strings.ToUpper(strings.TrimLeft(line, "*_ "))
+
+		if strings.HasPrefix(upper, "STATUS") {
+			// Убираем возможные звездочки (**STATUS:**) или точки
+			cleanStatus := strings.TrimPrefix(upper, "STATUS")
+			cleanStatus = strings.Trim(cleanStatus, " :.*,!-_")
+			status = cleanStatus
+		} else if strings.HasPrefix(upper, "REPLY") {
+			clean := strings.TrimLeft(line, "*_ ")
+			reply = strings.TrimSpace(strings.Trim(clean[len("REPLY"):], " :*_"))
+		} else if line != "" {
+			if reply == aiRaw {
+				reply = ""
+			}
+			reply += " " + line
+		}
+	}
+	reply = strings.TrimSpace(reply)
+	if reply == "" {
+		reply = "..."
+	}
+
+	switch {
+	case strings.Contains(status, VerdictWin):
+		status = VerdictWin
+	case strings.Contains(status, VerdictWrong):
+		status = VerdictWrong
+	case strings.Contains(status, VerdictHint):
+		status = VerdictHint
+	default:
+		status = VerdictChat
+	}
+	return GuessVerdict{Status: status, Reply: reply}
+}
+
+// ==========================================
+// OPENAI-СОВМЕСТИМЫЙ ПРОТОКОЛ
+// ==========================================
+
+type chatCompletionRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func postChatCompletion(ctx context.Context, client *http.Client, endpoint, token string, body chatCompletionRequest) (string, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var out chatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("пустой ответ модели")
+	}
+	return out.Choices[0].Message.Content, nil
+}
+
+type openAIJudge struct {
+	baseURL     string
+	apiKey      string
+	model       string
+	temperature float64
+	client      *http.Client
+}
+
+func (j *openAIJudge) Name() string { return judgeOpenAI + ":" + j.model }
+
+func (j *openAIJudge) Judge(ctx context.Context, q GuessQuery) (GuessVerdict, error) {
+	content, err := postChatCompletion(ctx, j.client, j.baseURL+"/chat/completions", j.apiKey, chatCompletionRequest{
+		Model:       j.model,
+		Messages:    []chatMessage{{Role: "user", Content: buildJudgePrompt(q)}},
+		Temperature: j.temperature,
+	})
+	if err != nil {
+		return GuessVerdict{}, err
+	}
+	return parseJudgeReply(content), nil
+}
+
+// ==========================================
+// GIGACHAT
+// ==========================================
+
+type gigaTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+type gigaChatJudge struct {
+	authKey     string
+	authURL     string
+	chatURL     string
+	scope       string
+	model       string
+	temperature float64
+	client      *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newGigaChatJudge(authKey string, client *http.Client) *gigaChatJudge {
+	return &gigaChatJudge{
+		authKey:     authKey,
+		authURL:     GigaAuthURL,
+		chatURL:     GigaChatURL,
+		scope:       Scope,
+		model:       defaultGigaChatModel,
+		temperature: defaultJudgeTemperature,
+		client:      client,
+	}
+}
+
+func (j *gigaChatJudge) Name() string { return judgeGigaChat + ":" + j.model }
+
+func (j *gigaChatJudge) Judge(ctx context.Context, q GuessQuery) (GuessVerdict, error) {
+	token, err := j.accessToken(ctx)
+	if err != nil {
+		return GuessVerdict{}, err
+	}
+	content, err := postChatCompletion(ctx, j.client, j.chatURL, token, chatCompletionRequest{
+		Model:       j.model,
+		Messages:    []chatMessage{{Role: "user", Content: buildJudgePrompt(q)}},
+		Temperature: j.temperature,
+	})
+	if err != nil {
+		return GuessVerdict{}, err
+	}
+	return parseJudgeReply(content), nil
+}
+
+// accessToken возвращает кешированный OAuth-токен и обновляет его за минуту до истечения.
+func (j *gigaChatJudge) accessToken(ctx context.Context) (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.token != "" && time.Now().Before(j.expires) {
+		return j.token, nil
+	}
+
+	payload := url.Values{}
+	payload.Set("scope", j.scope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.authURL, strings.NewReader(payload.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("RqUID", generateUUID())
+	req.Header.Set("Authorization", "Basic "+j.authKey)
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	var tokenResp gigaTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", err
+	}
+	j.token = tokenResp.AccessToken
+	j.expires = time.Unix(tokenResp.ExpiresAt/1000, 0).Add(-1 * time.Minute)
+	return j.token, nil
+}
+
+// ==========================================
+// ОФЛАЙН-СУДЬЯ (НЕЧЕТКОЕ СРАВНЕНИЕ)
+// ==========================================
+
+// offlineJudge работает без сети: сравнивает ответ с State.Answer по расстоянию
+// Левенштейна после транслитерации, засчитывает совпадение по одной фамилии.
+// На явные промахи молчит, чтобы не засорять чат.
+type offlineJudge struct{}
+
+func (offlineJudge) Name() string { return judgeOffline }
+
+func (offlineJudge) Judge(_ context.Context, q GuessQuery) (GuessVerdict, error) {
+	answer := judgeTokens(q.Answer)
+	guess := judgeTokens(q.Guess)
+	if len(answer) == 0 || len(guess) == 0 {
+		return GuessVerdict{Status: VerdictChat}, nil
+	}
+	answerStr := strings.Join(answer, " ")
+	guessStr := strings.Join(guess, " ")
+
+	if fuzzyEqual(guessStr, answerStr) || strings.Contains(" "+guessStr+" ", " "+answerStr+" ") {
+		return GuessVerdict{Status: VerdictWin, Reply: "Верно! Офелия узнает этот ответ."}, nil
+	}
+	// Фамилия — последнее слово ответа; для однословного ответа это он сам
+	surname := answer[len(answer)-1]
+	if runeLen(surname) >= 3 {
+		for _, g := range guess {
+			if fuzzyEqual(g, surname) {
+				return GuessVerdict{Status: VerdictWin, Reply: "Верно! Фамилии достаточно."}, nil
+			}
+		}
+	}
+
+	for _, a := range answer {
+		if runeLen(a) < 3 {
+			continue
+		}
+		for _, g := range guess {
+			if fuzzyEqual(g, a) {
+				return GuessVerdict{Status: VerdictHint, Reply: "Тепло... Часть ответа уже прозвучала."}, nil
+			}
+		}
+	}
+	if d := levenshtein(guessStr, answerStr); d <= 2*fuzzyTolerance(runeLen(answerStr))+1 {
+		return GuessVerdict{Status: VerdictHint, Reply: "Совсем близко, но не то."}, nil
+	}
+	if strings.HasSuffix(strings.TrimSpace(q.Guess), "?") {
+		return GuessVerdict{Status: VerdictChat}, nil
+	}
+	return GuessVerdict{Status: VerdictWrong}, nil
+}
+
+// judgeTokens приводит строку к словам в латинице: регистр, ё, пунктуация и алфавит не важны.
+func judgeTokens(s string) []string {
+	var out []string
+	for _, w := range splitSearchWords(strings.ReplaceAll(strings.ToLower(s), "ё", "е")) {
+		if t := transliterate(w); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+var cyrToLat = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p",
+	'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch",
+	'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+func transliterate(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if lat, ok := cyrToLat[r]; ok {
+			sb.WriteString(lat)
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	// Частые варианты латинского написания русских имен
+	out := sb.String()
+	out = strings.ReplaceAll(out, "ia", "ya")
+	out = strings.ReplaceAll(out, "iy", "y")
+	return out
+}
+
+// fuzzyTolerance — допустимое число опечаток для слова длины n.
+func fuzzyTolerance(n int) int {
+	switch {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	case n <= 10:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func fuzzyEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	return levenshtein(a, b) <= fuzzyTolerance(runeLen(b))
+}
+
+func runeLen(s string) int { return len([]rune(s)) }
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
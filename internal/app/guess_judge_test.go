@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOfflineJudge(t *testing.T) {
+	cases := []struct {
+		answer, guess, want string
+	}{
+		{"Софья Ковалевская", "софья ковалевская", VerdictWin},
+		{"Софья Ковалевская", "Ковалевская", VerdictWin},
+		{"Софья Ковалевская", "Коваливская", VerdictWin},
+		{"Софья Ковалевская", "Sofia Kovalevskaya", VerdictWin},
+		{"Софья Ковалевская", "kovalevskaia", VerdictWin},
+		{"Мария Кюри", "это мария кюри!", VerdictWin},
+		{"Мария Кюри", "Мария", VerdictHint},
+		{"Ада Лавлейс", "Ада Лавлес", VerdictWin},
+		{"Ада Лавлейс", "Эмми Нётер", VerdictWrong},
+		{"Ада Лавлейс", "а кто это вообще?", VerdictChat},
+	}
+	for _, tc := range cases {
+		v, err := offlineJudge{}.Judge(context.Background(), GuessQuery{Answer: tc.answer, Guess: tc.guess})
+		if err != nil {
+			t.Fatalf("%q: %v", tc.guess, err)
+		}
+		if v.Status != tc.want {
+			t.Errorf("answer %q guess %q: got %s, want %s", tc.answer, tc.guess, v.Status, tc.want)
+		}
+	}
+}
+
+func TestParseJudgeReply(t *testing.T) {
+	v := parseJudgeReply("**STATUS:** WIN\n**REPLY:** Да, это она.")
+	if v.Status != VerdictWin || v.Reply != "Да, это она." {
+		t.Fatalf("unexpected verdict: %+v", v)
+	}
+	v = parseJudgeReply("просто текст без формата")
+	if v.Status != VerdictChat || v.Reply != "просто текст без формата" {
+		t.Fatalf("unexpected verdict: %+v", v)
+	}
+}
+
+func chatServer(t *testing.T, wantToken, content string, got *chatCompletionRequest) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if wantToken != "" && r.Header.Get("Authorization") != "Bearer "+wantToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": content}}},
+		})
+	}))
+}
+
+func TestOpenAIJudge(t *testing.T) {
+	var got chatCompletionRequest
+	srv := chatServer(t, "secret", "STATUS: HINT\nREPLY: Подумайте о математике.", &got)
+	defer srv.Close()
+
+	temp := 0.1
+	judge, err := newGuessJudge(Config{
+		GameJudge:            "ollama",
+		GameJudgeURL:         srv.URL + "/v1/",
+		GameJudgeAPIKey:      "secret",
+		GameJudgeModel:       "qwen2.5",
+		GameJudgeTemperature: &temp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := judge.Judge(context.Background(), GuessQuery{Answer: "Ковалевская", Guess: "Гаусс"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Status != VerdictHint || v.Reply != "Подумайте о математике." {
+		t.Fatalf("unexpected verdict: %+v", v)
+	}
+	if got.Model != "qwen2.5" || got.Temperature != 0.1 || !strings.Contains(got.Messages[0].Content, "Гаусс") {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+}
+
+func TestGigaChatJudge(t *testing.T) {
+	var got chatCompletionRequest
+	authCalls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth", func(w http.ResponseWriter, r *http.Request) {
+		authCalls++
+		if r.Header.Get("Authorization") != "Basic key" || r.FormValue("scope") != Scope {
+			http.Error(w, "bad auth", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(gigaTokenResponse{AccessToken: "tok", ExpiresAt: 1 << 62 / 1000})
+	})
+	chat := chatServer(t, "tok", "STATUS: WIN\nREPLY: Браво!", &got)
+	defer chat.Close()
+	auth := httptest.NewServer(mux)
+	defer auth.Close()
+
+	judge, err := newGuessJudge(Config{GoogleAPI: "key", GameJudgeURL: chat.URL + "/v1/chat/completions"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	giga := judge.(*gigaChatJudge)
+	giga.authURL = auth.URL + "/oauth"
+
+	for i := 0; i < 2; i++ {
+		v, err := giga.Judge(context.Background(), GuessQuery{Answer: "Кюри", Guess: "Склодовская"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Status != VerdictWin {
+			t.Fatalf("unexpected verdict: %+v", v)
+		}
+	}
+	if authCalls != 1 {
+		t.Fatalf("token must be cached, auth calls = %d", authCalls)
+	}
+	if got.Model != defaultGigaChatModel {
+		t.Fatalf("unexpected model %q", got.Model)
+	}
+}
+
+func TestNewGuessJudgeDefaults(t *testing.T) {
+	j, err := newGuessJudge(Config{})
+	if err != nil || j.Name() != judgeOffline {
+		t.Fatalf("expected offline judge without keys, got %v %v", j, err)
+	}
+	if _, err := newGuessJudge(Config{GameJudge: "openai"}); err == nil {
+		t.Fatal("openai judge without URL must fail")
+	}
+}
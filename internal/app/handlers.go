@@ -87,6 +87,7 @@ const (
 	cbModePainting     = "mode_painting"
 	cbModeQuotes       = "mode_quotes"
 	cbModeDesc         = "mode_desc"
+	cbGameList         = "game_list"
 	cbRefreshStats     = "refresh_stats"
 	cbThemeMore        = "theme_more"
 	cbFinishWomanPhoto = "finish_woman_photo"
@@ -176,8 +177,14 @@ const (
 	STATE_WAITING_BROADCAST = "waiting_broadcast"
 	STATE_WAITING_CONFIRM   = "waiting_confirm"
 	STATE_WAITING_WL_ADD    = "waiting_wl_add"
+	STATE_WAITING_CHATMOD   = "waiting_chatmod_value"
 	STATE_WAITING_REJECT    = "waiting_reject_reason"
 
+	STATE_WAITING_CARD_IMPORT = "waiting_card_import"
+
+	STATE_WAITING_APPEAL       = "waiting_appeal"
+	STATE_WAITING_APPEAL_REPLY = "waiting_appeal_reply"
+
 	// Состояния добавления
 	STATE_WOMAN_NAME  = "woman_name"
 	STATE_WOMAN_FIELD = "woman_field"
@@ -207,6 +214,7 @@ type pendingAction struct {
 	KeepID   uint
 	RemoveID uint
 	Tag      string
+	NewTag   string
 	AddTags  bool
 	Filters  SearchFilters
 	FilePath string
@@ -431,11 +439,13 @@ func buildDBMenu() *tele.ReplyMarkup {
 	m := &tele.ReplyMarkup{}
 	btnBackup := m.Data("Экспорт (Backup)", cbDBBackup)
 	btnImport := m.Data("Импорт (Restore)", cbDBImport)
+	btnCardImport := m.Data("Импорт карточек (CSV/JSON)", cbCardImport)
 	btnVacuum := m.Data("Оптимизация (Vacuum)", cbDBVacuum)
 	btnBackFromDB := m.Data("Назад", cbAdminBackMain)
 	m.Inline(
 		m.Row(btnBackup),
 		m.Row(btnImport, btnVacuum),
+		m.Row(btnCardImport),
 		m.Row(btnBackFromDB),
 	)
 	return m
@@ -486,15 +496,97 @@ func buildModesMenu() *tele.ReplyMarkup {
 	btnModePainting := m.Data("Живопись", cbModePainting)
 	btnModeQuotes := m.Data("Цитаты", cbModeQuotes)
 	btnModeDesc := m.Data("Биография", cbModeDesc)
+	btnGameList := m.Data("Активные игры", cbGameList)
 	btnBackToMain := m.Data("Назад", cbAdminBackMain)
 	m.Inline(
 		m.Row(btnModePainting),
 		m.Row(btnModeQuotes, btnModeDesc),
+		m.Row(btnGameList),
 		m.Row(btnBackToMain),
 	)
 	return m
 }
 
+// buildGameChatMenu — выбор чата для запуска игры: основной чат и известные группы.
+func buildGameChatMenu() *tele.ReplyMarkup {
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	seen := map[int64]bool{}
+	if config.TargetChatID != 0 {
+		name := formatChatName(config.TargetChatID)
+		if name == "" {
+			name = fmt.Sprintf("%d", config.TargetChatID)
+		}
+		rows = append(rows, m.Row(m.Data("⭐ "+shorten(name, 40), fmt.Sprintf("game_chat_%d", config.TargetChatID))))
+		seen[config.TargetChatID] = true
+	}
+	chats, _ := womanManager.ListKnownChats(50, 0)
+	for _, ch := range chats {
+		if len(rows) >= 10 {
+			break
+		}
+		if seen[ch.ID] || (ch.Type != string(tele.ChatGroup) && ch.Type != string(tele.ChatSuperGroup)) {
+			continue
+		}
+		seen[ch.ID] = true
+		name := ch.Title
+		if name == "" {
+			name = fmt.Sprintf("%d", ch.ID)
+		}
+		if gameManager.IsActive(ch.ID) {
+			name = "🎯 " + name
+		}
+		rows = append(rows, m.Row(m.Data(shorten(name, 40), fmt.Sprintf("game_chat_%d", ch.ID))))
+	}
+	rows = append(rows, m.Row(m.Data("Отмена", cbAdminBackMain)))
+	m.Inline(rows...)
+	return m
+}
+
+// sendActiveGames показывает активные игры с кнопками остановки.
+func sendActiveGames(c tele.Context, edit bool) error {
+	games := gameManager.ActiveGames()
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	var sb strings.Builder
+	sb.WriteString("🎯 <b>Активные игры</b>\n\n")
+	if len(games) == 0 {
+		sb.WriteString("Сейчас игр нет.")
+	}
+	for _, g := range games {
+		name := formatChatName(g.ChatID)
+		if name == "" {
+			name = fmt.Sprintf("%d", g.ChatID)
+		}
+		left := "без лимита"
+		if g.Timeout > 0 {
+			left = formatDuration(time.Until(g.StartTime.Add(g.Timeout)))
+		}
+		sb.WriteString(fmt.Sprintf("• %s — %s, старт %s, осталось %s\n   Ответ: <tg-spoiler>%s</tg-spoiler>\n",
+			html.EscapeString(name), g.Mode, g.StartTime.Format("02.01 15:04"), left, html.EscapeString(g.Answer)))
+		rows = append(rows, m.Row(m.Data("⏹ "+shorten(name, 40), fmt.Sprintf("game_stop_%d", g.ChatID))))
+	}
+	rows = append(rows, m.Row(m.Data("Назад", cbStartQuiz)))
+	m.Inline(rows...)
+	if edit {
+		return tryEdit(c, sb.String(), m, tele.ModeHTML)
+	}
+	return c.Send(sb.String(), m, tele.ModeHTML)
+}
+
+// stopGameInChat останавливает игру и объявляет ответ в самом чате.
+func stopGameInChat(bot *tele.Bot, chatID int64) bool {
+	game, ok := gameManager.StopGame(chatID)
+	if !ok {
+		return false
+	}
+	text := fmt.Sprintf("Испытание завершено. Ответ: <b>%s</b>", html.EscapeString(game.Answer))
+	if _, err := bot.Send(&tele.Chat{ID: chatID}, text, tele.ModeHTML); err != nil {
+		log.Printf("⚠️ Ошибка отправки в чат %d: %v", chatID, err)
+	}
+	return true
+}
+
 func buildStatsMenu() *tele.ReplyMarkup {
 	m := &tele.ReplyMarkup{}
 	btnRefreshStats := m.Data("Обновить данные", cbRefreshStats)
@@ -561,9 +653,15 @@ func RegisterHandlers(b *tele.Bot) {
 	b.Handle("/audit", HandleAudit)
 	b.Handle("/broadcasts", HandleBroadcasts)
 	b.Handle("/export", HandleExport)
+	b.Handle("/import", HandleCardImport)
+	b.Handle("/book", HandleBook)
 	b.Handle("/merge", HandleMerge)
 	b.Handle("/tagadd", HandleTagAdd)
 	b.Handle("/tagremove", HandleTagRemove)
+	b.Handle("/tagrename", HandleTagRename)
+	b.Handle("/tagmerge", HandleTagMerge)
+	b.Handle("/tagalias", HandleTagAlias)
+	b.Handle("/tagdel", HandleTagDelete)
 	b.Handle("/whitelist", HandleWhitelist)
 	b.Handle("/wladd", HandleWhitelistAdd)
 	b.Handle("/wldel", HandleWhitelistDel)
@@ -577,12 +675,18 @@ func RegisterHandlers(b *tele.Bot) {
 	b.Handle("/colunpub", HandleCollectionUnpublish)
 	b.Handle("/mediacheck", HandleMediaCheck)
 	b.Handle("/history", HandleHistory)
+	b.Handle("/diff", HandleDiff)
+	b.Handle("/rollback", HandleRollback)
+	b.Handle("/trash", HandleTrash)
+	b.Handle("/restore", HandleRestore)
+	b.Handle("/purge", HandlePurge)
 	b.Handle("/tagsuggest", HandleTagSuggest)
 	b.Handle("/modadd", HandleModAdd)
 	b.Handle("/moddel", HandleModDel)
 	b.Handle("/modlist", HandleModList)
 	b.Handle("/modlog", HandleModLog)
 	b.Handle("/dups", HandleDuplicates)
+	b.Handle("/recwhy", HandleRecWhy)
 	b.Handle("/quality", HandleQuality)
 	b.Handle("/topcards", HandleTopCards)
 	b.Handle("/theme_on", HandleThemeOn)
@@ -596,6 +700,22 @@ func RegisterHandlers(b *tele.Bot) {
 	b.Handle("/report_off", HandleReportOff)
 	b.Handle("/report_time", HandleReportTime)
 	b.Handle("/report_day", HandleReportDay)
+	b.Handle("/stats", HandleStatsPeriod)
+	b.Handle("/violations", HandleViolations)
+	b.Handle("/pardon", HandlePardon)
+	b.Handle("/resetviolations", HandleResetViolations)
+	b.Handle("/policy", HandlePolicy)
+	b.Handle("/policy_set", HandlePolicySet)
+	b.Handle("/policy_reset", HandlePolicyReset)
+	b.Handle("/appeal", HandleAppeal)
+	b.Handle("/appeals", HandleAppeals)
+	b.Handle("/spam", HandleSpam)
+	b.Handle("/spamstats", HandleSpamStats)
+	b.Handle("/report", HandleReport)
+	b.Handle("/reports", HandleReports)
+	b.Handle("/shadow", HandleShadow)
+	b.Handle("/shadow_off", HandleShadowOff)
+	b.Handle("/shadow_drop", HandleShadowDrop)
 	b.Handle("/inbox", HandleInbox)
 	b.Handle("/cms_post", HandleCMSPostCommand)
 	b.Handle("/event_manage", HandleCMSEventManageCommand)
@@ -649,25 +769,10 @@ func RegisterHandlers(b *tele.Bot) {
 		}()
 
 		data := callbackRouteKey(c.Callback())
-		userID := c.Sender().ID
 
 		// Проверка капчи
 		if strings.HasPrefix(data, "captcha_") {
-			parts := strings.Split(data, "_")
-			if len(parts) != 2 {
-				return c.Respond()
-			}
-
-			if parts[1] == "correct" {
-				womanManager.SetUserVerified(userID)
-				c.Delete()
-				c.Respond(&tele.CallbackResponse{Text: "Доступ разрешен."})
-				return HandleStart(c) // Запускаем нормальный старт
-			} else {
-				c.Respond(&tele.CallbackResponse{Text: "Ошибка. Попробуйте снова."})
-				c.Delete()
-				return sendCaptcha(c)
-			}
+			return handleCaptchaCallback(c, data)
 		}
 		// Передаем остальные колбэки в процессор
 		return processCallback(c)
@@ -785,7 +890,7 @@ func RegisterHandlers(b *tele.Bot) {
 		if !isAdmin(c.Sender().ID) {
 			return nil
 		}
-		gameManager.SetupGameMode("painting")
+		gameManager.SetupGameMode(c.Sender().ID, "painting")
 		setAdminState(c.Sender().ID, STATE_WAITING_PHOTO)
 		return tryEdit(c, "Предоставьте полотно для анализа.", tele.ModeHTML)
 	})
@@ -793,7 +898,7 @@ func RegisterHandlers(b *tele.Bot) {
 		if !isAdmin(c.Sender().ID) {
 			return nil
 		}
-		gameManager.SetupGameMode("mode_quotes")
+		gameManager.SetupGameMode(c.Sender().ID, "mode_quotes")
 		setAdminState(c.Sender().ID, STATE_WAITING_ANSWER)
 		return tryEdit(c, "Введите верный ответ:", tele.ModeHTML)
 	})
@@ -801,7 +906,7 @@ func RegisterHandlers(b *tele.Bot) {
 		if !isAdmin(c.Sender().ID) {
 			return nil
 		}
-		gameManager.SetupGameMode("mode_desc")
+		gameManager.SetupGameMode(c.Sender().ID, "mode_desc")
 		setAdminState(c.Sender().ID, STATE_WAITING_ANSWER)
 		return tryEdit(c, "Введите верный ответ:", tele.ModeHTML)
 	})
@@ -809,8 +914,10 @@ func RegisterHandlers(b *tele.Bot) {
 	b.Handle(tele.OnPhoto, HandlePhoto)
 	b.Handle(tele.OnDocument, HandleDocument)
 	b.Handle(tele.OnText, HandleText)
-	b.Handle(tele.OnEdited, HandleText)
-	b.Handle(tele.OnSticker, func(c tele.Context) error { return nil })
+	b.Handle(tele.OnEdited, HandleEdited)
+	for _, kind := range []string{tele.OnSticker, tele.OnVideo, tele.OnAnimation, tele.OnAudio, tele.OnVoice, tele.OnVideoNote, tele.OnContact, tele.OnLocation, tele.OnVenue, tele.OnPoll} {
+		b.Handle(kind, HandleMedia)
+	}
 
 	// ВАЖНО: Middleware подключаем после всех хендлеров
 	b.Use(RecoverMiddleware())
@@ -897,7 +1004,7 @@ func processCallback(c tele.Context) error {
 	}
 	if data == cbConfirmNo {
 		if act, ok := getPendingAction(userID); ok {
-			if act.Action == cbDBImport && act.FilePath != "" {
+			if (act.Action == cbDBImport || act.Action == cbCardImport) && act.FilePath != "" {
 				_ = os.Remove(act.FilePath)
 			}
 		}
@@ -950,7 +1057,7 @@ func processCallback(c tele.Context) error {
 		if !ok {
 			return tryEdit(c, "Ошибка идентификатора.", buildStaffPanelMenuForContext(c), tele.ModeHTML)
 		}
-		err := womanManager.ApproveWoman(id)
+		err := womanManager.ApproveWoman(id, userID)
 		if err != nil {
 			return tryEdit(c, "Ошибка: "+err.Error(), buildStaffPanelMenuForContext(c), tele.ModeHTML)
 		}
@@ -1014,12 +1121,70 @@ func processCallback(c tele.Context) error {
 		setAdminState(userID, STATE_WAITING_WL_ADD)
 		return tryEdit(c, "Введите ID чата или пользователя для белого списка:", buildCancelEditMenu(), tele.ModeHTML)
 	}
+	if data == cbGameList {
+		if !isAdmin(userID) {
+			return c.Respond()
+		}
+		return sendActiveGames(c, true)
+	}
+	if strings.HasPrefix(data, "game_chat_") {
+		if !isAdmin(userID) {
+			return c.Respond()
+		}
+		chatID, err := strconv.ParseInt(strings.TrimPrefix(data, "game_chat_"), 10, 64)
+		if err != nil {
+			return c.Respond()
+		}
+		if err := gameManager.StartGame(c.Bot(), userID, chatID); err != nil {
+			log.Printf("⚠️ Ошибка старта игры в чате %d: %v", chatID, err)
+			return tryEdit(c, "Не удалось начать испытание: "+html.EscapeString(err.Error()), buildGameChatMenu(), tele.ModeHTML)
+		}
+		logModAction(userID, "game_start", fmt.Sprintf("%d", chatID), "")
+		return tryEdit(c, "Испытание началось.", buildModesMenu(), tele.ModeHTML)
+	}
+	if strings.HasPrefix(data, "game_stop_") {
+		if !isAdmin(userID) {
+			return c.Respond()
+		}
+		chatID, err := strconv.ParseInt(strings.TrimPrefix(data, "game_stop_"), 10, 64)
+		if err != nil {
+			return c.Respond()
+		}
+		if stopGameInChat(c.Bot(), chatID) {
+			logModAction(userID, "game_stop", fmt.Sprintf("%d", chatID), "")
+		}
+		return sendActiveGames(c, true)
+	}
 	if data == cbAdminChats {
 		if !hasPermission(userID, PermViewChats) {
 			return c.Respond()
 		}
 		return sendChatsPage(c, 0, true)
 	}
+	if strings.HasPrefix(data, "raid_") {
+		return handleRaidCallback(c, data)
+	}
+	if strings.HasPrefix(data, cbReportPrefix) {
+		return handleReportCallback(c, data)
+	}
+	if strings.HasPrefix(data, cbSpamPrefix) {
+		return handleSpamReviewCallback(c, data)
+	}
+	if strings.HasPrefix(data, cbAppealPrefix) {
+		return handleAppealCallback(c, data)
+	}
+	if strings.HasPrefix(data, cbChatModPrefix) {
+		return handleChatModCallback(c, data)
+	}
+	if strings.HasPrefix(data, cbRevisionPrefix) {
+		return handleRevisionCallback(c, data)
+	}
+	if strings.HasPrefix(data, cbTrashPrefix) {
+		return handleTrashCallback(c, data)
+	}
+	if strings.HasPrefix(data, cbDupPrefix) {
+		return handleDupCallback(c, data)
+	}
 	if strings.HasPrefix(data, "chats_page_") {
 		pstr := strings.TrimPrefix(data, "chats_page_")
 		p, _ := strconv.Atoi(pstr)
@@ -1070,10 +1235,20 @@ func processCallback(c tele.Context) error {
 		})
 		return c.Respond(&tele.CallbackResponse{Text: "Оптимизация завершена."})
 	}
+	if data == cbCardImport {
+		if !hasPermission(userID, PermImportDB) {
+			return c.Respond()
+		}
+		setAdminState(userID, STATE_WAITING_CARD_IMPORT)
+		return tryEdit(c, "Импорт карточек.\nПредоставьте файл .csv (колонки как в /export) или .json", buildCancelEditMenu(), tele.ModeHTML)
+	}
 	if data == cbDBImport {
 		if !isAdmin(userID) {
 			return c.Respond()
 		}
+		if womanManager.FilePath == "" {
+			return c.Respond(&tele.CallbackResponse{Text: "Импорт файла .db доступен только для SQLite.", ShowAlert: true})
+		}
 		setAdminState(userID, STATE_WAITING_DB_IMPORT)
 		return tryEdit(c, "Режим импорта.\nПредоставьте файл .db", buildCancelEditMenu(), tele.ModeHTML)
 	}
@@ -1303,7 +1478,7 @@ func processCallback(c tele.Context) error {
 			return tryEdit(c, "Запись не обнаружена.", buildStaffPanelMenuForContext(c), tele.ModeHTML)
 		}
 		w.MediaIDs = []string{}
-		if err := womanManager.UpdateWoman(w); err != nil {
+		if err := womanManager.UpdateWomanBy(w, userID, "media"); err != nil {
 			log.Printf("⚠️ Ошибка очистки галереи: %v", err)
 			return tryEdit(c, "Ошибка очистки галереи.", buildStaffPanelMenuForContext(c), tele.ModeHTML)
 		}
@@ -1397,7 +1572,7 @@ func processCallback(c tele.Context) error {
 		if s, ok := getSearchSuggestion(userID); ok && idx >= 0 && idx < len(s.Tags) {
 			f := SearchFilters{Tags: []string{s.Tags[idx]}, Limit: 10, PublishedOnly: true}
 			results := womanManager.SearchWomenAdvanced(f)
-			return sendSearchResults(c, results)
+			return sendSearchResults(c, results, "")
 		}
 		return c.Respond()
 	}
@@ -1407,7 +1582,7 @@ func processCallback(c tele.Context) error {
 		if s, ok := getSearchSuggestion(userID); ok && idx >= 0 && idx < len(s.Fields) {
 			f := SearchFilters{Field: s.Fields[idx], Limit: 10, PublishedOnly: true}
 			results := womanManager.SearchWomenAdvanced(f)
-			return sendSearchResults(c, results)
+			return sendSearchResults(c, results, "")
 		}
 		return c.Respond()
 	}
@@ -1523,25 +1698,6 @@ func makeFieldsMenu() *tele.ReplyMarkup {
 	return fieldsMenu
 }
 
-func sendCaptcha(c tele.Context) error {
-	a := rand.Intn(5) + 1
-	b := rand.Intn(5) + 1
-	res := a + b
-	options := []int{res, res + 1, res - 1}
-	rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
-	menu := &tele.ReplyMarkup{}
-	var btns []tele.Btn
-	for _, opt := range options {
-		data := "captcha_wrong"
-		if opt == res {
-			data = "captcha_correct"
-		}
-		btns = append(btns, menu.Data(strconv.Itoa(opt), data))
-	}
-	menu.Inline(menu.Row(btns...))
-	return c.Send(fmt.Sprintf("🛡 <b>Проверка на человечность.</b>\nРешите пример: %d + %d = ?", a, b), menu, tele.ModeHTML)
-}
-
 func callbackRouteKey(cb *tele.Callback) string {
 	if cb == nil {
 		return ""
@@ -1566,6 +1722,11 @@ func Middleware() tele.MiddlewareFunc {
 			}
 			isStaffUser := isStaff(sender.ID)
 
+			// Рейды: входы и сообщения новичков считаются до капчи и лимитов
+			if !isStaffUser && chat != nil && chat.Type != tele.ChatPrivate && raidGuard(c) {
+				return nil
+			}
+
 			// Rate Limit
 			userLastReqMu.Lock()
 			last, exists := userLastReq[sender.ID]
@@ -1584,14 +1745,24 @@ func Middleware() tele.MiddlewareFunc {
 
 			// Captcha
 			if !womanManager.IsUserVerified(sender.ID) {
-				if strings.HasPrefix(callbackRouteKey(c.Callback()), "captcha_") {
+				if strings.HasPrefix(callbackRouteKey(c.Callback()), "captcha_") || isAppealUpdate(c) {
 					return next(c)
 				}
 				if c.Message() != nil && c.Message().Text == "/start" {
 					return sendCaptcha(c)
 				}
+				// Вход в группу: задание выдает HandleUserJoin
+				if c.Message() != nil && len(c.Message().UsersJoined) > 0 {
+					return next(c)
+				}
 				if c.Message() != nil {
 					c.Delete()
+					// Участник без проверки пишет в группе — выдаем задание со сроком
+					if chat != nil && chat.Type != tele.ChatPrivate && !sender.IsBot && !captchas.pending(chat.ID, sender.ID) {
+						if err := startCaptcha(c.Bot(), chat, sender); err != nil {
+							log.Printf("⚠️ Не удалось отправить капчу: %v", err)
+						}
+					}
 				}
 				return nil
 			}
@@ -1849,7 +2020,7 @@ func executePendingAction(c tele.Context) error {
 	setAdminState(user.ID, STATE_IDLE)
 	switch act.Action {
 	case "delete":
-		if err := womanManager.DeleteWoman(act.TargetID); err != nil {
+		if err := womanManager.DeleteWoman(act.TargetID, user.ID, ""); err != nil {
 			log.Printf("⚠️ Ошибка удаления записи: %v", err)
 			return c.Send("Ошибка удаления записи.")
 		}
@@ -1872,6 +2043,24 @@ func executePendingAction(c tele.Context) error {
 		}
 		logModAction(user.ID, action, act.Tag, fmt.Sprintf("updated %d", updated))
 		return c.Send(fmt.Sprintf("Готово. Обновлено записей: %d", updated), buildStaffPanelMenuForContext(c), tele.ModeHTML)
+	case "tagrename", "tagmerge", "tagalias", "tagdel":
+		var updated int
+		var err error
+		switch act.Action {
+		case "tagrename":
+			updated, err = womanManager.RenameTag(act.Tag, act.NewTag, user.ID)
+		case "tagmerge":
+			updated, err = womanManager.MergeTags(act.Tag, act.NewTag, user.ID)
+		case "tagalias":
+			updated, err = womanManager.AliasTag(act.Tag, act.NewTag, user.ID)
+		default:
+			updated, err = womanManager.DeleteTag(act.Tag, user.ID)
+		}
+		if err != nil {
+			return c.Send("Ошибка обновления тегов: "+html.EscapeString(err.Error()), tele.ModeHTML)
+		}
+		logModAction(user.ID, "tag_"+strings.TrimPrefix(act.Action, "tag"), act.Tag, fmt.Sprintf("to=%s updated %d", act.NewTag, updated))
+		return c.Send(fmt.Sprintf("Готово. Обновлено записей: %d", updated), buildStaffPanelMenuForContext(c), tele.ModeHTML)
 	case cbDBImport:
 		if act.FilePath == "" {
 			return c.Send("Не найден файл для импорта.")
@@ -1881,26 +2070,34 @@ func executePendingAction(c tele.Context) error {
 		}
 		logModAction(user.ID, cbDBImport, "", "confirmed")
 		return c.Send("Хранилище знаний успешно обновлено.", buildStaffPanelMenuForContext(c), tele.ModeHTML)
+	case cbCardImport:
+		return confirmCardImport(c, act)
 	default:
 		return c.Send("Неизвестное действие.", buildStaffPanelMenuForContext(c), tele.ModeHTML)
 	}
 }
 
 func replaceDatabase(tempName string) error {
+	// Статистика живет в той же БД: дописываем накопленное до закрытия
+	FlushAllStats()
 	if err := womanManager.CloseDB(); err != nil {
 		log.Printf("⚠️ Ошибка закрытия БД: %v", err)
 	}
 	if err := os.MkdirAll(dirBackups, 0755); err != nil {
 		log.Printf("⚠️ Ошибка создания каталога бэкапов: %v", err)
 	}
-	if err := os.Rename(dbFilePath, dbBackupFilePath); err != nil {
+	if err := os.Rename(womanManager.FilePath, dbBackupFilePath); err != nil {
 		log.Printf("⚠️ Ошибка бэкапа БД: %v", err)
 	}
-	if err := os.Rename(tempName, dbFilePath); err != nil {
+	if err := os.Rename(tempName, womanManager.FilePath); err != nil {
 		log.Printf("⚠️ Ошибка замены БД: %v", err)
 		return err
 	}
 	womanManager.Connect()
+	AttachStatsDB(womanManager.DB)
+	resetChatProfileCache()
+	spamFilter.reset()
+	loadModerationPolicy()
 	return nil
 }
 
@@ -1935,7 +2132,10 @@ func HandleHelp(c tele.Context) error {
 		"/tags, /browse — навигация по тегам\n" +
 		"/collections — опубликованные коллекции\n" +
 		"/fav, /rec — избранное и рекомендации\n" +
-		"/daily_on, /daily_off, /daily_time — ежедневник\n\n" +
+		"/top — топ знатоков чата, /top all — общий\n" +
+		"/daily_on, /daily_off, /daily_time — ежедневник\n" +
+		"/appeal — обжаловать бан\n" +
+		"/report (ответом на сообщение) — пожаловаться модераторам\n\n" +
 		"Меню:\n" +
 		"Главное: Сайт, Развлечения\n" +
 		"Сайт: Главная, О себе, Проекты, Навыки, Контакты\n" +
@@ -1948,7 +2148,20 @@ func HandleHelp(c tele.Context) error {
 	adminHelp := userHelp + "\n\nАдмин-команды:\n" +
 		"/admin — панель управления\n" +
 		"/status, /audit, /history, /broadcasts — диагностика и отчеты\n" +
+		"/history id — ревизии карточки, /diff id A [B] — сравнить, /rollback id ревизия [поле] — откатить\n" +
+		"/trash — корзина удаленных карточек, /restore id — вернуть, /purge id — стереть навсегда\n" +
+		"/export [all] — карточки в CSV, /import — загрузить CSV/JSON (сначала покажу изменения)\n" +
+		"/book id_коллекции | фильтры [epub|zip] — подборка книгой EPUB и архивом HTML/Markdown\n" +
+		"/recwhy user_id [id] — почему пользователю рекомендуются карточки\n" +
+		"/stats [day|week|month|year|N] — активность за период со сравнением и тепловой картой\n" +
 		"/whitelist, /whitelist_del — белый список\n" +
+		"/violations, /pardon, /resetviolations [user_id] — нарушения (можно ответом на сообщение)\n" +
+		"/policy, /policy_set, /policy_reset — политика наказаний\n" +
+		"/shadow [правило] — теневые правила (или перевести в тень), /shadow_off, /shadow_drop — включить или убрать\n" +
+		"/appeals — очередь апелляций на бан, /reports — открытые жалобы\n" +
+		"/spam (ответом) — удалить спам и обучить фильтр, /spamstats — качество фильтра\n" +
+		"/tagrename, /tagmerge, /tagalias, /tagdel — управление тегами\n" +
+		"/stopgame [chat_id] — остановить игру (в личке без аргумента — список игр)\n" +
 		"/cms_site — выдать JWT-ссылку на сайт\n" +
 		"/cms_post — создать пост\n" +
 		"/cms_post_del — удалить пост\n" +
@@ -2087,7 +2300,21 @@ func HandleMe(c tele.Context) error {
 	}
 	return c.Reply(buildUserStatsText(c.Sender().ID), tele.ModeHTML)
 }
-func HandleTop(c tele.Context) error { return c.Reply(gameManager.GetTopPlayers(), tele.ModeHTML) }
+
+// HandleTop: в группе — топ этого чата, "/top all" или личка — общий топ.
+func HandleTop(c tele.Context) error {
+	chatID := int64(0)
+	if c.Chat() != nil && c.Chat().Type != tele.ChatPrivate {
+		chatID = c.Chat().ID
+	}
+	if args := c.Args(); len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "all", "global", "все", "общий":
+			chatID = 0
+		}
+	}
+	return c.Reply(gameManager.GetTopPlayers(chatID), tele.ModeHTML)
+}
 func HandleStatus(c tele.Context) error {
 	return sendStatus(c, false)
 }
@@ -2407,6 +2634,19 @@ func sendChatsPage(c tele.Context, page int, edit bool) error {
 		sb.WriteString(fmt.Sprintf("• %d — %s%s [%s]%s\n", ch.ID, html.EscapeString(name), u, ch.Type, mark))
 	}
 	chMenu := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	if isAdmin(c.Sender().ID) {
+		for _, ch := range chats {
+			if ch.Type == string(tele.ChatPrivate) {
+				continue
+			}
+			title := ch.Title
+			if title == "" {
+				title = strconv.FormatInt(ch.ID, 10)
+			}
+			rows = append(rows, chMenu.Row(chMenu.Data("🛡 "+shorten(title, 40), fmt.Sprintf("%s%d", cbChatModPrefix, ch.ID))))
+		}
+	}
 	var nav []tele.Btn
 	if page > 0 {
 		nav = append(nav, chMenu.Data("⬅️ Назад", fmt.Sprintf("chats_page_%d", page-1)))
@@ -2415,8 +2655,9 @@ func sendChatsPage(c tele.Context, page int, edit bool) error {
 		nav = append(nav, chMenu.Data("Вперед ➡️", fmt.Sprintf("chats_page_%d", page+1)))
 	}
 	if len(nav) > 0 {
-		chMenu.Inline(chMenu.Row(nav...))
+		rows = append(rows, chMenu.Row(nav...))
 	}
+	chMenu.Inline(rows...)
 	if edit {
 		return tryEdit(c, sb.String(), chMenu, tele.ModeHTML)
 	}
@@ -2552,6 +2793,91 @@ func HandleTagRemove(c tele.Context) error {
 	setAdminState(c.Sender().ID, STATE_WAITING_CONFIRM)
 	return c.Reply("Подтвердите массовое удаление тегов.", buildConfirmMenu(), tele.ModeHTML)
 }
+
+// parseTagPairArgs разбирает "/cmd старый новый"; теги можно писать с # или без.
+func parseTagPairArgs(c tele.Context) (string, string, bool) {
+	args := c.Args()
+	if len(args) != 2 {
+		return "", "", false
+	}
+	from, to := cleanTagName(args[0]), cleanTagName(args[1])
+	if from == "" || to == "" || from == to {
+		return "", "", false
+	}
+	return from, to, true
+}
+
+func confirmTagAction(c tele.Context, act pendingAction, prompt string) error {
+	if ok, wait := checkAdminCooldown(c.Sender().ID, act.Action, 30*time.Second); !ok {
+		return c.Reply(fmt.Sprintf("Подождите %s перед новой операцией.", formatDuration(wait)), tele.ModeHTML)
+	}
+	affected := len(womanManager.womenWithTag(act.Tag))
+	setPendingAction(c.Sender().ID, act)
+	setAdminState(c.Sender().ID, STATE_WAITING_CONFIRM)
+	return c.Reply(fmt.Sprintf("%s\nЗатронуто записей: %d", prompt, affected), buildConfirmMenu(), tele.ModeHTML)
+}
+
+func HandleTagRename(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermMassTag) {
+		return nil
+	}
+	from, to, ok := parseTagPairArgs(c)
+	if !ok {
+		return c.Reply("Используйте: /tagrename <code>старый</code> <code>новый</code>", tele.ModeHTML)
+	}
+	return confirmTagAction(c, pendingAction{Action: "tagrename", Tag: from, NewTag: to},
+		fmt.Sprintf("Переименовать #%s в #%s?", html.EscapeString(from), html.EscapeString(to)))
+}
+
+func HandleTagMerge(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermMassTag) {
+		return nil
+	}
+	from, into, ok := parseTagPairArgs(c)
+	if !ok {
+		return c.Reply("Используйте: /tagmerge <code>откуда</code> <code>куда</code>", tele.ModeHTML)
+	}
+	return confirmTagAction(c, pendingAction{Action: "tagmerge", Tag: from, NewTag: into},
+		fmt.Sprintf("Слить #%s в #%s? Старое имя останется алиасом.", html.EscapeString(from), html.EscapeString(into)))
+}
+
+func HandleTagAlias(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermMassTag) {
+		return nil
+	}
+	if len(c.Args()) == 0 {
+		aliases := womanManager.ListTagAliases()
+		if len(aliases) == 0 {
+			return c.Reply("Алиасов пока нет.", tele.ModeHTML)
+		}
+		var sb strings.Builder
+		sb.WriteString("🏷️ <b>Алиасы тегов</b>\n\n")
+		for _, a := range aliases {
+			sb.WriteString(fmt.Sprintf("%s → #%s\n", html.EscapeString(a.Alias), html.EscapeString(a.Tag)))
+		}
+		return c.Reply(sb.String(), tele.ModeHTML)
+	}
+	alias, tag, ok := parseTagPairArgs(c)
+	if !ok {
+		return c.Reply("Используйте: /tagalias <code>алиас</code> <code>тег</code> (без аргументов — список)", tele.ModeHTML)
+	}
+	return confirmTagAction(c, pendingAction{Action: "tagalias", Tag: alias, NewTag: tag},
+		fmt.Sprintf("Сделать «%s» алиасом #%s?", html.EscapeString(alias), html.EscapeString(tag)))
+}
+
+func HandleTagDelete(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermMassTag) {
+		return nil
+	}
+	args := c.Args()
+	if len(args) != 1 || cleanTagName(args[0]) == "" {
+		return c.Reply("Используйте: /tagdel <code>тег</code>", tele.ModeHTML)
+	}
+	tag := cleanTagName(args[0])
+	return confirmTagAction(c, pendingAction{Action: "tagdel", Tag: tag},
+		fmt.Sprintf("Удалить тег #%s со всех карточек?", html.EscapeString(tag)))
+}
+
 func HandleMediaCheck(c tele.Context) error {
 	if c.Sender() == nil || !isAdmin(c.Sender().ID) {
 		return nil
@@ -2577,6 +2903,13 @@ func HandleHistory(c tele.Context) error {
 	if id <= 0 {
 		return c.Reply("Неверный идентификатор.", tele.ModeHTML)
 	}
+	if text, menu := buildRevisionList(uint(id)); text != "" {
+		if !hasPermission(c.Sender().ID, PermEdit) {
+			return c.Reply(text, tele.ModeHTML)
+		}
+		return c.Reply(text, menu, tele.ModeHTML)
+	}
+	// Карточки, которые не менялись после появления ревизий — старый журнал
 	rows := womanManager.GetChangeHistory(uint(id), 5)
 	if len(rows) == 0 {
 		return c.Reply("История пуста.", tele.ModeHTML)
@@ -2693,49 +3026,6 @@ func HandleModLog(c tele.Context) error {
 	}
 	return c.Reply(sb.String(), tele.ModeHTML)
 }
-func HandleDuplicates(c tele.Context) error {
-	if c.Sender() == nil || !isAdmin(c.Sender().ID) {
-		return nil
-	}
-	var women []Woman
-	womanManager.DB.Select("id", "name", "year", "field").Find(&women)
-	if len(women) == 0 {
-		return c.Reply("Записей нет.", tele.ModeHTML)
-	}
-	groups := map[string][]Woman{}
-	for _, w := range women {
-		key := normalizeNameForDup(w.Name)
-		if key == "" {
-			continue
-		}
-		groups[key] = append(groups[key], w)
-	}
-	var sb strings.Builder
-	sb.WriteString("🔁 <b>Возможные дубликаты</b>\n")
-	count := 0
-	for _, list := range groups {
-		if len(list) < 2 {
-			continue
-		}
-		count++
-		if count > 10 {
-			sb.WriteString("... и другие.\n")
-			break
-		}
-		sb.WriteString("• ")
-		for i, w := range list {
-			if i > 0 {
-				sb.WriteString(" | ")
-			}
-			sb.WriteString(fmt.Sprintf("%d:%s", w.ID, html.EscapeString(shorten(w.Name, 18))))
-		}
-		sb.WriteString("\n")
-	}
-	if count == 0 {
-		return c.Reply("Дубликатов не найдено.", tele.ModeHTML)
-	}
-	return c.Reply(sb.String(), tele.ModeHTML)
-}
 func HandleQuality(c tele.Context) error {
 	if c.Sender() == nil || !isAdmin(c.Sender().ID) {
 		return nil
@@ -2969,9 +3259,7 @@ func HandleListWords(c tele.Context) error {
 	wordsMu.RLock()
 	list := strings.Join(badWords, ", ")
 	wordsMu.RUnlock()
-	if len(list) > 3000 {
-		list = list[:3000] + "..."
-	}
+	list = html.EscapeString(shorten(list, 3000))
 	return tryEdit(c, fmt.Sprintf("Индекс запрещенных слов: %s", list), buildWordsMenu(), tele.ModeHTML)
 }
 func HandleID(c tele.Context) error {
@@ -2981,8 +3269,24 @@ func HandleStopGame(c tele.Context) error {
 	if !isAdmin(c.Sender().ID) {
 		return nil
 	}
-	gameManager.StopGame()
-	return c.Reply("Испытание завершено.")
+	chat := c.Chat()
+	if chat != nil && chat.Type != tele.ChatPrivate {
+		if !stopGameInChat(c.Bot(), chat.ID) {
+			return c.Reply("В этом чате нет активной игры.")
+		}
+		logModAction(c.Sender().ID, "game_stop", fmt.Sprintf("%d", chat.ID), "")
+		return nil
+	}
+	// В личке: /stopgame <chat_id> или список активных игр
+	if args := c.Args(); len(args) == 1 {
+		chatID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || !stopGameInChat(c.Bot(), chatID) {
+			return c.Reply("Активная игра в этом чате не найдена.")
+		}
+		logModAction(c.Sender().ID, "game_stop", args[0], "")
+		return c.Reply("Испытание завершено.")
+	}
+	return sendActiveGames(c, false)
 }
 func HandleRandomWoman(c tele.Context) error {
 	if c.Chat() == nil {
@@ -3164,15 +3468,17 @@ func HandleSearch(c tele.Context) error {
 		return c.Reply(errMsg, tele.ModeHTML)
 	}
 	results := womanManager.SearchWomenAdvanced(filters)
-	return sendSearchResults(c, results)
+	return sendSearchResults(c, results, filters.Query)
 }
 
-func sendSearchResults(c tele.Context, results []Woman) error {
+func sendSearchResults(c tele.Context, results []Woman, query string) error {
 	if len(results) == 0 {
 		return c.Reply("Ничего не найдено.", tele.ModeHTML)
 	}
 	menu := &tele.ReplyMarkup{}
 	var rows []tele.Row
+	var sb strings.Builder
+	sb.WriteString("Результаты поиска:")
 	limit := 8
 	if len(results) < limit {
 		limit = len(results)
@@ -3181,23 +3487,46 @@ func sendSearchResults(c tele.Context, results []Woman) error {
 		w := results[i]
 		btn := menu.Data(fmt.Sprintf("%s (%s)", w.Name, w.Field), fmt.Sprintf("user_show_%d", w.ID))
 		rows = append(rows, menu.Row(btn))
+		if snippet := buildSearchSnippet(&w, query); snippet != "" {
+			sb.WriteString(fmt.Sprintf("\n\n%d. <b>%s</b>\n%s", i+1, html.EscapeString(w.Name), snippet))
+		}
 	}
 	menu.Inline(rows...)
-	return c.Reply("Результаты поиска:", menu, tele.ModeHTML)
+	return c.Reply(sb.String(), menu, tele.ModeHTML)
 }
 func HandleUserJoin(c tele.Context) error {
 	if c.Message() == nil {
 		return nil
 	}
 	c.Delete()
+	// Во время рейда участники уже ограничены: ник проверяем сразу, а капчу
+	// откладываем до снятия локдауна, чтобы не засыпать чат заданиями
+	lockdown := raidDetector.InLockdown(c.Chat().ID)
+	profile := getChatProfile(c.Chat().ID)
 	for _, u := range c.Message().UsersJoined {
-		if check, r := checkNickname(&u); check {
-			banUserImmediately(c, &u, r)
+		memberSince(c.Chat().ID, u.ID, time.Now())
+		v := profile.evaluateNickname(&u)
+		recordShadowHits(c.Chat().ID, u.ID, nicknameText(&u), v.Shadow)
+		if v.Spam {
+			enforcePolicy(c.Bot(), c.Chat(), &u, ViolationNickname, v.Reason, "Вход в чат", false)
+			continue
+		}
+		if !u.IsBot && !womanManager.IsUserVerified(u.ID) {
+			if lockdown {
+				raidDetector.QueueCaptcha(c.Chat().ID, &u)
+				continue
+			}
+			if err := startCaptcha(c.Bot(), c.Chat(), &u); err != nil {
+				log.Printf("⚠️ Не удалось отправить капчу: %v", err)
+			}
 		}
 	}
 	return nil
 }
 func HandlePhoto(c tele.Context) error {
+	if moderateMessage(c) {
+		return nil
+	}
 	if cmsService != nil {
 		if handled, err := cmsService.HandleBotCMSAdminMedia(c); handled {
 			return err
@@ -3215,7 +3544,10 @@ func HandlePhoto(c tele.Context) error {
 		}
 	}
 	if isAdmin(userID) && state == STATE_WAITING_PHOTO {
-		gameManager.SetGamePhoto(c.Message().Photo.FileID)
+		if !gameManager.SetGamePhoto(userID, c.Message().Photo.FileID) {
+			setAdminState(userID, STATE_IDLE)
+			return c.Send("Сессия истекла.")
+		}
 		setAdminState(userID, STATE_WAITING_ANSWER)
 		return c.Send("Изображение принято. Укажите верный ответ:", tele.ModeHTML)
 	}
@@ -3235,7 +3567,7 @@ func HandlePhoto(c tele.Context) error {
 		if w.WebImageURL == "" && webImageURL != "" {
 			w.WebImageURL = webImageURL
 		}
-		if err := womanManager.UpdateWoman(w); err != nil {
+		if err := womanManager.UpdateWomanBy(w, userID, "media"); err != nil {
 			log.Printf("⚠️ Ошибка обновления медиа: %v", err)
 			return c.Send("Ошибка обновления записи.")
 		}
@@ -3266,6 +3598,9 @@ func HandlePhoto(c tele.Context) error {
 	return nil
 }
 func HandleDocument(c tele.Context) error {
+	if moderateMessage(c) {
+		return nil
+	}
 	if cmsService != nil {
 		if handled, err := cmsService.HandleBotCMSAdminMedia(c); handled {
 			return err
@@ -3274,6 +3609,10 @@ func HandleDocument(c tele.Context) error {
 	userID := c.Sender().ID
 	state := getAdminState(userID)
 	if hasPermission(userID, PermImportDB) && state == STATE_WAITING_DB_IMPORT && c.Chat().Type == tele.ChatPrivate {
+		if womanManager.FilePath == "" {
+			setAdminState(userID, STATE_IDLE)
+			return c.Send("Импорт файла .db доступен только для SQLite.")
+		}
 		doc := c.Message().Document
 		if doc == nil || (!strings.HasSuffix(doc.FileName, ".db") && !strings.HasSuffix(doc.FileName, ".sqlite")) {
 			return c.Send("Формат файла не поддерживается.")
@@ -3288,6 +3627,9 @@ func HandleDocument(c tele.Context) error {
 		setAdminState(userID, STATE_WAITING_CONFIRM)
 		return c.Send("Подтвердите замену базы данных. Действие необратимо.", buildConfirmMenu(), tele.ModeHTML)
 	}
+	if hasPermission(userID, PermImportDB) && state == STATE_WAITING_CARD_IMPORT && c.Chat().Type == tele.ChatPrivate {
+		return handleCardImportDocument(c)
+	}
 	if state == STATE_WOMAN_MEDIA && strings.HasPrefix(c.Message().Document.MIME, "image/") {
 		webImageURL := ""
 		if cmsService != nil {
@@ -3368,6 +3710,12 @@ func HandleText(c tele.Context) error {
 
 	if chat.Type == tele.ChatPrivate {
 		currentState := getAdminState(user.ID)
+		if currentState == STATE_WAITING_APPEAL {
+			return submitAppeal(c, text)
+		}
+		if currentState == STATE_WAITING_APPEAL_REPLY && hasPermission(user.ID, PermModerate) {
+			return rejectAppealWithReply(c, text)
+		}
 		if isAdmin(user.ID) {
 			if currentState == STATE_WAITING_CONFIRM {
 				low := strings.ToLower(strings.TrimSpace(text))
@@ -3381,6 +3729,9 @@ func HandleText(c tele.Context) error {
 				}
 				return c.Send("Подтвердите действие кнопкой или словом: ДА.", buildConfirmMenu(), tele.ModeHTML)
 			}
+			if currentState == STATE_WAITING_CHATMOD {
+				return applyChatModInput(c, text)
+			}
 			if currentState == STATE_WAITING_WL_ADD {
 				id := extractID(text)
 				if id == 0 {
@@ -3410,7 +3761,7 @@ func HandleText(c tele.Context) error {
 				if reason == "-" {
 					reason = ""
 				}
-				if err := womanManager.DeleteWoman(id); err != nil {
+				if err := womanManager.DeleteWoman(id, user.ID, strings.TrimSpace("отклонено "+reason)); err != nil {
 					log.Printf("⚠️ Ошибка удаления записи: %v", err)
 					setAdminState(user.ID, STATE_IDLE)
 					return c.Send("Ошибка удаления записи.")
@@ -3491,7 +3842,7 @@ func HandleText(c tele.Context) error {
 					w.Tags = parseTagsText(text)
 					newVal = strings.Join(w.Tags, ", ")
 				}
-				if err := womanManager.UpdateWoman(w); err != nil {
+				if err := womanManager.UpdateWomanBy(w, user.ID, field); err != nil {
 					log.Printf("⚠️ Ошибка обновления записи: %v", err)
 				}
 				womanManager.LogChange(user.ID, w.ID, field, oldVal, newVal)
@@ -3509,7 +3860,8 @@ func HandleText(c tele.Context) error {
 			}
 			if currentState == STATE_WAITING_ADD_WORD {
 				wordsMu.Lock()
-				badWords = append(badWords, strings.ToLower(text))
+				badWords = append(badWords, normalizeWordEntry(text))
+				invalidateBadWords()
 				wordsMu.Unlock()
 				if err := saveWords(); err != nil {
 					log.Printf("⚠️ Ошибка сохранения списка слов: %v", err)
@@ -3518,18 +3870,19 @@ func HandleText(c tele.Context) error {
 				return c.Reply("Запрет наложен.", buildStaffPanelMenuForContext(c))
 			}
 			if currentState == STATE_WAITING_REMOVE_WORD {
-				needle := strings.ToLower(text)
+				needle := normalizeWordEntry(text)
 				removed := false
 				wordsMu.Lock()
 				filtered := badWords[:0]
 				for _, w := range badWords {
-					if strings.ToLower(w) == needle && !removed {
+					if normalizeWordEntry(w) == needle && !removed {
 						removed = true
 						continue
 					}
 					filtered = append(filtered, w)
 				}
 				badWords = filtered
+				invalidateBadWords()
 				wordsMu.Unlock()
 				if err := saveWords(); err != nil {
 					log.Printf("⚠️ Ошибка сохранения списка слов: %v", err)
@@ -3554,18 +3907,20 @@ func HandleText(c tele.Context) error {
 				return c.Reply("Воззвание отправлено в летопись рассылок.", buildStaffPanelMenuForContext(c), tele.ModeHTML)
 			}
 			if currentState == STATE_WAITING_ANSWER {
-				gameManager.SetGameAnswer(text)
+				if !gameManager.SetGameAnswer(user.ID, text) {
+					setAdminState(user.ID, STATE_IDLE)
+					return c.Reply("Сессия истекла.")
+				}
 				setAdminState(user.ID, STATE_WAITING_CONTEXT)
 				return c.Send("Ответ принят. Введите контекст (дополнительную информацию):", tele.ModeHTML)
 			}
 			if currentState == STATE_WAITING_CONTEXT {
-				gameManager.SetGameContext(text)
-				setAdminState(user.ID, STATE_IDLE)
-				if err := gameManager.StartGameFromState(c.Bot(), config.TargetChatID); err != nil {
-					log.Printf("⚠️ Ошибка старта игры: %v", err)
-					return c.Send("Не удалось начать испытание. Проверьте параметры.")
+				if !gameManager.SetGameContext(user.ID, text) {
+					setAdminState(user.ID, STATE_IDLE)
+					return c.Reply("Сессия истекла.")
 				}
-				return c.Send("Испытание началось.")
+				setAdminState(user.ID, STATE_IDLE)
+				return c.Send("Контекст принят. В каком чате начать испытание?", buildGameChatMenu(), tele.ModeHTML)
 			}
 		}
 		if strings.HasPrefix(currentState, "woman_") {
@@ -3584,6 +3939,7 @@ func HandleText(c tele.Context) error {
 					setAdminState(user.ID, STATE_IDLE)
 					return c.Reply("Сессия истекла.")
 				}
+				warnSimilarNames(c, name)
 				setAdminState(user.ID, STATE_WOMAN_FIELD)
 				return c.Send(fmt.Sprintf("Имя принято: <b>%s</b>\nУкажите сферу деятельности (или впишите свой вариант):", name), makeFieldsMenu(), tele.ModeHTML)
 			case STATE_WOMAN_FIELD:
@@ -3639,36 +3995,33 @@ func HandleText(c tele.Context) error {
 	}
 	if chat.ID == config.TargetChatID {
 		statsManager.TrackMessage(c)
-		if !isAdmin(user.ID) && !isWhitelisted(user.ID) {
-			isSpam, reason := checkMessageText(text)
-			if isSpam {
-				punishUser(c, user, reason)
-				return nil
+	}
+	if moderateMessage(c) {
+		return nil
+	}
+	// Игры идут в любом чате, где админ запустил загадку
+	if gameManager != nil && text != "" && chat.Type != tele.ChatPrivate && gameManager.IsActive(chat.ID) {
+		bot := c.Bot()
+		recipient := &tele.Chat{ID: chat.ID}
+		u := &tele.User{ID: user.ID, FirstName: user.FirstName, Username: user.Username}
+		guess := text
+		safeGo("game-check", func() {
+			isWin, reply, err := gameManager.CheckGuess(recipient.ID, guess, u)
+			if err != nil {
+				log.Println("Game Error:", err)
 			}
-		}
-		if gameManager != nil && gameManager.IsActive() && text != "" {
-			bot := c.Bot()
-			recipient := &tele.Chat{ID: chat.ID}
-			u := &tele.User{ID: user.ID, FirstName: user.FirstName, Username: user.Username}
-			guess := text
-			safeGo("game-check", func() {
-				isWin, reply, err := gameManager.CheckGuess(guess, u)
+			if isWin {
+				_, err = bot.Send(recipient, fmt.Sprintf("🎉 <b>Истина найдена!</b>\n👤 %s\n🔮 %s", u.FirstName, reply), tele.ModeHTML)
 				if err != nil {
-					log.Println("Game Error:", err)
+					log.Printf("⚠️ Ошибка отправки победы: %v", err)
 				}
-				if isWin {
-					_, err = bot.Send(recipient, fmt.Sprintf("🎉 <b>Истина найдена!</b>\n👤 %s\n🔮 %s", u.FirstName, reply), tele.ModeHTML)
-					if err != nil {
-						log.Printf("⚠️ Ошибка отправки победы: %v", err)
-					}
-				} else if reply != "" {
-					_, err = bot.Send(recipient, reply, tele.ModeHTML)
-					if err != nil {
-						log.Printf("⚠️ Ошибка отправки ответа: %v", err)
-					}
+			} else if reply != "" {
+				_, err = bot.Send(recipient, reply, tele.ModeHTML)
+				if err != nil {
+					log.Printf("⚠️ Ошибка отправки ответа: %v", err)
 				}
-			})
-		}
+			}
+		})
 	}
 	return nil
 }
@@ -4231,14 +4584,25 @@ func sendFavoritesPage(c tele.Context, userID int64, page int, edit bool) error
 }
 
 func buildRecommendations(userID int64) []Woman {
+	// сначала совместная фильтрация вместе с похожестью по содержанию
+	var recs []Woman
+	for _, r := range womanManager.Recommend(userID, 3) {
+		recs = append(recs, r.Woman)
+	}
+	if len(recs) >= 3 {
+		return recs
+	}
 	views := womanManager.GetRecentViews(userID, 30)
 	if len(views) == 0 {
+		if len(recs) > 0 {
+			return recs
+		}
 		return womanManager.GetRandomWomen(3)
 	}
 	viewedWomen := womanManager.GetWomenByIDs(views)
 	tagCounts := map[string]int{}
 	fieldCounts := map[string]int{}
-	viewedSet := map[uint]bool{}
+	_, viewedSet := womanManager.recHistory(userID)
 	for _, w := range viewedWomen {
 		viewedSet[w.ID] = true
 		for _, t := range w.Tags {
@@ -4264,8 +4628,10 @@ func buildRecommendations(userID int64) []Woman {
 	}
 	sort.Slice(fields, func(i, j int) bool { return fields[i].Count > fields[j].Count })
 
-	// сначала по тегам
-	var recs []Woman
+	for _, r := range recs {
+		viewedSet[r.ID] = true
+	}
+	// затем по тегам
 	if len(tags) > 0 {
 		f := SearchFilters{Tags: []string{tags[0].Key}, Limit: 10, PublishedOnly: true}
 		candidates := womanManager.SearchWomenAdvanced(f)
@@ -4291,6 +4657,9 @@ func buildRecommendations(userID int64) []Woman {
 			}
 		}
 	}
+	if len(recs) > 0 {
+		return recs
+	}
 	// запасной вариант
 	return womanManager.GetRandomWomen(3)
 }
@@ -4537,21 +4906,18 @@ func buildStatusText() string {
 	knownChats := len(womanManager.GetAllKnownChats())
 	verifiedCount := womanManager.VerifiedCount()
 
-	gameState := GameState{}
+	var games []GameState
 	if gameManager != nil {
-		gameState = gameManager.Snapshot()
+		games = gameManager.ActiveGames()
 	}
 	gameStatus := "Остановлена"
-	if gameState.IsActive {
-		gameStatus = "Активна"
-	}
-	gameMode := gameState.Mode
-	if gameMode == "" {
-		gameMode = "—"
-	}
+	gameMode := "—"
 	gameStart := "—"
-	if !gameState.StartTime.IsZero() {
-		gameStart = gameState.StartTime.Format("02.01 15:04")
+	if len(games) > 0 {
+		gameStatus = fmt.Sprintf("Активна в %d чат(ах)", len(games))
+		last := games[len(games)-1]
+		gameMode = last.Mode
+		gameStart = last.StartTime.Format("02.01 15:04")
 	}
 	theme := pickWeeklyTheme()
 	if theme == "" {
@@ -4564,11 +4930,13 @@ func buildStatusText() string {
 		"💾 Память: <b>%s</b> (alloc) | <b>%s</b> (sys)\n"+
 		"📦 DB: <b>%s</b>\n"+
 		"💬 Известных чатов: <b>%d</b>\n"+
-		"✅ Верифицированных: <b>%d</b>\n\n"+
+		"✅ Верифицированных: <b>%d</b>\n"+
+		"🛡 Капча: %s\n\n"+
 		"🗝 Тема недели: <b>%s</b>\n"+
 		"🕰 Хронограф: <b>%s</b> | Время: <b>%s</b> | LastRun: <b>%s</b>\n"+
 		"🎯 Игра: <b>%s</b> | Режим: <b>%s</b> | Старт: <b>%s</b>",
 		uptime, gor, formatBytes(alloc), formatBytes(sys), dbSize, knownChats, verifiedCount,
+		captchaStatsLine(),
 		theme,
 		scheduleStatus, scheduleTime, lastRun,
 		gameStatus, gameMode, gameStart,
@@ -4661,6 +5029,7 @@ func sendEditMenu(c tele.Context, w *Woman) error {
 	btnEditInfo := editMenu.Data("Изменить биографию", "do_edit_info")
 	btnEditTags := editMenu.Data(fmt.Sprintf("Теги: %d", len(w.Tags)), "do_edit_tags")
 	btnEditMedia := editMenu.Data("Галерея", "do_edit_media")
+	btnHistory := editMenu.Data("📜 История правок", fmt.Sprintf("%slist_%d", cbRevisionPrefix, w.ID))
 	btnDelete := editMenu.Data("Удалить из реестра", "do_edit_delete")
 	btnBack := editMenu.Data("Назад", "admin_back_main")
 	editMenu.Inline(
@@ -4670,6 +5039,7 @@ func sendEditMenu(c tele.Context, w *Woman) error {
 		editMenu.Row(btnEditInfo),
 		editMenu.Row(btnEditTags),
 		editMenu.Row(btnEditMedia),
+		editMenu.Row(btnHistory),
 		editMenu.Row(btnDelete),
 		editMenu.Row(btnBack),
 	)
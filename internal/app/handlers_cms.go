@@ -61,6 +61,12 @@ type CMSWoman struct {
 	PhotoURL  string   `json:"photo_url"`
 	Century   string   `json:"century"`
 	Spheres   []string `json:"spheres"`
+	Snippet   string   `json:"snippet,omitempty"`
+}
+
+type CMSRelatedWoman struct {
+	CMSWoman
+	Score float64 `json:"score"`
 }
 
 type CMSWomenPage struct {
@@ -200,6 +206,7 @@ func (s *CMSService) RegisterHTTPRoutes(mux *http.ServeMux) {
 		}
 		s.GetWomen(w, r)
 	})
+	mux.HandleFunc("/api/women/{id}/related", s.GetRelatedWomen)
 	mux.HandleFunc("/api/fields", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			writeCMSError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -214,6 +221,7 @@ func (s *CMSService) RegisterHTTPRoutes(mux *http.ServeMux) {
 		}
 		s.GetWomenTags(w, r)
 	})
+	mux.Handle("/cms/women/book", requireCMSAdminJWT(http.HandlerFunc(s.ExportBook)))
 	mux.Handle("/cms/events/register", requireValidUserID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeCMSError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -1186,21 +1194,16 @@ func (s *CMSService) GetWomen(w http.ResponseWriter, r *http.Request) {
 	filters.UnpublishedOnly = false
 	filters.Limit = 0
 
-	filteredWomen := womanManager.SearchWomenAdvanced(filters)
-	total := int64(len(filteredWomen))
-
-	if offset > len(filteredWomen) {
-		offset = len(filteredWomen)
+	pagedWomen, total := womanManager.SearchWomenPage(filters, limit, offset)
+	if int64(offset) > total {
+		offset = int(total)
 	}
-	end := offset + limit
-	if end > len(filteredWomen) {
-		end = len(filteredWomen)
-	}
-	pagedWomen := filteredWomen[offset:end]
 
 	items := make([]CMSWoman, 0, len(pagedWomen))
 	for i := range pagedWomen {
-		items = append(items, s.mapWomanToCMS(r.Context(), &pagedWomen[i]))
+		item := s.mapWomanToCMS(r.Context(), &pagedWomen[i])
+		item.Snippet = buildSearchSnippet(&pagedWomen[i], filters.Query)
+		items = append(items, item)
 	}
 
 	writeCMSJSON(w, http.StatusOK, CMSWomenPage{
@@ -1211,6 +1214,42 @@ func (s *CMSService) GetWomen(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetRelatedWomen: GET /api/women/{id}/related?limit=N — похожие по содержанию карточки с оценкой.
+func (s *CMSService) GetRelatedWomen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeCMSError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if womanManager == nil || womanManager.DB == nil {
+		writeCMSError(w, http.StatusInternalServerError, "women database is not initialized")
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeCMSError(w, http.StatusBadRequest, "id must be a positive integer")
+		return
+	}
+	limit := 6
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 20 {
+			writeCMSError(w, http.StatusBadRequest, "limit must be between 1 and 20")
+			return
+		}
+	}
+	woman, err := womanManager.GetWomanByID(uint(id))
+	if err != nil || woman == nil || !woman.IsPublished {
+		writeCMSError(w, http.StatusNotFound, "woman not found")
+		return
+	}
+	related := womanManager.RelatedScored(woman.ID, limit)
+	items := make([]CMSRelatedWoman, 0, len(related))
+	for i := range related {
+		items = append(items, CMSRelatedWoman{CMSWoman: s.mapWomanToCMS(r.Context(), &related[i].Woman), Score: related[i].Score})
+	}
+	writeCMSJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
 func (s *CMSService) GetWomenFields(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeCMSError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -26,6 +26,48 @@ type Config struct {
 	BotAPIUrl    string `json:"bot_api_url"`
 	CMSSiteURL   string `json:"cms_site_url"`
 	CMSJWTSecret string `json:"cms_jwt_secret"`
+
+	// Основная БД: путь к файлу SQLite или DSN Postgres (переопределяется OPHELIA_DB_DSN)
+	DBDSN string `json:"db_dsn"`
+
+	// Хранилище CMS: sqlite (по умолчанию, основная БД), postgres или mongo
+	CMSBackend     string `json:"cms_backend"`
+	CMSPostgresDSN string `json:"cms_postgres_dsn"`
+	CMSMongoURI    string `json:"cms_mongo_uri"`
+	CMSMongoDB     string `json:"cms_mongo_db"`
+
+	// Судья игры-загадки: gigachat, openai (любой OpenAI-совместимый API, включая llama.cpp/Ollama) или offline.
+	// По умолчанию gigachat при заданном google_api, иначе offline.
+	GameJudge            string   `json:"game_judge"`
+	GameJudgeURL         string   `json:"game_judge_url"` // базовый URL вида http://localhost:11434/v1
+	GameJudgeAPIKey      string   `json:"game_judge_api_key"`
+	GameJudgeModel       string   `json:"game_judge_model"`
+	GameJudgeTemperature *float64 `json:"game_judge_temperature"`
+	GameJudgeInsecureTLS *bool    `json:"game_judge_insecure_tls"` // для gigachat по умолчанию true
+
+	// Защита от рейдов (0 — значение по умолчанию, см. currentRaidSettings)
+	RaidJoinThreshold    int `json:"raid_join_threshold"`    // входов за окно до локдауна (10)
+	RaidMessageThreshold int `json:"raid_message_threshold"` // сообщений новичков за окно (20)
+	RaidWindowSeconds    int `json:"raid_window_seconds"`    // окно подсчета (60)
+	RaidSlowModeSeconds  int `json:"raid_slow_mode_seconds"` // медленный режим в локдауне (30)
+	RaidLockdownMinutes  int `json:"raid_lockdown_minutes"`  // локдаун снимается сам через (60)
+
+	// Капча: типы заданий (arithmetic, emoji, portrait, topic; пусто — все),
+	// срок прохождения в группе до кика (180) и вопросы о теме чата
+	CaptchaKinds          []string          `json:"captcha_kinds"`
+	CaptchaTimeoutSeconds int               `json:"captcha_timeout_seconds"`
+	CaptchaQuestions      []CaptchaQuestion `json:"captcha_questions"`
+
+	// Спам-фильтр: сообщения с оценкой выше порога уходят на проверку (0.9)
+	SpamScoreThreshold float64 `json:"spam_score_threshold"`
+
+	// Жалобы: столько разных участников скрывают сообщение до решения (3),
+	// лимит жалоб на участника в час (5)
+	ReportHideThreshold int `json:"report_hide_threshold"`
+	ReportsPerHour      int `json:"reports_per_hour"`
+
+	// Корзина: удаленные карточки стираются навсегда через столько дней (30)
+	TrashRetentionDays int `json:"trash_retention_days"`
 }
 
 // ==========================================
@@ -57,30 +99,44 @@ func Run() {
 	}
 	applyEnvOverrides(&config)
 
-	// 2. Инициализация Игры (GigaChat)
-	var err error
-	gameManager, err = InitGame(config.GoogleAPI)
+	// Разовые команды (например, cms-migrate) выполняются без запуска бота
+	if len(os.Args) > 1 && runCommand(os.Args[1:]) {
+		return
+	}
+
+	// 2. Инициализация менеджера женщин (SQLite или Postgres по OPHELIA_DB_DSN).
+	// Открывается первой: в этой же БД хранится статистика чата и игры.
+	womanManager = NewWomanManager(resolveDBDSN(config))
+	log.Printf("✅ База данных женщин (%s) подключена.", womanManager.Dialect.Name())
+
+	// 3. Инициализация Игры (судья: GigaChat, OpenAI-совместимый API или офлайн)
+	judge, err := newGuessJudge(config)
 	if err != nil {
-		log.Printf("⚠️ Ошибка подключения GigaChat: %v. Игровые функции могут быть ограничены.", err)
-	} else {
-		log.Println("✅ GigaChat успешно подключен.")
+		log.Printf("⚠️ Судья игры недоступен: %v. Ответы проверяются офлайн.", err)
+		judge = offlineJudge{}
 	}
+	gameManager = InitGame(judge, womanManager.DB)
+	log.Printf("✅ Судья игры: %s", judge.Name())
 
-	// 3. Загрузка списков модерации (из moderation.go)
+	// 4. Загрузка списков модерации (из moderation.go)
 	loadModerationLists()
 
-	// 4. Инициализация статистики (из stats.go)
-	statsManager = NewStatsManager(appStatsFilePath)
+	// 5. Инициализация статистики (из stats.go, старый stats.json переносится в БД)
+	statsManager = NewStatsManager(appStatsFilePath, womanManager.DB)
 	log.Printf("✅ Статистика загружена. Сообщений: %d, Забанено: %d", statsManager.Data.TotalMessages, statsManager.Data.BannedUsers)
 
-	// 5. Инициализация менеджера женщин (SQLite)
-	// ВАЖНО: Используем women.db вместо .json
-	womanManager = NewWomanManager(dbFilePath)
-	log.Println("✅ База данных женщин (SQLite) подключена.")
-
-	cmsRepo := NewPostgreSQLRepository(womanManager.DB)
-	if err := cmsRepo.InitPostgreSQL(context.Background()); err != nil {
-		log.Printf("⚠️ CMS schema init failed: %v", err)
+	cmsRepo, closeCMS, err := openCMSRepository(context.Background(), config, womanManager.DB)
+	if err != nil {
+		// Явно выбранный бэкенд не подменяем: иначе записи CMS разъедутся по двум хранилищам
+		if strings.TrimSpace(config.CMSBackend) != "" {
+			log.Fatalf("❌ CMS backend %q недоступен: %v", config.CMSBackend, err)
+		}
+		log.Printf("⚠️ CMS в основной БД недоступна: %v. Пробую еще раз без проверок бэкенда.", err)
+		fallback := NewPostgreSQLRepository(womanManager.DB)
+		if err := fallback.InitPostgreSQL(context.Background()); err != nil {
+			log.Printf("⚠️ CMS schema init failed: %v", err)
+		}
+		cmsRepo, closeCMS = fallback, func(context.Context) error { return nil }
 	}
 	cmsService = NewCMSService(cmsRepo)
 
@@ -120,6 +176,14 @@ func Run() {
 	// Он будет проверять настройки в БД и отправлять пост в нужное время
 	safeGo("scheduler", func() { StartScheduler(b, womanManager, config.TargetChatID) })
 	safeGo("housekeeping", startHousekeeping)
+	safeGo("game-timeouts", func() { gameManager.StartGameTimeoutLoop(b) })
+	safeGo("stats-flush", StartStatsFlushLoop)
+	safeGo("punishments", func() { StartPunishmentLoop(b) })
+	safeGo("raid-guard", func() { StartRaidLoop(b) })
+	safeGo("captcha", func() { StartCaptchaLoop(b) })
+	safeGo("spam-filter", StartSpamLoop)
+	safeGo("trash", StartTrashLoop)
+	safeGo("recommendations", StartRecommendLoop)
 	webAddr := os.Getenv("OPHELIA_WEB_ADDR")
 	if strings.TrimSpace(webAddr) == "" {
 		webAddr = defaultWebAddr
@@ -160,6 +224,10 @@ func Run() {
 	<-stop
 	log.Println("⏹ Завершение работы...")
 	b.Stop()
+	FlushAllStats()
+	if err := closeCMS(context.Background()); err != nil {
+		log.Printf("⚠️ Ошибка закрытия хранилища CMS: %v", err)
+	}
 	if err := womanManager.CloseDB(); err != nil {
 		log.Printf("⚠️ Ошибка закрытия БД: %v", err)
 	}
@@ -175,6 +243,18 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("OPHELIA_GIGACHAT_KEY"); v != "" {
 		cfg.GoogleAPI = v
 	}
+	if v := os.Getenv("OPHELIA_GAME_JUDGE"); v != "" {
+		cfg.GameJudge = v
+	}
+	if v := os.Getenv("OPHELIA_GAME_JUDGE_URL"); v != "" {
+		cfg.GameJudgeURL = v
+	}
+	if v := os.Getenv("OPHELIA_GAME_JUDGE_KEY"); v != "" {
+		cfg.GameJudgeAPIKey = v
+	}
+	if v := os.Getenv("OPHELIA_GAME_JUDGE_MODEL"); v != "" {
+		cfg.GameJudgeModel = v
+	}
 	if v := os.Getenv("OPHELIA_BOT_API_URL"); v != "" {
 		cfg.BotAPIUrl = v
 	}
@@ -189,4 +269,34 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("OPHELIA_CMS_JWT_SECRET"); v != "" {
 		cfg.CMSJWTSecret = v
 	}
+	if v := os.Getenv("OPHELIA_CMS_BACKEND"); v != "" {
+		cfg.CMSBackend = v
+	}
+	if v := os.Getenv("OPHELIA_CMS_POSTGRES_DSN"); v != "" {
+		cfg.CMSPostgresDSN = v
+	}
+	if v := os.Getenv("OPHELIA_CMS_MONGO_URI"); v != "" {
+		cfg.CMSMongoURI = v
+	}
+	if v := os.Getenv("OPHELIA_CMS_MONGO_DB"); v != "" {
+		cfg.CMSMongoDB = v
+	}
+}
+
+// runCommand выполняет разовую команду из аргументов запуска.
+// Возвращает false, если аргументы не являются командой и нужно стартовать бота.
+func runCommand(args []string) bool {
+	switch args[0] {
+	case "cms-migrate":
+		if err := runCMSMigrateCommand(args[1:]); err != nil {
+			log.Fatalf("❌ Миграция CMS не выполнена: %v", err)
+		}
+		return true
+	case "import":
+		if err := runImportCommand(args[1:]); err != nil {
+			log.Fatalf("❌ Импорт не выполнен: %v", err)
+		}
+		return true
+	}
+	return false
 }
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// ==========================================
+// ЕДИНАЯ ТОЧКА МОДЕРАЦИИ СООБЩЕНИЙ
+// ==========================================
+
+// moderateMessage проверяет любое сообщение в группе: текст, подписи к медиа,
+// скрытые ссылки (text_link и кнопки), пересылки из каналов, сообщения через
+// inline-ботов, контакты и геопозиции, а также правки. Какие проверки включены —
+// решает профиль чата. true — нарушение найдено и наказано.
+func moderateMessage(c tele.Context) bool {
+	msg, chat, user := c.Message(), c.Chat(), c.Sender()
+	if msg == nil || chat == nil || user == nil || chat.Type == tele.ChatPrivate || isAdmin(user.ID) || isWhitelisted(user.ID) {
+		return false
+	}
+	profile := getChatProfile(chat.ID)
+	if !profile.Enabled {
+		return false
+	}
+	memberSince(chat.ID, user.ID, time.Now())
+	var botID int64
+	if b := c.Bot(); b != nil && b.Me != nil {
+		botID = b.Me.ID
+	}
+	v := profile.evaluateMessage(msg, botID)
+	recordShadowHits(chat.ID, user.ID, c.Text(), v.Shadow)
+	if v.Spam {
+		punishUser(c, user, v.Type, v.Reason)
+		return true
+	}
+	if msg.LastEdit == 0 {
+		// Правила пройдены — оценка спам-фильтром, подозрительное уходит на проверку
+		checkSpamScore(c)
+	}
+	return false
+}
+
+// HandleEdited — правка в группе проверяется как новое сообщение (если включено
+// в профиле чата), в личке обрабатывается как обычный текст.
+func HandleEdited(c tele.Context) error {
+	if c.Chat() != nil && c.Chat().Type != tele.ChatPrivate {
+		moderateMessage(c)
+		return nil
+	}
+	return HandleText(c)
+}
+
+// HandleMedia — видео, голосовые, стикеры, контакты, места и опросы: только модерация.
+func HandleMedia(c tele.Context) error {
+	moderateMessage(c)
+	return nil
+}
+
+// ------------------------------------------
+// Проверки
+// ------------------------------------------
+
+// evaluateMessage — проверка сообщения целиком. Проверки содержимого (пересылки,
+// боты, контакты, скрытые ссылки) не касаются доверенных участников, как и ссылки в тексте.
+func (p ChatModerationProfile) evaluateMessage(m *tele.Message, botID int64) textVerdict {
+	var v textVerdict
+	if m == nil || m.Sender == nil || !p.Enabled || p.whitelisted(m.Sender.ID) {
+		return v
+	}
+	if m.LastEdit != 0 && !p.CheckEdits {
+		return v
+	}
+	userID := m.Sender.ID
+	policy := currentModerationPolicy()
+	if (p.CheckForwards || p.CheckViaBots || p.CheckContacts || p.CheckEntityLinks || p.CheckButtons) && !p.trusted(userID) {
+		if p.CheckForwards {
+			if ch := forwardedChannel(m); ch != nil && v.decide(policy, ViolationForward, "📢 Пересылка из канала "+channelName(ch)) {
+				return v
+			}
+		}
+		if p.CheckViaBots && m.Via != nil && m.Via.ID != botID && v.decide(policy, ViolationViaBot, "🤖 Сообщение через @"+m.Via.Username) {
+			return v
+		}
+		if p.CheckContacts && (m.Contact != nil || m.Location != nil || m.Venue != nil) && v.decide(policy, ViolationContact, "📇 Контакт или геопозиция") {
+			return v
+		}
+		for _, u := range p.hiddenURLs(m) {
+			if linkRegex.MatchString(p.stripAllowedLinks(u)) {
+				if v.decide(policy, ViolationLink, "🔗 Скрытая ссылка") {
+					return v
+				}
+				break
+			}
+		}
+	}
+	t := p.evaluateText(p.messageText(m), userID)
+	t.Shadow = append(v.Shadow, t.Shadow...)
+	return t
+}
+
+// messageText собирает текст, который видит читатель: сам текст, подпись
+// к медиа и текстовые поля контакта, места и опроса.
+func (p ChatModerationProfile) messageText(m *tele.Message) string {
+	parts := []string{m.Text}
+	if p.CheckCaptions {
+		parts = append(parts, m.Caption)
+	}
+	if m.Contact != nil {
+		parts = append(parts, m.Contact.FirstName, m.Contact.LastName)
+	}
+	if m.Venue != nil {
+		parts = append(parts, m.Venue.Title, m.Venue.Address)
+	}
+	if m.Poll != nil {
+		parts = append(parts, m.Poll.Question)
+		for _, o := range m.Poll.Options {
+			parts = append(parts, o.Text)
+		}
+	}
+	var out []string
+	for _, s := range parts {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// hiddenURLs — ссылки, которых нет в тексте: text_link и URL-кнопки.
+func (p ChatModerationProfile) hiddenURLs(m *tele.Message) []string {
+	var out []string
+	if p.CheckEntityLinks {
+		for _, list := range []tele.Entities{m.Entities, m.CaptionEntities} {
+			for _, e := range list {
+				if e.Type == tele.EntityTextLink && e.URL != "" {
+					out = append(out, e.URL)
+				}
+			}
+		}
+	}
+	if p.CheckButtons && m.ReplyMarkup != nil {
+		for _, row := range m.ReplyMarkup.InlineKeyboard {
+			for _, b := range row {
+				if b.URL != "" {
+					out = append(out, b.URL)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// forwardedChannel — канал, из которого переслано сообщение. Автопересылка
+// из привязанного канала в обсуждение нарушением не считается.
+func forwardedChannel(m *tele.Message) *tele.Chat {
+	if m.AutomaticForward {
+		return nil
+	}
+	if m.OriginalChat != nil && m.OriginalChat.Type == tele.ChatChannel {
+		return m.OriginalChat
+	}
+	if m.Origin != nil && m.Origin.Type == "channel" {
+		if m.Origin.Chat != nil {
+			return m.Origin.Chat
+		}
+		return &tele.Chat{Type: tele.ChatChannel}
+	}
+	return nil
+}
+
+func channelName(ch *tele.Chat) string {
+	switch {
+	case ch.Username != "":
+		return "@" + ch.Username
+	case ch.Title != "":
+		return "«" + ch.Title + "»"
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"testing"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestEvaluateMessageChecks(t *testing.T) {
+	wordsMu.Lock()
+	saved := badWords
+	badWords = []string{"казино"}
+	invalidateBadWords()
+	wordsMu.Unlock()
+	t.Cleanup(func() {
+		wordsMu.Lock()
+		badWords = saved
+		invalidateBadWords()
+		wordsMu.Unlock()
+	})
+
+	const botID = 999
+	full := ChatModerationProfile{ChatID: -300, Enabled: true, CheckLinks: true, CheckBadWords: true,
+		CheckCaptions: true, CheckEntityLinks: true, CheckButtons: true, CheckForwards: true, CheckViaBots: true, CheckContacts: true, CheckEdits: true,
+		AllowedDomains: []string{"wikipedia.org"}}
+	sender := &tele.User{ID: 1}
+	button := &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{{{Text: "Жми", URL: "https://evil.example/x"}}}}
+
+	cases := []struct {
+		name string
+		msg  tele.Message
+		want ViolationType
+	}{
+		{"clean text", tele.Message{Text: "Привет"}, ""},
+		{"caption", tele.Message{Caption: "лучшее казино"}, ViolationBadWord},
+		{"text_link", tele.Message{Text: "подробнее", Entities: tele.Entities{{Type: tele.EntityTextLink, URL: "https://evil.example"}}}, ViolationLink},
+		{"allowed text_link", tele.Message{Text: "статья", Entities: tele.Entities{{Type: tele.EntityTextLink, URL: "https://ru.wikipedia.org/wiki/Кюри"}}}, ""},
+		{"caption text_link", tele.Message{Caption: "фото", CaptionEntities: tele.Entities{{Type: tele.EntityTextLink, URL: "t.me/spam"}}}, ViolationLink},
+		{"button", tele.Message{Text: "акция", ReplyMarkup: button}, ViolationLink},
+		{"channel forward", tele.Message{Text: "реклама", OriginalChat: &tele.Chat{ID: -1001, Type: tele.ChatChannel, Title: "Ads"}}, ViolationForward},
+		{"origin forward", tele.Message{Text: "реклама", Origin: &tele.MessageOrigin{Type: "channel"}}, ViolationForward},
+		{"automatic forward", tele.Message{Text: "пост", AutomaticForward: true, OriginalChat: &tele.Chat{ID: -1001, Type: tele.ChatChannel}}, ""},
+		{"user forward", tele.Message{Text: "цитата", OriginalSender: &tele.User{ID: 7}}, ""},
+		{"via bot", tele.Message{Text: "гиф", Via: &tele.User{ID: 5, Username: "gif"}}, ViolationViaBot},
+		{"via our bot", tele.Message{Text: "карточка", Via: &tele.User{ID: botID}}, ""},
+		{"contact", tele.Message{Contact: &tele.Contact{PhoneNumber: "+70000000000", FirstName: "Менеджер"}}, ViolationContact},
+		{"venue text", tele.Message{Venue: &tele.Venue{Title: "казино", Address: "ул. Ленина"}}, ViolationContact},
+		{"poll", tele.Message{Poll: &tele.Poll{Question: "Где играть?", Options: []tele.PollOption{{Text: "казино"}}}}, ViolationBadWord},
+		{"edit", tele.Message{Text: "теперь казино", LastEdit: 1}, ViolationBadWord},
+	}
+	for _, tc := range cases {
+		m := tc.msg
+		m.Sender = sender
+		v := full.evaluateMessage(&m, botID)
+		if v.Spam != (tc.want != "") || v.Type != tc.want {
+			t.Errorf("%s: got spam=%v type=%q, want %q", tc.name, v.Spam, v.Type, tc.want)
+		}
+	}
+
+	// Отключенные проверки пропускают то же самое
+	off := ChatModerationProfile{ChatID: -300, Enabled: true, CheckLinks: true, CheckBadWords: true}
+	for _, tc := range cases {
+		if tc.name == "poll" || tc.name == "venue text" {
+			continue // текст опроса и места проверяется всегда, как обычный текст
+		}
+		m := tc.msg
+		m.Sender = sender
+		if v := off.evaluateMessage(&m, botID); v.Spam {
+			t.Errorf("%s: disabled checks must not fire: %+v", tc.name, v)
+		}
+	}
+}
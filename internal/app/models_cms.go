@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -365,7 +366,7 @@ func (r *PostgreSQLRepository) UpdateEvent(ctx context.Context, event *Event) er
 		"location":             event.Location,
 		"media_url":            event.MediaURL,
 		"max_participants":     event.MaxParticipants,
-		"current_participants": event.CurrentParticipants,
+		"current_participants": participantsJSON(event.CurrentParticipants),
 	})
 	if res.Error != nil {
 		return res.Error
@@ -406,7 +407,7 @@ func (r *PostgreSQLRepository) AddEventParticipant(ctx context.Context, eventID
 
 		event.CurrentParticipants = append(event.CurrentParticipants, userID)
 		return tx.Model(&Event{}).Where("id = ?", eventID).
-			Update("current_participants", event.CurrentParticipants).Error
+			Update("current_participants", participantsJSON(event.CurrentParticipants)).Error
 	})
 }
 
@@ -422,7 +423,7 @@ func (r *PostgreSQLRepository) RemoveEventParticipant(ctx context.Context, event
 
 		event.CurrentParticipants = removeParticipant(event.CurrentParticipants, userID)
 		return tx.Model(&Event{}).Where("id = ?", eventID).
-			Update("current_participants", event.CurrentParticipants).Error
+			Update("current_participants", participantsJSON(event.CurrentParticipants)).Error
 	})
 }
 
@@ -993,6 +994,19 @@ func ensureEventDefaults(event *Event) {
 	}
 }
 
+// participantsJSON сериализует участников вручную: Update/Updates по имени колонки
+// обходят serializer:json и записывают срез как есть.
+func participantsJSON(participants []int64) string {
+	if participants == nil {
+		participants = make([]int64, 0)
+	}
+	raw, err := json.Marshal(participants)
+	if err != nil {
+		return "[]"
+	}
+	return string(raw)
+}
+
 func containsParticipant(participants []int64, userID int64) bool {
 	for _, id := range participants {
 		if id == userID {
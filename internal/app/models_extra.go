@@ -18,6 +18,15 @@ type UserView struct {
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
+// Карточки, отправленные по личной подписке. Это не просмотр: в статистику
+// и модель рекомендаций не идут, только не дают прислать карточку повторно.
+type UserDelivery struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    int64     `gorm:"index"`
+	WomanID   uint      `gorm:"index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
 // Личные подписки на ежедневную карточку
 type UserSubscription struct {
 	UserID    int64     `gorm:"primaryKey"`
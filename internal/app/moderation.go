@@ -8,9 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
 	"sync"
-	"time"
 
 	tele "gopkg.in/telebot.v3"
 )
@@ -26,7 +24,7 @@ var (
 	badWords  []string
 
 	// МЬЮТЕКСЫ
-	wordsMu sync.RWMutex // Защищает список badWords
+	wordsMu sync.RWMutex // Защищает список badWords и его скомпилированную версию
 	listsMu sync.RWMutex // Защищает whitelist/admins
 )
 
@@ -76,126 +74,70 @@ func loadModerationLists() {
 
 	wordsMu.Lock()
 	badWords = bw
+	invalidateBadWords()
 	wordsMu.Unlock()
-}
-
-func checkMessageText(text string) (bool, string) {
-	if text == "" {
-		return false, ""
-	}
 
-	// 1. Проверка ссылок и @ (строгая)
-	if linkRegex.MatchString(text) {
-		return true, "🔗 Ссылка или @"
-	}
+	loadModerationPolicy()
+}
 
-	// 2. Проверка номеров телефонов
-	if isPhoneSpam(text) {
-		return true, "📞 Номер телефона"
-	}
+// Проверка текста сообщений — ChatModerationProfile.checkText (chat_profiles.go)
 
-	// 3. Проверка карт
-	if isCardSpam(text) {
-		return true, "💳 Номер карты"
-	}
-
-	// 4. Проверка запрещенных слов (ТОЛЬКО ЦЕЛЫЕ СЛОВА)
-	if containsBadWord(text) {
-		return true, "📝 Запрещенное слово"
-	}
+func checkNickname(user *tele.User, extraWords ...string) (bool, string) {
+	v := evaluateNickname(user, extraWords...)
+	return v.Spam, v.Reason
+}
 
-	return false, ""
+func nicknameText(user *tele.User) string {
+	return fmt.Sprintf("%s %s %s", user.FirstName, user.LastName, user.Username)
 }
 
-func checkNickname(user *tele.User) (bool, string) {
-	fullName := fmt.Sprintf("%s %s %s", user.FirstName, user.LastName, user.Username)
+// evaluateNickname — проверка ника; все причины относятся к правилу nickname,
+// теневые слова записываются отдельно (shadow_mode.go).
+func evaluateNickname(user *tele.User, extraWords ...string) textVerdict {
+	fullName := nicknameText(user)
+	var v textVerdict
+	reason := ""
 
 	// Проверка на ссылки/телефоны в нике
 	if linkRegex.MatchString(fullName) {
-		return true, "🔗 Ссылка/@ в нике"
-	}
-	if isPhoneSpam(fullName) {
-		return true, "📞 Телефон в нике"
+		reason = "🔗 Ссылка/@ в нике"
+	} else if isPhoneSpam(fullName) {
+		reason = "📞 Телефон в нике"
 	}
 
 	// Проверка на плохие слова в нике
-	if containsBadWord(fullName) {
-		return true, "📝 Запрещенное слово в нике"
+	_, hit, shadow := badWordHits(fullName, extraWords...)
+	v.addShadowWords(shadow, "📝 Запрещенное слово в нике")
+	if reason == "" && hit {
+		reason = "📝 Запрещенное слово в нике"
 	}
 
-	return false, ""
+	if reason != "" {
+		v.decide(currentModerationPolicy(), ViolationNickname, reason)
+	}
+	return v
 }
 
-// containsBadWord ищет точное совпадение и (для длинных корней) вхождение.
-// Защита от ложных срабатываний: root-check только для слов длиной >= 4
-// и с ограничением на длину суффикса/префикса (до 4 символов).
-func containsBadWord(text string) bool {
-	lowerText := strings.ToLower(text)
-	cleanText := splitRegex.ReplaceAllString(lowerText, " ")
-	messageWords := strings.Fields(cleanText)
-
-	wordsMu.RLock()
-	defer wordsMu.RUnlock()
-
-	for _, msgWord := range messageWords {
-		msgWord = strings.TrimSpace(msgWord)
-		if msgWord == "" {
-			continue
-		}
-		msgLen := len([]rune(msgWord))
-
-		for _, badWord := range badWords {
-			bw := strings.ToLower(strings.TrimSpace(badWord))
-			if bw == "" {
-				continue
-			}
-			if msgWord == bw {
-				return true
-			}
-
-			// root-check только для более длинных запрещенных корней.
-			bwLen := len([]rune(bw))
-			if bwLen < 4 || msgLen < bwLen {
-				continue
-			}
-			if !strings.Contains(msgWord, bw) {
-				continue
-			}
-
-			// Защита от слишком далеких совпадений:
-			// допускаем морфологические хвосты/префиксы до 4 символов.
-			if msgLen-bwLen <= 4 {
-				return true
-			}
-		}
-	}
-	return false
+// containsBadWord проверяет текст по общему списку и (extra) словам профиля чата.
+// Теневые записи не учитываются. Нормализация и форматы записей — badwords.go.
+func containsBadWord(text string, extra ...string) bool {
+	_, hit, _ := badWordHits(text, extra...)
+	return hit
 }
 
-// punishUser — удаляет сообщение и выдает варн
-func punishUser(c tele.Context, user *tele.User, reason string) error {
+// punishUser — удаляет сообщение (если так велит правило) и применяет политику наказаний
+func punishUser(c tele.Context, user *tele.User, vt ViolationType, reason string) error {
 	// Регистрируем нарушение в статистике
-	count := statsManager.RegisterViolation(user.ID)
+	statsManager.RegisterViolation(user.ID)
 
-	c.Delete()
-	go sendAdminReport(c.Bot(), user, "⚠️ УДАЛЕНИЕ", reason, c.Text())
-
-	if count == 1 {
-		statsManager.RegisterWarning()
-		msg, _ := c.Bot().Send(c.Chat(), fmt.Sprintf("⚠️ @%s, сообщение удалено (%s). Предупреждение 1/2.", user.Username, reason))
-		go func() { time.Sleep(90 * time.Second); c.Bot().Delete(msg) }()
-	} else if count >= 2 {
-		banUserImmediately(c, user, reason+" (x2)")
+	if msg := c.Message(); msg != nil {
+		spamFilter.TrainSpam(c.Chat().ID, msg.ID, c.Text())
 	}
-	return nil
-}
-
-// banUserImmediately — банит пользователя и отправляет отчет
-func banUserImmediately(c tele.Context, user *tele.User, reason string) error {
-	c.Bot().Ban(c.Chat(), &tele.ChatMember{User: user})
-	statsManager.RegisterBan(user.ID)
-
-	go sendAdminReport(c.Bot(), user, "🚫 БАН", reason, "Auto-ban")
+	deleted := false
+	if currentModerationPolicy().rule(vt).deletes() {
+		deleted = c.Delete() == nil
+	}
+	enforcePolicy(c.Bot(), c.Chat(), user, vt, reason, c.Text(), deleted)
 	return nil
 }
 
@@ -0,0 +1,712 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// ПОЛИТИКА НАКАЗАНИЙ
+// ==========================================
+
+// Политика задается в configs/moderation/policy.json или в БД (/policy_set).
+// Версия из БД главнее файла; без обоих действует defaultModerationPolicy —
+// старая лестница "предупреждение, затем бан".
+
+type ViolationType string
+
+const (
+	ViolationLink     ViolationType = "link"
+	ViolationPhone    ViolationType = "phone"
+	ViolationCard     ViolationType = "card"
+	ViolationBadWord  ViolationType = "bad_word"
+	ViolationNickname ViolationType = "nickname"
+	ViolationForward  ViolationType = "forward"
+	ViolationViaBot   ViolationType = "via_bot"
+	ViolationContact  ViolationType = "contact"
+	ViolationReport   ViolationType = "report" // подтвержденная модератором жалоба участников
+)
+
+var violationTypes = []ViolationType{ViolationLink, ViolationPhone, ViolationCard, ViolationBadWord, ViolationNickname, ViolationForward, ViolationViaBot, ViolationContact, ViolationReport}
+
+type PolicyAction string
+
+const (
+	ActionWarn PolicyAction = "warn"
+	ActionMute PolicyAction = "mute"
+	ActionBan  PolicyAction = "ban"
+)
+
+// policyDuration в JSON пишется строкой: "30m", "12h", "7d" (0 или "" — бессрочно).
+type policyDuration time.Duration
+
+func parsePolicyDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("неверная длительность %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("неверная длительность %q", s)
+	}
+	return d, nil
+}
+
+func (d *policyDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		// Допускаем число секунд
+		var sec int64
+		if err := json.Unmarshal(b, &sec); err != nil {
+			return fmt.Errorf("длительность должна быть строкой вида \"10m\" или \"7d\"")
+		}
+		*d = policyDuration(time.Duration(sec) * time.Second)
+		return nil
+	}
+	v, err := parsePolicyDuration(s)
+	*d = policyDuration(v)
+	return err
+}
+
+func (d policyDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d policyDuration) String() string {
+	v := time.Duration(d)
+	switch {
+	case v == 0:
+		return ""
+	case v%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", v/(24*time.Hour))
+	default:
+		return v.String()
+	}
+}
+
+type EscalationStep struct {
+	Action   PolicyAction   `json:"action"`
+	Duration policyDuration `json:"duration,omitempty"` // для mute и ban; бан без срока — навсегда
+}
+
+type ViolationRule struct {
+	Delete *bool            `json:"delete,omitempty"` // удалять сообщение (по умолчанию да)
+	Weight int              `json:"weight,omitempty"` // сколько нарушений засчитывается (по умолчанию 1)
+	Steps  []EscalationStep `json:"steps,omitempty"`  // своя лестница вместо общей
+	// Теневой режим (shadow_mode.go): правило только записывает срабатывания
+	Shadow      bool             `json:"shadow,omitempty"`
+	ShadowSteps []EscalationStep `json:"shadow_steps,omitempty"` // лестница-кандидат, сравнивается с действующей
+}
+
+type ModerationPolicy struct {
+	DecayWindow policyDuration                  `json:"decay_window"` // нарушения старше окна сгорают; 0 — не сгорают
+	Steps       []EscalationStep                `json:"steps"`
+	Rules       map[ViolationType]ViolationRule `json:"rules,omitempty"`
+}
+
+func defaultModerationPolicy() ModerationPolicy {
+	return ModerationPolicy{
+		DecayWindow: policyDuration(30 * 24 * time.Hour),
+		Steps:       []EscalationStep{{Action: ActionWarn}, {Action: ActionBan}},
+		Rules: map[ViolationType]ViolationRule{
+			// Спам-ник при входе — сразу бан, как и раньше
+			ViolationNickname: {Steps: []EscalationStep{{Action: ActionBan}}},
+		},
+	}
+}
+
+func (p ModerationPolicy) Validate() error {
+	if len(p.Steps) == 0 {
+		return errors.New("нужен хотя бы один шаг в steps")
+	}
+	checkSteps := func(where string, steps []EscalationStep) error {
+		for i, s := range steps {
+			switch s.Action {
+			case ActionWarn:
+			case ActionMute:
+				if s.Duration <= 0 {
+					return fmt.Errorf("%s[%d]: для mute нужна длительность", where, i)
+				}
+			case ActionBan:
+			default:
+				return fmt.Errorf("%s[%d]: неизвестное действие %q (warn, mute, ban)", where, i, s.Action)
+			}
+		}
+		return nil
+	}
+	if err := checkSteps("steps", p.Steps); err != nil {
+		return err
+	}
+	for vt, r := range p.Rules {
+		if !isViolationType(vt) {
+			return fmt.Errorf("неизвестный тип нарушения %q", vt)
+		}
+		if r.Weight < 0 {
+			return fmt.Errorf("rules.%s: вес не может быть отрицательным", vt)
+		}
+		if err := checkSteps("rules."+string(vt)+".steps", r.Steps); err != nil {
+			return err
+		}
+		if err := checkSteps("rules."+string(vt)+".shadow_steps", r.ShadowSteps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isViolationType(vt ViolationType) bool {
+	for _, t := range violationTypes {
+		if t == vt {
+			return true
+		}
+	}
+	return false
+}
+
+func (p ModerationPolicy) rule(vt ViolationType) ViolationRule { return p.Rules[vt] }
+
+func (r ViolationRule) deletes() bool { return r.Delete == nil || *r.Delete }
+
+func (r ViolationRule) weight() int {
+	if r.Weight <= 0 {
+		return 1
+	}
+	return r.Weight
+}
+
+func (p ModerationPolicy) ladder(vt ViolationType) []EscalationStep {
+	if steps := p.rule(vt).Steps; len(steps) > 0 {
+		return steps
+	}
+	return p.Steps
+}
+
+// stepFor выбирает ступень по числу действующих нарушений (1 — первая ступень).
+// После последней ступени повторяется последняя.
+func (p ModerationPolicy) stepFor(vt ViolationType, points int) (EscalationStep, int) {
+	steps := p.ladder(vt)
+	idx := points - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(steps) {
+		idx = len(steps) - 1
+	}
+	return steps[idx], idx
+}
+
+func describeStep(s EscalationStep) string {
+	switch s.Action {
+	case ActionWarn:
+		return "предупреждение"
+	case ActionMute:
+		return "мут на " + formatDuration(time.Duration(s.Duration))
+	case ActionBan:
+		if s.Duration > 0 {
+			return "бан на " + formatDuration(time.Duration(s.Duration))
+		}
+		return "бан"
+	}
+	return string(s.Action)
+}
+
+var (
+	modPolicyMu     sync.RWMutex
+	modPolicy       = defaultModerationPolicy()
+	modPolicySource = "по умолчанию"
+)
+
+func currentModerationPolicy() ModerationPolicy {
+	modPolicyMu.RLock()
+	defer modPolicyMu.RUnlock()
+	return modPolicy
+}
+
+func setModerationPolicy(p ModerationPolicy, source string) {
+	modPolicyMu.Lock()
+	modPolicy, modPolicySource = p, source
+	modPolicyMu.Unlock()
+}
+
+// saveModerationPolicy сохраняет политику в БД и сразу применяет ее.
+func saveModerationPolicy(p ModerationPolicy, by int64) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	row := ModerationPolicyRow{Name: defaultPolicyName, Data: string(data), UpdatedBy: by}
+	if err := womanManager.DB.Save(&row).Error; err != nil {
+		return err
+	}
+	setModerationPolicy(p, "БД")
+	return nil
+}
+
+func parseModerationPolicy(data []byte) (ModerationPolicy, error) {
+	var p ModerationPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, err
+	}
+	return p, p.Validate()
+}
+
+// loadModerationPolicy читает политику из БД, затем из policy.json.
+func loadModerationPolicy() {
+	if womanManager != nil {
+		var row ModerationPolicyRow
+		if err := womanManager.DB.Where("name = ?", defaultPolicyName).Limit(1).Find(&row).Error; err == nil && row.Data != "" {
+			p, err := parseModerationPolicy([]byte(row.Data))
+			if err == nil {
+				setModerationPolicy(p, "БД")
+				return
+			}
+			log.Printf("⚠️ Политика модерации в БД некорректна: %v", err)
+		}
+	}
+	var raw json.RawMessage
+	if err := loadJSON(policyFilePath, &raw); err == nil {
+		p, err := parseModerationPolicy(raw)
+		if err == nil {
+			setModerationPolicy(p, "policy.json")
+			return
+		}
+		log.Printf("⚠️ Файл policy.json некорректен: %v", err)
+	}
+	setModerationPolicy(defaultModerationPolicy(), "по умолчанию")
+}
+
+// ==========================================
+// ХРАНЕНИЕ НАРУШЕНИЙ И НАКАЗАНИЙ
+// ==========================================
+
+const defaultPolicyName = "default"
+
+type ModerationPolicyRow struct {
+	Name      string `gorm:"primaryKey;size:64"`
+	Data      string `gorm:"type:text"`
+	UpdatedBy int64
+	UpdatedAt time.Time
+}
+
+type ViolationRecord struct {
+	ID        uint   `gorm:"primaryKey"`
+	ChatID    int64  `gorm:"index:idx_violation_chat_user"`
+	UserID    int64  `gorm:"index:idx_violation_chat_user"`
+	Type      string `gorm:"size:32"`
+	Reason    string
+	Weight    int
+	Pardoned  bool      `gorm:"default:false"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// ModerationPunishment — действующие муты и баны. Временные баны снимает
+// StartPunishmentLoop, муты Telegram снимает сам по until_date.
+type ModerationPunishment struct {
+	ID        uint         `gorm:"primaryKey"`
+	ChatID    int64        `gorm:"index"`
+	UserID    int64        `gorm:"index"`
+	Action    PolicyAction `gorm:"size:16"`
+	Until     *time.Time   `gorm:"index"` // nil — бессрочно
+	Lifted    bool         `gorm:"default:false;index"`
+	Reason    string
+	Content   string // удаленное сообщение — для апелляции
+	CreatedAt time.Time
+}
+
+func activeViolationsQuery(db *gorm.DB, chatID, userID int64, window time.Duration, now time.Time) *gorm.DB {
+	q := db.Model(&ViolationRecord{}).Where("chat_id = ? AND user_id = ? AND pardoned = ?", chatID, userID, false)
+	if window > 0 {
+		q = q.Where("created_at > ?", now.Add(-window))
+	}
+	return q
+}
+
+// recordViolation сохраняет нарушение и возвращает сумму действующих (с учетом затухания).
+func recordViolation(db *gorm.DB, chatID, userID int64, vt ViolationType, reason string, weight int, window time.Duration, now time.Time) (int, error) {
+	rec := ViolationRecord{ChatID: chatID, UserID: userID, Type: string(vt), Reason: shorten(reason, 200), Weight: weight, CreatedAt: now}
+	if err := db.Create(&rec).Error; err != nil {
+		return 0, err
+	}
+	return activeViolationPoints(db, chatID, userID, window, now), nil
+}
+
+func activeViolationPoints(db *gorm.DB, chatID, userID int64, window time.Duration, now time.Time) int {
+	var points int
+	activeViolationsQuery(db, chatID, userID, window, now).Select("COALESCE(SUM(weight), 0)").Scan(&points)
+	return points
+}
+
+// pardonViolations снимает последнее действующее нарушение (all — все).
+// Возвращает число снятых записей.
+func pardonViolations(db *gorm.DB, chatID, userID int64, all bool) (int64, error) {
+	q := db.Model(&ViolationRecord{}).Where("chat_id = ? AND user_id = ? AND pardoned = ?", chatID, userID, false)
+	if !all {
+		var last ViolationRecord
+		if err := q.Order("created_at DESC, id DESC").Limit(1).Find(&last).Error; err != nil || last.ID == 0 {
+			return 0, err
+		}
+		q = db.Model(&ViolationRecord{}).Where("id = ?", last.ID)
+	}
+	res := q.Update("pardoned", true)
+	return res.RowsAffected, res.Error
+}
+
+func recordPunishment(db *gorm.DB, chatID, userID int64, action PolicyAction, d time.Duration, now time.Time, reason, content string) {
+	p := ModerationPunishment{ChatID: chatID, UserID: userID, Action: action, Reason: shorten(reason, 200), Content: shorten(content, 1000)}
+	if d > 0 {
+		until := now.Add(d)
+		p.Until = &until
+	}
+	if err := db.Create(&p).Error; err != nil {
+		log.Printf("⚠️ Не удалось сохранить наказание: %v", err)
+	}
+}
+
+// ==========================================
+// ПРИМЕНЕНИЕ
+// ==========================================
+
+// enforcePolicy засчитывает нарушение и применяет ступень эскалации.
+// Сообщение (если нужно) удаляет вызывающий — см. punishUser; deleted сообщает,
+// удалено ли оно на самом деле, чтобы текст предупреждения не обманывал.
+// Возвращает примененную ступень.
+func enforcePolicy(bot *tele.Bot, chat *tele.Chat, user *tele.User, vt ViolationType, reason, content string, deleted bool) EscalationStep {
+	policy := currentModerationPolicy()
+	rule := policy.rule(vt)
+	window := time.Duration(policy.DecayWindow)
+	now := time.Now()
+
+	points := 1
+	if womanManager != nil {
+		var err error
+		points, err = recordViolation(womanManager.DB, chat.ID, user.ID, vt, reason, rule.weight(), window, now)
+		if err != nil {
+			log.Printf("⚠️ Не удалось сохранить нарушение: %v", err)
+			points = rule.weight()
+		}
+	}
+	step, idx := policy.stepFor(vt, points)
+	step.Duration = policyDuration(restrictDuration(time.Duration(step.Duration)))
+	applyEscalationStep(bot, chat, user, step, reason, content, deleted)
+	if hit, ok := shadowStepHit(policy, vt, points, step); ok {
+		recordShadowHits(chat.ID, user.ID, content, []shadowHit{hit})
+	}
+
+	details := fmt.Sprintf("chat=%d type=%s points=%d step=%d %s: %s", chat.ID, vt, points, idx+1, describeStep(step), reason)
+	logModAction(0, "auto_"+string(step.Action), strconv.FormatInt(user.ID, 10), details)
+
+	if step.Action == ActionWarn {
+		ladder := policy.ladder(vt)
+		what := "предупреждение"
+		if deleted {
+			what = "сообщение удалено"
+		}
+		text := fmt.Sprintf("⚠️ %s, %s (%s). Нарушений: %d.", mentionUser(user), what, html.EscapeString(reason), points)
+		if idx+1 < len(ladder) {
+			text += " Следующее — " + describeStep(ladder[idx+1]) + "."
+		}
+		if window > 0 {
+			text += fmt.Sprintf(" Нарушения сгорают через %s.", formatDuration(window))
+		}
+		msg, err := bot.Send(chat, text, tele.ModeHTML)
+		if err == nil {
+			go func() { time.Sleep(90 * time.Second); bot.Delete(msg) }()
+		}
+	}
+	return step
+}
+
+// telegramMinRestrict — Telegram считает ограничения короче 30 секунд бессрочными.
+const telegramMinRestrict = 30 * time.Second
+
+// restrictDuration поднимает срок мута или бана до минимума Telegram (0 — навсегда).
+func restrictDuration(d time.Duration) time.Duration {
+	if d > 0 && d < telegramMinRestrict {
+		return telegramMinRestrict
+	}
+	return d
+}
+
+func applyEscalationStep(bot *tele.Bot, chat *tele.Chat, user *tele.User, step EscalationStep, reason, content string, deleted bool) {
+	d := restrictDuration(time.Duration(step.Duration))
+	step.Duration = policyDuration(d)
+	now := time.Now()
+	switch step.Action {
+	case ActionWarn:
+		if statsManager != nil {
+			statsManager.RegisterWarning()
+		}
+		title := "⚠️ ПРЕДУПРЕЖДЕНИЕ"
+		if deleted {
+			title = "⚠️ УДАЛЕНИЕ"
+		}
+		go sendAdminReport(bot, user, title, reason, content)
+	case ActionMute:
+		member := &tele.ChatMember{User: user, Rights: tele.NoRights(), RestrictedUntil: now.Add(d).Unix()}
+		if err := bot.Restrict(chat, member); err != nil {
+			log.Printf("⚠️ Не удалось замьютить %d: %v", user.ID, err)
+		}
+		if womanManager != nil {
+			recordPunishment(womanManager.DB, chat.ID, user.ID, ActionMute, d, now, reason, content)
+		}
+		msg, err := bot.Send(chat, fmt.Sprintf("🔇 %s: %s (%s).", mentionUser(user), describeStep(step), html.EscapeString(reason)), tele.ModeHTML)
+		if err == nil {
+			go func() { time.Sleep(90 * time.Second); bot.Delete(msg) }()
+		}
+		go sendAdminReport(bot, user, "🔇 МУТ "+formatDuration(d), reason, content)
+	case ActionBan:
+		member := &tele.ChatMember{User: user}
+		if d > 0 {
+			member.RestrictedUntil = now.Add(d).Unix()
+		}
+		if err := bot.Ban(chat, member); err != nil {
+			log.Printf("⚠️ Не удалось забанить %d: %v", user.ID, err)
+		}
+		if statsManager != nil {
+			statsManager.RegisterBan(user.ID)
+		}
+		if womanManager != nil {
+			recordPunishment(womanManager.DB, chat.ID, user.ID, ActionBan, d, now, reason, content)
+		}
+		go notifyBanned(bot, chat.ID, user, step, reason)
+		go sendAdminReport(bot, user, "🚫 "+strings.ToUpper(describeStep(step)), reason, content)
+	}
+}
+
+// liftPunishments снимает действующие муты и баны (при помиловании).
+func liftPunishments(bot *tele.Bot, chatID, userID int64) int {
+	if womanManager == nil {
+		return 0
+	}
+	var active []ModerationPunishment
+	womanManager.DB.Where("chat_id = ? AND user_id = ? AND lifted = ?", chatID, userID, false).
+		Where("until IS NULL OR until > ?", time.Now()).
+		Find(&active)
+	lifted := 0
+	for _, p := range active {
+		if err := liftPunishment(bot, p); err != nil {
+			log.Printf("⚠️ Не удалось снять %s с %d: %v", p.Action, p.UserID, err)
+			continue
+		}
+		lifted++
+	}
+	return lifted
+}
+
+func liftPunishment(bot *tele.Bot, p ModerationPunishment) error {
+	if bot != nil {
+		chat, user := &tele.Chat{ID: p.ChatID}, &tele.User{ID: p.UserID}
+		var err error
+		switch p.Action {
+		case ActionBan:
+			err = bot.Unban(chat, user, true)
+		case ActionMute:
+			err = bot.Restrict(chat, &tele.ChatMember{User: user, Rights: tele.NoRestrictions()})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return womanManager.DB.Model(&ModerationPunishment{}).Where("id = ?", p.ID).Update("lifted", true).Error
+}
+
+// ExpirePunishments снимает истекшие временные баны; истекшие муты только помечаются.
+func ExpirePunishments(bot *tele.Bot) {
+	if womanManager == nil {
+		return
+	}
+	var due []ModerationPunishment
+	now := time.Now()
+	womanManager.DB.Where("lifted = ? AND until IS NOT NULL AND until <= ?", false, now).Find(&due)
+	for _, p := range due {
+		if p.Action == ActionMute {
+			womanManager.DB.Model(&ModerationPunishment{}).Where("id = ?", p.ID).Update("lifted", true)
+			continue
+		}
+		if err := liftPunishment(bot, p); err != nil {
+			log.Printf("⚠️ Не удалось снять бан с %d: %v", p.UserID, err)
+			continue
+		}
+		logModAction(0, "auto_unban", strconv.FormatInt(p.UserID, 10), fmt.Sprintf("chat=%d", p.ChatID))
+	}
+}
+
+func StartPunishmentLoop(bot *tele.Bot) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		ExpirePunishments(bot)
+	}
+}
+
+// moderationReviewers — админы и модераторы с правом модерации (очереди проверки).
+func moderationReviewers() []int64 {
+	ids := getAdmins()
+	if womanManager != nil {
+		for _, id := range womanManager.ListModerators() {
+			if !isAdmin(id) && hasPermission(id, PermModerate) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func mentionUser(u *tele.User) string {
+	name := u.FirstName
+	if u.Username != "" {
+		name = "@" + u.Username
+	}
+	if name == "" {
+		name = strconv.FormatInt(u.ID, 10)
+	}
+	return fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, u.ID, html.EscapeString(name))
+}
+
+// ==========================================
+// КОМАНДЫ ПЕРСОНАЛА
+// ==========================================
+
+// moderationTarget берет пользователя из реплая или первого аргумента.
+// Чат — текущая группа или целевой чат из конфига (в личке).
+func moderationTarget(c tele.Context) (chatID, userID int64) {
+	chatID = config.TargetChatID
+	if c.Chat() != nil && c.Chat().Type != tele.ChatPrivate {
+		chatID = c.Chat().ID
+	}
+	if msg := c.Message(); msg != nil && msg.ReplyTo != nil && msg.ReplyTo.Sender != nil {
+		return chatID, msg.ReplyTo.Sender.ID
+	}
+	if args := c.Args(); len(args) > 0 {
+		userID, _ = strconv.ParseInt(args[0], 10, 64)
+	}
+	return chatID, userID
+}
+
+func HandleViolations(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermModerate) || womanManager == nil {
+		return nil
+	}
+	chatID, userID := moderationTarget(c)
+	if userID == 0 {
+		return c.Reply("Используйте: /violations <code>&lt;user_id&gt;</code> или ответом на сообщение", tele.ModeHTML)
+	}
+	policy := currentModerationPolicy()
+	window := time.Duration(policy.DecayWindow)
+	var recs []ViolationRecord
+	activeViolationsQuery(womanManager.DB, chatID, userID, window, time.Now()).Order("created_at DESC").Limit(15).Find(&recs)
+	points := activeViolationPoints(womanManager.DB, chatID, userID, window, time.Now())
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("👮 <b>Нарушения %d</b> в чате %s\nДействующих: <b>%d</b>\n", userID, html.EscapeString(formatChatName(chatID)), points))
+	for _, r := range recs {
+		sb.WriteString(fmt.Sprintf("• %s — %s (%s)\n", r.CreatedAt.Format("02.01 15:04"), html.EscapeString(r.Reason), r.Type))
+	}
+	var active []ModerationPunishment
+	womanManager.DB.Where("chat_id = ? AND user_id = ? AND lifted = ?", chatID, userID, false).Find(&active)
+	for _, p := range active {
+		until := "бессрочно"
+		if p.Until != nil {
+			until = "до " + p.Until.Format("02.01 15:04")
+		}
+		sb.WriteString(fmt.Sprintf("⛔ %s %s\n", p.Action, until))
+	}
+	return c.Reply(sb.String(), tele.ModeHTML)
+}
+
+func handlePardon(c tele.Context, all bool) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermModerate) || womanManager == nil {
+		return nil
+	}
+	chatID, userID := moderationTarget(c)
+	if userID == 0 {
+		cmd := "/pardon"
+		if all {
+			cmd = "/resetviolations"
+		}
+		return c.Reply("Используйте: "+cmd+" <code>&lt;user_id&gt;</code> или ответом на сообщение", tele.ModeHTML)
+	}
+	n, err := pardonViolations(womanManager.DB, chatID, userID, all)
+	if err != nil {
+		return c.Reply("Ошибка: "+html.EscapeString(err.Error()), tele.ModeHTML)
+	}
+	lifted := liftPunishments(c.Bot(), chatID, userID)
+	if all && statsManager != nil {
+		statsManager.ClearViolations(userID)
+	}
+	action := "pardon"
+	if all {
+		action = "violations_reset"
+	}
+	logModAction(c.Sender().ID, action, strconv.FormatInt(userID, 10), fmt.Sprintf("chat=%d pardoned=%d lifted=%d", chatID, n, lifted))
+	return c.Reply(fmt.Sprintf("✅ Снято нарушений: %d, снято ограничений: %d.", n, lifted), tele.ModeHTML)
+}
+
+func HandlePardon(c tele.Context) error { return handlePardon(c, false) }
+
+func HandleResetViolations(c tele.Context) error { return handlePardon(c, true) }
+
+func HandlePolicy(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermModerate) {
+		return nil
+	}
+	modPolicyMu.RLock()
+	p, source := modPolicy, modPolicySource
+	modPolicyMu.RUnlock()
+	data, _ := json.MarshalIndent(p, "", "  ")
+	text := fmt.Sprintf("🛡 <b>Политика модерации</b> (источник: %s)\n<pre>%s</pre>", source, html.EscapeString(string(data)))
+	if isAdmin(c.Sender().ID) {
+		text += "\nИзменить: /policy_set <code>{json}</code>, вернуть файл/умолчания: /policy_reset"
+	}
+	return c.Reply(text, tele.ModeHTML)
+}
+
+func HandlePolicySet(c tele.Context) error {
+	if c.Sender() == nil || !isAdmin(c.Sender().ID) || womanManager == nil {
+		return nil
+	}
+	raw := strings.TrimSpace(c.Message().Payload)
+	if raw == "" {
+		return c.Reply("Используйте: /policy_set <code>{\"decay_window\":\"30d\",\"steps\":[{\"action\":\"warn\"},{\"action\":\"mute\",\"duration\":\"1h\"},{\"action\":\"ban\"}]}</code>", tele.ModeHTML)
+	}
+	p, err := parseModerationPolicy([]byte(raw))
+	if err != nil {
+		return c.Reply("❌ Политика не принята: "+html.EscapeString(err.Error()), tele.ModeHTML)
+	}
+	if err := saveModerationPolicy(p, c.Sender().ID); err != nil {
+		return c.Reply("Ошибка сохранения: "+html.EscapeString(err.Error()), tele.ModeHTML)
+	}
+	data, _ := json.Marshal(p)
+	logModAction(c.Sender().ID, "policy_set", defaultPolicyName, string(data))
+	return c.Reply("✅ Политика модерации обновлена.", tele.ModeHTML)
+}
+
+func HandlePolicyReset(c tele.Context) error {
+	if c.Sender() == nil || !isAdmin(c.Sender().ID) || womanManager == nil {
+		return nil
+	}
+	womanManager.DB.Where("name = ?", defaultPolicyName).Delete(&ModerationPolicyRow{})
+	loadModerationPolicy()
+	logModAction(c.Sender().ID, "policy_reset", defaultPolicyName, "")
+	modPolicyMu.RLock()
+	source := modPolicySource
+	modPolicyMu.RUnlock()
+	return c.Reply("✅ Политика из БД удалена. Действует: "+source+".", tele.ModeHTML)
+}
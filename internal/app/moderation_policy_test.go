@@ -0,0 +1,167 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestModerationPolicyParse(t *testing.T) {
+	p, err := parseModerationPolicy([]byte(`{"decay_window": "7d",
+		"steps": [{"action": "warn"}, {"action": "mute", "duration": "90m"}, {"action": "ban", "duration": "2d"}],
+		"rules": {"card": {"weight": 2, "delete": false}, "nickname": {"steps": [{"action": "ban"}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(p.DecayWindow) != 7*24*time.Hour || time.Duration(p.Steps[1].Duration) != 90*time.Minute {
+		t.Fatalf("durations parsed wrong: %+v", p)
+	}
+	if p.rule(ViolationCard).deletes() || !p.rule(ViolationLink).deletes() || p.rule(ViolationCard).weight() != 2 {
+		t.Fatal("rule defaults applied wrong")
+	}
+
+	cases := []struct {
+		vt     ViolationType
+		points int
+		want   PolicyAction
+	}{
+		{ViolationLink, 1, ActionWarn},
+		{ViolationLink, 2, ActionMute},
+		{ViolationLink, 3, ActionBan},
+		{ViolationLink, 10, ActionBan},
+		{ViolationNickname, 1, ActionBan},
+	}
+	for _, tc := range cases {
+		if step, _ := p.stepFor(tc.vt, tc.points); step.Action != tc.want {
+			t.Errorf("%s x%d: got %s, want %s", tc.vt, tc.points, step.Action, tc.want)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"steps": []}`,
+		`{"steps": [{"action": "mute"}]}`,
+		`{"steps": [{"action": "kick"}]}`,
+		`{"steps": [{"action": "warn"}], "rules": {"spam": {}}}`,
+		`{"steps": [{"action": "ban", "duration": "soon"}]}`,
+	} {
+		if _, err := parseModerationPolicy([]byte(bad)); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestViolationDecayAndPardon(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&ViolationRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	const chat, user = -100, 7
+	window := 24 * time.Hour
+	now := time.Now()
+
+	// Старое нарушение за пределами окна не учитывается
+	if _, err := recordViolation(db, chat, user, ViolationLink, "old", 1, window, now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := recordViolation(db, chat, user, ViolationLink, "a", 1, window, now); n != 1 {
+		t.Fatalf("expired violation must decay, got %d points", n)
+	}
+	if n, _ := recordViolation(db, chat, user, ViolationCard, "b", 2, window, now); n != 3 {
+		t.Fatalf("weights must add up, got %d points", n)
+	}
+	if n, _ := recordViolation(db, -200, user, ViolationLink, "other chat", 1, window, now); n != 1 {
+		t.Fatalf("violations are counted per chat, got %d", n)
+	}
+
+	if n, err := pardonViolations(db, chat, user, false); err != nil || n != 1 {
+		t.Fatalf("pardon must remove one record: %d, %v", n, err)
+	}
+	if p := activeViolationPoints(db, chat, user, window, now); p != 1 {
+		t.Fatalf("expected 1 point after pardon, got %d", p)
+	}
+	if _, err := pardonViolations(db, chat, user, true); err != nil {
+		t.Fatal(err)
+	}
+	if p := activeViolationPoints(db, chat, user, 0, now); p != 0 {
+		t.Fatalf("reset must clear the whole record, got %d", p)
+	}
+}
+
+// botCall — запрос к Bot API, перехваченный newRecordingBot.
+type botCall struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// newRecordingBot — бот, отвечающий «ok» на любой вызов и запоминающий вызовы.
+func newRecordingBot(t *testing.T) (*tele.Bot, func() []botCall) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []botCall
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		mu.Lock()
+		calls = append(calls, botCall{Method: path.Base(r.URL.Path), Params: params})
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`))
+	}))
+	t.Cleanup(srv.Close)
+	bot, err := tele.NewBot(tele.Settings{Token: "test", URL: srv.URL, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot, func() []botCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]botCall(nil), calls...)
+	}
+}
+
+func TestEnforcePolicyActions(t *testing.T) {
+	wm := newTestWomanManager(t)
+	saved := womanManager
+	womanManager = wm
+	savedPolicy, savedSource := currentModerationPolicy(), modPolicySource
+	t.Cleanup(func() {
+		womanManager = saved
+		setModerationPolicy(savedPolicy, savedSource)
+	})
+	setModerationPolicy(ModerationPolicy{Steps: []EscalationStep{{Action: ActionWarn}, {Action: ActionMute, Duration: policyDuration(10 * time.Second)}}}, "test")
+
+	bot, calls := newRecordingBot(t)
+	chat, user := &tele.Chat{ID: -100}, &tele.User{ID: 7, FirstName: "Spam"}
+	enforcePolicy(bot, chat, user, ViolationLink, "ссылка", "http://x", false)
+	if got := calls(); len(got) != 1 || strings.Contains(got[0].Params["text"].(string), "удалено") {
+		t.Fatalf("kept message must not be reported as deleted: %+v", got)
+	}
+	enforcePolicy(bot, chat, user, ViolationLink, "ссылка", "http://x", true)
+
+	var restrict *botCall
+	for _, c := range calls() {
+		if c.Method == "restrictChatMember" {
+			c := c
+			restrict = &c
+		}
+	}
+	if restrict == nil {
+		t.Fatal("second violation must mute")
+	}
+	until, _ := strconv.ParseInt(restrict.Params["until_date"].(string), 10, 64)
+	if left := time.Until(time.Unix(until, 0)); left < 25*time.Second {
+		t.Fatalf("short mute must be raised to Telegram minimum, got %s", left)
+	}
+	var p ModerationPunishment
+	wm.DB.Where("user_id = ? AND action = ?", user.ID, ActionMute).First(&p)
+	if p.Until == nil || p.Until.Sub(p.CreatedAt) < telegramMinRestrict-time.Second {
+		t.Fatalf("stored mute must match the applied one: %+v", p)
+	}
+}
@@ -38,3 +38,34 @@ func TestParseTagsText(t *testing.T) {
 		t.Fatalf("expected 4 tags, got %d: %#v", len(tags), tags)
 	}
 }
+
+func TestStemRussian(t *testing.T) {
+	pairs := [][2]string{
+		{"поэтесса", "поэтессой"},
+		{"математика", "математике"},
+		{"писательница", "писательницы"},
+		{"Ёлка", "елки"},
+	}
+	for _, p := range pairs {
+		if a, b := stemRussian(p[0]), stemRussian(p[1]); a != b {
+			t.Fatalf("stemRussian(%q)=%q, stemRussian(%q)=%q; want equal", p[0], a, p[1], b)
+		}
+	}
+}
+
+func TestNewDBDialect(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"", dialectSQLite},
+		{"storage/db/women.db", dialectSQLite},
+		{"postgres://ophelia:secret@db:5432/ophelia?sslmode=disable", dialectPostgres},
+		{"host=localhost user=ophelia dbname=ophelia", dialectPostgres},
+	}
+	for _, tt := range tests {
+		if got := newDBDialect(tt.dsn).Name(); got != tt.want {
+			t.Fatalf("newDBDialect(%q) = %s; want %s", tt.dsn, got, tt.want)
+		}
+	}
+}
@@ -31,6 +31,7 @@ var (
 	whitelistFilePath = filepath.Join(dirModeration, "whitelist.json")
 	wordsFilePath     = filepath.Join(dirModeration, "words.json")
 	adminFilePath     = filepath.Join(dirModeration, "admin.json")
+	policyFilePath    = filepath.Join(dirModeration, "policy.json")
 
 	logFilePath = filepath.Join(dirLogs, "bot.log")
 	errLogPath  = filepath.Join(dirLogs, "errors.log")
@@ -13,12 +13,14 @@ const (
 	PermModerators  Permission = "moderators"
 	PermCollections Permission = "collections"
 	PermAudit       Permission = "audit"
+	PermModerate    Permission = "moderate" // помилование и просмотр нарушений
 )
 
 var rolePermissions = map[string]map[Permission]bool{
 	"moderator": {
-		PermEdit:  true,
-		PermAudit: true,
+		PermEdit:     true,
+		PermAudit:    true,
+		PermModerate: true,
 	},
 	"editor": {
 		PermEdit:        true,
@@ -0,0 +1,519 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// ==========================================
+// ЗАЩИТА ОТ РЕЙДОВ
+// ==========================================
+
+// Детектор считает входы и сообщения новичков по каждому чату. При превышении
+// порога чат переходит в локдаун: новые участники ограничиваются, остальные
+// пишут не чаще раза в raid_slow_mode_seconds (Bot API не умеет включать slow mode, его
+// соблюдает бот), сообщения новичков придерживаются до решения персонала.
+
+const (
+	raidNewMemberAge = 10 * time.Minute // "новичок" — вошел не раньше этого срока
+	raidMaxHeld      = 200
+)
+
+type raidSettings struct {
+	JoinThreshold    int
+	MessageThreshold int
+	Window           time.Duration
+	SlowMode         time.Duration
+	LockdownMax      time.Duration
+}
+
+func currentRaidSettings() raidSettings {
+	s := raidSettings{JoinThreshold: 10, MessageThreshold: 20, Window: time.Minute, SlowMode: 30 * time.Second, LockdownMax: time.Hour}
+	if config.RaidJoinThreshold > 0 {
+		s.JoinThreshold = config.RaidJoinThreshold
+	}
+	if config.RaidMessageThreshold > 0 {
+		s.MessageThreshold = config.RaidMessageThreshold
+	}
+	if config.RaidWindowSeconds > 0 {
+		s.Window = time.Duration(config.RaidWindowSeconds) * time.Second
+	}
+	if config.RaidSlowModeSeconds > 0 {
+		s.SlowMode = time.Duration(config.RaidSlowModeSeconds) * time.Second
+	}
+	if config.RaidLockdownMinutes > 0 {
+		s.LockdownMax = time.Duration(config.RaidLockdownMinutes) * time.Minute
+	}
+	return s
+}
+
+type raidMember struct {
+	ID       int64
+	Name     string
+	JoinedAt time.Time
+}
+
+type heldMessage struct {
+	UserID int64
+	Name   string
+	Text   string
+}
+
+type raidChat struct {
+	joins     []time.Time
+	newMsgs   []time.Time
+	newcomers map[int64]raidMember
+
+	lockdown  bool
+	since     time.Time
+	reason    string
+	wave      map[int64]raidMember // ограничены до решения персонала
+	held      []heldMessage
+	heldTotal int
+	lastPost  map[int64]time.Time
+	summaries []*tele.Message
+	captchas  []raidMember // вошли во время локдауна: капча выдается после снятия
+}
+
+type RaidDetector struct {
+	mu       sync.Mutex
+	chats    map[int64]*raidChat
+	settings func() raidSettings
+}
+
+type raidVerdict int
+
+const (
+	raidPass     raidVerdict = iota
+	raidStart                // порог превышен только что — чат уходит в локдаун
+	raidHold                 // сообщение новичка во время локдауна
+	raidSlowDrop             // нарушение медленного режима
+)
+
+var raidDetector = newRaidDetector(currentRaidSettings)
+
+func newRaidDetector(settings func() raidSettings) *RaidDetector {
+	return &RaidDetector{chats: make(map[int64]*raidChat), settings: settings}
+}
+
+func (d *RaidDetector) chat(chatID int64) *raidChat {
+	rc, ok := d.chats[chatID]
+	if !ok {
+		rc = &raidChat{newcomers: make(map[int64]raidMember), wave: make(map[int64]raidMember), lastPost: make(map[int64]time.Time)}
+		d.chats[chatID] = rc
+	}
+	return rc
+}
+
+func pruneTimes(ts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && !ts[i].After(cutoff) {
+		i++
+	}
+	return ts[i:]
+}
+
+// startLockdownLocked переводит чат в локдаун; в волну попадают все, кто вошел за окно.
+func (rc *raidChat) startLockdownLocked(now time.Time, window time.Duration, reason string) {
+	rc.lockdown = true
+	rc.since = now
+	rc.reason = reason
+	for id, m := range rc.newcomers {
+		if !m.JoinedAt.Before(now.Add(-window)) {
+			rc.wave[id] = m
+		}
+	}
+}
+
+// Join учитывает вход участника. started — локдаун начался этим входом,
+// locked — чат в локдауне (нового участника нужно ограничить).
+func (d *RaidDetector) Join(chatID int64, user *tele.User, now time.Time) (started, locked bool) {
+	s := d.settings()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rc := d.chat(chatID)
+	m := raidMember{ID: user.ID, Name: strings.TrimSpace(user.FirstName + " " + user.LastName), JoinedAt: now}
+	rc.newcomers[user.ID] = m
+	if rc.lockdown {
+		rc.wave[user.ID] = m
+		return false, true
+	}
+	rc.joins = append(pruneTimes(rc.joins, now.Add(-s.Window)), now)
+	if len(rc.joins) >= s.JoinThreshold {
+		rc.startLockdownLocked(now, s.Window, fmt.Sprintf("%d входов за %s", len(rc.joins), formatDuration(s.Window)))
+		return true, true
+	}
+	return false, false
+}
+
+// Message учитывает сообщение участника и решает, что с ним делать.
+func (d *RaidDetector) Message(chatID int64, user *tele.User, text string, now time.Time) raidVerdict {
+	s := d.settings()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rc, ok := d.chats[chatID]
+	if !ok {
+		return raidPass
+	}
+	m, newcomer := rc.newcomers[user.ID]
+	newcomer = newcomer && now.Sub(m.JoinedAt) < raidNewMemberAge
+
+	if !rc.lockdown {
+		if !newcomer {
+			return raidPass
+		}
+		rc.newMsgs = append(pruneTimes(rc.newMsgs, now.Add(-s.Window)), now)
+		if len(rc.newMsgs) < s.MessageThreshold {
+			return raidPass
+		}
+		rc.startLockdownLocked(now, raidNewMemberAge, fmt.Sprintf("%d сообщений новичков за %s", len(rc.newMsgs), formatDuration(s.Window)))
+		rc.holdLocked(user, text)
+		return raidStart
+	}
+	if newcomer {
+		rc.wave[user.ID] = m
+		rc.holdLocked(user, text)
+		return raidHold
+	}
+	if last, ok := rc.lastPost[user.ID]; ok && now.Sub(last) < s.SlowMode {
+		return raidSlowDrop
+	}
+	rc.lastPost[user.ID] = now
+	return raidPass
+}
+
+// DropEdit — правку нужно удалить: во время локдауна новичок правит свое сообщение.
+// Правки не считаются новыми сообщениями: не запускают локдаун, не попадают
+// в придержанные и не ограничиваются медленным режимом.
+func (d *RaidDetector) DropEdit(chatID, userID int64, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rc, ok := d.chats[chatID]
+	if !ok || !rc.lockdown {
+		return false
+	}
+	m, newcomer := rc.newcomers[userID]
+	return newcomer && now.Sub(m.JoinedAt) < raidNewMemberAge
+}
+
+func (rc *raidChat) holdLocked(user *tele.User, text string) {
+	rc.heldTotal++
+	if text == "" || len(rc.held) >= raidMaxHeld {
+		return
+	}
+	rc.held = append(rc.held, heldMessage{UserID: user.ID, Name: user.FirstName, Text: text})
+}
+
+func (d *RaidDetector) InLockdown(chatID int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rc, ok := d.chats[chatID]
+	return ok && rc.lockdown
+}
+
+// raidOutcome — то, что нужно разобрать после снятия локдауна.
+type raidOutcome struct {
+	Wave      []raidMember
+	Held      []heldMessage
+	HeldTotal int
+	Summaries []*tele.Message
+	Since     time.Time
+	Captchas  []raidMember
+}
+
+// Resolve завершает локдаун и отдает волну и придержанные сообщения.
+func (d *RaidDetector) Resolve(chatID int64) (raidOutcome, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rc, ok := d.chats[chatID]
+	if !ok || (len(rc.wave) == 0 && !rc.lockdown) {
+		return raidOutcome{}, false
+	}
+	out := raidOutcome{Held: rc.held, HeldTotal: rc.heldTotal, Summaries: rc.summaries, Since: rc.since, Captchas: rc.captchas}
+	for _, m := range rc.wave {
+		out.Wave = append(out.Wave, m)
+	}
+	delete(d.chats, chatID)
+	return out, true
+}
+
+// QueueCaptcha откладывает капчу участника, вошедшего во время локдауна,
+// до решения персонала: ограниченный участник все равно не может писать.
+func (d *RaidDetector) QueueCaptcha(chatID int64, user *tele.User) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rc := d.chat(chatID)
+	rc.captchas = append(rc.captchas, raidMember{ID: user.ID, Name: user.FirstName, JoinedAt: time.Now()})
+}
+
+func (d *RaidDetector) addSummary(chatID int64, msg *tele.Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rc, ok := d.chats[chatID]; ok {
+		rc.summaries = append(rc.summaries, msg)
+	}
+}
+
+// snapshot — данные для сводки персоналу.
+func (d *RaidDetector) snapshot(chatID int64) (reason string, wave int, held int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rc, ok := d.chats[chatID]; ok {
+		return rc.reason, len(rc.wave), rc.heldTotal
+	}
+	return "", 0, 0
+}
+
+// Expire снимает режим локдауна по таймеру (волна остается ограниченной до решения)
+// и забывает старые входы. Возвращает чаты, где локдаун закончился.
+func (d *RaidDetector) Expire(now time.Time) []int64 {
+	s := d.settings()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var ended []int64
+	for id, rc := range d.chats {
+		if rc.lockdown && now.Sub(rc.since) >= s.LockdownMax {
+			rc.lockdown = false
+			rc.lastPost = make(map[int64]time.Time)
+			ended = append(ended, id)
+		}
+		for uid, m := range rc.newcomers {
+			if now.Sub(m.JoinedAt) >= raidNewMemberAge {
+				delete(rc.newcomers, uid)
+			}
+		}
+		rc.joins = pruneTimes(rc.joins, now.Add(-s.Window))
+		rc.newMsgs = pruneTimes(rc.newMsgs, now.Add(-s.Window))
+		if !rc.lockdown && len(rc.wave) == 0 && len(rc.newcomers) == 0 {
+			delete(d.chats, id)
+		}
+	}
+	return ended
+}
+
+// ==========================================
+// ДЕЙСТВИЯ БОТА
+// ==========================================
+
+// raidGuard вызывается из Middleware для групповых апдейтов не-персонала.
+// Возвращает true, если апдейт поглощен (сообщение удалено или придержано).
+// Учитываются только новые сообщения: нажатия кнопок проходят как есть
+// (c.Message() у них — сообщение самого бота), а правки новичков во время
+// локдауна просто удаляются.
+func raidGuard(c tele.Context) bool {
+	if c.Chat() == nil || c.Callback() != nil {
+		return false
+	}
+	chat, bot, now := c.Chat(), c.Bot(), time.Now()
+	if c.Update().EditedMessage != nil {
+		if c.Sender() != nil && raidDetector.DropEdit(chat.ID, c.Sender().ID, now) {
+			c.Delete()
+			return true
+		}
+		return false
+	}
+	msg := c.Update().Message
+	if msg == nil {
+		return false
+	}
+
+	joined := msg.UsersJoined
+	if msg.UserJoined != nil && len(joined) == 0 {
+		joined = []tele.User{*msg.UserJoined}
+	}
+	if len(joined) > 0 {
+		for i := range joined {
+			u := &joined[i]
+			if u.IsBot && u.ID == bot.Me.ID {
+				continue
+			}
+			started, locked := raidDetector.Join(chat.ID, u, now)
+			if started {
+				startLockdown(bot, chat)
+			} else if locked {
+				restrictRaider(bot, chat.ID, u.ID)
+			}
+		}
+		return false
+	}
+
+	switch raidDetector.Message(chat.ID, c.Sender(), c.Text(), now) {
+	case raidStart:
+		c.Delete()
+		startLockdown(bot, chat)
+		return true
+	case raidHold, raidSlowDrop:
+		c.Delete()
+		return true
+	}
+	return false
+}
+
+func restrictRaider(bot *tele.Bot, chatID, userID int64) {
+	member := &tele.ChatMember{User: &tele.User{ID: userID}, Rights: tele.NoRights()}
+	if err := bot.Restrict(&tele.Chat{ID: chatID}, member); err != nil {
+		log.Printf("⚠️ Не удалось ограничить %d в %d: %v", userID, chatID, err)
+	}
+}
+
+func startLockdown(bot *tele.Bot, chat *tele.Chat) {
+	reason, wave, _ := raidDetector.snapshot(chat.ID)
+	log.Printf("🚨 Рейд в чате %d: %s, в волне %d", chat.ID, reason, wave)
+	logModAction(0, "raid_lockdown", strconv.FormatInt(chat.ID, 10), fmt.Sprintf("%s; wave=%d", reason, wave))
+
+	safeGo("raid-restrict", func() {
+		out, ok := raidDetector.waveIDs(chat.ID)
+		if !ok {
+			return
+		}
+		for _, id := range out {
+			restrictRaider(bot, chat.ID, id)
+		}
+	})
+
+	s := currentRaidSettings()
+	announce := fmt.Sprintf("🚨 <b>Чат временно закрыт от рейда.</b>\nНовые участники ограничены, медленный режим: одно сообщение в %s. Модераторы уже разбираются.", formatDuration(s.SlowMode))
+	if _, err := bot.Send(chat, announce, tele.ModeHTML); err != nil {
+		log.Printf("⚠️ Не удалось объявить локдаун: %v", err)
+	}
+	sendRaidSummary(bot, chat.ID)
+}
+
+func (d *RaidDetector) waveIDs(chatID int64) ([]int64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rc, ok := d.chats[chatID]
+	if !ok {
+		return nil, false
+	}
+	ids := make([]int64, 0, len(rc.wave))
+	for id := range rc.wave {
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+func buildRaidMenu(chatID int64) *tele.ReplyMarkup {
+	m := &tele.ReplyMarkup{}
+	m.Inline(m.Row(
+		m.Data("🔓 Снять локдаун", fmt.Sprintf("raid_lift_%d", chatID)),
+		m.Data("🔨 Забанить волну", fmt.Sprintf("raid_ban_%d", chatID)),
+	))
+	return m
+}
+
+// sendRaidSummary отправляет админам одну сводку вместо отчета на каждого участника.
+func sendRaidSummary(bot *tele.Bot, chatID int64) {
+	reason, wave, held := raidDetector.snapshot(chatID)
+	name := formatChatName(chatID)
+	if name == "" {
+		name = strconv.FormatInt(chatID, 10)
+	}
+	text := fmt.Sprintf("🚨 <b>РЕЙД</b> в %s\n❓ %s\n👥 В волне: %d\n✉️ Придержано сообщений: %d\n\nНовые участники ограничены до вашего решения.",
+		html.EscapeString(name), html.EscapeString(reason), wave, held)
+	for _, adminID := range getAdmins() {
+		msg, err := bot.Send(&tele.User{ID: adminID}, text, buildRaidMenu(chatID), tele.ModeHTML)
+		if err != nil {
+			log.Printf("⚠️ Не удалось отправить сводку рейда админу %d: %v", adminID, err)
+			continue
+		}
+		raidDetector.addSummary(chatID, msg)
+	}
+}
+
+// resolveRaid снимает локдаун: ban — забанить волну, иначе снять ограничения и
+// вернуть придержанные сообщения.
+func resolveRaid(bot *tele.Bot, chatID int64, actorID int64, ban bool) (string, bool) {
+	out, ok := raidDetector.Resolve(chatID)
+	if !ok {
+		return "Локдаун уже снят.", false
+	}
+	chat := &tele.Chat{ID: chatID}
+	action, result := "raid_lift", ""
+	if ban {
+		action = "raid_mass_ban"
+		banned := 0
+		for _, m := range out.Wave {
+			if err := bot.Ban(chat, &tele.ChatMember{User: &tele.User{ID: m.ID}}); err != nil {
+				log.Printf("⚠️ Не удалось забанить %d: %v", m.ID, err)
+				continue
+			}
+			if statsManager != nil {
+				statsManager.RegisterBan(m.ID)
+			}
+			banned++
+		}
+		result = fmt.Sprintf("🔨 Забанено: %d из %d. Придержанные сообщения удалены (%d).", banned, len(out.Wave), out.HeldTotal)
+	} else {
+		for _, m := range out.Wave {
+			member := &tele.ChatMember{User: &tele.User{ID: m.ID}, Rights: tele.NoRestrictions()}
+			if err := bot.Restrict(chat, member); err != nil {
+				log.Printf("⚠️ Не удалось снять ограничения с %d: %v", m.ID, err)
+			}
+		}
+		for _, h := range out.Held {
+			text := fmt.Sprintf("💬 <b>%s</b>: %s", html.EscapeString(h.Name), html.EscapeString(h.Text))
+			if _, err := bot.Send(chat, text, tele.ModeHTML); err != nil {
+				log.Printf("⚠️ Не удалось вернуть придержанное сообщение: %v", err)
+			}
+		}
+		captchaStarted := 0
+		for _, m := range out.Captchas {
+			if womanManager.IsUserVerified(m.ID) || captchas.pending(chatID, m.ID) {
+				continue
+			}
+			if err := startCaptcha(bot, chat, &tele.User{ID: m.ID, FirstName: m.Name}); err != nil {
+				log.Printf("⚠️ Не удалось отправить отложенную капчу %d: %v", m.ID, err)
+				continue
+			}
+			captchaStarted++
+		}
+		result = fmt.Sprintf("🔓 Локдаун снят. Ограничения сняты с %d, возвращено сообщений: %d, выдано капч: %d.", len(out.Wave), len(out.Held), captchaStarted)
+		if _, err := bot.Send(chat, "✅ Чат снова открыт.", tele.ModeHTML); err != nil {
+			log.Printf("⚠️ Не удалось объявить снятие локдауна: %v", err)
+		}
+	}
+	logModAction(actorID, action, strconv.FormatInt(chatID, 10), fmt.Sprintf("wave=%d held=%d since=%s", len(out.Wave), out.HeldTotal, out.Since.Format("02.01 15:04")))
+
+	for _, msg := range out.Summaries {
+		if _, err := bot.Edit(msg, msg.Text+"\n\n"+result); err != nil {
+			log.Printf("⚠️ Не удалось обновить сводку рейда: %v", err)
+		}
+	}
+	return result, true
+}
+
+func handleRaidCallback(c tele.Context, data string) error {
+	userID := c.Sender().ID
+	if !hasPermission(userID, PermModerate) {
+		return c.Respond()
+	}
+	ban := strings.HasPrefix(data, "raid_ban_")
+	chatID, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimPrefix(data, "raid_ban_"), "raid_lift_"), 10, 64)
+	if err != nil {
+		return c.Respond()
+	}
+	result, _ := resolveRaid(c.Bot(), chatID, userID, ban)
+	return c.Respond(&tele.CallbackResponse{Text: result})
+}
+
+// StartRaidLoop завершает затянувшиеся локдауны.
+func StartRaidLoop(bot *tele.Bot) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, chatID := range raidDetector.Expire(time.Now()) {
+			logModAction(0, "raid_lockdown_expired", strconv.FormatInt(chatID, 10), "")
+			if _, err := bot.Send(&tele.Chat{ID: chatID}, "⌛ Медленный режим снят. Участники из волны рейда остаются ограниченными до решения модераторов.", tele.ModeHTML); err != nil {
+				log.Printf("⚠️ Не удалось объявить окончание локдауна: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestRaidDetector(t *testing.T) {
+	d := newRaidDetector(func() raidSettings {
+		return raidSettings{JoinThreshold: 3, MessageThreshold: 3, Window: time.Minute, SlowMode: 30 * time.Second, LockdownMax: time.Hour}
+	})
+	now := time.Now()
+	const chat = -100
+	regular := &tele.User{ID: 1, FirstName: "Old"}
+
+	// Два входа с большим перерывом — не рейд
+	d.Join(chat, &tele.User{ID: 10}, now.Add(-5*time.Minute))
+	if started, _ := d.Join(chat, &tele.User{ID: 11}, now.Add(-time.Second)); started {
+		t.Fatal("slow joins must not trigger lockdown")
+	}
+	if started, locked := d.Join(chat, &tele.User{ID: 12}, now); started || locked {
+		t.Fatal("two joins inside the window are below the threshold")
+	}
+	started, locked := d.Join(chat, &tele.User{ID: 13}, now)
+	if !started || !locked || !d.InLockdown(chat) {
+		t.Fatal("third join inside the window must start lockdown")
+	}
+	if _, wave, _ := d.snapshot(chat); wave != 3 {
+		t.Fatalf("wave must contain joins from the window only, got %d", wave)
+	}
+	if started, locked := d.Join(chat, &tele.User{ID: 14}, now); started || !locked {
+		t.Fatal("joins during lockdown must be restricted without a new summary")
+	}
+
+	if v := d.Message(chat, &tele.User{ID: 12, FirstName: "Bot"}, "купи", now); v != raidHold {
+		t.Fatalf("newcomer message during lockdown must be held, got %v", v)
+	}
+	if v := d.Message(chat, regular, "привет", now); v != raidPass {
+		t.Fatalf("first message of a regular member passes, got %v", v)
+	}
+	if v := d.Message(chat, regular, "еще", now.Add(10*time.Second)); v != raidSlowDrop {
+		t.Fatalf("slow mode must drop frequent messages, got %v", v)
+	}
+
+	out, ok := d.Resolve(chat)
+	if !ok || len(out.Wave) != 4 || len(out.Held) != 1 || out.Held[0].Text != "купи" {
+		t.Fatalf("unexpected outcome: %+v", out)
+	}
+	if d.InLockdown(chat) {
+		t.Fatal("resolve must end lockdown")
+	}
+	if _, ok := d.Resolve(chat); ok {
+		t.Fatal("second resolve must be a no-op")
+	}
+}
+
+func TestRaidDetectorMessageFloodAndExpiry(t *testing.T) {
+	d := newRaidDetector(func() raidSettings {
+		return raidSettings{JoinThreshold: 100, MessageThreshold: 3, Window: time.Minute, SlowMode: time.Second, LockdownMax: time.Hour}
+	})
+	now := time.Now()
+	const chat = -200
+	spammer := &tele.User{ID: 5, FirstName: "Spam"}
+	d.Join(chat, spammer, now)
+
+	d.Message(chat, spammer, "1", now)
+	d.Message(chat, spammer, "2", now)
+	if v := d.Message(chat, spammer, "3", now); v != raidStart {
+		t.Fatalf("message flood from newcomers must start lockdown, got %v", v)
+	}
+
+	if ended := d.Expire(now.Add(2 * time.Hour)); len(ended) != 1 || d.InLockdown(chat) {
+		t.Fatal("lockdown must end after LockdownMax")
+	}
+	if out, ok := d.Resolve(chat); !ok || len(out.Wave) != 1 {
+		t.Fatal("the wave stays pending until staff decide")
+	}
+}
+
+func TestJoinDuringLockdownQueuesChecks(t *testing.T) {
+	wm := newTestWomanManager(t)
+	savedWM, savedRaid, savedCaptchas := womanManager, raidDetector, captchas
+	womanManager = wm
+	raidDetector = newRaidDetector(func() raidSettings {
+		return raidSettings{JoinThreshold: 1, MessageThreshold: 100, Window: time.Minute, SlowMode: time.Second, LockdownMax: time.Hour}
+	})
+	captchas = newCaptchaStore()
+	t.Cleanup(func() { womanManager, raidDetector, captchas = savedWM, savedRaid, savedCaptchas })
+
+	const chatID = -300
+	bot, calls := newRecordingBot(t)
+	chat := &tele.Chat{ID: chatID, Type: tele.ChatSuperGroup}
+	raidDetector.Join(chatID, &tele.User{ID: 1}, time.Now())
+	if !raidDetector.InLockdown(chatID) {
+		t.Fatal("setup: lockdown expected")
+	}
+
+	joined := []tele.User{{ID: 20, FirstName: "Новичок"}, {ID: 21, FirstName: "t.me/spam"}}
+	for _, u := range joined {
+		raidDetector.Join(chatID, &u, time.Now())
+	}
+	c := bot.NewContext(tele.Update{Message: &tele.Message{ID: 5, Chat: chat, Sender: &joined[0], UsersJoined: joined}})
+	if err := HandleUserJoin(c); err != nil {
+		t.Fatal(err)
+	}
+	if captchas.pending(chatID, 20) {
+		t.Fatal("captcha must wait for the end of lockdown")
+	}
+	banned := false
+	for _, call := range calls() {
+		banned = banned || call.Method == "kickChatMember"
+	}
+	if !banned {
+		t.Fatalf("spam nickname must be punished during lockdown: %+v", calls())
+	}
+
+	if _, ok := resolveRaid(bot, chatID, 1, false); !ok {
+		t.Fatal("resolve failed")
+	}
+	if !captchas.pending(chatID, 20) {
+		t.Fatal("queued captcha must start after the lockdown is lifted")
+	}
+	if captchas.pending(chatID, 21) {
+		t.Fatal("punished user must not get a captcha")
+	}
+}
+
+func TestRaidGuardIgnoresButtonsAndEdits(t *testing.T) {
+	savedRaid := raidDetector
+	raidDetector = newRaidDetector(func() raidSettings {
+		return raidSettings{JoinThreshold: 3, MessageThreshold: 1, Window: time.Minute, SlowMode: time.Hour, LockdownMax: time.Hour}
+	})
+	t.Cleanup(func() { raidDetector = savedRaid })
+
+	const chatID = -400
+	bot, calls := newRecordingBot(t)
+	chat := &tele.Chat{ID: chatID, Type: tele.ChatSuperGroup}
+	botMsg := &tele.Message{ID: 7, Chat: chat, Sender: bot.Me, Text: "🤖 Нажмите кнопку"}
+	press := func(userID int64) bool {
+		return raidGuard(bot.NewContext(tele.Update{Callback: &tele.Callback{ID: "cb", Sender: &tele.User{ID: userID}, Message: botMsg, Data: "captcha_ok"}}))
+	}
+	deleted := func() bool {
+		for _, call := range calls() {
+			if call.Method == "deleteMessage" {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Нажатие кнопки новичком не считается сообщением и не запускает локдаун
+	raidDetector.Join(chatID, &tele.User{ID: 20}, time.Now())
+	if press(20) || raidDetector.InLockdown(chatID) {
+		t.Fatal("button press must not start a lockdown")
+	}
+
+	for _, id := range []int64{21, 22} {
+		raidDetector.Join(chatID, &tele.User{ID: id}, time.Now())
+	}
+	if !raidDetector.InLockdown(chatID) {
+		t.Fatal("setup: lockdown expected")
+	}
+	// Во время локдауна кнопки капчи и повторные нажатия проходят
+	if press(20) || press(30) || press(30) {
+		t.Fatal("button presses must pass during a lockdown")
+	}
+	if _, _, held := raidDetector.snapshot(chatID); held != 0 || deleted() {
+		t.Fatalf("bot message must be neither held nor deleted: held=%d %+v", held, calls())
+	}
+
+	// Правка новичка удаляется, но не придерживается; правка старожила проходит
+	edit := func(userID int64) bool {
+		return raidGuard(bot.NewContext(tele.Update{EditedMessage: &tele.Message{ID: 9, Chat: chat, Sender: &tele.User{ID: userID}, Text: "спам"}}))
+	}
+	if edit(30) || deleted() {
+		t.Fatal("old member's edit must pass")
+	}
+	if !edit(21) || !deleted() {
+		t.Fatal("newcomer's edit during a lockdown must be deleted")
+	}
+	if _, _, held := raidDetector.snapshot(chatID); held != 0 {
+		t.Fatalf("edits must not be held: %d", held)
+	}
+}
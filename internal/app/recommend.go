@@ -0,0 +1,460 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// РЕКОМЕНДАЦИИ: СОВМЕСТНАЯ ФИЛЬТРАЦИЯ
+// ==========================================
+
+// Фоновая задача раз в час строит по UserFavorite и UserView модель «item-to-item»:
+// каждая карточка — вектор весов пользователей (избранное весит больше просмотра),
+// близость двух карточек — косинус между такими векторами. Для пользователя
+// оценки соседей его истории складываются и смешиваются с похожестью по
+// содержанию (relatedIndex); уже просмотренное и избранное отбрасывается.
+
+const (
+	recFavoriteWeight   = 3.0
+	recViewWeight       = 1.0
+	recCoocMinUsers     = 2   // пары, замеченные меньшим числом пользователей, — шум
+	recCoocNeighbors    = 30  // соседей на карточку
+	recCoocMaxUserItems = 200 // последних карточек пользователя в расчете пар
+	recCoocWindow       = 180 * 24 * time.Hour
+	recCoocBatchSize    = 1000 // записей избранного и просмотров за один запрос
+	recRebuildInterval  = time.Hour
+	recCFShare          = 0.6 // доля совместной фильтрации в итоговой оценке
+	recHistoryViews     = 30
+	recContentSources   = 5 // карточек истории, для которых ищутся похожие по содержанию
+	recReasonsShown     = 3
+)
+
+type coocNeighbor struct {
+	ID    uint
+	Score float64
+	Users int // сколько пользователей отметили обе карточки
+}
+
+type coocModel struct {
+	Neighbors map[uint][]coocNeighbor
+	Users     int
+	BuiltAt   time.Time
+}
+
+type recReason struct {
+	Source  uint // карточка из истории пользователя
+	Content bool // true — похожа по содержанию, false — «отмечали вместе»
+	Score   float64
+	Users   int
+}
+
+type recommendation struct {
+	Woman       Woman
+	Score       float64
+	CF, Content float64 // нормированные составляющие оценки
+	Reasons     []recReason
+}
+
+// buildCoocModel собирает модель по избранному (целиком) и просмотрам за окно.
+// Записи читаются пачками по возрастанию ID, то есть от старых к новым; у каждого
+// пользователя остается recCoocMaxUserItems карточек — сначала избранное, затем
+// самые свежие просмотры.
+func (wm *WomanManager) buildCoocModel(now time.Time) (*coocModel, error) {
+	type userItem struct {
+		weight float64
+		seq    int // порядок последнего появления: больше — свежее
+	}
+	items := map[int64]map[uint]userItem{}
+	seq := 0
+	// trim оставляет пользователю limit карточек: избранное важнее просмотров, свежее — старого
+	trim := func(m map[uint]userItem, limit int) {
+		ids := make([]uint, 0, len(m))
+		for id := range m {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := m[ids[i]], m[ids[j]]
+			if a.weight != b.weight {
+				return a.weight > b.weight
+			}
+			return a.seq > b.seq
+		})
+		for _, id := range ids[limit:] {
+			delete(m, id)
+		}
+	}
+	add := func(userID int64, womanID uint, weight float64) {
+		seq++
+		m := items[userID]
+		if m == nil {
+			m = map[uint]userItem{}
+			items[userID] = m
+		}
+		if it, ok := m[womanID]; ok && it.weight > weight {
+			return
+		}
+		m[womanID] = userItem{weight: weight, seq: seq}
+		// Память ограничена: лишнее отбрасывается, не дожидаясь конца чтения
+		if len(m) >= 2*recCoocMaxUserItems {
+			trim(m, recCoocMaxUserItems)
+		}
+	}
+	var favs []UserFavorite
+	err := wm.DB.Select("id", "user_id", "woman_id").FindInBatches(&favs, recCoocBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, f := range favs {
+			add(f.UserID, f.WomanID, recFavoriteWeight)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	var views []UserView
+	err = wm.DB.Select("id", "user_id", "woman_id").Where("created_at >= ?", now.Add(-recCoocWindow)).FindInBatches(&views, recCoocBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, v := range views {
+			add(v.UserID, v.WomanID, recViewWeight)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	type pair struct{ a, b uint }
+	dots := map[pair]float64{}
+	users := map[pair]int{}
+	norms := map[uint]float64{}
+	for _, m := range items {
+		if len(m) > recCoocMaxUserItems {
+			trim(m, recCoocMaxUserItems)
+		}
+		ids := make([]uint, 0, len(m))
+		for id := range m {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for i, a := range ids {
+			wa := m[a].weight
+			norms[a] += wa * wa
+			for _, b := range ids[i+1:] {
+				p := pair{a, b}
+				dots[p] += wa * m[b].weight
+				users[p]++
+			}
+		}
+	}
+
+	model := &coocModel{Neighbors: map[uint][]coocNeighbor{}, Users: len(items), BuiltAt: now}
+	for p, dot := range dots {
+		if users[p] < recCoocMinUsers {
+			continue
+		}
+		s := dot / math.Sqrt(norms[p.a]*norms[p.b])
+		model.Neighbors[p.a] = append(model.Neighbors[p.a], coocNeighbor{ID: p.b, Score: s, Users: users[p]})
+		model.Neighbors[p.b] = append(model.Neighbors[p.b], coocNeighbor{ID: p.a, Score: s, Users: users[p]})
+	}
+	for id, list := range model.Neighbors {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Score != list[j].Score {
+				return list[i].Score > list[j].Score
+			}
+			return list[i].ID < list[j].ID
+		})
+		if len(list) > recCoocNeighbors {
+			list = list[:recCoocNeighbors]
+		}
+		model.Neighbors[id] = list
+	}
+	return model, nil
+}
+
+// RebuildCoocModel пересчитывает модель; при ошибке чтения остается прежняя.
+func (wm *WomanManager) RebuildCoocModel() (*coocModel, error) {
+	m, err := wm.buildCoocModel(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	wm.Mu.Lock()
+	wm.cooc = m
+	wm.Mu.Unlock()
+	return m, nil
+}
+
+func (wm *WomanManager) coocModel() *coocModel {
+	wm.Mu.RLock()
+	defer wm.Mu.RUnlock()
+	return wm.cooc
+}
+
+func StartRecommendLoop() {
+	rebuild := func() {
+		if womanManager == nil {
+			return
+		}
+		started := time.Now()
+		m, err := womanManager.RebuildCoocModel()
+		if err != nil {
+			log.Printf("⚠️ Не удалось пересчитать модель рекомендаций: %v", err)
+			return
+		}
+		log.Printf("✅ Модель рекомендаций: %d карточек, %d пользователей за %s", len(m.Neighbors), m.Users, time.Since(started).Round(time.Millisecond))
+	}
+	rebuild()
+	ticker := time.NewTicker(recRebuildInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		rebuild()
+	}
+}
+
+type recHistoryItem struct {
+	ID     uint
+	Weight float64
+}
+
+// recHistory — избранное и последние просмотры с весами (свежие просмотры весят больше)
+// и множество всего, что пользователь уже видел или получил по подписке.
+func (wm *WomanManager) recHistory(userID int64) ([]recHistoryItem, map[uint]bool) {
+	weights := map[uint]float64{}
+	var favIDs []uint
+	wm.DB.Model(&UserFavorite{}).Where("user_id = ?", userID).Pluck("woman_id", &favIDs)
+	for _, id := range favIDs {
+		weights[id] = recFavoriteWeight
+	}
+	rank := 0
+	for _, id := range wm.GetRecentViews(userID, recHistoryViews) {
+		if _, ok := weights[id]; ok {
+			continue
+		}
+		rank++
+		weights[id] = recViewWeight / float64(rank)
+	}
+	history := make([]recHistoryItem, 0, len(weights))
+	for id, w := range weights {
+		history = append(history, recHistoryItem{ID: id, Weight: w})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].Weight != history[j].Weight {
+			return history[i].Weight > history[j].Weight
+		}
+		return history[i].ID < history[j].ID
+	})
+
+	var viewed, delivered []uint
+	wm.DB.Model(&UserView{}).Where("user_id = ?", userID).Distinct().Pluck("woman_id", &viewed)
+	wm.DB.Model(&UserDelivery{}).Where("user_id = ?", userID).Distinct().Pluck("woman_id", &delivered)
+	seen := make(map[uint]bool, len(viewed)+len(delivered)+len(favIDs))
+	for _, id := range viewed {
+		seen[id] = true
+	}
+	for _, id := range delivered {
+		seen[id] = true
+	}
+	for _, id := range favIDs {
+		seen[id] = true
+	}
+	return history, seen
+}
+
+// scoreRecommendations оценивает все непросмотренные опубликованные карточки,
+// до которых дотягиваются соседи истории пользователя.
+func (wm *WomanManager) scoreRecommendations(userID int64) map[uint]*recommendation {
+	history, seen := wm.recHistory(userID)
+	if len(history) == 0 {
+		return nil
+	}
+	recs := map[uint]*recommendation{}
+	get := func(id uint) *recommendation {
+		r := recs[id]
+		if r == nil {
+			r = &recommendation{}
+			recs[id] = r
+		}
+		return r
+	}
+	if model := wm.coocModel(); model != nil {
+		for _, h := range history {
+			for _, n := range model.Neighbors[h.ID] {
+				if seen[n.ID] {
+					continue
+				}
+				r := get(n.ID)
+				r.CF += h.Weight * n.Score
+				r.Reasons = append(r.Reasons, recReason{Source: h.ID, Score: n.Score, Users: n.Users})
+			}
+		}
+	}
+	for i, h := range history {
+		if i == recContentSources {
+			break
+		}
+		for _, c := range wm.RelatedScored(h.ID, recCoocNeighbors) {
+			if seen[c.Woman.ID] {
+				continue
+			}
+			r := get(c.Woman.ID)
+			r.Content += h.Weight * c.Score
+			r.Reasons = append(r.Reasons, recReason{Source: h.ID, Content: true, Score: c.Score})
+		}
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(recs))
+	var maxCF, maxContent float64
+	for id, r := range recs {
+		ids = append(ids, id)
+		maxCF = math.Max(maxCF, r.CF)
+		maxContent = math.Max(maxContent, r.Content)
+	}
+	var women []Woman
+	wm.DB.Where("id IN ? AND is_published = ?", ids, true).Find(&women)
+	out := make(map[uint]*recommendation, len(women))
+	for _, w := range women {
+		r := recs[w.ID]
+		r.Woman = w
+		if maxCF > 0 {
+			r.CF /= maxCF
+		}
+		if maxContent > 0 {
+			r.Content /= maxContent
+		}
+		switch {
+		case maxCF == 0:
+			r.Score = r.Content
+		case maxContent == 0:
+			r.Score = r.CF
+		default:
+			r.Score = recCFShare*r.CF + (1-recCFShare)*r.Content
+		}
+		sort.Slice(r.Reasons, func(i, j int) bool { return r.Reasons[i].Score > r.Reasons[j].Score })
+		out[w.ID] = r
+	}
+	return out
+}
+
+// Recommend — до limit рекомендаций для пользователя, лучшие — первыми.
+func (wm *WomanManager) Recommend(userID int64, limit int) []recommendation {
+	scored := wm.scoreRecommendations(userID)
+	out := make([]recommendation, 0, len(scored))
+	for _, r := range scored {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Woman.ID < out[j].Woman.ID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// dailyCardFor — карточка для личной рассылки: лучшая рекомендация, иначе случайная.
+func (wm *WomanManager) dailyCardFor(userID int64) *Woman {
+	if recs := wm.Recommend(userID, 1); len(recs) > 0 {
+		w := recs[0].Woman
+		return &w
+	}
+	return wm.GetRandomWoman()
+}
+
+// ------------------------------------------
+// Диагностика
+// ------------------------------------------
+
+// HandleRecWhy: /recwhy user_id [id] — почему пользователю рекомендуются карточки.
+func HandleRecWhy(c tele.Context) error {
+	if c.Sender() == nil || !isAdmin(c.Sender().ID) {
+		return nil
+	}
+	args := c.Args()
+	if len(args) == 0 || len(args) > 2 {
+		return c.Reply("Используйте: /recwhy <code>user_id</code> [<code>id карточки</code>]", tele.ModeHTML)
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return c.Reply("Некорректный user_id.", tele.ModeHTML)
+	}
+	var cardID uint
+	if len(args) == 2 {
+		if cardID = parseWomanID(args[1]); cardID == 0 {
+			return c.Reply("Некорректный ID карточки.", tele.ModeHTML)
+		}
+	}
+	return c.Reply(recWhyText(userID, cardID), tele.ModeHTML)
+}
+
+func recWhyText(userID int64, cardID uint) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🔎 <b>Рекомендации для %d</b>\n", userID))
+	if m := womanManager.coocModel(); m != nil {
+		sb.WriteString(fmt.Sprintf("Модель: %d карточек, %d пользователей, обновлена %s назад\n",
+			len(m.Neighbors), m.Users, formatDuration(time.Since(m.BuiltAt))))
+	} else {
+		sb.WriteString("Модель еще не построена — только похожесть по содержанию\n")
+	}
+	history, seen := womanManager.recHistory(userID)
+	sb.WriteString(fmt.Sprintf("История: %d карточек, видел всего %d\n\n", len(history), len(seen)))
+
+	names := map[uint]string{}
+	label := func(id uint) string {
+		if _, ok := names[id]; !ok {
+			var w Woman
+			womanManager.DB.Unscoped().Select("id", "name").First(&w, id)
+			names[id] = w.Name
+		}
+		return fmt.Sprintf("#%d %s", id, html.EscapeString(names[id]))
+	}
+	writeRec := func(prefix string, r recommendation) {
+		names[r.Woman.ID] = r.Woman.Name
+		sb.WriteString(fmt.Sprintf("%s%s — %.2f (вместе %.2f · содержание %.2f)\n", prefix, label(r.Woman.ID), r.Score, r.CF, r.Content))
+		for i, reason := range r.Reasons {
+			if i == recReasonsShown {
+				sb.WriteString(fmt.Sprintf("   …и еще %d\n", len(r.Reasons)-i))
+				break
+			}
+			if reason.Content {
+				sb.WriteString(fmt.Sprintf("   📚 похожа на %s: %.2f\n", label(reason.Source), reason.Score))
+			} else {
+				sb.WriteString(fmt.Sprintf("   👥 отмечали вместе с %s: %.2f, %d польз.\n", label(reason.Source), reason.Score, reason.Users))
+			}
+		}
+	}
+
+	if cardID != 0 {
+		if seen[cardID] {
+			sb.WriteString(label(cardID) + " — уже просмотрена или в избранном, не рекомендуется.")
+			return sb.String()
+		}
+		r, ok := womanManager.scoreRecommendations(userID)[cardID]
+		if !ok {
+			sb.WriteString(label(cardID) + " — нет связей с историей пользователя (или карточка не опубликована).")
+			return sb.String()
+		}
+		writeRec("", *r)
+		return sb.String()
+	}
+	recs := womanManager.Recommend(userID, 5)
+	if len(recs) == 0 {
+		sb.WriteString("Связей нет — /rec покажет карточки по тегам, сфере или случайные.")
+		return sb.String()
+	}
+	for i, r := range recs {
+		writeRec(fmt.Sprintf("%d. ", i+1), r)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecommendations(t *testing.T) {
+	wm := newTestWomanManager(t)
+	saved := womanManager
+	womanManager = wm
+	t.Cleanup(func() { womanManager = saved })
+
+	cards := []*Woman{
+		{Name: "Мария Кюри", Field: "физика", Info: "Изучала радиоактивность.", Tags: []string{"физика"}, IsPublished: true},
+		{Name: "Ада Лавлейс", Field: "математика", Info: "Написала первую программу.", Tags: []string{"математика"}, IsPublished: true},
+		{Name: "Анна Ахматова", Field: "литература", Info: "Поэтесса.", Tags: []string{"поэзия"}, IsPublished: true},
+		{Name: "Лиза Мейтнер", Field: "физика", Info: "Объяснила радиоактивность и деление ядра.", Tags: []string{"физика"}, IsPublished: true},
+		{Name: "Черновик", Field: "математика", Info: "Теория чисел.", Tags: []string{"математика"}},
+	}
+	for _, w := range cards {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	curie, ada, akhmatova, meitner, draft := cards[0], cards[1], cards[2], cards[3], cards[4]
+
+	for _, u := range []int64{1, 2, 3} {
+		_ = wm.AddFavorite(u, curie.ID)
+		_ = wm.AddFavorite(u, ada.ID)
+		wm.TrackView(u, draft.ID)
+	}
+	wm.TrackView(2, akhmatova.ID) // пара с одним пользователем — шум
+	wm.TrackView(4, curie.ID)
+	wm.TrackView(4, ada.ID)
+	wm.TrackView(4, ada.ID)
+
+	if got := wm.Recommend(10, 3); len(got) != 0 {
+		t.Fatalf("no history, no recommendations: %+v", got)
+	}
+	model, err := wm.RebuildCoocModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Users != 4 || len(model.Neighbors[curie.ID]) != 2 {
+		t.Fatalf("model: %+v", model)
+	}
+	if n := model.Neighbors[curie.ID][0]; n.ID != ada.ID || n.Users != 4 || n.Score <= 0 || n.Score > 1 {
+		t.Fatalf("co-favorited card must be the nearest neighbour: %+v", n)
+	}
+
+	_ = wm.AddFavorite(10, curie.ID)
+	recs := wm.Recommend(10, 5)
+	if len(recs) != 2 || recs[0].Woman.ID != ada.ID || recs[1].Woman.ID != meitner.ID {
+		t.Fatalf("blend of co-occurrence and content expected: %+v", recs)
+	}
+	if r := recs[0].Reasons[0]; r.Source != curie.ID || r.Content || r.Users != 4 {
+		t.Fatalf("reason: %+v", r)
+	}
+	if r := recs[1]; r.CF != 0 || r.Content != 1 || !r.Reasons[0].Content {
+		t.Fatalf("content-only candidate: %+v", r)
+	}
+
+	// Просмотренное и избранное не рекомендуется
+	wm.TrackView(10, ada.ID)
+	if recs := wm.Recommend(10, 5); len(recs) != 1 || recs[0].Woman.ID != meitner.ID {
+		t.Fatalf("seen cards must be skipped: %+v", recs)
+	}
+	if w := wm.dailyCardFor(10); w == nil || w.ID != meitner.ID {
+		t.Fatalf("daily card must follow recommendations: %+v", w)
+	}
+	if w := wm.dailyCardFor(99); w == nil {
+		t.Fatal("cold start falls back to a random card")
+	}
+
+	text := recWhyText(11, 0)
+	if !strings.Contains(text, "Связей нет") {
+		t.Fatalf("empty history: %s", text)
+	}
+	_ = wm.AddFavorite(11, curie.ID)
+	text = recWhyText(11, 0)
+	if !strings.Contains(text, fmt.Sprintf("1. #%d Ада Лавлейс", ada.ID)) || !strings.Contains(text, fmt.Sprintf("отмечали вместе с #%d Мария Кюри: ", curie.ID)) || !strings.Contains(text, "4 польз.") {
+		t.Fatalf("diagnostic must explain the co-occurrence:\n%s", text)
+	}
+	if text := recWhyText(11, curie.ID); !strings.Contains(text, "уже просмотрена") {
+		t.Fatalf("seen card: %s", text)
+	}
+	if text := recWhyText(11, draft.ID); !strings.Contains(text, "нет связей") {
+		t.Fatalf("unpublished card: %s", text)
+	}
+
+	if got := buildRecommendations(11); len(got) != 2 || got[0].ID != ada.ID {
+		t.Fatalf("/rec must start with blended recommendations: %+v", got)
+	}
+
+	// Карточка из подписки больше не предлагается, но просмотром не считается
+	before, _ := wm.buildCoocModel(time.Now())
+	wm.TrackDelivery(10, meitner.ID)
+	if recs := wm.Recommend(10, 5); len(recs) != 0 {
+		t.Fatalf("delivered card must be skipped: %+v", recs)
+	}
+	if n := wm.CountViews(10); n != 1 {
+		t.Fatalf("delivery must not count as a view: %d", n)
+	}
+	if after, _ := wm.buildCoocModel(time.Now()); after.Users != before.Users || !reflect.DeepEqual(after.Neighbors, before.Neighbors) {
+		t.Fatalf("deliveries must stay out of the model: %+v", after)
+	}
+
+	// Просмотры вне окна не учитываются
+	old, err := wm.buildCoocModel(time.Now().Add(2 * recCoocWindow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Users != 5 || len(old.Neighbors[draft.ID]) != 0 {
+		t.Fatalf("stale views must drop out: %+v", old)
+	}
+}
@@ -0,0 +1,276 @@
+package app
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ==========================================
+// ПОХОЖИЕ КАРТОЧКИ (TF-IDF)
+// ==========================================
+
+// Каждая карточка — вектор TF-IDF по основам слов (stemRussian) из биографии,
+// сферы и тегов; стоп-слова и короткие слова отбрасываются. Теги весят больше
+// сферы, сфера — больше биографии. Похожесть — косинус между векторами.
+// Индекс живет в памяти и содержит только опубликованные карточки: строится
+// при первом запросе, а затем обновляется по одной карточке из syncSearchIndex /
+// dropFromSearchIndex и при одобрении предложенной карточки.
+
+const (
+	relatedTagWeight   = 3.0
+	relatedFieldWeight = 2.0
+	relatedInfoWeight  = 1.0
+	relatedMinScore    = 0.05
+)
+
+var relatedStopWords = func() map[string]bool {
+	words := strings.Fields(`и в во не что он на я с со как а то все она так его но да ты к у же вы за бы по
+		только ее мне было вот от меня еще нет о из ему теперь когда даже ну вдруг ли если уже или ни быть был
+		него до вас нибудь опять уж вам ведь там потом себя ничего ей может они тут где есть надо ней для мы
+		тебя их чем была сам чтоб без будто чего раз тоже себе под будет ж тогда кто этот того потому этого
+		какой совсем ним здесь этом один почти мой тем чтобы нее сейчас были куда зачем всех никогда можно при
+		наконец два об другой хоть после над больше тот через эти нас про всего них какая много разве три эту
+		моя впрочем хорошо свою этой перед иногда лучше чуть том нельзя такой им более всегда конечно всю между
+		также который которая которые которых году годах годы год лет время стала стал была было свои своей своих`)
+	out := make(map[string]bool, len(words))
+	for _, w := range words {
+		out[stemRussian(w)] = true
+	}
+	return out
+}()
+
+type relatedIndex struct {
+	mu       sync.Mutex
+	built    bool
+	terms    map[uint]map[string]float64 // взвешенная частота термов карточки
+	postings map[string]map[uint]bool
+	norms    map[uint]float64 // длины векторов; nil — пересчитать
+}
+
+type relatedCard struct {
+	Woman Woman
+	Score float64
+}
+
+func newRelatedIndex() *relatedIndex {
+	return &relatedIndex{terms: map[uint]map[string]float64{}, postings: map[string]map[uint]bool{}}
+}
+
+// relatedTerms — взвешенные термы карточки. Имя не учитывается: общие имена
+// («Мария», «Анна») сближали бы случайных людей.
+func relatedTerms(w *Woman) map[string]float64 {
+	out := map[string]float64{}
+	add := func(text string, weight float64) {
+		for _, word := range splitSearchWords(text) {
+			if runeLen(word) < 3 || isDigits(word) {
+				continue
+			}
+			stem := stemRussian(word)
+			if stem == "" || relatedStopWords[stem] {
+				continue
+			}
+			out[stem] += weight
+		}
+	}
+	add(removeHTMLTags(w.Info), relatedInfoWeight)
+	add(w.Field, relatedFieldWeight)
+	add(strings.Join(w.Tags, " "), relatedTagWeight)
+	return out
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (ix *relatedIndex) removeLocked(id uint) {
+	for t := range ix.terms[id] {
+		if p := ix.postings[t]; p != nil {
+			delete(p, id)
+			if len(p) == 0 {
+				delete(ix.postings, t)
+			}
+		}
+	}
+	delete(ix.terms, id)
+	ix.norms = nil
+}
+
+func (ix *relatedIndex) putLocked(w *Woman) {
+	ix.removeLocked(w.ID)
+	terms := relatedTerms(w)
+	if len(terms) == 0 {
+		return
+	}
+	ix.terms[w.ID] = terms
+	for t := range terms {
+		if ix.postings[t] == nil {
+			ix.postings[t] = map[uint]bool{}
+		}
+		ix.postings[t][w.ID] = true
+	}
+}
+
+// update обновляет карточку в уже построенном индексе (до постройки — ничего не делает).
+// Снятая с публикации карточка из индекса убирается.
+func (ix *relatedIndex) update(w *Woman) {
+	if ix == nil || w == nil || w.ID == 0 {
+		return
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.built {
+		return
+	}
+	if w.IsPublished {
+		ix.putLocked(w)
+	} else {
+		ix.removeLocked(w.ID)
+	}
+}
+
+func (ix *relatedIndex) remove(id uint) {
+	if ix == nil {
+		return
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.built {
+		ix.removeLocked(id)
+	}
+}
+
+func (ix *relatedIndex) buildLocked(women []Woman) {
+	ix.terms = map[uint]map[string]float64{}
+	ix.postings = map[string]map[uint]bool{}
+	for i := range women {
+		ix.putLocked(&women[i])
+	}
+	ix.norms = nil
+	ix.built = true
+}
+
+func (ix *relatedIndex) idfLocked(term string) float64 {
+	n := float64(len(ix.terms))
+	return math.Log((n+1)/(float64(len(ix.postings[term]))+1)) + 1
+}
+
+func relatedTF(f float64) float64 { return 1 + math.Log(f) }
+
+// ensureNormsLocked пересчитывает длины векторов (df меняется при любой правке).
+func (ix *relatedIndex) ensureNormsLocked() {
+	if ix.norms != nil {
+		return
+	}
+	norms := make(map[uint]float64, len(ix.terms))
+	for id, terms := range ix.terms {
+		var sum float64
+		for t, f := range terms {
+			v := relatedTF(f) * ix.idfLocked(t)
+			sum += v * v
+		}
+		norms[id] = math.Sqrt(sum)
+	}
+	ix.norms = norms
+}
+
+// similar возвращает ID карточек, похожих на id, с косинусной оценкой, лучшие — первыми.
+func (ix *relatedIndex) similar(id uint, limit int) []relatedScore {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	src := ix.terms[id]
+	if len(src) == 0 {
+		return nil
+	}
+	ix.ensureNormsLocked()
+	dots := map[uint]float64{}
+	for t, f := range src {
+		idf := ix.idfLocked(t)
+		a := relatedTF(f) * idf
+		for other := range ix.postings[t] {
+			if other != id {
+				dots[other] += a * relatedTF(ix.terms[other][t]) * idf
+			}
+		}
+	}
+	out := make([]relatedScore, 0, len(dots))
+	for other, dot := range dots {
+		if n := ix.norms[id] * ix.norms[other]; n > 0 {
+			if s := dot / n; s >= relatedMinScore {
+				out = append(out, relatedScore{ID: other, Score: s})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].ID < out[j].ID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+type relatedScore struct {
+	ID    uint
+	Score float64
+}
+
+// relatedIdx возвращает индекс, при первом обращении строя его по опубликованным карточкам.
+// Если база недоступна, индекс остается непостроенным и следующий запрос попробует снова.
+func (wm *WomanManager) relatedIdx() *relatedIndex {
+	wm.Mu.Lock()
+	if wm.related == nil {
+		wm.related = newRelatedIndex()
+	}
+	ix := wm.related
+	wm.Mu.Unlock()
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.built {
+		var women []Woman
+		if err := wm.DB.Select("id", "field", "info", "tags").Where("is_published = ?", true).Find(&women).Error; err != nil {
+			log.Printf("⚠️ Не удалось построить индекс похожих карточек: %v", err)
+			return ix
+		}
+		ix.buildLocked(women)
+	}
+	return ix
+}
+
+// RelatedScored — до limit опубликованных карточек, похожих на id по содержанию.
+func (wm *WomanManager) RelatedScored(id uint, limit int) []relatedCard {
+	if limit <= 0 {
+		return nil
+	}
+	scores := wm.relatedIdx().similar(id, limit)
+	if len(scores) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(scores))
+	for _, s := range scores {
+		ids = append(ids, s.ID)
+	}
+	var women []Woman
+	wm.DB.Where("id IN ?", ids).Find(&women)
+	byID := make(map[uint]Woman, len(women))
+	for _, w := range women {
+		byID[w.ID] = w
+	}
+	var out []relatedCard
+	for _, s := range scores {
+		if w, ok := byID[s.ID]; ok {
+			out = append(out, relatedCard{Woman: w, Score: s.Score})
+		}
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRelatedIndex(t *testing.T) {
+	wm := newTestWomanManager(t)
+	saved := womanManager
+	womanManager = wm
+	t.Cleanup(func() { womanManager = saved })
+
+	cards := []*Woman{
+		{Name: "Мария Кюри", Field: "физика", Info: "Исследовала радиоактивность, открыла полоний и радий.", Tags: []string{"физика", "химия"}, IsPublished: true},
+		{Name: "Ирен Жолио-Кюри", Field: "физика", Info: "Открыла искусственную радиоактивность вместе с мужем.", Tags: []string{"физика"}, IsPublished: true},
+		{Name: "Лиза Мейтнер", Field: "физика", Info: "Объяснила деление ядра и радиоактивность.", Tags: []string{"физика"}},
+		{Name: "Анна Ахматова", Field: "литература", Info: "Поэтесса Серебряного века, автор «Реквиема».", Tags: []string{"поэзия"}, IsPublished: true},
+		{Name: "Марина Цветаева", Field: "литература", Info: "Поэтесса Серебряного века.", Tags: []string{"поэзия"}, IsPublished: true},
+	}
+	for _, w := range cards {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	curie, joliot, meitner, akhmatova, tsvetaeva := cards[0], cards[1], cards[2], cards[3], cards[4]
+
+	got := wm.RelatedScored(curie.ID, 5)
+	if len(got) != 1 || got[0].Woman.ID != joliot.ID || got[0].Score <= 0 || got[0].Score > 1 {
+		t.Fatalf("only the published physicist is related: %+v", got)
+	}
+	if got := wm.RelatedScored(akhmatova.ID, 5); len(got) != 1 || got[0].Woman.ID != tsvetaeva.ID {
+		t.Fatalf("poets must be related: %+v", got)
+	}
+
+	// Правка и удаление обновляют уже построенный индекс
+	meitner.IsPublished = true
+	tsvetaeva.Field, tsvetaeva.Info, tsvetaeva.Tags = "физика", "Изучала радиоактивность и полоний.", []string{"физика"}
+	for _, w := range []*Woman{meitner, tsvetaeva} {
+		if err := wm.UpdateWomanBy(w, 1, "edit"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := wm.RelatedScored(akhmatova.ID, 5); len(got) != 0 {
+		t.Fatalf("edited card must leave the poets: %+v", got)
+	}
+	if err := wm.DeleteWoman(joliot.ID, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	got = wm.RelatedScored(curie.ID, 5)
+	if len(got) != 2 || got[0].Woman.ID != tsvetaeva.ID {
+		t.Fatalf("polonium bio must rank first after the edit: %+v", got)
+	}
+
+	fallback := wm.GetRelatedWomen(akhmatova, 3)
+	if len(fallback) != 0 {
+		t.Fatalf("no content, tag or field matches left: %+v", fallback)
+	}
+
+	mux := http.NewServeMux()
+	(&CMSService{mediaCache: map[string]string{}}).RegisterHTTPRoutes(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/women/1/related?limit=1", nil))
+	var body struct {
+		Items []CMSRelatedWoman `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK || len(body.Items) != 1 || body.Items[0].ID != tsvetaeva.ID || body.Items[0].Score <= 0 {
+		t.Fatalf("api: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{"/api/women/x/related", "/api/women/999/related"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code == http.StatusOK {
+			t.Fatalf("%s must fail", path)
+		}
+	}
+
+	// Снятая с публикации карточка уходит из индекса, одобренная — возвращается
+	curie.IsPublished = false
+	if err := wm.UpdateWomanBy(curie, 1, "edit"); err != nil {
+		t.Fatal(err)
+	}
+	if got := wm.RelatedScored(tsvetaeva.ID, 5); len(got) != 1 || got[0].Woman.ID != meitner.ID {
+		t.Fatalf("unpublished card must leave the index: %+v", got)
+	}
+	if got := wm.relatedIdx().similar(curie.ID, 5); len(got) != 0 {
+		t.Fatalf("unpublished card has no neighbours: %+v", got)
+	}
+	if err := wm.ApproveWoman(curie.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := wm.RelatedScored(tsvetaeva.ID, 5); len(got) != 2 || got[1].Woman.ID != curie.ID {
+		t.Fatalf("approved card must be indexed again: %+v", got)
+	}
+
+	// Ошибка чтения базы не оставляет пустой индекс построенным
+	broken := newTestWomanManager(t)
+	sqlDB, _ := broken.DB.DB()
+	sqlDB.Close()
+	if ix := broken.relatedIdx(); ix.built {
+		t.Fatal("index must stay unbuilt after a failed load")
+	}
+}
@@ -0,0 +1,373 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==========================================
+// ЖАЛОБЫ УЧАСТНИКОВ (/report)
+// ==========================================
+
+// Участник отвечает /report на сообщение — жалоба уходит модераторам с
+// кнопками "удалить / варн / бан / отклонить". Если на одно сообщение
+// пожаловались reportHideThreshold разных верифицированных участников, оно
+// скрывается (удаляется с сохранением текста) до решения; при отклонении
+// бот возвращает текст в чат.
+
+const (
+	ReportOpen      = "open"
+	ReportDeleted   = "deleted"
+	ReportWarned    = "warned"
+	ReportBanned    = "banned"
+	ReportDismissed = "dismissed"
+
+	cbReportPrefix = "report_"
+
+	defaultReportHideThreshold = 3
+	defaultReportsPerHour      = 5
+	// Кому часто отклоняют жалобы, тот может жаловаться раз в сутки
+	abusiveReporterDismissals = 3
+	abusiveReporterWindow     = 7 * 24 * time.Hour
+)
+
+var errReportResolved = errors.New("жалоба уже рассмотрена")
+
+type MessageReport struct {
+	ID         uint  `gorm:"primaryKey"`
+	ChatID     int64 `gorm:"uniqueIndex:idx_report_message"`
+	MessageID  int   `gorm:"uniqueIndex:idx_report_message"`
+	AuthorID   int64 `gorm:"index"`
+	AuthorName string
+	Text       string
+	Link       string
+	Status     string `gorm:"size:16;index"`
+	Hidden     bool
+	ReviewerID int64
+	CreatedAt  time.Time
+	ResolvedAt *time.Time
+}
+
+// MessageReportVote — кто пожаловался; один голос на участника.
+type MessageReportVote struct {
+	ReportID   uint  `gorm:"primaryKey"`
+	ReporterID int64 `gorm:"primaryKey;index"`
+	CreatedAt  time.Time
+}
+
+func reportHideThreshold() int {
+	if config.ReportHideThreshold > 0 {
+		return config.ReportHideThreshold
+	}
+	return defaultReportHideThreshold
+}
+
+func reportsPerHour() int {
+	if config.ReportsPerHour > 0 {
+		return config.ReportsPerHour
+	}
+	return defaultReportsPerHour
+}
+
+// ------------------------------------------
+// Хранилище
+// ------------------------------------------
+
+// fileReport находит или создает жалобу на сообщение и добавляет голос.
+// added=false — этот участник уже жаловался на это сообщение.
+func fileReport(db *gorm.DB, r MessageReport, reporterID int64, now time.Time) (report *MessageReport, votes int64, added bool, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing MessageReport
+		q := tx.Where("chat_id = ? AND message_id = ?", r.ChatID, r.MessageID).Limit(1).Find(&existing)
+		if q.Error != nil {
+			return q.Error
+		}
+		if q.RowsAffected == 0 {
+			r.Status = ReportOpen
+			r.CreatedAt = now
+			if err := tx.Create(&r).Error; err != nil {
+				return err
+			}
+			existing = r
+		}
+		report = &existing
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&MessageReportVote{ReportID: existing.ID, ReporterID: reporterID, CreatedAt: now})
+		if res.Error != nil {
+			return res.Error
+		}
+		added = res.RowsAffected > 0
+		return tx.Model(&MessageReportVote{}).Where("report_id = ?", existing.ID).Count(&votes).Error
+	})
+	return report, votes, added, err
+}
+
+// reporterLimited — превышен ли лимит жалоб. Тем, у кого часто отклоняют
+// жалобы, остается одна в сутки.
+func reporterLimited(db *gorm.DB, reporterID int64, now time.Time) bool {
+	var dismissed int64
+	db.Model(&MessageReportVote{}).
+		Joins("JOIN message_reports ON message_reports.id = message_report_votes.report_id").
+		Where("message_report_votes.reporter_id = ? AND message_reports.status = ? AND message_report_votes.created_at > ?", reporterID, ReportDismissed, now.Add(-abusiveReporterWindow)).
+		Count(&dismissed)
+
+	window, limit := time.Hour, int64(reportsPerHour())
+	if dismissed >= abusiveReporterDismissals {
+		window, limit = 24*time.Hour, 1
+	}
+	var recent int64
+	db.Model(&MessageReportVote{}).Where("reporter_id = ? AND created_at > ?", reporterID, now.Add(-window)).Count(&recent)
+	return recent >= limit
+}
+
+// resolveReport закрывает жалобу ровно один раз.
+func resolveReport(db *gorm.DB, id uint, reviewerID int64, status string, now time.Time) (*MessageReport, error) {
+	res := db.Model(&MessageReport{}).Where("id = ? AND status = ?", id, ReportOpen).
+		Updates(map[string]any{"status": status, "reviewer_id": reviewerID, "resolved_at": now})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errReportResolved
+	}
+	var r MessageReport
+	if err := db.First(&r, id).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ------------------------------------------
+// Подача жалобы
+// ------------------------------------------
+
+func messageLink(chat *tele.Chat, messageID int) string {
+	if chat.Username != "" {
+		return fmt.Sprintf("https://t.me/%s/%d", chat.Username, messageID)
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d", cleanChatID(chat.ID), messageID)
+}
+
+// replyBriefly отвечает в группе и убирает ответ через полминуты.
+func replyBriefly(c tele.Context, text string) error {
+	msg, err := c.Bot().Send(c.Chat(), text, tele.ModeHTML)
+	if err == nil {
+		go func() { time.Sleep(30 * time.Second); c.Bot().Delete(msg) }()
+	}
+	return err
+}
+
+func HandleReport(c tele.Context) error {
+	msg, reporter := c.Message(), c.Sender()
+	if msg == nil || reporter == nil || womanManager == nil {
+		return nil
+	}
+	if c.Chat().Type == tele.ChatPrivate {
+		return c.Send("Отвечайте /report на сообщение в группе.")
+	}
+	c.Delete()
+	target := msg.ReplyTo
+	if target == nil || target.Sender == nil {
+		return replyBriefly(c, "🚩 Ответьте /report на сообщение, о котором хотите сообщить.")
+	}
+	author := target.Sender
+	if author.ID == reporter.ID || author.IsBot || isStaff(author.ID) {
+		return replyBriefly(c, "🚩 На это сообщение пожаловаться нельзя.")
+	}
+	if !womanManager.IsUserVerified(reporter.ID) && !isStaff(reporter.ID) {
+		return nil
+	}
+	db := womanManager.DB
+	if !isStaff(reporter.ID) && reporterLimited(db, reporter.ID, time.Now()) {
+		return replyBriefly(c, "⏳ Слишком много жалоб. Попробуйте позже.")
+	}
+
+	text := target.Text
+	if text == "" {
+		text = target.Caption
+	}
+	if text == "" {
+		text = "[медиа без подписи]"
+	}
+	r, votes, added, err := fileReport(db, MessageReport{
+		ChatID:     c.Chat().ID,
+		MessageID:  target.ID,
+		AuthorID:   author.ID,
+		AuthorName: strings.TrimSpace(author.FirstName + " " + author.LastName),
+		Text:       shorten(text, 1000),
+		Link:       messageLink(c.Chat(), target.ID),
+	}, reporter.ID, time.Now())
+	if err != nil {
+		log.Printf("⚠️ Не удалось сохранить жалобу: %v", err)
+		return nil
+	}
+	if !added {
+		return replyBriefly(c, "🚩 Вы уже жаловались на это сообщение.")
+	}
+	if r.Status != ReportOpen {
+		return replyBriefly(c, "🚩 Модераторы уже рассмотрели это сообщение.")
+	}
+	statsManager.RegisterReport()
+	logModAction(reporter.ID, "report_filed", strconv.FormatInt(author.ID, 10), fmt.Sprintf("report=%d chat=%d msg=%d votes=%d", r.ID, r.ChatID, r.MessageID, votes))
+
+	hidden := false
+	if !r.Hidden && votes >= int64(reportHideThreshold()) {
+		if err := c.Bot().Delete(target); err != nil {
+			log.Printf("⚠️ Не удалось скрыть сообщение %d: %v", target.ID, err)
+		} else {
+			hidden = true
+			r.Hidden = true
+			db.Model(&MessageReport{}).Where("id = ?", r.ID).Update("hidden", true)
+			logModAction(0, "report_hidden", strconv.FormatInt(author.ID, 10), fmt.Sprintf("report=%d votes=%d", r.ID, votes))
+		}
+	}
+	// Карточка уходит при первой жалобе и еще раз, когда сообщение скрыто
+	if votes == 1 || hidden {
+		sendReportToStaff(c.Bot(), *r, author, votes)
+	}
+	if hidden {
+		return replyBriefly(c, "🙈 Сообщение скрыто до решения модераторов.")
+	}
+	return replyBriefly(c, "🚩 Жалоба отправлена модераторам.")
+}
+
+func reportCardText(r MessageReport, author *tele.User, votes int64) string {
+	state := ""
+	if r.Hidden {
+		state = " · 🙈 скрыто"
+	}
+	return fmt.Sprintf("🚩 <b>Жалоба #%d</b> в %s%s\n👤 %s (ID: %d)\n👥 Жалоб: %d\n🔗 %s\n📄 %s",
+		r.ID, html.EscapeString(chatTitle(r.ChatID)), state, mentionUser(author), r.AuthorID, votes,
+		html.EscapeString(r.Link), html.EscapeString(r.Text))
+}
+
+func buildReportMenu(id uint) *tele.ReplyMarkup {
+	menu := &tele.ReplyMarkup{}
+	data := func(action string) string { return fmt.Sprintf("%s%s_%d", cbReportPrefix, action, id) }
+	menu.Inline(
+		menu.Row(menu.Data("🗑 Удалить", data("del")), menu.Data("⚠️ Варн", data("warn"))),
+		menu.Row(menu.Data("🚫 Бан", data("ban")), menu.Data("✖️ Отклонить", data("dis"))),
+	)
+	return menu
+}
+
+func sendReportToStaff(bot *tele.Bot, r MessageReport, author *tele.User, votes int64) {
+	text := reportCardText(r, author, votes)
+	for _, id := range moderationReviewers() {
+		if _, err := bot.Send(&tele.User{ID: id}, text, buildReportMenu(r.ID), tele.ModeHTML, tele.NoPreview); err != nil {
+			log.Printf("⚠️ Не удалось отправить жалобу %d: %v", id, err)
+		}
+	}
+}
+
+// ------------------------------------------
+// Решение модератора
+// ------------------------------------------
+
+func handleReportCallback(c tele.Context, data string) error {
+	reviewer := c.Sender().ID
+	if !hasPermission(reviewer, PermModerate) || womanManager == nil {
+		return c.Respond(&tele.CallbackResponse{Text: "Недостаточно прав."})
+	}
+	action, idStr, _ := strings.Cut(strings.TrimPrefix(data, cbReportPrefix), "_")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return c.Respond()
+	}
+	status := map[string]string{"del": ReportDeleted, "warn": ReportWarned, "ban": ReportBanned, "dis": ReportDismissed}[action]
+	if status == "" {
+		return c.Respond()
+	}
+	r, err := resolveReport(womanManager.DB, uint(id), reviewer, status, time.Now())
+	if err != nil {
+		return c.Respond(&tele.CallbackResponse{Text: err.Error()})
+	}
+
+	bot := c.Bot()
+	chat, author := &tele.Chat{ID: r.ChatID}, &tele.User{ID: r.AuthorID, FirstName: r.AuthorName}
+	deleted := false
+	if status != ReportDismissed && !r.Hidden {
+		if err := bot.Delete(&tele.Message{ID: r.MessageID, Chat: chat}); err != nil {
+			log.Printf("⚠️ Не удалось удалить сообщение по жалобе: %v", err)
+		} else {
+			deleted = true
+		}
+	}
+	// Подтвержденная жалоба — такое же нарушение, как и найденное фильтрами:
+	// оно попадает в /violations и участвует в эскалации
+	const reportReason = "Жалоба участников"
+	result := ""
+	switch status {
+	case ReportDeleted:
+		statsManager.RegisterViolation(r.AuthorID)
+		recordReportViolation(r, reportReason)
+		result = "🗑 Удалено"
+		if r.Hidden {
+			result = "🗑 Оставлено скрытым"
+		}
+	case ReportWarned:
+		statsManager.RegisterViolation(r.AuthorID)
+		step := enforcePolicy(bot, chat, author, ViolationReport, reportReason, r.Text, deleted)
+		result = "⚠️ Засчитано: " + describeStep(step)
+	case ReportBanned:
+		if err := bot.Ban(chat, &tele.ChatMember{User: author}); err != nil {
+			log.Printf("⚠️ Не удалось забанить %d: %v", r.AuthorID, err)
+		}
+		statsManager.RegisterBan(r.AuthorID)
+		recordReportViolation(r, reportReason)
+		recordPunishment(womanManager.DB, r.ChatID, r.AuthorID, ActionBan, 0, time.Now(), reportReason, r.Text)
+		go notifyBanned(bot, r.ChatID, author, EscalationStep{Action: ActionBan}, reportReason)
+		result = "🚫 Забанен"
+	case ReportDismissed:
+		if r.Hidden {
+			text := fmt.Sprintf("💬 <b>%s</b>: %s", html.EscapeString(r.AuthorName), html.EscapeString(r.Text))
+			if _, err := bot.Send(chat, text, tele.ModeHTML); err != nil {
+				log.Printf("⚠️ Не удалось вернуть скрытое сообщение: %v", err)
+			}
+		}
+		result = "✖️ Отклонена"
+	}
+	statsManager.RegisterReportOutcome(status == ReportDismissed)
+	logModAction(reviewer, "report_"+status, strconv.FormatInt(r.AuthorID, 10), fmt.Sprintf("report=%d chat=%d msg=%d hidden=%v", r.ID, r.ChatID, r.MessageID, r.Hidden))
+
+	c.Respond(&tele.CallbackResponse{Text: result})
+	if msg := c.Message(); msg != nil {
+		_, _ = bot.Edit(msg, msg.Text+"\n\n"+result, tele.NoPreview)
+	}
+	return nil
+}
+
+// recordReportViolation засчитывает нарушение без применения ступени эскалации
+// (удаление и бан модератор выбрал сам).
+func recordReportViolation(r *MessageReport, reason string) {
+	policy := currentModerationPolicy()
+	if _, err := recordViolation(womanManager.DB, r.ChatID, r.AuthorID, ViolationReport, reason, policy.rule(ViolationReport).weight(), time.Duration(policy.DecayWindow), time.Now()); err != nil {
+		log.Printf("⚠️ Не удалось сохранить нарушение: %v", err)
+	}
+}
+
+// HandleReports — открытые жалобы для модераторов.
+func HandleReports(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermModerate) || womanManager == nil {
+		return nil
+	}
+	var open []MessageReport
+	womanManager.DB.Where("status = ?", ReportOpen).Order("created_at").Limit(10).Find(&open)
+	if len(open) == 0 {
+		return c.Send("Открытых жалоб нет.")
+	}
+	for _, r := range open {
+		var votes int64
+		womanManager.DB.Model(&MessageReportVote{}).Where("report_id = ?", r.ID).Count(&votes)
+		c.Send(reportCardText(r, &tele.User{ID: r.AuthorID, FirstName: r.AuthorName}, votes), buildReportMenu(r.ID), tele.ModeHTML, tele.NoPreview)
+	}
+	return nil
+}
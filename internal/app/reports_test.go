@@ -0,0 +1,157 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestFileReportCountsDistinctReporters(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&MessageReport{}, &MessageReportVote{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	msg := MessageReport{ChatID: -100, MessageID: 7, AuthorID: 5, Text: "купи-продай"}
+
+	r1, votes, added, err := fileReport(db, msg, 1, now)
+	if err != nil || !added || votes != 1 || r1.Status != ReportOpen {
+		t.Fatalf("first report: %+v votes=%d added=%v err=%v", r1, votes, added, err)
+	}
+	if _, votes, added, _ := fileReport(db, msg, 1, now); added || votes != 1 {
+		t.Fatalf("same reporter must not add a vote: votes=%d added=%v", votes, added)
+	}
+	r2, votes, added, _ := fileReport(db, msg, 2, now)
+	if !added || votes != 2 || r2.ID != r1.ID {
+		t.Fatalf("second reporter: %+v votes=%d added=%v", r2, votes, added)
+	}
+
+	got, err := resolveReport(db, r1.ID, 99, ReportDismissed, now)
+	if err != nil || got.Status != ReportDismissed || got.ReviewerID != 99 || got.ResolvedAt == nil {
+		t.Fatalf("resolve: %+v %v", got, err)
+	}
+	if _, err := resolveReport(db, r1.ID, 99, ReportBanned, now); !errors.Is(err, errReportResolved) {
+		t.Fatalf("report must be resolved once, got %v", err)
+	}
+}
+
+func TestReporterLimited(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&MessageReport{}, &MessageReportVote{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < defaultReportsPerHour; i++ {
+		if reporterLimited(db, 1, now) {
+			t.Fatalf("reporter limited after %d reports", i)
+		}
+		fileReport(db, MessageReport{ChatID: -100, MessageID: i + 1}, 1, now)
+	}
+	if !reporterLimited(db, 1, now) {
+		t.Fatal("hourly limit must apply")
+	}
+	if reporterLimited(db, 1, now.Add(2*time.Hour)) {
+		t.Fatal("limit must reset after an hour")
+	}
+
+	// Три отклоненные жалобы — одна в сутки
+	db.Model(&MessageReport{}).Where("message_id <= ?", abusiveReporterDismissals).Update("status", ReportDismissed)
+	if !reporterLimited(db, 1, now.Add(2*time.Hour)) {
+		t.Fatal("abusive reporter must be limited to one report per day")
+	}
+	if reporterLimited(db, 1, now.Add(25*time.Hour)) {
+		t.Fatal("daily limit must reset after a day")
+	}
+}
+
+func TestReportStatsCounters(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := migrateStatsTables(db); err != nil {
+		t.Fatal(err)
+	}
+	sm := NewStatsManager("", db)
+	sm.RegisterReport()
+	sm.RegisterReport()
+	sm.RegisterReportOutcome(true)
+	sm.RegisterReportOutcome(false)
+	if err := sm.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := NewStatsManager("", db)
+	if reloaded.Data.ReportsFiled != 2 || reloaded.Data.ReportsActioned != 1 || reloaded.Data.ReportsDismissed != 1 {
+		t.Fatalf("report counters not persisted: %+v", reloaded.Data)
+	}
+}
+
+func TestReportOutcomesEscalate(t *testing.T) {
+	wm := newTestWomanManager(t)
+	savedWM, savedStats := womanManager, statsManager
+	womanManager = wm
+	statsManager = NewStatsManager(filepath.Join(t.TempDir(), "stats.json"), wm.DB)
+	savedPolicy, savedSource := currentModerationPolicy(), modPolicySource
+	t.Cleanup(func() {
+		womanManager, statsManager = savedWM, savedStats
+		setModerationPolicy(savedPolicy, savedSource)
+	})
+	setModerationPolicy(ModerationPolicy{Steps: []EscalationStep{{Action: ActionWarn}, {Action: ActionWarn}, {Action: ActionMute, Duration: policyDuration(time.Hour)}}}, "test")
+	if err := wm.AddModerator(99, "moderator"); err != nil {
+		t.Fatal(err)
+	}
+
+	const chatID, authorID = -100, 5
+	now := time.Now()
+	var ids []uint
+	for i, hidden := range []bool{false, true, false} {
+		r, _, _, err := fileReport(wm.DB, MessageReport{ChatID: chatID, MessageID: i + 1, AuthorID: authorID, AuthorName: "Spam", Text: "купи"}, 1, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wm.DB.Model(r).Update("hidden", hidden)
+		ids = append(ids, r.ID)
+	}
+
+	bot, calls := newRecordingBot(t)
+	press := func(action string, id uint) {
+		c := bot.NewContext(tele.Update{Callback: &tele.Callback{ID: "cb", Sender: &tele.User{ID: 99}, Data: fmt.Sprintf("%s%s_%d", cbReportPrefix, action, id)}})
+		if err := handleReportCallback(c, c.Callback().Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lastText := func() string {
+		got := calls()
+		for i := len(got) - 1; i >= 0; i-- {
+			if got[i].Method == "sendMessage" {
+				return got[i].Params["text"].(string)
+			}
+		}
+		return ""
+	}
+
+	press("del", ids[0])
+	if lastText() != "" {
+		t.Fatal("delete outcome must not post a warning")
+	}
+	press("warn", ids[1])
+	if text := lastText(); !strings.Contains(text, "предупреждение") || strings.Contains(text, "удалено") {
+		t.Fatalf("hidden message was not deleted now, warning must say so: %q", text)
+	}
+	press("warn", ids[2])
+	muted := false
+	for _, c := range calls() {
+		muted = muted || c.Method == "restrictChatMember"
+	}
+	if !muted {
+		t.Fatalf("third confirmed report must escalate to mute: %+v", calls())
+	}
+
+	var records []ViolationRecord
+	wm.DB.Where("chat_id = ? AND user_id = ?", chatID, authorID).Find(&records)
+	if len(records) != 3 || records[0].Type != string(ViolationReport) {
+		t.Fatalf("every confirmed report must be a violation: %+v", records)
+	}
+}
@@ -0,0 +1,459 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// РЕВИЗИИ КАРТОЧЕК
+// ==========================================
+
+// Каждое сохранение карточки (UpdateWomanBy, SaveDraft, ApproveWoman) пишет полный
+// снимок в WomanRevision. Если у карточки еще нет ревизий, перед первым изменением
+// сохраняется исходное состояние (baseline) — первую же правку можно откатить.
+// Откат — это тоже сохранение, поэтому он становится новой ревизией.
+
+const (
+	cbRevisionPrefix = "rev_"
+	revisionsPerPage = 8
+)
+
+type WomanRevision struct {
+	ID        uint   `gorm:"primaryKey"`
+	WomanID   uint   `gorm:"uniqueIndex:idx_revision_woman_rev"`
+	Rev       int    `gorm:"uniqueIndex:idx_revision_woman_rev"`
+	UserID    int64  // 0 — система
+	Action    string // поле ChangeLog, "baseline", "create", "rollback r3" ...
+	Data      string `gorm:"type:text"` // JSON womanSnapshot
+	CreatedAt time.Time
+}
+
+// womanSnapshot — содержимое карточки без служебных полей gorm.
+type womanSnapshot struct {
+	Name        string   `json:"name"`
+	Field       string   `json:"field"`
+	Year        string   `json:"year"`
+	YearFrom    int      `json:"year_from"`
+	YearTo      int      `json:"year_to"`
+	Info        string   `json:"info"`
+	MediaIDs    []string `json:"media_ids"`
+	Tags        []string `json:"tags"`
+	WebImageURL string   `json:"web_image_url"`
+	IsPublished bool     `json:"is_published"`
+}
+
+func snapshotWoman(w *Woman) womanSnapshot {
+	return womanSnapshot{
+		Name: w.Name, Field: w.Field, Year: w.Year, YearFrom: w.YearFrom, YearTo: w.YearTo, Info: w.Info,
+		MediaIDs: append([]string(nil), w.MediaIDs...), Tags: append([]string(nil), w.Tags...),
+		WebImageURL: w.WebImageURL, IsPublished: w.IsPublished,
+	}
+}
+
+func (s womanSnapshot) applyTo(w *Woman) {
+	w.Name, w.Field, w.Year, w.YearFrom, w.YearTo, w.Info = s.Name, s.Field, s.Year, s.YearFrom, s.YearTo, s.Info
+	w.MediaIDs = append([]string{}, s.MediaIDs...)
+	w.Tags = append([]string(nil), s.Tags...)
+	w.WebImageURL, w.IsPublished = s.WebImageURL, s.IsPublished
+}
+
+func (r WomanRevision) snapshot() (womanSnapshot, error) {
+	var s womanSnapshot
+	err := json.Unmarshal([]byte(r.Data), &s)
+	return s, err
+}
+
+// revisionField — поле, которое можно сравнить и восстановить отдельно.
+type revisionField struct {
+	Key   string
+	Title string
+	Show  func(womanSnapshot) string
+	Copy  func(dst *womanSnapshot, src womanSnapshot)
+}
+
+var revisionFields = []revisionField{
+	{"name", "Имя", func(s womanSnapshot) string { return s.Name }, func(d *womanSnapshot, s womanSnapshot) { d.Name = s.Name }},
+	{"year", "Годы", func(s womanSnapshot) string { return s.Year }, func(d *womanSnapshot, s womanSnapshot) {
+		d.Year, d.YearFrom, d.YearTo = s.Year, s.YearFrom, s.YearTo
+	}},
+	{"field", "Сфера", func(s womanSnapshot) string { return s.Field }, func(d *womanSnapshot, s womanSnapshot) { d.Field = s.Field }},
+	{"info", "Биография", func(s womanSnapshot) string { return s.Info }, func(d *womanSnapshot, s womanSnapshot) { d.Info = s.Info }},
+	{"tags", "Теги", func(s womanSnapshot) string { return strings.Join(s.Tags, ", ") }, func(d *womanSnapshot, s womanSnapshot) { d.Tags = s.Tags }},
+	{"media", "Галерея", func(s womanSnapshot) string {
+		return fmt.Sprintf("%d файл(ов): %s", len(s.MediaIDs), strings.Join(s.MediaIDs, ", "))
+	},
+		func(d *womanSnapshot, s womanSnapshot) { d.MediaIDs = s.MediaIDs }},
+	{"image", "Изображение на сайте", func(s womanSnapshot) string { return s.WebImageURL }, func(d *womanSnapshot, s womanSnapshot) { d.WebImageURL = s.WebImageURL }},
+	{"published", "Публикация", func(s womanSnapshot) string {
+		if s.IsPublished {
+			return "опубликована"
+		}
+		return "скрыта"
+	}, func(d *womanSnapshot, s womanSnapshot) { d.IsPublished = s.IsPublished }},
+}
+
+func findRevisionField(key string) (revisionField, bool) {
+	for _, f := range revisionFields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return revisionField{}, false
+}
+
+type fieldDiff struct {
+	Field revisionField
+	Old   string
+	New   string
+}
+
+func diffSnapshots(a, b womanSnapshot) []fieldDiff {
+	var out []fieldDiff
+	for _, f := range revisionFields {
+		if ov, nv := f.Show(a), f.Show(b); ov != nv {
+			out = append(out, fieldDiff{Field: f, Old: ov, New: nv})
+		}
+	}
+	return out
+}
+
+// ------------------------------------------
+// Хранилище
+// ------------------------------------------
+
+var errRevisionNotFound = errors.New("ревизия не найдена")
+
+func latestRevision(db *gorm.DB, womanID uint) (WomanRevision, bool) {
+	var r WomanRevision
+	db.Where("woman_id = ?", womanID).Order("rev desc").Limit(1).Find(&r)
+	return r, r.ID != 0
+}
+
+// recordRevision сохраняет снимок карточки. Снимок, не отличающийся от последнего,
+// новой ревизии не создает.
+func recordRevision(db *gorm.DB, w *Woman, actorID int64, action string, now time.Time) (WomanRevision, error) {
+	data, err := json.Marshal(snapshotWoman(w))
+	if err != nil {
+		return WomanRevision{}, err
+	}
+	last, ok := latestRevision(db, w.ID)
+	if ok && last.Data == string(data) {
+		return last, nil
+	}
+	r := WomanRevision{WomanID: w.ID, Rev: last.Rev + 1, UserID: actorID, Action: action, Data: string(data), CreatedAt: now}
+	return r, db.Create(&r).Error
+}
+
+// ensureBaselineRevision сохраняет текущее (еще не измененное) состояние карточки,
+// если истории ревизий у нее нет.
+func ensureBaselineRevision(db *gorm.DB, womanID uint) {
+	if womanID == 0 {
+		return
+	}
+	if _, ok := latestRevision(db, womanID); ok {
+		return
+	}
+	var w Woman
+	if err := db.First(&w, womanID).Error; err != nil {
+		return
+	}
+	recordRevision(db, &w, 0, "baseline", w.UpdatedAt)
+}
+
+func getRevision(db *gorm.DB, womanID uint, rev int) (WomanRevision, error) {
+	var r WomanRevision
+	if err := db.Where("woman_id = ? AND rev = ?", womanID, rev).Limit(1).Find(&r).Error; err != nil {
+		return r, err
+	}
+	if r.ID == 0 {
+		return r, errRevisionNotFound
+	}
+	return r, nil
+}
+
+func listRevisions(db *gorm.DB, womanID uint, limit int) []WomanRevision {
+	var rows []WomanRevision
+	db.Where("woman_id = ?", womanID).Order("rev desc").Limit(limit).Find(&rows)
+	return rows
+}
+
+// RestoreRevision возвращает карточке состояние ревизии целиком или одно поле (field != "").
+func (wm *WomanManager) RestoreRevision(womanID uint, rev int, field string, actorID int64) (*Woman, error) {
+	r, err := getRevision(wm.DB, womanID, rev)
+	if err != nil {
+		return nil, err
+	}
+	old, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	w, err := wm.GetWomanByID(womanID)
+	if err != nil || w == nil {
+		return nil, fmt.Errorf("запись не найдена")
+	}
+	before := snapshotWoman(w)
+	next := before
+	action := fmt.Sprintf("rollback r%d", rev)
+	if field == "" {
+		next = old
+	} else {
+		f, ok := findRevisionField(field)
+		if !ok {
+			return nil, fmt.Errorf("неизвестное поле %q", field)
+		}
+		f.Copy(&next, old)
+		action += ":" + field
+	}
+	next.applyTo(w)
+	if err := wm.UpdateWomanBy(w, actorID, action); err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, d := range diffSnapshots(before, snapshotWoman(w)) {
+		changed = append(changed, d.Field.Key)
+	}
+	wm.LogChange(actorID, w.ID, "rollback", fmt.Sprintf("r%d %s", rev, field), strings.Join(changed, ", "))
+	return w, nil
+}
+
+// ------------------------------------------
+// Бот: история, сравнение, откат
+// ------------------------------------------
+
+func revisionActor(id int64) string {
+	if id == 0 {
+		return "система"
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+func buildRevisionList(womanID uint) (string, *tele.ReplyMarkup) {
+	rows := listRevisions(womanManager.DB, womanID, revisionsPerPage+1)
+	if len(rows) == 0 {
+		return "", nil
+	}
+	title := strconv.FormatUint(uint64(womanID), 10)
+	if w, err := womanManager.GetWomanByID(womanID); err == nil && w != nil {
+		title = w.Name
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📜 <b>Ревизии: %s</b>\n\n", html.EscapeString(title)))
+	m := &tele.ReplyMarkup{}
+	var btns []tele.Row
+	for i, r := range rows {
+		if i == revisionsPerPage {
+			break
+		}
+		changed := ""
+		if i+1 < len(rows) {
+			prev, _ := rows[i+1].snapshot()
+			cur, _ := r.snapshot()
+			var titles []string
+			for _, d := range diffSnapshots(prev, cur) {
+				titles = append(titles, d.Field.Title)
+			}
+			changed = " — " + strings.Join(titles, ", ")
+		}
+		sb.WriteString(fmt.Sprintf("<b>r%d</b> · %s · %s · 👤 %s%s\n", r.Rev, r.CreatedAt.Format("02.01 15:04"),
+			html.EscapeString(r.Action), revisionActor(r.UserID), html.EscapeString(changed)))
+		if r.Rev > 1 {
+			btns = append(btns, m.Row(
+				m.Data(fmt.Sprintf("🔍 r%d → r%d", r.Rev-1, r.Rev), fmt.Sprintf("%sdiff_%d_%d_%d", cbRevisionPrefix, womanID, r.Rev-1, r.Rev)),
+				m.Data(fmt.Sprintf("↩️ Вернуть r%d", r.Rev-1), fmt.Sprintf("%sall_%d_%d", cbRevisionPrefix, womanID, r.Rev-1)),
+			))
+		}
+	}
+	if len(rows) > revisionsPerPage {
+		sb.WriteString("…\n")
+	}
+	sb.WriteString("\nСравнить любые: /diff <code>id A [B]</code>, откатить: /rollback <code>id ревизия [поле]</code>")
+	if len(btns) == 0 {
+		return sb.String(), nil
+	}
+	m.Inline(btns...)
+	return sb.String(), m
+}
+
+// buildRevisionDiff сравнивает ревизию a с ревизией b (b == 0 — текущее состояние).
+func buildRevisionDiff(womanID uint, a, b int) (string, *tele.ReplyMarkup, error) {
+	ra, err := getRevision(womanManager.DB, womanID, a)
+	if err != nil {
+		return "", nil, err
+	}
+	from, err := ra.snapshot()
+	if err != nil {
+		return "", nil, err
+	}
+	var to womanSnapshot
+	label := "текущей"
+	if b > 0 {
+		rb, err := getRevision(womanManager.DB, womanID, b)
+		if err != nil {
+			return "", nil, err
+		}
+		if to, err = rb.snapshot(); err != nil {
+			return "", nil, err
+		}
+		label = fmt.Sprintf("r%d", b)
+	} else {
+		w, err := womanManager.GetWomanByID(womanID)
+		if err != nil || w == nil {
+			return "", nil, fmt.Errorf("запись не найдена")
+		}
+		to = snapshotWoman(w)
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🔍 <b>r%d → %s</b> (ID %d)\n", a, label, womanID))
+	diffs := diffSnapshots(from, to)
+	if len(diffs) == 0 {
+		sb.WriteString("\nРазличий нет.")
+		return sb.String(), nil, nil
+	}
+	m := &tele.ReplyMarkup{}
+	var btns []tele.Row
+	for _, d := range diffs {
+		sb.WriteString(fmt.Sprintf("\n<b>%s</b>\n− %s\n+ %s\n", d.Field.Title,
+			html.EscapeString(shorten(orDash(d.Old), 300)), html.EscapeString(shorten(orDash(d.New), 300))))
+		btns = append(btns, m.Row(m.Data(fmt.Sprintf("↩️ %s из r%d", d.Field.Title, a), fmt.Sprintf("%sfield_%d_%d_%s", cbRevisionPrefix, womanID, a, d.Field.Key))))
+	}
+	btns = append(btns, m.Row(m.Data(fmt.Sprintf("↩️ Вся карточка из r%d", a), fmt.Sprintf("%sall_%d_%d", cbRevisionPrefix, womanID, a))))
+	m.Inline(btns...)
+	return sb.String(), m, nil
+}
+
+func orDash(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "—"
+	}
+	return s
+}
+
+func parseWomanID(s string) uint {
+	id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+func parseRevArg(s string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(strings.ToLower(s)), "r"))
+	return n
+}
+
+// HandleDiff: /diff <id> <A> [B] — разница между ревизиями (без B — с текущим состоянием).
+func HandleDiff(c tele.Context) error {
+	if c.Sender() == nil || !isStaff(c.Sender().ID) {
+		return nil
+	}
+	args := c.Args()
+	if len(args) < 2 || len(args) > 3 {
+		return c.Reply("Используйте: /diff <code>&lt;id&gt; &lt;A&gt; [B]</code>", tele.ModeHTML)
+	}
+	id, a, b := parseWomanID(args[0]), parseRevArg(args[1]), 0
+	if len(args) == 3 {
+		b = parseRevArg(args[2])
+	}
+	if id == 0 || a <= 0 || b < 0 {
+		return c.Reply("Неверные аргументы.", tele.ModeHTML)
+	}
+	text, menu, err := buildRevisionDiff(id, a, b)
+	if err != nil {
+		return c.Reply("❌ "+html.EscapeString(err.Error()), tele.ModeHTML)
+	}
+	if menu == nil || !hasPermission(c.Sender().ID, PermEdit) {
+		return c.Reply(text, tele.ModeHTML)
+	}
+	return c.Reply(text, menu, tele.ModeHTML)
+}
+
+// HandleRollback: /rollback <id> <ревизия> [поле]
+func HandleRollback(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermEdit) {
+		return nil
+	}
+	args := c.Args()
+	if len(args) < 2 || len(args) > 3 {
+		var keys []string
+		for _, f := range revisionFields {
+			keys = append(keys, f.Key)
+		}
+		return c.Reply("Используйте: /rollback <code>&lt;id&gt; &lt;ревизия&gt; [поле]</code>\nПоля: "+strings.Join(keys, ", "), tele.ModeHTML)
+	}
+	id, rev, field := parseWomanID(args[0]), parseRevArg(args[1]), ""
+	if len(args) == 3 {
+		field = strings.ToLower(args[2])
+	}
+	if id == 0 || rev <= 0 {
+		return c.Reply("Неверные аргументы.", tele.ModeHTML)
+	}
+	return c.Reply(rollbackReply(id, rev, field, c.Sender().ID), tele.ModeHTML)
+}
+
+func rollbackReply(id uint, rev int, field string, actorID int64) string {
+	w, err := womanManager.RestoreRevision(id, rev, field, actorID)
+	if err != nil {
+		return "❌ Откат не выполнен: " + html.EscapeString(err.Error())
+	}
+	what := "Карточка"
+	if f, ok := findRevisionField(field); ok {
+		what = "Поле «" + f.Title + "»"
+	}
+	last, _ := latestRevision(womanManager.DB, id)
+	return fmt.Sprintf("✅ %s «%s» восстановлено из r%d (новая ревизия r%d).", what, html.EscapeString(w.Name), rev, last.Rev)
+}
+
+// handleRevisionCallback: rev_list_<id>, rev_diff_<id>_<a>_<b>, rev_all_<id>_<rev>, rev_field_<id>_<rev>_<поле>
+func handleRevisionCallback(c tele.Context, data string) error {
+	userID := c.Sender().ID
+	if !isStaff(userID) {
+		return c.Respond()
+	}
+	parts := strings.Split(strings.TrimPrefix(data, cbRevisionPrefix), "_")
+	if len(parts) < 2 {
+		return c.Respond()
+	}
+	id := parseWomanID(parts[1])
+	if id == 0 {
+		return c.Respond()
+	}
+	switch {
+	case parts[0] == "list":
+		text, menu := buildRevisionList(id)
+		if text == "" {
+			return c.Respond(&tele.CallbackResponse{Text: "Ревизий пока нет"})
+		}
+		c.Respond()
+		return c.Send(text, menu, tele.ModeHTML)
+	case parts[0] == "diff" && len(parts) == 4:
+		text, menu, err := buildRevisionDiff(id, parseRevArg(parts[2]), parseRevArg(parts[3]))
+		if err != nil {
+			return c.Respond(&tele.CallbackResponse{Text: err.Error()})
+		}
+		c.Respond()
+		if menu == nil || !hasPermission(userID, PermEdit) {
+			return c.Send(text, tele.ModeHTML)
+		}
+		return c.Send(text, menu, tele.ModeHTML)
+	case parts[0] == "all" && len(parts) == 3, parts[0] == "field" && len(parts) == 4:
+		if !hasPermission(userID, PermEdit) {
+			return c.Respond(&tele.CallbackResponse{Text: "Нет прав на редактирование"})
+		}
+		field := ""
+		if parts[0] == "field" {
+			field = parts[3]
+		}
+		c.Respond()
+		return c.Send(rollbackReply(id, parseRevArg(parts[2]), field, userID), tele.ModeHTML)
+	}
+	return c.Respond()
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRevisionsRecordAndRestore(t *testing.T) {
+	wm := newTestWomanManager(t)
+	w := &Woman{Name: "Мария Кюри", Field: "физика", Year: "1867–1934", Info: "Дважды лауреат", Tags: []string{"физика"}, MediaIDs: []string{"a"}, IsPublished: true}
+	if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+		t.Fatal(err)
+	}
+	// Карточка без ревизий (создана до их появления) получает baseline перед первой правкой
+	wm.DB.Where("woman_id = ?", w.ID).Delete(&WomanRevision{})
+
+	w.Info = "Испорчено"
+	w.MediaIDs = append(w.MediaIDs, "b")
+	if err := wm.UpdateWomanBy(w, 2, "info"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wm.UpdateWomanBy(w, 2, "info"); err != nil {
+		t.Fatal(err)
+	}
+	w.Tags = []string{"химия"}
+	if err := wm.UpdateWomanBy(w, 3, "tags"); err != nil {
+		t.Fatal(err)
+	}
+
+	revs := listRevisions(wm.DB, w.ID, 10)
+	if len(revs) != 3 || revs[2].Action != "baseline" || revs[1].UserID != 2 || revs[0].Rev != 3 {
+		t.Fatalf("unexpected revisions: %+v", revs)
+	}
+	base, _ := revs[2].snapshot()
+	cur, _ := revs[0].snapshot()
+	var keys []string
+	for _, d := range diffSnapshots(base, cur) {
+		keys = append(keys, d.Field.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"info", "tags", "media"}) {
+		t.Fatalf("unexpected diff: %v", keys)
+	}
+
+	// Одно поле: теги остаются, биография возвращается
+	got, err := wm.RestoreRevision(w.ID, 1, "info", 4)
+	if err != nil || got.Info != "Дважды лауреат" || got.Tags[0] != "химия" || len(got.MediaIDs) != 2 {
+		t.Fatalf("field restore: %+v %v", got, err)
+	}
+	last, _ := latestRevision(wm.DB, w.ID)
+	if last.Rev != 4 || last.Action != "rollback r1:info" || last.UserID != 4 {
+		t.Fatalf("restore must be a revision: %+v", last)
+	}
+
+	// Вся карточка
+	got, err = wm.RestoreRevision(w.ID, 1, "", 4)
+	if err != nil || got.Tags[0] != "физика" || len(got.MediaIDs) != 1 {
+		t.Fatalf("full restore: %+v %v", got, err)
+	}
+	fresh, _ := wm.GetWomanByID(w.ID)
+	if fresh.Info != "Дважды лауреат" || !reflect.DeepEqual(fresh.MediaIDs, []string{"a"}) {
+		t.Fatalf("restore not persisted: %+v", fresh)
+	}
+	if tags := wm.womenWithTag("химия"); len(tags) != 0 {
+		t.Fatalf("tag index must follow the restore: %v", tags)
+	}
+
+	if _, err := wm.RestoreRevision(w.ID, 99, "", 4); !errors.Is(err, errRevisionNotFound) {
+		t.Fatalf("missing revision: %v", err)
+	}
+	if _, err := wm.RestoreRevision(w.ID, 1, "nope", 4); err == nil {
+		t.Fatal("unknown field must fail")
+	}
+}
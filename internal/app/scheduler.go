@@ -3,6 +3,7 @@ package app
 import (
 	"fmt"
 	"log"
+	"path/filepath"
 	"time"
 
 	tele "gopkg.in/telebot.v3"
@@ -34,6 +35,9 @@ func StartScheduler(bot *tele.Bot, wm *WomanManager, chatID int64) {
 
 		// 6. Еженедельный отчет
 		checkAndSendReport(bot, wm)
+
+		// 7. Сводка теневых правил модерации
+		checkAndSendShadowDigest(bot, wm)
 	}
 }
 
@@ -110,16 +114,19 @@ func checkAndBackup(bot *tele.Bot, wm *WomanManager) {
 
 // PerformBackup выполняет сжатие и отправку базы данных
 func PerformBackup(bot *tele.Bot, wm *WomanManager) {
-	// 1. Оптимизация базы данных перед отправкой
-	if err := wm.Vacuum(); err != nil {
-		log.Printf("⚠️ Ошибка Vacuum перед бэкапом: %v", err)
+	// 1. Снимок базы средствами диалекта (VACUUM INTO для SQLite, pg_dump для Postgres)
+	ext := wm.Dialect.BackupExt()
+	path := filepath.Join(dirBackups, "women_backup_weekly"+ext)
+	if err := wm.Backup(path); err != nil {
+		log.Printf("⚠️ Ошибка создания бэкапа: %v", err)
+		return
 	}
 
 	// 2. Формирование файла
 	file := &tele.Document{
-		File:     tele.FromDisk(wm.FilePath),
+		File:     tele.FromDisk(path),
 		Caption:  fmt.Sprintf("💾 <b>Авто-Бэкап базы данных</b>\n📅 %s\n📦 <i>Weekly Backup</i>", time.Now().Format("02.01.2006 15:04")),
-		FileName: "women_backup.db",
+		FileName: "women_backup" + ext,
 	}
 
 	// 3. Отправка всем админам
@@ -159,7 +166,7 @@ func checkAndSendSubscriptions(bot *tele.Bot, wm *WomanManager) {
 			continue
 		}
 		if now.Hour() == targetTime.Hour() && now.Minute() == targetTime.Minute() {
-			w := wm.GetRandomWoman()
+			w := wm.dailyCardFor(sub.UserID)
 			if w == nil {
 				continue
 			}
@@ -168,10 +175,14 @@ func checkAndSendSubscriptions(bot *tele.Bot, wm *WomanManager) {
 				return e
 			})
 			if err == nil {
-				_ = sendWithRetry(3, 500*time.Millisecond, func() error {
+				err = sendWithRetry(3, 500*time.Millisecond, func() error {
 					return wm.SendWomanCard(bot, &tele.User{ID: sub.UserID}, w)
 				})
 			}
+			// отправленная карточка больше не рекомендуется, но просмотром не считается
+			if err == nil {
+				wm.TrackDelivery(sub.UserID, w.ID)
+			}
 			sub.LastRun = now
 			_ = wm.UpdateSubscription(&sub)
 		}
@@ -292,3 +303,37 @@ func checkAndSendReport(bot *tele.Bot, wm *WomanManager) {
 	s.ReportLastRun = now
 	_ = wm.UpdateSettings(s)
 }
+
+// checkAndSendShadowDigest — ежедневная сводка срабатываний теневых правил для админов.
+func checkAndSendShadowDigest(bot *tele.Bot, wm *WomanManager) {
+	s, err := wm.GetSettings()
+	if err != nil || s == nil {
+		return
+	}
+	now := time.Now()
+	if s.ShadowDigestLastRun.Year() == now.Year() && s.ShadowDigestLastRun.YearDay() == now.YearDay() {
+		return
+	}
+	targetTime, err := time.Parse("15:04", s.ShadowDigestTime)
+	if err != nil {
+		return
+	}
+	if now.Hour() != targetTime.Hour() || now.Minute() != targetTime.Minute() {
+		return
+	}
+	since := s.ShadowDigestLastRun
+	if since.IsZero() || now.Sub(since) > 7*24*time.Hour {
+		since = now.Add(-24 * time.Hour)
+	}
+	if text := buildShadowDigest(wm.DB, activeShadowRules(), since); text != "" {
+		for _, adminID := range getAdmins() {
+			_ = sendWithRetry(3, 500*time.Millisecond, func() error {
+				_, e := bot.Send(&tele.User{ID: adminID}, text, tele.ModeHTML)
+				return e
+			})
+		}
+	}
+	pruneShadowHits(wm.DB, now)
+	s.ShadowDigestLastRun = now
+	_ = wm.UpdateSettings(s)
+}
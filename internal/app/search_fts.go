@@ -0,0 +1,213 @@
+package app
+
+import (
+	"html"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// ПОЛНОТЕКСТОВЫЙ ПОИСК (FTS5)
+// ==========================================
+
+// В индексе хранятся основы слов (см. stemRussian), rowid совпадает с id записи.
+// Веса bm25: имя важнее тегов, теги важнее сферы, сфера важнее биографии.
+// womenFTSVersion увеличивается при любой правке стеммера, токенизатора или
+// состава колонок — тогда индекс пересоздается при старте.
+const (
+	womenFTSTable   = "women_fts"
+	womenFTSRank    = "bm25(women_fts, 10.0, 3.0, 1.0, 5.0)"
+	womenFTSVersion = 1
+)
+
+// ensureSearchIndex создает FTS-таблицу и переиндексирует архив, если индекс
+// устарел по версии или разошелся с таблицей.
+func (wm *WomanManager) ensureSearchIndex() {
+	if !wm.Dialect.SupportsFTS5() {
+		wm.ftsEnabled = false
+		return
+	}
+	stale := wm.schemaVersion(womenFTSTable) != womenFTSVersion
+	if stale {
+		if err := wm.DB.Exec("DROP TABLE IF EXISTS " + womenFTSTable).Error; err != nil {
+			log.Printf("⚠️ Не удалось удалить устаревший поисковый индекс: %v", err)
+		}
+	}
+	err := wm.DB.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS " + womenFTSTable +
+		" USING fts5(name_idx, field_idx, info_idx, tags_idx, tokenize = 'unicode61 remove_diacritics 2')").Error
+	if err != nil {
+		log.Printf("⚠️ FTS5 недоступен, поиск работает через LIKE: %v", err)
+		wm.ftsEnabled = false
+		return
+	}
+	wm.ftsEnabled = true
+
+	var indexed, total int64
+	wm.DB.Raw("SELECT COUNT(*) FROM " + womenFTSTable).Scan(&indexed)
+	wm.DB.Model(&Woman{}).Count(&total)
+	if !stale && indexed == total {
+		return
+	}
+	log.Printf("🔎 Перестраиваю поисковый индекс (%d записей, версия %d)...", total, womenFTSVersion)
+	if err := wm.rebuildSearchIndex(); err != nil {
+		log.Printf("⚠️ Ошибка построения поискового индекса: %v", err)
+		return
+	}
+	if err := wm.setSchemaVersion(womenFTSTable, womenFTSVersion); err != nil {
+		log.Printf("⚠️ Не удалось сохранить версию поискового индекса: %v", err)
+	}
+}
+
+func (wm *WomanManager) rebuildSearchIndex() error {
+	if err := wm.DB.Exec("DELETE FROM " + womenFTSTable).Error; err != nil {
+		return err
+	}
+	var women []Woman
+	return wm.DB.FindInBatches(&women, 200, func(tx *gorm.DB, batch int) error {
+		for i := range women {
+			if err := indexWoman(tx, &women[i]); err != nil {
+				log.Printf("⚠️ Не удалось проиндексировать ID %d: %v", women[i].ID, err)
+			}
+		}
+		return nil
+	}).Error
+}
+
+func indexWoman(db *gorm.DB, w *Woman) error {
+	if err := db.Exec("DELETE FROM "+womenFTSTable+" WHERE rowid = ?", w.ID).Error; err != nil {
+		return err
+	}
+	return db.Exec("INSERT INTO "+womenFTSTable+" (rowid, name_idx, field_idx, info_idx, tags_idx) VALUES (?, ?, ?, ?, ?)",
+		w.ID,
+		stemText(w.Name),
+		stemText(w.Field),
+		stemText(removeHTMLTags(w.Info)),
+		stemText(strings.Join(w.Tags, " ")),
+	).Error
+}
+
+// syncSearchIndex обновляет запись в индексе (и в индексе похожих) после сохранения карточки.
+func (wm *WomanManager) syncSearchIndex(w *Woman) {
+	wm.related.update(w)
+	if !wm.ftsEnabled || w == nil || w.ID == 0 {
+		return
+	}
+	if err := indexWoman(wm.DB, w); err != nil {
+		log.Printf("⚠️ Не удалось обновить поисковый индекс для ID %d: %v", w.ID, err)
+	}
+}
+
+// dropFromSearchIndex убирает запись из индекса (удаление, слияние).
+func (wm *WomanManager) dropFromSearchIndex(id uint) {
+	wm.related.remove(id)
+	if !wm.ftsEnabled {
+		return
+	}
+	if err := wm.DB.Exec("DELETE FROM "+womenFTSTable+" WHERE rowid = ?", id).Error; err != nil {
+		log.Printf("⚠️ Не удалось удалить ID %d из поискового индекса: %v", id, err)
+	}
+}
+
+// buildFTSQuery превращает пользовательский запрос в выражение MATCH:
+// все слова обязательны, каждое ищется как префикс основы.
+func buildFTSQuery(query string) string {
+	var terms []string
+	for _, w := range splitSearchWords(query) {
+		stem := stemRussian(w)
+		if stem == "" {
+			continue
+		}
+		terms = append(terms, `"`+stem+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// ftsMatch возвращает выражение MATCH или "", если FTS выключен и нужен LIKE.
+func (wm *WomanManager) ftsMatch(query string) string {
+	if !wm.ftsEnabled || strings.TrimSpace(query) == "" {
+		return ""
+	}
+	return buildFTSQuery(query)
+}
+
+// ==========================================
+// СНИППЕТЫ
+// ==========================================
+
+const searchSnippetWords = 24
+
+// buildSearchSnippet вырезает фрагмент биографии вокруг первого совпадения
+// и выделяет найденные слова тегом <b>. Результат уже экранирован для HTML.
+func buildSearchSnippet(w *Woman, query string) string {
+	if w == nil {
+		return ""
+	}
+	stems := map[string]bool{}
+	for _, q := range splitSearchWords(query) {
+		if s := stemRussian(q); s != "" {
+			stems[s] = true
+		}
+	}
+	if len(stems) == 0 {
+		return ""
+	}
+	matches := func(word string) bool {
+		for _, t := range splitSearchWords(word) {
+			s := stemRussian(t)
+			for q := range stems {
+				if strings.HasPrefix(s, q) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	words := strings.Fields(removeHTMLTags(w.Info))
+	first := -1
+	for i, word := range words {
+		if matches(word) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		// Совпадение только в имени, сфере или тегах — показываем сферу и теги
+		meta := strings.Fields(w.Field)
+		for _, t := range w.Tags {
+			meta = append(meta, "#"+t)
+		}
+		return highlightWords(meta, matches)
+	}
+
+	start := first - searchSnippetWords/3
+	if start < 0 {
+		start = 0
+	}
+	end := start + searchSnippetWords
+	if end > len(words) {
+		end = len(words)
+	}
+	out := highlightWords(words[start:end], matches)
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(words) {
+		out += "…"
+	}
+	return out
+}
+
+func highlightWords(words []string, matches func(string) bool) string {
+	parts := make([]string, 0, len(words))
+	for _, word := range words {
+		escaped := html.EscapeString(word)
+		if matches(word) {
+			escaped = "<b>" + escaped + "</b>"
+		}
+		parts = append(parts, escaped)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,47 @@
+package app
+
+import "testing"
+
+func TestSearchIndexPaging(t *testing.T) {
+	wm := newTestWomanManager(t)
+	if !wm.ftsEnabled {
+		t.Skip("FTS5 недоступен")
+	}
+	cards := []*Woman{
+		{Name: "Ада Лавлейс", Field: "математика", Info: "Первая программа для машины.", IsPublished: true},
+		{Name: "Софья Ковалевская", Field: "математика", Info: "Математик и писательница.", IsPublished: true},
+		{Name: "Математика", Field: "математика", Info: "Математика, математика.", IsPublished: true},
+		{Name: "Анна Ахматова", Field: "литература", Info: "Поэтесса.", IsPublished: true},
+	}
+	for _, w := range cards {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all := wm.SearchWomenAdvanced(SearchFilters{Query: "математика"})
+	if len(all) != 3 || all[0].ID != cards[2].ID {
+		t.Fatalf("name match must rank first: %+v", all)
+	}
+	page, total := wm.SearchWomenPage(SearchFilters{Query: "математика"}, 1, 1)
+	if total != 3 || len(page) != 1 || page[0].ID != all[1].ID {
+		t.Fatalf("page 2 of 3: %d %+v", total, page)
+	}
+	if page, total := wm.SearchWomenPage(SearchFilters{Field: "математика"}, 2, 2); total != 3 || len(page) != 1 {
+		t.Fatalf("last page without FTS: %d %+v", total, page)
+	}
+
+	// Устаревшая версия индекса перестраивает его при старте
+	if err := wm.setSchemaVersion(womenFTSTable, womenFTSVersion-1); err != nil {
+		t.Fatal(err)
+	}
+	wm.DB.Exec("DELETE FROM "+womenFTSTable+" WHERE rowid = ?", cards[0].ID)
+	wm.DB.Exec("INSERT INTO "+womenFTSTable+" (rowid, name_idx) VALUES (?, ?)", 999, "мусор")
+	wm.ensureSearchIndex()
+	if wm.schemaVersion(womenFTSTable) != womenFTSVersion {
+		t.Fatal("version must be stored after rebuild")
+	}
+	if got := wm.SearchWomenAdvanced(SearchFilters{Query: "программа"}); len(got) != 1 || got[0].ID != cards[0].ID {
+		t.Fatalf("rebuilt index must find the dropped card: %+v", got)
+	}
+}
@@ -0,0 +1,493 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// ТЕНЕВОЙ РЕЖИМ ПРАВИЛ МОДЕРАЦИИ
+// ==========================================
+
+// Правило в тени ничего не удаляет и не наказывает — только записывает,
+// что сделало бы. Раз в сутки админы получают сводку по срабатываниям
+// и решают: /shadow_off — включить правило, /shadow_drop — убрать.
+//
+// Имена правил:
+//   link, phone, card, bad_word, nickname — проверка целиком ("shadow": true в политике)
+//   steps:<тип>  — новая лестница наказаний ("shadow_steps" в политике)
+//   word:<слово> — запись списка слов с префиксом shadow: (words.json или профиль чата)
+
+const (
+	shadowWordPrefix  = "word:"
+	shadowStepsPrefix = "steps:"
+	shadowSampleLen   = 200
+	shadowDigestRules = 15
+	shadowSamples     = 3
+	shadowRetention   = 30 * 24 * time.Hour
+)
+
+// ShadowHit — срабатывание теневого правила.
+type ShadowHit struct {
+	ID        uint   `gorm:"primaryKey"`
+	Rule      string `gorm:"size:160;index"`
+	Reason    string
+	ChatID    int64
+	UserID    int64
+	Sample    string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+type shadowHit struct {
+	Rule   string
+	Reason string
+}
+
+// textVerdict — итог проверки сообщения или ника: боевое нарушение (если есть)
+// и срабатывания теневых правил.
+type textVerdict struct {
+	Spam   bool
+	Type   ViolationType
+	Reason string
+	Shadow []shadowHit
+}
+
+// decide засчитывает нарушение или, если правило в тени, только запоминает его.
+func (v *textVerdict) decide(policy ModerationPolicy, vt ViolationType, reason string) bool {
+	if policy.rule(vt).Shadow {
+		v.Shadow = append(v.Shadow, shadowHit{Rule: string(vt), Reason: reason})
+		return false
+	}
+	v.Spam, v.Type, v.Reason = true, vt, reason
+	return true
+}
+
+func (v *textVerdict) addShadowWords(entries []string, reason string) {
+	for _, e := range entries {
+		v.Shadow = append(v.Shadow, shadowHit{Rule: shadowWordPrefix + e, Reason: reason})
+	}
+}
+
+func sameStep(a, b EscalationStep) bool { return a.Action == b.Action && a.Duration == b.Duration }
+
+// shadowStepHit сравнивает действующую лестницу с теневой на том же числе нарушений.
+func shadowStepHit(policy ModerationPolicy, vt ViolationType, points int, actual EscalationStep) (shadowHit, bool) {
+	steps := policy.rule(vt).ShadowSteps
+	if len(steps) == 0 {
+		return shadowHit{}, false
+	}
+	candidate, _ := ModerationPolicy{Steps: steps}.stepFor(vt, points)
+	if sameStep(candidate, actual) {
+		return shadowHit{}, false
+	}
+	return shadowHit{
+		Rule:   shadowStepsPrefix + string(vt),
+		Reason: fmt.Sprintf("%s вместо %s", describeStep(candidate), describeStep(actual)),
+	}, true
+}
+
+func saveShadowHits(db *gorm.DB, chatID, userID int64, sample string, hits []shadowHit, now time.Time) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	rows := make([]ShadowHit, 0, len(hits))
+	for _, h := range hits {
+		rows = append(rows, ShadowHit{Rule: h.Rule, Reason: h.Reason, ChatID: chatID, UserID: userID, Sample: shorten(sample, shadowSampleLen), CreatedAt: now})
+	}
+	return db.Create(&rows).Error
+}
+
+func recordShadowHits(chatID, userID int64, sample string, hits []shadowHit) {
+	if len(hits) == 0 || womanManager == nil {
+		return
+	}
+	if err := saveShadowHits(womanManager.DB, chatID, userID, sample, hits, time.Now()); err != nil {
+		log.Printf("⚠️ Не удалось записать срабатывание теневого правила: %v", err)
+	}
+}
+
+// ------------------------------------------
+// Списки слов
+// ------------------------------------------
+
+// rewriteWordList применяет fn к каждой записи; fn возвращает новую запись
+// и false, если запись нужно удалить.
+func rewriteWordList(list []string, fn func(string) (string, bool)) ([]string, bool) {
+	out := make([]string, 0, len(list))
+	changed := false
+	for _, w := range list {
+		nw, keep := fn(w)
+		if !keep || nw != w {
+			changed = true
+		}
+		if keep {
+			out = append(out, nw)
+		}
+	}
+	return out, changed
+}
+
+// rewriteWords меняет общий список и доп. слова профилей чатов. Возвращает число измененных списков.
+func rewriteWords(fn func(string) (string, bool)) (int, error) {
+	changed := 0
+	wordsMu.Lock()
+	list, ok := rewriteWordList(badWords, fn)
+	if ok {
+		badWords = list
+		invalidateBadWords()
+	}
+	wordsMu.Unlock()
+	if ok {
+		if err := saveWords(); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	if womanManager == nil {
+		return changed, nil
+	}
+	var profiles []ChatModerationProfile
+	if err := womanManager.DB.Find(&profiles).Error; err != nil {
+		return changed, err
+	}
+	for _, p := range profiles {
+		list, ok := rewriteWordList(p.ExtraWords, fn)
+		if !ok {
+			continue
+		}
+		p.ExtraWords = list
+		if err := saveChatProfile(p); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+func shadowWords() []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(list []string) {
+		for _, w := range list {
+			if e, ok := isShadowEntry(w); ok && !seen[e] {
+				seen[e] = true
+				out = append(out, e)
+			}
+		}
+	}
+	wordsMu.RLock()
+	add(badWords)
+	wordsMu.RUnlock()
+	if womanManager != nil {
+		var profiles []ChatModerationProfile
+		womanManager.DB.Find(&profiles)
+		for _, p := range profiles {
+			add(p.ExtraWords)
+		}
+	}
+	return out
+}
+
+// activeShadowRules — все правила, которые сейчас работают в тени.
+func activeShadowRules() []string {
+	policy := currentModerationPolicy()
+	var out []string
+	for _, vt := range violationTypes {
+		r := policy.rule(vt)
+		if r.Shadow {
+			out = append(out, string(vt))
+		}
+		if len(r.ShadowSteps) > 0 {
+			out = append(out, shadowStepsPrefix+string(vt))
+		}
+	}
+	for _, w := range shadowWords() {
+		out = append(out, shadowWordPrefix+w)
+	}
+	return out
+}
+
+// ------------------------------------------
+// Перевод правил в тень и обратно
+// ------------------------------------------
+
+var errShadowUnknownRule = errors.New("неизвестное правило")
+
+// withPolicyRule копирует политику, меняет одно правило и сохраняет в БД.
+func withPolicyRule(vt ViolationType, by int64, fn func(*ViolationRule) error) error {
+	p := currentModerationPolicy()
+	rules := make(map[ViolationType]ViolationRule, len(p.Rules)+1)
+	for k, v := range p.Rules {
+		rules[k] = v
+	}
+	r := rules[vt]
+	if err := fn(&r); err != nil {
+		return err
+	}
+	rules[vt] = r
+	p.Rules = rules
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return saveModerationPolicy(p, by)
+}
+
+type shadowOp int
+
+const (
+	shadowOn shadowOp = iota
+	shadowPromote
+	shadowDrop
+)
+
+// applyShadowOp выполняет /shadow, /shadow_off и /shadow_drop. Возвращает текст ответа.
+func applyShadowOp(rule string, op shadowOp, by int64) (string, error) {
+	switch {
+	case strings.HasPrefix(rule, shadowWordPrefix):
+		entry := normalizeWordEntry(strings.TrimPrefix(rule, shadowWordPrefix))
+		if entry == "" {
+			return "", errShadowUnknownRule
+		}
+		return applyShadowWordOp(entry, op)
+	case strings.HasPrefix(rule, shadowStepsPrefix):
+		vt := ViolationType(strings.TrimPrefix(rule, shadowStepsPrefix))
+		if !isViolationType(vt) {
+			return "", errShadowUnknownRule
+		}
+		if op == shadowOn {
+			return "Теневую лестницу задайте в политике: /policy_set с <code>\"shadow_steps\"</code> в rules." + string(vt) + ".", nil
+		}
+		err := withPolicyRule(vt, by, func(r *ViolationRule) error {
+			if len(r.ShadowSteps) == 0 {
+				return errShadowUnknownRule
+			}
+			if op == shadowPromote {
+				r.Steps = r.ShadowSteps
+			}
+			r.ShadowSteps = nil
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if op == shadowPromote {
+			return "✅ Новая лестница для " + string(vt) + " включена.", nil
+		}
+		return "✅ Теневая лестница для " + string(vt) + " удалена.", nil
+	default:
+		vt := ViolationType(rule)
+		if !isViolationType(vt) {
+			return "", errShadowUnknownRule
+		}
+		if op == shadowDrop {
+			return "Встроенную проверку нельзя удалить — отключите её в профилях чатов (/chatmod) и выполните /shadow_off " + string(vt) + ".", nil
+		}
+		err := withPolicyRule(vt, by, func(r *ViolationRule) error {
+			r.Shadow = op == shadowOn
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if op == shadowOn {
+			return "🌘 Правило " + string(vt) + " работает в тени: нарушения записываются, но не наказываются.", nil
+		}
+		return "✅ Правило " + string(vt) + " снова действует.", nil
+	}
+}
+
+func applyShadowWordOp(entry string, op shadowOp) (string, error) {
+	plain, _ := isShadowEntry(entry)
+	shadowed := shadowPrefix + plain
+	var fn func(string) (string, bool)
+	switch op {
+	case shadowOn:
+		fn = func(w string) (string, bool) {
+			if w == plain {
+				return shadowed, true
+			}
+			return w, true
+		}
+	case shadowPromote:
+		fn = func(w string) (string, bool) {
+			if w == shadowed {
+				return plain, true
+			}
+			return w, true
+		}
+	case shadowDrop:
+		fn = func(w string) (string, bool) { return w, w != shadowed }
+	}
+	n, err := rewriteWords(fn)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 && op == shadowOn {
+		// Нового слова еще нет ни в одном списке — добавляем в общий сразу в тени
+		wordsMu.Lock()
+		badWords = append(badWords, shadowed)
+		invalidateBadWords()
+		wordsMu.Unlock()
+		if err := saveWords(); err != nil {
+			return "", err
+		}
+		n = 1
+	}
+	if n == 0 {
+		return "", errShadowUnknownRule
+	}
+	switch op {
+	case shadowOn:
+		return fmt.Sprintf("🌘 Слово «%s» работает в тени (списков: %d).", html.EscapeString(plain), n), nil
+	case shadowPromote:
+		return fmt.Sprintf("✅ Слово «%s» теперь запрещено (списков: %d).", html.EscapeString(plain), n), nil
+	}
+	return fmt.Sprintf("✅ Слово «%s» удалено (списков: %d).", html.EscapeString(plain), n), nil
+}
+
+// ------------------------------------------
+// Сводка
+// ------------------------------------------
+
+type shadowRuleStats struct {
+	Rule    string
+	Hits    int
+	Users   map[int64]bool
+	Chats   map[int64]bool
+	Samples []string
+}
+
+func collectShadowStats(db *gorm.DB, since time.Time) []*shadowRuleStats {
+	var hits []ShadowHit
+	db.Where("created_at >= ?", since).Order("created_at desc").Find(&hits)
+	byRule := make(map[string]*shadowRuleStats)
+	var out []*shadowRuleStats
+	for _, h := range hits {
+		s := byRule[h.Rule]
+		if s == nil {
+			s = &shadowRuleStats{Rule: h.Rule, Users: make(map[int64]bool), Chats: make(map[int64]bool)}
+			byRule[h.Rule] = s
+			out = append(out, s)
+		}
+		s.Hits++
+		s.Users[h.UserID] = true
+		s.Chats[h.ChatID] = true
+		sample := h.Sample
+		if h.Reason != "" && strings.HasPrefix(h.Rule, shadowStepsPrefix) {
+			sample = h.Reason + ": " + sample
+		}
+		if len(s.Samples) < shadowSamples && !containsString(s.Samples, sample) {
+			s.Samples = append(s.Samples, sample)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Hits > out[j].Hits })
+	return out
+}
+
+// buildShadowDigest — сводка за период по срабатываниям и теневым правилам без срабатываний.
+// Пустая строка — теневых правил нет и ничего не сработало.
+func buildShadowDigest(db *gorm.DB, rules []string, since time.Time) string {
+	stats := collectShadowStats(db, since)
+	if len(stats) == 0 && len(rules) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("🌘 <b>Теневые правила модерации</b>\n")
+	sb.WriteString(fmt.Sprintf("<i>С %s</i>\n", since.Format("02.01 15:04")))
+	seen := make(map[string]bool)
+	for i, s := range stats {
+		seen[s.Rule] = true
+		if i >= shadowDigestRules {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n<b>%s</b> — %d сраб., участников %d, чатов %d\n", html.EscapeString(s.Rule), s.Hits, len(s.Users), len(s.Chats)))
+		for _, sample := range s.Samples {
+			sb.WriteString("  • " + html.EscapeString(shorten(sample, 120)) + "\n")
+		}
+		sb.WriteString(fmt.Sprintf("  /shadow_off %s · /shadow_drop %s\n", html.EscapeString(s.Rule), html.EscapeString(s.Rule)))
+	}
+	if len(stats) > shadowDigestRules {
+		sb.WriteString(fmt.Sprintf("\n…и еще правил: %d\n", len(stats)-shadowDigestRules))
+	}
+	var quiet []string
+	for _, r := range rules {
+		if !seen[r] {
+			quiet = append(quiet, html.EscapeString(r))
+		}
+	}
+	if len(quiet) > 0 {
+		sb.WriteString("\n💤 Без срабатываний: " + strings.Join(quiet, ", ") + "\n")
+	}
+	return sb.String()
+}
+
+func pruneShadowHits(db *gorm.DB, now time.Time) {
+	db.Where("created_at < ?", now.Add(-shadowRetention)).Delete(&ShadowHit{})
+}
+
+// ------------------------------------------
+// Команды
+// ------------------------------------------
+
+// HandleShadow: /shadow — теневые правила и срабатывания за сутки; /shadow <правило> — перевести в тень.
+func HandleShadow(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermModerate) || womanManager == nil {
+		return nil
+	}
+	rule := strings.TrimSpace(c.Message().Payload)
+	if rule == "" {
+		text := buildShadowDigest(womanManager.DB, activeShadowRules(), time.Now().Add(-24*time.Hour))
+		if text == "" {
+			text = "Теневых правил нет. Перевести в тень: /shadow <code>bad_word</code> или /shadow <code>word:слово</code>."
+		}
+		return c.Reply(text, tele.ModeHTML)
+	}
+	return handleShadowOp(c, rule, shadowOn, "shadow_on")
+}
+
+func HandleShadowOff(c tele.Context) error {
+	return handleShadowOp(c, strings.TrimSpace(c.Message().Payload), shadowPromote, "shadow_promote")
+}
+
+func HandleShadowDrop(c tele.Context) error {
+	return handleShadowOp(c, strings.TrimSpace(c.Message().Payload), shadowDrop, "shadow_drop")
+}
+
+func handleShadowOp(c tele.Context, rule string, op shadowOp, action string) error {
+	if c.Sender() == nil || !isAdmin(c.Sender().ID) || womanManager == nil {
+		return nil
+	}
+	if rule == "" {
+		return c.Reply("Укажите правило: <code>bad_word</code>, <code>steps:link</code> или <code>word:слово</code>.", tele.ModeHTML)
+	}
+	text, err := applyShadowOp(rule, op, c.Sender().ID)
+	if errors.Is(err, errShadowUnknownRule) {
+		return c.Reply("❌ Теневое правило не найдено: "+html.EscapeString(rule), tele.ModeHTML)
+	}
+	if err != nil {
+		return c.Reply("❌ Ошибка: "+html.EscapeString(err.Error()), tele.ModeHTML)
+	}
+	if op != shadowOn {
+		// Решение принято — старые срабатывания больше не нужны в сводке
+		womanManager.DB.Where("rule = ?", shadowRuleKey(rule)).Delete(&ShadowHit{})
+	}
+	logModAction(c.Sender().ID, action, rule, "")
+	return c.Reply(text, tele.ModeHTML)
+}
+
+// shadowRuleKey приводит имя правила к виду, в котором оно хранится в ShadowHit.
+func shadowRuleKey(rule string) string {
+	if strings.HasPrefix(rule, shadowWordPrefix) {
+		entry, _ := isShadowEntry(normalizeWordEntry(strings.TrimPrefix(rule, shadowWordPrefix)))
+		return shadowWordPrefix + entry
+	}
+	return rule
+}
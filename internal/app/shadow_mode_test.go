@@ -0,0 +1,121 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestShadowRulesRecordWithoutEnforcing(t *testing.T) {
+	wordsMu.Lock()
+	saved := badWords
+	badWords = []string{"спам", "shadow:казино"}
+	invalidateBadWords()
+	wordsMu.Unlock()
+	oldPolicy := currentModerationPolicy()
+	t.Cleanup(func() {
+		wordsMu.Lock()
+		badWords = saved
+		invalidateBadWords()
+		wordsMu.Unlock()
+		setModerationPolicy(oldPolicy, "по умолчанию")
+	})
+
+	p := ChatModerationProfile{ChatID: -300, Enabled: true, CheckLinks: true, CheckBadWords: true, CheckNicknames: true}
+
+	v := p.evaluateText("лучшее казин0 города", 1)
+	if v.Spam || len(v.Shadow) != 1 || v.Shadow[0].Rule != "word:казино" {
+		t.Fatalf("shadow word must be recorded only: %+v", v)
+	}
+	if !containsBadWord("спам и казино") || containsBadWord("казино") {
+		t.Fatal("containsBadWord must ignore shadow entries")
+	}
+
+	policy := defaultModerationPolicy()
+	policy.Rules[ViolationLink] = ViolationRule{Shadow: true}
+	setModerationPolicy(policy, "тест")
+	v = p.evaluateText("evil.com и спам", 1)
+	if !v.Spam || v.Type != ViolationBadWord || len(v.Shadow) != 1 || v.Shadow[0].Rule != string(ViolationLink) {
+		t.Fatalf("shadow link rule must not stop enforcing rules: %+v", v)
+	}
+	if spam, _, _ := p.checkText("evil.com", 1); spam {
+		t.Fatal("shadow rule must not be enforced")
+	}
+
+	policy.Rules[ViolationNickname] = ViolationRule{Shadow: true}
+	v = p.evaluateNickname(&tele.User{ID: 5, FirstName: "Спам", LastName: "Рассылка"})
+	if v.Spam || len(v.Shadow) == 0 || v.Shadow[0].Rule != string(ViolationNickname) {
+		t.Fatalf("shadow nickname rule must be recorded only: %+v", v)
+	}
+}
+
+func TestShadowStepHit(t *testing.T) {
+	policy := defaultModerationPolicy()
+	policy.Rules[ViolationPhone] = ViolationRule{ShadowSteps: []EscalationStep{{Action: ActionMute, Duration: policyDuration(time.Hour)}, {Action: ActionBan}}}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	actual, _ := policy.stepFor(ViolationPhone, 1)
+	hit, ok := shadowStepHit(policy, ViolationPhone, 1, actual)
+	if !ok || hit.Rule != "steps:phone" || !strings.Contains(hit.Reason, "мут") {
+		t.Fatalf("candidate ladder must be reported: %+v %v", hit, ok)
+	}
+	actual, _ = policy.stepFor(ViolationPhone, 2)
+	if _, ok := shadowStepHit(policy, ViolationPhone, 2, actual); ok {
+		t.Fatal("matching steps must not be reported")
+	}
+}
+
+func TestRewriteWordListPromotesShadowEntry(t *testing.T) {
+	list := []string{"спам", "shadow:казино", "shadow:лото"}
+	got, changed := rewriteWordList(list, func(w string) (string, bool) {
+		if w == "shadow:казино" {
+			return "казино", true
+		}
+		return w, w != "shadow:лото"
+	})
+	if !changed || strings.Join(got, ",") != "спам,казино" {
+		t.Fatalf("unexpected list: %v", got)
+	}
+	if _, changed := rewriteWordList(got, func(w string) (string, bool) { return w, true }); changed {
+		t.Fatal("untouched list must not be reported as changed")
+	}
+}
+
+func TestBuildShadowDigest(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&ShadowHit{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	word := []shadowHit{{Rule: "word:казино", Reason: "📝 Запрещенное слово"}}
+	for i := 0; i < 5; i++ {
+		if err := saveShadowHits(db, -100, int64(i%2+1), "играй в казино <b>", word, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saveShadowHits(db, -200, 3, "evil.com", []shadowHit{{Rule: "link"}}, now)
+	saveShadowHits(db, -200, 3, "старое", []shadowHit{{Rule: "phone"}}, now.Add(-48*time.Hour))
+
+	if buildShadowDigest(db, nil, now.Add(time.Hour)) != "" {
+		t.Fatal("digest without rules and hits must be empty")
+	}
+	text := buildShadowDigest(db, []string{"word:казино", "link", "card"}, now.Add(-24*time.Hour))
+	for _, want := range []string{"word:казино</b> — 5 сраб., участников 2, чатов 1", "играй в казино &lt;b&gt;", "/shadow_off word:казино", "Без срабатываний: card"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("digest must contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Index(text, "word:казино") > strings.Index(text, "<b>link") || strings.Contains(text, "старое") {
+		t.Fatalf("rules must be sorted by hits and limited to the period:\n%s", text)
+	}
+
+	pruneShadowHits(db, now.Add(shadowRetention-time.Hour))
+	var left int64
+	db.Model(&ShadowHit{}).Count(&left)
+	if left != 6 {
+		t.Fatalf("only hits older than retention must be pruned, left %d", left)
+	}
+}
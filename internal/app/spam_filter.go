@@ -0,0 +1,555 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==========================================
+// САМООБУЧАЮЩИЙСЯ СПАМ-ФИЛЬТР
+// ==========================================
+
+// Наивный Байес по документной частоте токенов. Примеры размечают сами
+// модераторы: удаление по правилам и /spam — спам, "не спам" в очереди
+// проверки и сообщения, которые никто не тронул за spamHamDelay, — не спам.
+// Перед обучением на каждом примере фильтр делает прогноз, из этого
+// считаются precision и recall. Подозрительные сообщения не удаляются,
+// а уходят модераторам на проверку.
+
+const (
+	defaultSpamThreshold = 0.9
+	spamMinDocs          = 20 // до стольких примеров каждого класса фильтр молчит
+	spamHamDelay         = 15 * time.Minute
+	spamHamBufferMax     = 5000
+	spamMaxTokens        = 64
+)
+
+type SpamToken struct {
+	Token string `gorm:"primaryKey;size:64"`
+	Spam  int64
+	Ham   int64
+}
+
+// SpamModelStat — одна строка с числом примеров и матрицей ошибок.
+type SpamModelStat struct {
+	ID       uint `gorm:"primaryKey"`
+	SpamDocs int64
+	HamDocs  int64
+	TP       int64 `gorm:"column:tp"`
+	FP       int64 `gorm:"column:fp"`
+	FN       int64 `gorm:"column:fn"`
+	TN       int64 `gorm:"column:tn"`
+}
+
+type SpamReview struct {
+	ID        uint  `gorm:"primaryKey"`
+	ChatID    int64 `gorm:"index"`
+	MessageID int
+	UserID    int64
+	Text      string
+	Score     float64
+	Status    string `gorm:"size:16;index"` // pending/spam/ham
+	CreatedAt time.Time
+}
+
+const (
+	spamReviewPending = "pending"
+	spamReviewSpam    = "spam"
+	spamReviewHam     = "ham"
+	cbSpamPrefix      = "spamrv_"
+)
+
+// spamTokens — уникальные нормализованные слова плюс признаки ссылок/телефонов/карт.
+func spamTokens(text string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(tok string) {
+		if !seen[tok] && len(out) < spamMaxTokens {
+			seen[tok] = true
+			out = append(out, tok)
+		}
+	}
+	if linkRegex.MatchString(text) {
+		add("#link")
+	}
+	if isPhoneSpam(text) {
+		add("#phone")
+	}
+	if isCardSpam(text) {
+		add("#card")
+	}
+	for _, w := range normalizeWords(text) {
+		if len([]rune(w)) < 2 {
+			continue
+		}
+		add(shorten(w, 60))
+	}
+	return out
+}
+
+type spamCounts struct{ Spam, Ham int64 }
+
+type SpamFilter struct {
+	mu     sync.Mutex
+	loaded bool
+	tokens map[string]*spamCounts
+	stat   SpamModelStat
+
+	// Сообщения, которые ждут spamHamDelay, чтобы стать примерами "не спам"
+	pending map[chatMsgKey]pendingHam
+}
+
+type chatMsgKey struct {
+	ChatID    int64
+	MessageID int
+}
+
+type pendingHam struct {
+	Text string
+	At   time.Time
+}
+
+var spamFilter = newSpamFilter()
+
+func newSpamFilter() *SpamFilter {
+	return &SpamFilter{tokens: make(map[string]*spamCounts), pending: make(map[chatMsgKey]pendingHam)}
+}
+
+func spamDB() *gorm.DB {
+	if womanManager == nil {
+		return nil
+	}
+	return womanManager.DB
+}
+
+// reset сбрасывает модель в памяти (после замены базы).
+func (f *SpamFilter) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loaded = false
+	f.tokens = make(map[string]*spamCounts)
+	f.stat = SpamModelStat{}
+	f.pending = make(map[chatMsgKey]pendingHam)
+}
+
+func (f *SpamFilter) ensureLoadedLocked(db *gorm.DB) {
+	if f.loaded || db == nil {
+		return
+	}
+	var rows []SpamToken
+	if err := db.Find(&rows).Error; err != nil {
+		log.Printf("⚠️ Не удалось загрузить спам-фильтр: %v", err)
+		return
+	}
+	for _, r := range rows {
+		f.tokens[r.Token] = &spamCounts{Spam: r.Spam, Ham: r.Ham}
+	}
+	db.FirstOrCreate(&f.stat, SpamModelStat{ID: 1})
+	f.loaded = true
+}
+
+// scoreLocked — вероятность спама; ready=false, пока примеров мало.
+func (f *SpamFilter) scoreLocked(tokens []string) (score float64, ready bool) {
+	s, h := float64(f.stat.SpamDocs), float64(f.stat.HamDocs)
+	ready = f.stat.SpamDocs >= spamMinDocs && f.stat.HamDocs >= spamMinDocs
+	logOdds := math.Log((s + 1) / (h + 1))
+	for _, tok := range tokens {
+		c, ok := f.tokens[tok]
+		if !ok {
+			continue // незнакомые слова не сдвигают оценку
+		}
+		ps := (float64(c.Spam) + 1) / (s + 2)
+		ph := (float64(c.Ham) + 1) / (h + 2)
+		logOdds += math.Log(ps / ph)
+	}
+	return 1 / (1 + math.Exp(-logOdds)), ready
+}
+
+func spamThreshold() float64 {
+	if config.SpamScoreThreshold > 0 && config.SpamScoreThreshold < 1 {
+		return config.SpamScoreThreshold
+	}
+	return defaultSpamThreshold
+}
+
+// Score оценивает текст. ready=false — модель еще не обучена.
+func (f *SpamFilter) Score(text string) (float64, bool) {
+	tokens := spamTokens(text)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ensureLoadedLocked(spamDB())
+	return f.scoreLocked(tokens)
+}
+
+type spamExample struct {
+	Text string
+	Spam bool
+}
+
+// train обучает модель на примерах и сохраняет приращения одной транзакцией.
+// Прогноз до обучения пополняет матрицу ошибок (если модель уже готова).
+func (f *SpamFilter) train(db *gorm.DB, examples []spamExample) error {
+	if len(examples) == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	f.ensureLoadedLocked(db)
+	threshold := spamThreshold()
+	deltas := make(map[string]*spamCounts)
+	var delta SpamModelStat
+	for _, ex := range examples {
+		tokens := spamTokens(ex.Text)
+		if score, ready := f.scoreLocked(tokens); ready {
+			flagged := score >= threshold
+			switch {
+			case ex.Spam && flagged:
+				delta.TP++
+			case ex.Spam:
+				delta.FN++
+			case flagged:
+				delta.FP++
+			default:
+				delta.TN++
+			}
+		}
+		// Следующие примеры пачки оцениваются уже с учетом этого
+		if ex.Spam {
+			delta.SpamDocs++
+			f.stat.SpamDocs++
+		} else {
+			delta.HamDocs++
+			f.stat.HamDocs++
+		}
+		for _, tok := range tokens {
+			c := f.tokens[tok]
+			if c == nil {
+				c = &spamCounts{}
+				f.tokens[tok] = c
+			}
+			d := deltas[tok]
+			if d == nil {
+				d = &spamCounts{}
+				deltas[tok] = d
+			}
+			if ex.Spam {
+				c.Spam++
+				d.Spam++
+			} else {
+				c.Ham++
+				d.Ham++
+			}
+		}
+	}
+	f.stat.TP += delta.TP
+	f.stat.FP += delta.FP
+	f.stat.FN += delta.FN
+	f.stat.TN += delta.TN
+	f.mu.Unlock()
+
+	if db == nil {
+		return nil
+	}
+	rows := make([]SpamToken, 0, len(deltas))
+	for tok, d := range deltas {
+		rows = append(rows, SpamToken{Token: tok, Spam: d.Spam, Ham: d.Ham})
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "token"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"spam": gorm.Expr("spam_tokens.spam + excluded.spam"),
+				"ham":  gorm.Expr("spam_tokens.ham + excluded.ham"),
+			}),
+		}).CreateInBatches(&rows, 200).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&SpamModelStat{}).Where("id = ?", 1).Updates(map[string]any{
+			"spam_docs": gorm.Expr("spam_docs + ?", delta.SpamDocs),
+			"ham_docs":  gorm.Expr("ham_docs + ?", delta.HamDocs),
+			"tp":        gorm.Expr("tp + ?", delta.TP),
+			"fp":        gorm.Expr("fp + ?", delta.FP),
+			"fn":        gorm.Expr("fn + ?", delta.FN),
+			"tn":        gorm.Expr("tn + ?", delta.TN),
+		}).Error
+	})
+}
+
+// Observe ставит сообщение в очередь кандидатов "не спам".
+func (f *SpamFilter) Observe(chatID int64, messageID int, text string, at time.Time) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) >= spamHamBufferMax {
+		return
+	}
+	f.pending[chatMsgKey{chatID, messageID}] = pendingHam{Text: text, At: at}
+}
+
+// forget убирает сообщение из кандидатов: его удалили или отправили на проверку.
+func (f *SpamFilter) forget(chatID int64, messageID int) {
+	f.mu.Lock()
+	delete(f.pending, chatMsgKey{chatID, messageID})
+	f.mu.Unlock()
+}
+
+// TrainSpam — сообщение удалено как спам (правилами или модератором).
+func (f *SpamFilter) TrainSpam(chatID int64, messageID int, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	f.forget(chatID, messageID)
+	if err := f.train(spamDB(), []spamExample{{Text: text, Spam: true}}); err != nil {
+		log.Printf("⚠️ Не удалось обучить спам-фильтр: %v", err)
+	}
+}
+
+// flushHam обучает на сообщениях, которые пролежали spamHamDelay нетронутыми.
+func (f *SpamFilter) flushHam(db *gorm.DB, now time.Time) int {
+	f.mu.Lock()
+	var examples []spamExample
+	for k, p := range f.pending {
+		if now.Sub(p.At) >= spamHamDelay {
+			examples = append(examples, spamExample{Text: p.Text})
+			delete(f.pending, k)
+		}
+	}
+	f.mu.Unlock()
+	if err := f.train(db, examples); err != nil {
+		log.Printf("⚠️ Не удалось обучить спам-фильтр: %v", err)
+	}
+	return len(examples)
+}
+
+// metrics возвращает precision и recall (NaN, если данных нет).
+func (s SpamModelStat) metrics() (precision, recall float64) {
+	precision, recall = math.NaN(), math.NaN()
+	if s.TP+s.FP > 0 {
+		precision = float64(s.TP) / float64(s.TP+s.FP)
+	}
+	if s.TP+s.FN > 0 {
+		recall = float64(s.TP) / float64(s.TP+s.FN)
+	}
+	return precision, recall
+}
+
+type spamTokenScore struct {
+	Token string
+	Prob  float64
+	Spam  int64
+}
+
+// topSpamTokens — токены с наибольшей долей спама среди встреченных не реже minCount раз.
+func (f *SpamFilter) topSpamTokens(limit int, minCount int64) []spamTokenScore {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ensureLoadedLocked(spamDB())
+	s, h := float64(f.stat.SpamDocs), float64(f.stat.HamDocs)
+	var out []spamTokenScore
+	for tok, c := range f.tokens {
+		if c.Spam+c.Ham < minCount || c.Spam == 0 {
+			continue
+		}
+		ps := (float64(c.Spam) + 1) / (s + 2)
+		ph := (float64(c.Ham) + 1) / (h + 2)
+		out = append(out, spamTokenScore{Token: tok, Prob: ps / (ps + ph), Spam: c.Spam})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Prob != out[j].Prob {
+			return out[i].Prob > out[j].Prob
+		}
+		return out[i].Spam > out[j].Spam
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func (f *SpamFilter) snapshot() SpamModelStat {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ensureLoadedLocked(spamDB())
+	return f.stat
+}
+
+// ------------------------------------------
+// Очередь проверки
+// ------------------------------------------
+
+// checkSpamScore вызывается для сообщений, прошедших правила профиля.
+// true — сообщение отправлено на проверку модераторам.
+func checkSpamScore(c tele.Context) bool {
+	msg := c.Message()
+	if msg == nil || strings.TrimSpace(msg.Text) == "" {
+		return false
+	}
+	score, ready := spamFilter.Score(msg.Text)
+	if !ready || score < spamThreshold() {
+		spamFilter.Observe(c.Chat().ID, msg.ID, msg.Text, time.Now())
+		return false
+	}
+	db := spamDB()
+	if db == nil {
+		return false
+	}
+	review := SpamReview{ChatID: c.Chat().ID, MessageID: msg.ID, UserID: c.Sender().ID, Text: shorten(msg.Text, 1000), Score: score, Status: spamReviewPending, CreatedAt: time.Now()}
+	if err := db.Create(&review).Error; err != nil {
+		log.Printf("⚠️ Не удалось поставить сообщение на проверку: %v", err)
+		return false
+	}
+	text := fmt.Sprintf("🧪 <b>Похоже на спам</b> (%.0f%%) в %s\n👤 %s (ID: %d)\n📄 %s",
+		score*100, html.EscapeString(chatTitle(review.ChatID)), mentionUser(c.Sender()), review.UserID, html.EscapeString(review.Text))
+	menu := &tele.ReplyMarkup{}
+	menu.Inline(menu.Row(
+		menu.Data("🗑 Спам", fmt.Sprintf("%sspam_%d", cbSpamPrefix, review.ID)),
+		menu.Data("✅ Не спам", fmt.Sprintf("%sham_%d", cbSpamPrefix, review.ID)),
+	))
+	for _, id := range moderationReviewers() {
+		if _, err := c.Bot().Send(&tele.User{ID: id}, text, menu, tele.ModeHTML); err != nil {
+			log.Printf("⚠️ Не удалось отправить спам на проверку %d: %v", id, err)
+		}
+	}
+	return true
+}
+
+var errSpamReviewed = errors.New("сообщение уже проверено")
+
+func resolveSpamReview(db *gorm.DB, id uint, spam bool) (*SpamReview, error) {
+	status := spamReviewHam
+	if spam {
+		status = spamReviewSpam
+	}
+	res := db.Model(&SpamReview{}).Where("id = ? AND status = ?", id, spamReviewPending).Update("status", status)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errSpamReviewed
+	}
+	var r SpamReview
+	if err := db.First(&r, id).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func handleSpamReviewCallback(c tele.Context, data string) error {
+	if !hasPermission(c.Sender().ID, PermModerate) || spamDB() == nil {
+		return c.Respond(&tele.CallbackResponse{Text: "Недостаточно прав."})
+	}
+	verdict, idStr, _ := strings.Cut(strings.TrimPrefix(data, cbSpamPrefix), "_")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return c.Respond()
+	}
+	spam := verdict == "spam"
+	r, err := resolveSpamReview(spamDB(), uint(id), spam)
+	if err != nil {
+		return c.Respond(&tele.CallbackResponse{Text: err.Error()})
+	}
+	if err := spamFilter.train(spamDB(), []spamExample{{Text: r.Text, Spam: spam}}); err != nil {
+		log.Printf("⚠️ Не удалось обучить спам-фильтр: %v", err)
+	}
+	result := "✅ Не спам"
+	if spam {
+		result = "🗑 Спам, удалено"
+		if err := c.Bot().Delete(&tele.Message{ID: r.MessageID, Chat: &tele.Chat{ID: r.ChatID}}); err != nil {
+			log.Printf("⚠️ Не удалось удалить сообщение %d: %v", r.MessageID, err)
+		}
+		statsManager.RegisterViolation(r.UserID)
+	}
+	logModAction(c.Sender().ID, "spam_review_"+verdict, strconv.FormatInt(r.UserID, 10), fmt.Sprintf("chat=%d review=%d score=%.2f", r.ChatID, r.ID, r.Score))
+	c.Respond(&tele.CallbackResponse{Text: result})
+	if msg := c.Message(); msg != nil {
+		_, _ = c.Bot().Edit(msg, msg.Text+"\n\n"+result)
+	}
+	return nil
+}
+
+// ------------------------------------------
+// Команды
+// ------------------------------------------
+
+// HandleSpam — модератор удаляет сообщение ответом /spam, фильтр учится на нем.
+func HandleSpam(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermModerate) {
+		return nil
+	}
+	msg := c.Message()
+	if msg == nil || msg.ReplyTo == nil || c.Chat().Type == tele.ChatPrivate {
+		return c.Reply("Ответьте /spam на сообщение в группе.")
+	}
+	target := msg.ReplyTo
+	text := target.Text
+	if text == "" {
+		text = target.Caption
+	}
+	spamFilter.TrainSpam(c.Chat().ID, target.ID, text)
+	c.Bot().Delete(target)
+	c.Delete()
+	uid := ""
+	if target.Sender != nil {
+		uid = strconv.FormatInt(target.Sender.ID, 10)
+	}
+	logModAction(c.Sender().ID, "spam_delete", uid, fmt.Sprintf("chat=%d text=%s", c.Chat().ID, shorten(text, 200)))
+	return nil
+}
+
+func formatPercent(v float64) string {
+	if math.IsNaN(v) {
+		return "—"
+	}
+	return fmt.Sprintf("%.1f%%", v*100)
+}
+
+// HandleSpamStats — состояние фильтра, топ спам-токенов и качество.
+func HandleSpamStats(c tele.Context) error {
+	if c.Sender() == nil || !isAdmin(c.Sender().ID) {
+		return nil
+	}
+	st := spamFilter.snapshot()
+	precision, recall := st.metrics()
+	var pending int64
+	if db := spamDB(); db != nil {
+		db.Model(&SpamReview{}).Where("status = ?", spamReviewPending).Count(&pending)
+	}
+	var sb strings.Builder
+	sb.WriteString("🧪 <b>Спам-фильтр</b>\n")
+	sb.WriteString(fmt.Sprintf("Примеров: спам <b>%d</b> | не спам <b>%d</b>\n", st.SpamDocs, st.HamDocs))
+	if st.SpamDocs < spamMinDocs || st.HamDocs < spamMinDocs {
+		sb.WriteString(fmt.Sprintf("⏳ Обучается: нужно хотя бы по %d примеров каждого класса\n", spamMinDocs))
+	}
+	sb.WriteString(fmt.Sprintf("Порог: <b>%.0f%%</b> | На проверке: <b>%d</b>\n", spamThreshold()*100, pending))
+	sb.WriteString(fmt.Sprintf("Precision: <b>%s</b> | Recall: <b>%s</b>\n", formatPercent(precision), formatPercent(recall)))
+	sb.WriteString(fmt.Sprintf("TP %d · FP %d · FN %d · TN %d\n", st.TP, st.FP, st.FN, st.TN))
+	if top := spamFilter.topSpamTokens(15, 3); len(top) > 0 {
+		sb.WriteString("\n<b>Топ спам-токенов:</b>\n")
+		for _, t := range top {
+			sb.WriteString(fmt.Sprintf("• %s — %.0f%% (%d)\n", html.EscapeString(t.Token), t.Prob*100, t.Spam))
+		}
+	}
+	return c.Reply(sb.String(), tele.ModeHTML)
+}
+
+func StartSpamLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		spamFilter.flushHam(spamDB(), time.Now())
+	}
+}
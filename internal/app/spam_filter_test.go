@@ -0,0 +1,103 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSpamFilterLearnsAndPersists(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&SpamToken{}, &SpamModelStat{}, &SpamReview{}); err != nil {
+		t.Fatal(err)
+	}
+	f := newSpamFilter()
+	var examples []spamExample
+	for i := 0; i < spamMinDocs+5; i++ {
+		examples = append(examples,
+			spamExample{Text: fmt.Sprintf("Быстрый заработок %d без вложений, пиши в личку t.me/earn%d", i, i), Spam: true},
+			spamExample{Text: fmt.Sprintf("Сегодня читала про Аду Лавлейс %d, интересная судьба", i)},
+		)
+	}
+	if err := f.train(db, examples); err != nil {
+		t.Fatal(err)
+	}
+
+	spam, ready := f.Score("заработок без вложений, пиши в личку")
+	if !ready || spam < defaultSpamThreshold {
+		t.Fatalf("spam score too low: %.3f ready=%v", spam, ready)
+	}
+	if ham, _ := f.Score("интересная судьба, читала вчера"); ham >= 0.5 {
+		t.Fatalf("ham score too high: %.3f", ham)
+	}
+
+	// Прогнозы до обучения попадают в матрицу ошибок
+	before := f.stat
+	if err := f.train(db, []spamExample{{Text: "заработок без вложений в личку", Spam: true}, {Text: "интересная судьба"}}); err != nil {
+		t.Fatal(err)
+	}
+	if f.stat.TP != before.TP+1 || f.stat.TN != before.TN+1 {
+		t.Fatalf("confusion matrix not updated: %+v -> %+v", before, f.stat)
+	}
+	if p, r := f.stat.metrics(); p != 1 || r != 1 {
+		t.Fatalf("precision/recall = %v/%v", p, r)
+	}
+
+	// Новая модель из той же базы дает ту же оценку
+	reloaded := newSpamFilter()
+	reloaded.mu.Lock()
+	reloaded.ensureLoadedLocked(db)
+	got, _ := reloaded.scoreLocked(spamTokens("заработок без вложений, пиши в личку"))
+	reloaded.mu.Unlock()
+	want, _ := f.Score("заработок без вложений, пиши в личку")
+	if diff := got - want; diff > 1e-9 || diff < -1e-9 || reloaded.stat.SpamDocs != f.stat.SpamDocs {
+		t.Fatalf("reloaded model differs: %.6f vs %.6f (%+v)", got, want, reloaded.stat)
+	}
+
+	top := f.topSpamTokens(5, 3)
+	if len(top) == 0 || top[0].Prob < 0.9 {
+		t.Fatalf("unexpected top tokens: %+v", top)
+	}
+}
+
+func TestSpamFilterHamBuffer(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&SpamToken{}, &SpamModelStat{}); err != nil {
+		t.Fatal(err)
+	}
+	f := newSpamFilter()
+	now := time.Now()
+	f.Observe(-100, 1, "обычное сообщение", now.Add(-spamHamDelay-time.Minute))
+	f.Observe(-100, 2, "удаленное модератором", now.Add(-spamHamDelay-time.Minute))
+	f.Observe(-100, 3, "свежее сообщение", now)
+	f.forget(-100, 2)
+
+	if n := f.flushHam(db, now); n != 1 {
+		t.Fatalf("expected one ham example, got %d", n)
+	}
+	if f.stat.HamDocs != 1 || len(f.pending) != 1 {
+		t.Fatalf("unexpected state: %+v pending=%d", f.stat, len(f.pending))
+	}
+	var row SpamToken
+	db.First(&row, "token = ?", normalizeToken("обычное"))
+	if row.Ham != 1 {
+		t.Fatalf("token not persisted: %+v", row)
+	}
+}
+
+func TestResolveSpamReviewOnce(t *testing.T) {
+	db := openTestStatsDB(t)
+	if err := db.AutoMigrate(&SpamReview{}); err != nil {
+		t.Fatal(err)
+	}
+	r := SpamReview{ChatID: -100, MessageID: 5, Text: "x", Status: spamReviewPending}
+	db.Create(&r)
+	got, err := resolveSpamReview(db, r.ID, false)
+	if err != nil || got.Status != spamReviewHam {
+		t.Fatalf("resolve: %+v %v", got, err)
+	}
+	if _, err := resolveSpamReview(db, r.ID, true); !errors.Is(err, errSpamReviewed) {
+		t.Fatalf("second decision must fail, got %v", err)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -14,6 +13,7 @@ import (
 
 	"github.com/wcharczuk/go-chart/v2"
 	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
 )
 
 // ==========================================
@@ -21,9 +21,15 @@ import (
 // ==========================================
 
 type StatsManager struct {
-	FilePath string
+	FilePath string // старый stats.json, импортируется в БД один раз
 	Data     GlobalStats
 	Mu       sync.RWMutex
+
+	db    *gorm.DB
+	dirty statsDirty // что изменилось с последней записи в БД (см. stats_store.go)
+
+	buckets   bucketDeltas // приращения дневных/почасовых бакетов (см. stats_periods.go)
+	lastPrune time.Time
 }
 
 // GlobalStats — единая структура для всей статистики (чат + модерация)
@@ -41,6 +47,11 @@ type GlobalStats struct {
 	WarningsGiven   int           `json:"warnings_given"`
 	Violations      map[int64]int `json:"violations"` // Текущие нарушения
 
+	// --- Жалобы участников ---
+	ReportsFiled     int `json:"reports_filed"`
+	ReportsActioned  int `json:"reports_actioned"` // удалено/варн/бан
+	ReportsDismissed int `json:"reports_dismissed"`
+
 	LastUpdated time.Time `json:"last_updated"`
 }
 
@@ -83,20 +94,44 @@ type TgExport struct {
 // ИНИЦИАЛИЗАЦИЯ
 // ==========================================
 
-func NewStatsManager(file string) *StatsManager {
+// NewStatsManager загружает статистику из БД (db == nil — только в памяти).
+// legacyFile — старый JSON, который переносится в БД при первом запуске.
+func NewStatsManager(legacyFile string, db *gorm.DB) *StatsManager {
 	sm := &StatsManager{
-		FilePath: file,
-		Data: GlobalStats{
-			Users:       make(map[int64]*UserStat),
-			Posts:       make(map[int64]*PostStat),
-			ActivityLog: make(map[string]int),
-			Violations:  make(map[int64]int),
-		},
+		FilePath: legacyFile,
+		Data:     newGlobalStats(),
+		db:       db,
+		dirty:    newStatsDirty(),
+		buckets:  newBucketDeltas(),
 	}
 	sm.Load()
 	return sm
 }
 
+func newGlobalStats() GlobalStats {
+	return GlobalStats{
+		Users:       make(map[int64]*UserStat),
+		Posts:       make(map[int64]*PostStat),
+		ActivityLog: make(map[string]int),
+		Violations:  make(map[int64]int),
+	}
+}
+
+func (g *GlobalStats) ensureMaps() {
+	if g.Users == nil {
+		g.Users = make(map[int64]*UserStat)
+	}
+	if g.Posts == nil {
+		g.Posts = make(map[int64]*PostStat)
+	}
+	if g.ActivityLog == nil {
+		g.ActivityLog = make(map[string]int)
+	}
+	if g.Violations == nil {
+		g.Violations = make(map[int64]int)
+	}
+}
+
 // ==========================================
 // ЛОГИКА ТРЕКИНГА (ЧАТ)
 // ==========================================
@@ -114,7 +149,6 @@ func (sm *StatsManager) TrackMessage(c tele.Context) {
 	if sender == nil {
 		if msg.SenderChat != nil && msg.SenderChat.Type == tele.ChatChannel {
 			sm.trackPost(msg)
-			sm.saveInternal()
 		}
 		return
 	}
@@ -133,18 +167,22 @@ func (sm *StatsManager) TrackMessage(c tele.Context) {
 
 	if isChannelPost {
 		sm.trackPost(msg)
-		sm.saveInternal()
 		return
 	}
 
 	// Логика пользователя
 	sm.Data.TotalMessages++
+	sm.dirty.counters = true
 
 	// Активность по дням
 	today := time.Now().Format("2006-01-02")
 	sm.Data.ActivityLog[today]++
+	sm.dirty.days[today] = true
 
 	sm.trackUser(sender, len(msg.Text))
+	if sm.db != nil {
+		sm.trackBucketMessage(sender.ID, len(strings.Fields(msg.Text)), msg.ReplyTo != nil, time.Now())
+	}
 
 	// Логика реплаев на посты (комментарии)
 	if msg.ReplyTo != nil {
@@ -152,6 +190,7 @@ func (sm *StatsManager) TrackMessage(c tele.Context) {
 		if _, exists := sm.Data.Posts[originalID]; exists {
 			sm.Data.Posts[originalID].CommentCount++
 			sm.Data.Posts[originalID].LastActivity = time.Now()
+			sm.dirty.posts[originalID] = true
 		} else {
 			if msg.ReplyTo.Sender != nil && msg.ReplyTo.Sender.ID == 777000 {
 				sm.trackPost(msg.ReplyTo)
@@ -159,10 +198,6 @@ func (sm *StatsManager) TrackMessage(c tele.Context) {
 			}
 		}
 	}
-
-	if sm.Data.TotalMessages%10 == 0 {
-		sm.saveInternal()
-	}
 }
 
 func (sm *StatsManager) TrackReaction(c tele.Context) {
@@ -181,8 +216,11 @@ func (sm *StatsManager) TrackReaction(c tele.Context) {
 		sm.Data.Users[user.ID] = &UserStat{ID: user.ID, Name: user.FirstName, Username: user.Username}
 	}
 	sm.Data.Users[user.ID].ReactionCount++
-
-	sm.saveInternal()
+	sm.dirty.users[user.ID] = true
+	if sm.db != nil {
+		sm.trackBucketReaction(user.ID, time.Now())
+	}
+	sm.dirty.counters = true
 }
 
 func (sm *StatsManager) trackUser(u *tele.User, textLen int) {
@@ -199,6 +237,7 @@ func (sm *StatsManager) trackUser(u *tele.User, textLen int) {
 	if u.Username != "" {
 		user.Username = u.Username
 	}
+	sm.dirty.users[u.ID] = true
 }
 
 func (sm *StatsManager) trackPost(msg *tele.Message) {
@@ -218,6 +257,7 @@ func (sm *StatsManager) trackPost(msg *tele.Message) {
 		CommentCount: 0,
 		LastActivity: time.Now(),
 	}
+	sm.dirty.posts[int64(msg.ID)] = true
 }
 
 // ==========================================
@@ -230,7 +270,8 @@ func (sm *StatsManager) RegisterViolation(userID int64) int {
 
 	sm.Data.Violations[userID]++
 	sm.Data.DeletedMessages++
-	sm.saveInternal()
+	sm.dirty.violations[userID] = true
+	sm.dirty.counters = true
 
 	return sm.Data.Violations[userID]
 }
@@ -239,7 +280,7 @@ func (sm *StatsManager) RegisterWarning() {
 	sm.Mu.Lock()
 	defer sm.Mu.Unlock()
 	sm.Data.WarningsGiven++
-	sm.saveInternal()
+	sm.dirty.counters = true
 }
 
 func (sm *StatsManager) RegisterBan(userID int64) {
@@ -248,7 +289,36 @@ func (sm *StatsManager) RegisterBan(userID int64) {
 
 	sm.Data.BannedUsers++
 	delete(sm.Data.Violations, userID)
-	sm.saveInternal()
+	sm.dirty.violations[userID] = true
+	sm.dirty.counters = true
+}
+
+// RegisterReport считает новую жалобу.
+func (sm *StatsManager) RegisterReport() {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	sm.Data.ReportsFiled++
+	sm.dirty.counters = true
+}
+
+// RegisterReportOutcome считает решение по жалобе.
+func (sm *StatsManager) RegisterReportOutcome(dismissed bool) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	if dismissed {
+		sm.Data.ReportsDismissed++
+	} else {
+		sm.Data.ReportsActioned++
+	}
+	sm.dirty.counters = true
+}
+
+// ClearViolations обнуляет счетчик нарушений пользователя (сброс персоналом).
+func (sm *StatsManager) ClearViolations(userID int64) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	delete(sm.Data.Violations, userID)
+	sm.dirty.violations[userID] = true
 }
 
 // ==========================================
@@ -337,9 +407,11 @@ func (sm *StatsManager) GetFormattedStatsText() string {
 		"👮‍♂️ <b>МОДЕРАЦИЯ</b>\n"+
 		"🗑 Удалено сообщений: <b>%d</b>\n"+
 		"⚠️ Выдано варнов: <b>%d</b>\n"+
-		"🚫 Забанено: <b>%d</b>\n\n",
+		"🚫 Забанено: <b>%d</b>\n"+
+		"🚩 Жалоб: <b>%d</b> (принято: %d | отклонено: %d)\n\n",
 		sm.Data.TotalMessages, sm.Data.TotalReactions, len(sm.Data.Users), len(sm.Data.Posts),
-		sm.Data.DeletedMessages, sm.Data.WarningsGiven, sm.Data.BannedUsers)
+		sm.Data.DeletedMessages, sm.Data.WarningsGiven, sm.Data.BannedUsers,
+		sm.Data.ReportsFiled, sm.Data.ReportsActioned, sm.Data.ReportsDismissed)
 
 	text += "🏆 <b>ТОП-5 ГОВОРУНОВ:</b>\n"
 	limit := 5
@@ -428,46 +500,35 @@ func (sm *StatsManager) ImportFromJSON(path string) error {
 			}
 		}
 	}
-	sm.saveInternal()
+	sm.markAllDirty()
 	return nil
 }
 
-func (sm *StatsManager) saveInternal() {
-	sm.Data.LastUpdated = time.Now()
-	data, _ := json.MarshalIndent(sm.Data, "", "  ")
-	if err := os.MkdirAll(filepath.Dir(sm.FilePath), 0755); err != nil {
-		log.Printf("⚠️ Ошибка создания директории статистики: %v", err)
-		return
-	}
-	if err := os.WriteFile(sm.FilePath, data, 0644); err != nil {
+// Save немедленно сбрасывает накопленные изменения в БД.
+func (sm *StatsManager) Save() {
+	if err := sm.Flush(); err != nil {
 		log.Printf("⚠️ Ошибка сохранения статистики: %v", err)
 	}
 }
 
-func (sm *StatsManager) Save() {
-	sm.Mu.Lock()
-	defer sm.Mu.Unlock()
-	sm.saveInternal()
-}
-
+// Load читает статистику из БД; при пустых таблицах переносит туда старый stats.json.
 func (sm *StatsManager) Load() {
+	if sm.db == nil {
+		return
+	}
+	if err := migrateStatsTables(sm.db); err != nil {
+		log.Printf("⚠️ Ошибка миграции таблиц статистики: %v", err)
+	}
 	sm.Mu.Lock()
-	defer sm.Mu.Unlock()
-	file, err := os.ReadFile(sm.FilePath)
-	if err == nil {
-		json.Unmarshal(file, &sm.Data)
-		if sm.Data.Users == nil {
-			sm.Data.Users = make(map[int64]*UserStat)
-		}
-		if sm.Data.Posts == nil {
-			sm.Data.Posts = make(map[int64]*PostStat)
-		}
-		if sm.Data.ActivityLog == nil {
-			sm.Data.ActivityLog = make(map[string]int)
-		}
-		if sm.Data.Violations == nil {
-			sm.Data.Violations = make(map[int64]int)
+	loaded := sm.loadFromDB()
+	imported := !loaded && sm.importLegacyJSON()
+	sm.Mu.Unlock()
+	if imported {
+		if err := sm.Flush(); err != nil {
+			log.Printf("⚠️ Ошибка импорта статистики: %v", err)
+			return
 		}
+		markLegacyImported(sm.FilePath)
 	}
 }
 
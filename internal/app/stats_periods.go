@@ -0,0 +1,581 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==========================================
+// АНАЛИТИКА ПО ПЕРИОДАМ
+// ==========================================
+
+// Поминутно ничего не храним: на каждого участника одна строка в день,
+// на чат — одна строка на каждый час. Старые бакеты удаляются по срокам хранения.
+
+const (
+	userDayRetention = 400 * 24 * time.Hour // чуть больше года: сравнение год к году
+	hourRetention    = 120 * 24 * time.Hour // тепловая карта нужна за последние месяцы
+	statsDayLayout   = "2006-01-02"
+)
+
+type UserDayStat struct {
+	Day       string `gorm:"primaryKey;size:10"`
+	UserID    int64  `gorm:"primaryKey;autoIncrement:false;index"`
+	Messages  int
+	Words     int
+	Reactions int
+	Replies   int
+}
+
+type ChatHourStat struct {
+	Day      string `gorm:"primaryKey;size:10"`
+	Hour     int    `gorm:"primaryKey;autoIncrement:false"`
+	Messages int
+}
+
+type userDayKey struct {
+	Day    string
+	UserID int64
+}
+
+type dayHourKey struct {
+	Day  string
+	Hour int
+}
+
+// bucketDeltas — приращения с последней записи. В БД они прибавляются к уже
+// записанным значениям, поэтому переживают перезапуск без чтения старых строк.
+type bucketDeltas struct {
+	users map[userDayKey]*UserDayStat
+	hours map[dayHourKey]int
+}
+
+func newBucketDeltas() bucketDeltas {
+	return bucketDeltas{users: make(map[userDayKey]*UserDayStat), hours: make(map[dayHourKey]int)}
+}
+
+func (b *bucketDeltas) empty() bool { return len(b.users) == 0 && len(b.hours) == 0 }
+
+func (b *bucketDeltas) user(day string, userID int64) *UserDayStat {
+	k := userDayKey{Day: day, UserID: userID}
+	row, ok := b.users[k]
+	if !ok {
+		row = &UserDayStat{Day: day, UserID: userID}
+		b.users[k] = row
+	}
+	return row
+}
+
+func (b *bucketDeltas) merge(o bucketDeltas) {
+	for k, r := range o.users {
+		row := b.user(k.Day, k.UserID)
+		row.Messages += r.Messages
+		row.Words += r.Words
+		row.Reactions += r.Reactions
+		row.Replies += r.Replies
+	}
+	for k, n := range o.hours {
+		b.hours[k] += n
+	}
+}
+
+// trackBucketMessage учитывает сообщение участника в дневном и часовом бакетах.
+// Вызывается под sm.Mu.
+func (sm *StatsManager) trackBucketMessage(userID int64, words int, isReply bool, at time.Time) {
+	day := at.Format(statsDayLayout)
+	row := sm.buckets.user(day, userID)
+	row.Messages++
+	row.Words += words
+	if isReply {
+		row.Replies++
+	}
+	sm.buckets.hours[dayHourKey{Day: day, Hour: at.Hour()}]++
+}
+
+func (sm *StatsManager) trackBucketReaction(userID int64, at time.Time) {
+	sm.buckets.user(at.Format(statsDayLayout), userID).Reactions++
+}
+
+// flushBuckets прибавляет приращения к строкам в БД (upsert с суммированием).
+func flushBuckets(tx *gorm.DB, b bucketDeltas) error {
+	if len(b.users) > 0 {
+		rows := make([]UserDayStat, 0, len(b.users))
+		for _, r := range b.users {
+			rows = append(rows, *r)
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "day"}, {Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"messages":  gorm.Expr("user_day_stats.messages + excluded.messages"),
+				"words":     gorm.Expr("user_day_stats.words + excluded.words"),
+				"reactions": gorm.Expr("user_day_stats.reactions + excluded.reactions"),
+				"replies":   gorm.Expr("user_day_stats.replies + excluded.replies"),
+			}),
+		}).CreateInBatches(&rows, 200).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(b.hours) > 0 {
+		rows := make([]ChatHourStat, 0, len(b.hours))
+		for k, n := range b.hours {
+			rows = append(rows, ChatHourStat{Day: k.Day, Hour: k.Hour, Messages: n})
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "day"}, {Name: "hour"}},
+			DoUpdates: clause.Assignments(map[string]any{"messages": gorm.Expr("chat_hour_stats.messages + excluded.messages")}),
+		}).CreateInBatches(&rows, 200).Error
+	}
+	return nil
+}
+
+// pruneStatsBuckets удаляет бакеты старше сроков хранения.
+func pruneStatsBuckets(db *gorm.DB, now time.Time) {
+	userCutoff := now.Add(-userDayRetention).Format(statsDayLayout)
+	hourCutoff := now.Add(-hourRetention).Format(statsDayLayout)
+	if err := db.Where("day < ?", userCutoff).Delete(&UserDayStat{}).Error; err != nil {
+		log.Printf("⚠️ Ошибка очистки дневной статистики: %v", err)
+	}
+	if err := db.Where("day < ?", hourCutoff).Delete(&ChatHourStat{}).Error; err != nil {
+		log.Printf("⚠️ Ошибка очистки почасовой статистики: %v", err)
+	}
+}
+
+// PruneBuckets применяет сроки хранения не чаще раза в сутки.
+func (sm *StatsManager) PruneBuckets() {
+	sm.Mu.Lock()
+	db := sm.db
+	due := db != nil && time.Since(sm.lastPrune) >= 24*time.Hour
+	if due {
+		sm.lastPrune = time.Now()
+	}
+	sm.Mu.Unlock()
+	if due {
+		pruneStatsBuckets(db, time.Now())
+	}
+}
+
+// ==========================================
+// ПЕРИОДЫ
+// ==========================================
+
+type statsPeriod struct {
+	Title string
+	From  time.Time // первый день периода (00:00)
+	Days  int
+}
+
+func (p statsPeriod) To() time.Time { return p.From.AddDate(0, 0, p.Days-1) }
+
+func (p statsPeriod) FromKey() string { return p.From.Format(statsDayLayout) }
+
+func (p statsPeriod) ToKey() string { return p.To().Format(statsDayLayout) }
+
+func (p statsPeriod) Label() string {
+	if p.Days == 1 {
+		return p.From.Format("02.01.2006")
+	}
+	return p.From.Format("02.01") + "–" + p.To().Format("02.01.2006")
+}
+
+// Previous — такой же по длине период непосредственно перед текущим.
+func (p statsPeriod) Previous() statsPeriod {
+	return statsPeriod{Title: "предыдущий период", From: p.From.AddDate(0, 0, -p.Days), Days: p.Days}
+}
+
+// parseStatsPeriod понимает day/week/month/year (и по-русски) или число дней: 14, 14d, 14д.
+// Период всегда заканчивается сегодняшним днем.
+func parseStatsPeriod(arg string, now time.Time) (statsPeriod, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	days, title := 0, ""
+	switch arg {
+	case "", "week", "w", "неделя", "нед":
+		days, title = 7, "неделя"
+	case "day", "d", "today", "день", "сегодня":
+		days, title = 1, "сегодня"
+	case "month", "m", "месяц", "мес":
+		days, title = 30, "месяц"
+	case "quarter", "q", "квартал":
+		days, title = 90, "квартал"
+	case "year", "y", "год":
+		days, title = 365, "год"
+	default:
+		n, err := strconv.Atoi(strings.TrimRight(arg, "dд"))
+		if err != nil || n <= 0 {
+			return statsPeriod{}, fmt.Errorf("неизвестный период %q", arg)
+		}
+		if n > 366 {
+			n = 366
+		}
+		days, title = n, fmt.Sprintf("%d дн.", n)
+	}
+	return statsPeriod{Title: title, From: today.AddDate(0, 0, -(days - 1)), Days: days}, nil
+}
+
+// ==========================================
+// ЗАПРОСЫ
+// ==========================================
+
+type periodSummary struct {
+	Messages    int
+	Words       int
+	Reactions   int
+	Replies     int
+	ActiveUsers int
+}
+
+type periodUser struct {
+	UserID    int64
+	Messages  int
+	Words     int
+	Reactions int
+	Replies   int
+}
+
+func (sm *StatsManager) periodSummary(p statsPeriod) periodSummary {
+	var s periodSummary
+	sm.db.Model(&UserDayStat{}).
+		Select("COALESCE(SUM(messages), 0) AS messages, COALESCE(SUM(words), 0) AS words, COALESCE(SUM(reactions), 0) AS reactions, COALESCE(SUM(replies), 0) AS replies, COUNT(DISTINCT user_id) AS active_users").
+		Where("day BETWEEN ? AND ?", p.FromKey(), p.ToKey()).
+		Scan(&s)
+	return s
+}
+
+func (sm *StatsManager) periodTopUsers(p statsPeriod, limit int) []periodUser {
+	var rows []periodUser
+	sm.db.Model(&UserDayStat{}).
+		Select("user_id, SUM(messages) AS messages, SUM(words) AS words, SUM(reactions) AS reactions, SUM(replies) AS replies").
+		Where("day BETWEEN ? AND ?", p.FromKey(), p.ToKey()).
+		Group("user_id").
+		Order("messages DESC").
+		Limit(limit).
+		Scan(&rows)
+	return rows
+}
+
+// periodDaily возвращает число сообщений по дням периода (индекс — смещение от начала).
+func (sm *StatsManager) periodDaily(p statsPeriod) []float64 {
+	var rows []struct {
+		Day      string
+		Messages int
+	}
+	sm.db.Model(&UserDayStat{}).
+		Select("day, SUM(messages) AS messages").
+		Where("day BETWEEN ? AND ?", p.FromKey(), p.ToKey()).
+		Group("day").
+		Scan(&rows)
+	out := make([]float64, p.Days)
+	for _, r := range rows {
+		d, err := time.ParseInLocation(statsDayLayout, r.Day, p.From.Location())
+		if err != nil {
+			continue
+		}
+		if i := int(math.Round(d.Sub(p.From).Hours() / 24)); i >= 0 && i < p.Days {
+			out[i] = float64(r.Messages)
+		}
+	}
+	return out
+}
+
+// periodHeatmap — сообщения по дням недели (0 = понедельник) и часам.
+func (sm *StatsManager) periodHeatmap(p statsPeriod) [7][24]int {
+	var rows []ChatHourStat
+	sm.db.Where("day BETWEEN ? AND ?", p.FromKey(), p.ToKey()).Find(&rows)
+	var grid [7][24]int
+	for _, r := range rows {
+		d, err := time.Parse(statsDayLayout, r.Day)
+		if err != nil || r.Hour < 0 || r.Hour > 23 {
+			continue
+		}
+		wd := (int(d.Weekday()) + 6) % 7
+		grid[wd][r.Hour] += r.Messages
+	}
+	return grid
+}
+
+// ==========================================
+// ОТЧЕТ
+// ==========================================
+
+func formatDelta(cur, prev int) string {
+	if prev == 0 {
+		if cur == 0 {
+			return "—"
+		}
+		return "новое"
+	}
+	pct := float64(cur-prev) / float64(prev) * 100
+	sign := "+"
+	if pct < 0 {
+		sign = ""
+	}
+	return fmt.Sprintf("%s%.0f%%", sign, pct)
+}
+
+// FormatPeriodStatsText — текст отчета за период со сравнением с предыдущим.
+func (sm *StatsManager) FormatPeriodStatsText(p statsPeriod) string {
+	prev := p.Previous()
+	cur, old := sm.periodSummary(p), sm.periodSummary(prev)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📊 <b>Статистика: %s</b> (%s)\n", html.EscapeString(p.Title), p.Label()))
+	sb.WriteString(fmt.Sprintf("<i>Сравнение с %s</i>\n\n", prev.Label()))
+	sb.WriteString(fmt.Sprintf("📨 Сообщений: <b>%d</b> (%s)\n", cur.Messages, formatDelta(cur.Messages, old.Messages)))
+	sb.WriteString(fmt.Sprintf("👥 Активных участников: <b>%d</b> (%s)\n", cur.ActiveUsers, formatDelta(cur.ActiveUsers, old.ActiveUsers)))
+	sb.WriteString(fmt.Sprintf("↩️ Ответов: <b>%d</b> (%s)\n", cur.Replies, formatDelta(cur.Replies, old.Replies)))
+	sb.WriteString(fmt.Sprintf("❤️ Реакций: <b>%d</b> (%s)\n", cur.Reactions, formatDelta(cur.Reactions, old.Reactions)))
+	sb.WriteString(fmt.Sprintf("🔡 Слов: <b>%d</b> (%s)\n", cur.Words, formatDelta(cur.Words, old.Words)))
+
+	top := sm.periodTopUsers(p, 5)
+	if len(top) > 0 {
+		sb.WriteString("\n🏆 <b>Самые активные:</b>\n")
+		sm.Mu.RLock()
+		for i, u := range top {
+			name := fmt.Sprintf("ID %d", u.UserID)
+			if us, ok := sm.Data.Users[u.UserID]; ok {
+				name = us.Name
+				if us.Username != "" {
+					name = "@" + us.Username
+				}
+			}
+			sb.WriteString(fmt.Sprintf("%d. <b>%s</b>: %d сообщ. | %d отв. | %d симп.\n", i+1, html.EscapeString(name), u.Messages, u.Replies, u.Reactions))
+		}
+		sm.Mu.RUnlock()
+	}
+	return sb.String()
+}
+
+// GeneratePeriodStatsImage рисует сравнение периодов по дням и тепловую карту
+// "день недели × час" с итогами по часам и дням недели.
+func (sm *StatsManager) GeneratePeriodStatsImage(p statsPeriod) ([]byte, error) {
+	const width = 900
+	prev := p.Previous()
+	curDaily, prevDaily := sm.periodDaily(p), sm.periodDaily(prev)
+
+	xs := make([]float64, p.Days)
+	for i := range xs {
+		xs[i] = float64(i + 1)
+	}
+	if p.Days == 1 {
+		// Для одного дня линия вырождается в точку — рисуем отрезок
+		xs = []float64{0, 1}
+		curDaily = []float64{curDaily[0], curDaily[0]}
+		prevDaily = []float64{prevDaily[0], prevDaily[0]}
+	}
+	var ticks []chart.Tick
+	if p.Days > 1 {
+		step := (p.Days + 14) / 15
+		for d := 1; d <= p.Days; d += step {
+			ticks = append(ticks, chart.Tick{Value: float64(d), Label: strconv.Itoa(d)})
+		}
+	}
+	graph := chart.Chart{
+		Title:      fmt.Sprintf("Сообщения: %s против %s", p.Label(), prev.Label()),
+		Background: chart.Style{Padding: chart.Box{Top: 40, Left: 20, Right: 20, Bottom: 20}},
+		Series: []chart.Series{
+			chart.ContinuousSeries{
+				Name:    "Текущий период",
+				XValues: xs,
+				YValues: curDaily,
+				Style:   chart.Style{StrokeColor: chart.ColorBlue, StrokeWidth: 4.0},
+			},
+			chart.ContinuousSeries{
+				Name:    "Предыдущий период",
+				XValues: xs,
+				YValues: prevDaily,
+				Style:   chart.Style{StrokeColor: drawing.Color{R: 150, G: 150, B: 150, A: 255}, StrokeWidth: 3.0, StrokeDashArray: []float64{6, 4}},
+			},
+		},
+		XAxis:  chart.XAxis{Name: "День периода", Ticks: ticks, ValueFormatter: func(v interface{}) string { return fmt.Sprintf("%.0f", v.(float64)) }},
+		YAxis:  chart.YAxis{Name: "Сообщений", ValueFormatter: func(v interface{}) string { return fmt.Sprintf("%.0f", v.(float64)) }},
+		Height: 380,
+		Width:  width,
+	}
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+
+	var lineBuf bytes.Buffer
+	if err := graph.Render(chart.PNG, &lineBuf); err != nil {
+		return nil, err
+	}
+	heatBuf, err := renderHeatmap(sm.periodHeatmap(p), width)
+	if err != nil {
+		return nil, err
+	}
+
+	lineImg, err := png.Decode(&lineBuf)
+	if err != nil {
+		return nil, err
+	}
+	heatImg, err := png.Decode(bytes.NewReader(heatBuf))
+	if err != nil {
+		return nil, err
+	}
+	out := image.NewRGBA(image.Rect(0, 0, width, lineImg.Bounds().Dy()+heatImg.Bounds().Dy()))
+	draw.Draw(out, out.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(out, lineImg.Bounds(), lineImg, image.Point{}, draw.Src)
+	draw.Draw(out, heatImg.Bounds().Add(image.Pt(0, lineImg.Bounds().Dy())), heatImg, image.Point{}, draw.Src)
+
+	var res bytes.Buffer
+	if err := png.Encode(&res, out); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+var weekdayShort = [7]string{"Пн", "Вт", "Ср", "Чт", "Пт", "Сб", "Вс"}
+
+// renderHeatmap рисует сетку 7×24 средствами go-chart; справа — сумма по дню недели,
+// снизу — сумма по часу.
+func renderHeatmap(grid [7][24]int, width int) ([]byte, error) {
+	const (
+		left, top = 50, 50
+		rowH      = 34
+		totalsW   = 60
+	)
+	cellW := (width - left - totalsW - 20) / 24
+	height := top + rowH*8 + 30
+
+	r, err := chart.PNG(width, height)
+	if err != nil {
+		return nil, err
+	}
+	font, err := chart.GetDefaultFont()
+	if err != nil {
+		return nil, err
+	}
+	r.SetFont(font)
+
+	fillRect := func(x, y, w, h int, c drawing.Color) {
+		r.SetFillColor(c)
+		r.SetStrokeColor(drawing.ColorWhite)
+		r.SetStrokeWidth(1)
+		r.MoveTo(x, y)
+		r.LineTo(x+w, y)
+		r.LineTo(x+w, y+h)
+		r.LineTo(x, y+h)
+		r.Close()
+		r.FillStroke()
+	}
+	fillRect(0, 0, width, height, drawing.ColorWhite)
+
+	var hourTotals [24]int
+	var dayTotals [7]int
+	maxCell, maxHour, maxDay := 0, 0, 0
+	for d := 0; d < 7; d++ {
+		for h := 0; h < 24; h++ {
+			v := grid[d][h]
+			hourTotals[h] += v
+			dayTotals[d] += v
+			if v > maxCell {
+				maxCell = v
+			}
+		}
+	}
+	for _, v := range hourTotals {
+		if v > maxHour {
+			maxHour = v
+		}
+	}
+	for _, v := range dayTotals {
+		if v > maxDay {
+			maxDay = v
+		}
+	}
+
+	r.SetFontColor(drawing.ColorBlack)
+	r.SetFontSize(14)
+	r.Text("Активность по дням недели и часам", left, 24)
+	r.SetFontSize(10)
+	for h := 0; h < 24; h += 2 {
+		r.Text(fmt.Sprintf("%02d", h), left+h*cellW+cellW/4, top-6)
+	}
+	r.Text("Σ", left+24*cellW+totalsW/3, top-6)
+
+	for d := 0; d < 7; d++ {
+		y := top + d*rowH
+		r.SetFontColor(drawing.ColorBlack)
+		r.Text(weekdayShort[d], 10, y+rowH/2+4)
+		for h := 0; h < 24; h++ {
+			fillRect(left+h*cellW, y, cellW, rowH, heatColor(grid[d][h], maxCell))
+		}
+		fillRect(left+24*cellW+8, y, totalsW-8, rowH, heatColor(dayTotals[d], maxDay))
+		r.SetFontColor(drawing.ColorBlack)
+		r.Text(strconv.Itoa(dayTotals[d]), left+24*cellW+12, y+rowH/2+4)
+	}
+	y := top + 7*rowH + 8
+	r.Text("Σ", 10, y+rowH/2+4)
+	for h := 0; h < 24; h++ {
+		fillRect(left+h*cellW, y, cellW, rowH, heatColor(hourTotals[h], maxHour))
+	}
+
+	var buf bytes.Buffer
+	if err := r.Save(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// heatColor — от почти белого к насыщенному синему.
+func heatColor(v, max int) drawing.Color {
+	if max <= 0 || v <= 0 {
+		return drawing.Color{R: 240, G: 243, B: 248, A: 255}
+	}
+	t := math.Sqrt(float64(v) / float64(max)) // корень: редкие пики не "выжигают" остальное
+	lerp := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*t) }
+	return drawing.Color{R: lerp(220, 20), G: lerp(232, 70), B: lerp(245, 160), A: 255}
+}
+
+// ==========================================
+// КОМАНДА /stats <период>
+// ==========================================
+
+func HandleStatsPeriod(c tele.Context) error {
+	if c.Sender() == nil || !isAdmin(c.Sender().ID) || statsManager == nil {
+		return nil
+	}
+	if statsManager.db == nil {
+		return c.Reply("Статистика по периодам недоступна: нет подключения к БД.", tele.ModeHTML)
+	}
+	arg := ""
+	if args := c.Args(); len(args) > 0 {
+		arg = args[0]
+	}
+	period, err := parseStatsPeriod(arg, time.Now())
+	if err != nil {
+		return c.Reply("Используйте: /stats <code>day|week|month|quarter|year|N</code> (N — число дней)", tele.ModeHTML)
+	}
+	// Отчет строится по БД — сначала дописываем накопленное
+	if err := statsManager.Flush(); err != nil {
+		log.Printf("⚠️ Ошибка записи статистики: %v", err)
+	}
+	text := statsManager.FormatPeriodStatsText(period)
+	img, err := statsManager.GeneratePeriodStatsImage(period)
+	if err != nil {
+		log.Printf("⚠️ Ошибка генерации графика: %v", err)
+		return c.Reply(text, tele.ModeHTML)
+	}
+	if len([]rune(text)) > 1000 {
+		// Подпись к фото ограничена 1024 символами
+		if _, err := c.Bot().Send(c.Recipient(), &tele.Photo{File: tele.FromReader(bytes.NewReader(img))}); err != nil {
+			log.Printf("⚠️ Ошибка отправки графика: %v", err)
+		}
+		return c.Send(text, tele.ModeHTML)
+	}
+	return c.Send(&tele.Photo{File: tele.FromReader(bytes.NewReader(img)), Caption: text}, tele.ModeHTML)
+}
@@ -0,0 +1,528 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==========================================
+// ХРАНЕНИЕ СТАТИСТИКИ В БД
+// ==========================================
+
+// Статистика чата и игры живет в памяти (быстрые чтения), а изменения копятся
+// в "грязных" наборах и раз в statsFlushInterval пишутся в БД одной транзакцией.
+// Старые stats.json и gamestats.json импортируются один раз при пустых таблицах.
+
+const statsFlushInterval = 30 * time.Second
+
+// GameScore — строка лидерборда. ChatID = 0 — общий зачет.
+type GameScore struct {
+	ChatID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	UserID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Wins      int
+	UpdatedAt time.Time
+}
+
+type RiddleRecord struct {
+	ID          uint  `gorm:"primaryKey"`
+	ChatID      int64 `gorm:"index"`
+	Answer      string
+	Description string
+	WinnerName  string
+	WinnerID    int64
+	Date        string
+	CreatedAt   time.Time
+}
+
+type ChatUserStat struct {
+	UserID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name          string
+	Username      string
+	MsgCount      int
+	WordCount     int
+	ReactionCount int
+	UpdatedAt     time.Time
+}
+
+type ChatActivity struct {
+	Day      string `gorm:"primaryKey;size:10"` // 2006-01-02
+	Messages int
+}
+
+type ChannelPostStat struct {
+	PostID       int64 `gorm:"primaryKey;autoIncrement:false"`
+	Preview      string
+	CommentCount int
+	LastActivity time.Time
+}
+
+type ChatViolation struct {
+	UserID int64 `gorm:"primaryKey;autoIncrement:false"`
+	Count  int
+}
+
+// ChatCounter — глобальные счетчики (сообщения, реакции, модерация).
+type ChatCounter struct {
+	Key   string `gorm:"primaryKey;size:32"`
+	Value int64
+}
+
+const (
+	counterTotalMessages    = "total_messages"
+	counterTotalReactions   = "total_reactions"
+	counterDeletedMessages  = "deleted_messages"
+	counterBannedUsers      = "banned_users"
+	counterWarningsGiven    = "warnings_given"
+	counterReportsFiled     = "reports_filed"
+	counterReportsActioned  = "reports_actioned"
+	counterReportsDismissed = "reports_dismissed"
+)
+
+func migrateStatsTables(db *gorm.DB) error {
+	return db.AutoMigrate(&GameScore{}, &RiddleRecord{}, &ChatUserStat{}, &ChatActivity{}, &ChannelPostStat{}, &ChatViolation{}, &ChatCounter{}, &UserDayStat{}, &ChatHourStat{})
+}
+
+// markLegacyImported переименовывает импортированный JSON, чтобы не импортировать его повторно.
+func markLegacyImported(path string) {
+	if err := os.Rename(path, path+".imported"); err != nil {
+		log.Printf("⚠️ Не удалось переименовать %s: %v", path, err)
+	}
+}
+
+func upsertAll(tx *gorm.DB, rows any) error {
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 200).Error
+}
+
+// StartStatsFlushLoop периодически сбрасывает накопленные изменения статистики в БД.
+func StartStatsFlushLoop() {
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		FlushAllStats()
+		if statsManager != nil {
+			statsManager.PruneBuckets()
+		}
+	}
+}
+
+// FlushAllStats пишет в БД все накопленные изменения (вызывается и при остановке).
+func FlushAllStats() {
+	if statsManager != nil {
+		if err := statsManager.Flush(); err != nil {
+			log.Printf("⚠️ Ошибка записи статистики чата: %v", err)
+		}
+	}
+	if gameManager != nil {
+		if err := gameManager.Flush(); err != nil {
+			log.Printf("⚠️ Ошибка записи статистики игры: %v", err)
+		}
+	}
+}
+
+// AttachStatsDB переключает менеджеры статистики на новое подключение (после импорта БД).
+func AttachStatsDB(db *gorm.DB) {
+	if statsManager != nil {
+		statsManager.Attach(db)
+	}
+	if gameManager != nil {
+		gameManager.Attach(db)
+	}
+}
+
+// ------------------------------------------
+// Статистика чата
+// ------------------------------------------
+
+type statsDirty struct {
+	users      map[int64]bool
+	posts      map[int64]bool
+	days       map[string]bool
+	violations map[int64]bool
+	counters   bool
+}
+
+func newStatsDirty() statsDirty {
+	return statsDirty{
+		users:      make(map[int64]bool),
+		posts:      make(map[int64]bool),
+		days:       make(map[string]bool),
+		violations: make(map[int64]bool),
+	}
+}
+
+func (d *statsDirty) empty() bool {
+	return !d.counters && len(d.users) == 0 && len(d.posts) == 0 && len(d.days) == 0 && len(d.violations) == 0
+}
+
+func (d *statsDirty) merge(o statsDirty) {
+	for k := range o.users {
+		d.users[k] = true
+	}
+	for k := range o.posts {
+		d.posts[k] = true
+	}
+	for k := range o.days {
+		d.days[k] = true
+	}
+	for k := range o.violations {
+		d.violations[k] = true
+	}
+	d.counters = d.counters || o.counters
+}
+
+// markAllDirty помечает всю статистику к записи (импорт JSON, переключение БД).
+func (sm *StatsManager) markAllDirty() {
+	for id := range sm.Data.Users {
+		sm.dirty.users[id] = true
+	}
+	for id := range sm.Data.Posts {
+		sm.dirty.posts[id] = true
+	}
+	for day := range sm.Data.ActivityLog {
+		sm.dirty.days[day] = true
+	}
+	for id := range sm.Data.Violations {
+		sm.dirty.violations[id] = true
+	}
+	sm.dirty.counters = true
+}
+
+func (sm *StatsManager) counters() []ChatCounter {
+	return []ChatCounter{
+		{Key: counterTotalMessages, Value: int64(sm.Data.TotalMessages)},
+		{Key: counterTotalReactions, Value: int64(sm.Data.TotalReactions)},
+		{Key: counterDeletedMessages, Value: int64(sm.Data.DeletedMessages)},
+		{Key: counterBannedUsers, Value: int64(sm.Data.BannedUsers)},
+		{Key: counterWarningsGiven, Value: int64(sm.Data.WarningsGiven)},
+		{Key: counterReportsFiled, Value: int64(sm.Data.ReportsFiled)},
+		{Key: counterReportsActioned, Value: int64(sm.Data.ReportsActioned)},
+		{Key: counterReportsDismissed, Value: int64(sm.Data.ReportsDismissed)},
+	}
+}
+
+// Flush пишет накопленные изменения. Запись идет вне мьютекса, TrackMessage не ждет диск.
+func (sm *StatsManager) Flush() error {
+	sm.Mu.Lock()
+	if sm.db == nil || (sm.dirty.empty() && sm.buckets.empty()) {
+		sm.Mu.Unlock()
+		return nil
+	}
+	pending := sm.dirty
+	sm.dirty = newStatsDirty()
+	buckets := sm.buckets
+	sm.buckets = newBucketDeltas()
+	db := sm.db
+
+	var users []ChatUserStat
+	for id := range pending.users {
+		if u, ok := sm.Data.Users[id]; ok {
+			users = append(users, ChatUserStat{UserID: u.ID, Name: u.Name, Username: u.Username, MsgCount: u.MsgCount, WordCount: u.WordCount, ReactionCount: u.ReactionCount})
+		}
+	}
+	var posts []ChannelPostStat
+	for id := range pending.posts {
+		if p, ok := sm.Data.Posts[id]; ok {
+			posts = append(posts, ChannelPostStat{PostID: p.PostID, Preview: p.Preview, CommentCount: p.CommentCount, LastActivity: p.LastActivity})
+		}
+	}
+	var days []ChatActivity
+	for day := range pending.days {
+		days = append(days, ChatActivity{Day: day, Messages: sm.Data.ActivityLog[day]})
+	}
+	var violations []ChatViolation
+	var cleared []int64
+	for id := range pending.violations {
+		if n := sm.Data.Violations[id]; n > 0 {
+			violations = append(violations, ChatViolation{UserID: id, Count: n})
+		} else {
+			cleared = append(cleared, id)
+		}
+	}
+	var counters []ChatCounter
+	if pending.counters {
+		counters = sm.counters()
+	}
+	sm.Data.LastUpdated = time.Now()
+	sm.Mu.Unlock()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(users) > 0 {
+			if err := upsertAll(tx, &users); err != nil {
+				return err
+			}
+		}
+		if len(posts) > 0 {
+			if err := upsertAll(tx, &posts); err != nil {
+				return err
+			}
+		}
+		if len(days) > 0 {
+			if err := upsertAll(tx, &days); err != nil {
+				return err
+			}
+		}
+		if len(violations) > 0 {
+			if err := upsertAll(tx, &violations); err != nil {
+				return err
+			}
+		}
+		if len(cleared) > 0 {
+			if err := tx.Where("user_id IN ?", cleared).Delete(&ChatViolation{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(counters) > 0 {
+			if err := upsertAll(tx, &counters); err != nil {
+				return err
+			}
+		}
+		return flushBuckets(tx, buckets)
+	})
+	if err != nil {
+		// Не теряем изменения: вернем их в очередь до следующей попытки
+		sm.Mu.Lock()
+		sm.dirty.merge(pending)
+		sm.buckets.merge(buckets)
+		sm.Mu.Unlock()
+	}
+	return err
+}
+
+// loadFromDB читает статистику из таблиц. Возвращает false, если таблицы пусты.
+func (sm *StatsManager) loadFromDB() bool {
+	var counters []ChatCounter
+	sm.db.Find(&counters)
+	var usersCount int64
+	sm.db.Model(&ChatUserStat{}).Count(&usersCount)
+	if len(counters) == 0 && usersCount == 0 {
+		return false
+	}
+	data := newGlobalStats()
+	for _, c := range counters {
+		switch c.Key {
+		case counterTotalMessages:
+			data.TotalMessages = int(c.Value)
+		case counterTotalReactions:
+			data.TotalReactions = int(c.Value)
+		case counterDeletedMessages:
+			data.DeletedMessages = int(c.Value)
+		case counterBannedUsers:
+			data.BannedUsers = int(c.Value)
+		case counterWarningsGiven:
+			data.WarningsGiven = int(c.Value)
+		case counterReportsFiled:
+			data.ReportsFiled = int(c.Value)
+		case counterReportsActioned:
+			data.ReportsActioned = int(c.Value)
+		case counterReportsDismissed:
+			data.ReportsDismissed = int(c.Value)
+		}
+	}
+	var users []ChatUserStat
+	sm.db.Find(&users)
+	for _, u := range users {
+		data.Users[u.UserID] = &UserStat{ID: u.UserID, Name: u.Name, Username: u.Username, MsgCount: u.MsgCount, WordCount: u.WordCount, ReactionCount: u.ReactionCount}
+	}
+	var posts []ChannelPostStat
+	sm.db.Find(&posts)
+	for _, p := range posts {
+		data.Posts[p.PostID] = &PostStat{PostID: p.PostID, Preview: p.Preview, CommentCount: p.CommentCount, LastActivity: p.LastActivity}
+	}
+	var days []ChatActivity
+	sm.db.Find(&days)
+	for _, d := range days {
+		data.ActivityLog[d.Day] = d.Messages
+	}
+	var violations []ChatViolation
+	sm.db.Find(&violations)
+	for _, v := range violations {
+		data.Violations[v.UserID] = v.Count
+	}
+	sm.Data = data
+	return true
+}
+
+// importLegacyJSON переносит stats.json в БД. Возвращает true, если файл был.
+func (sm *StatsManager) importLegacyJSON() bool {
+	if sm.FilePath == "" {
+		return false
+	}
+	file, err := os.ReadFile(sm.FilePath)
+	if err != nil {
+		return false
+	}
+	data := newGlobalStats()
+	if err := json.Unmarshal(file, &data); err != nil {
+		log.Printf("⚠️ Не удалось разобрать %s: %v", sm.FilePath, err)
+		return false
+	}
+	data.ensureMaps()
+	sm.Data = data
+	sm.markAllDirty()
+	log.Printf("📥 Импорт статистики из %s: %d участников, %d постов", sm.FilePath, len(data.Users), len(data.Posts))
+	return true
+}
+
+// Attach переключает статистику на новое подключение. Если в новой БД статистики нет,
+// туда записывается текущая из памяти.
+func (sm *StatsManager) Attach(db *gorm.DB) {
+	if err := migrateStatsTables(db); err != nil {
+		log.Printf("⚠️ Ошибка миграции таблиц статистики: %v", err)
+	}
+	sm.Mu.Lock()
+	sm.db = db
+	sm.dirty = newStatsDirty()
+	if !sm.loadFromDB() {
+		sm.markAllDirty()
+	}
+	sm.Mu.Unlock()
+	if err := sm.Flush(); err != nil {
+		log.Printf("⚠️ Ошибка записи статистики: %v", err)
+	}
+}
+
+// ------------------------------------------
+// Статистика игры
+// ------------------------------------------
+
+type scoreKey struct {
+	ChatID int64
+	UserID int64
+}
+
+func (gm *GameManager) Flush() error {
+	gm.mu.Lock()
+	if gm.db == nil || (len(gm.dirtyScores) == 0 && len(gm.pendingRiddles) == 0) {
+		gm.mu.Unlock()
+		return nil
+	}
+	keys := gm.dirtyScores
+	riddles := gm.pendingRiddles
+	gm.dirtyScores = make(map[scoreKey]bool)
+	gm.pendingRiddles = nil
+	db := gm.db
+
+	var scores []GameScore
+	for k := range keys {
+		board := gm.Stats.Leaderboard
+		if k.ChatID != 0 {
+			board = gm.Stats.ChatLeaderboard[k.ChatID]
+		}
+		scores = append(scores, GameScore{ChatID: k.ChatID, UserID: k.UserID, Name: gm.Stats.PlayerNames[k.UserID], Wins: board[k.UserID]})
+	}
+	gm.mu.Unlock()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(scores) > 0 {
+			if err := upsertAll(tx, &scores); err != nil {
+				return err
+			}
+		}
+		if len(riddles) > 0 {
+			return tx.CreateInBatches(&riddles, 200).Error
+		}
+		return nil
+	})
+	if err != nil {
+		gm.mu.Lock()
+		for k := range keys {
+			gm.dirtyScores[k] = true
+		}
+		gm.pendingRiddles = append(riddles, gm.pendingRiddles...)
+		gm.mu.Unlock()
+	}
+	return err
+}
+
+func (gm *GameManager) markScoresDirty() {
+	for id := range gm.Stats.Leaderboard {
+		gm.dirtyScores[scoreKey{UserID: id}] = true
+	}
+	for chatID, board := range gm.Stats.ChatLeaderboard {
+		for id := range board {
+			gm.dirtyScores[scoreKey{ChatID: chatID, UserID: id}] = true
+		}
+	}
+}
+
+func riddleRecord(h RiddleHistory) RiddleRecord {
+	return RiddleRecord{ChatID: h.ChatID, Answer: h.Answer, Description: h.Description, WinnerName: h.WinnerName, WinnerID: h.WinnerID, Date: h.Date}
+}
+
+// loadFromDB читает лидерборды и историю загадок. Возвращает false, если таблицы пусты.
+func (gm *GameManager) loadFromDB() bool {
+	var scores []GameScore
+	gm.db.Find(&scores)
+	var riddles []RiddleRecord
+	gm.db.Order("id asc").Find(&riddles)
+	if len(scores) == 0 && len(riddles) == 0 {
+		return false
+	}
+	stats := newGlobalGameStats()
+	for _, s := range scores {
+		if s.ChatID == 0 {
+			stats.Leaderboard[s.UserID] = s.Wins
+		} else {
+			if stats.ChatLeaderboard[s.ChatID] == nil {
+				stats.ChatLeaderboard[s.ChatID] = make(map[int64]int)
+			}
+			stats.ChatLeaderboard[s.ChatID][s.UserID] = s.Wins
+		}
+		if s.Name != "" {
+			stats.PlayerNames[s.UserID] = s.Name
+		}
+	}
+	for _, r := range riddles {
+		stats.History = append(stats.History, RiddleHistory{Date: r.Date, Answer: r.Answer, Description: r.Description, WinnerName: r.WinnerName, WinnerID: r.WinnerID, ChatID: r.ChatID})
+	}
+	gm.Stats = stats
+	return true
+}
+
+// importLegacyJSON переносит gamestats.json в БД. Возвращает true, если файл был.
+func (gm *GameManager) importLegacyJSON(path string) bool {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	stats := newGlobalGameStats()
+	if err := json.Unmarshal(file, &stats); err != nil {
+		log.Printf("⚠️ Не удалось разобрать %s: %v", path, err)
+		return false
+	}
+	stats.ensureMaps()
+	gm.Stats = stats
+	gm.markScoresDirty()
+	for _, h := range stats.History {
+		gm.pendingRiddles = append(gm.pendingRiddles, riddleRecord(h))
+	}
+	log.Printf("📥 Импорт статистики игры из %s: %d игроков, %d загадок", path, len(stats.Leaderboard), len(stats.History))
+	return true
+}
+
+// Attach переключает игру на новое подключение (см. StatsManager.Attach).
+func (gm *GameManager) Attach(db *gorm.DB) {
+	if err := migrateStatsTables(db); err != nil {
+		log.Printf("⚠️ Ошибка миграции таблиц статистики: %v", err)
+	}
+	gm.mu.Lock()
+	gm.db = db
+	gm.dirtyScores = make(map[scoreKey]bool)
+	gm.pendingRiddles = nil
+	if !gm.loadFromDB() {
+		gm.markScoresDirty()
+		for _, h := range gm.Stats.History {
+			gm.pendingRiddles = append(gm.pendingRiddles, riddleRecord(h))
+		}
+	}
+	gm.mu.Unlock()
+	if err := gm.Flush(); err != nil {
+		log.Printf("⚠️ Ошибка записи статистики игры: %v", err)
+	}
+}
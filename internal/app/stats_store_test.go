@@ -0,0 +1,174 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestStatsDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "stats.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestStatsManagerImportAndFlush(t *testing.T) {
+	db := openTestStatsDB(t)
+	legacy := filepath.Join(t.TempDir(), "stats.json")
+	raw := `{"total_messages": 42, "banned_users": 1,
+		"users": {"7": {"id": 7, "name": "Ann", "msg_count": 40, "word_count": 300}},
+		"posts": {"15": {"post_id": 15, "preview": "пост", "comment_count": 2}},
+		"activity_log": {"2024-03-08": 42},
+		"violations": {"9": 2}}`
+	if err := os.WriteFile(legacy, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewStatsManager(legacy, db)
+	if _, err := os.Stat(legacy + ".imported"); err != nil {
+		t.Fatalf("legacy file must be renamed after import: %v", err)
+	}
+	if sm.Data.TotalMessages != 42 || sm.Data.Users[7].MsgCount != 40 {
+		t.Fatalf("unexpected imported data: %+v", sm.Data)
+	}
+
+	sm.Mu.Lock()
+	sm.trackUser(&tele.User{ID: 7, FirstName: "Ann", Username: "ann"}, 10)
+	sm.Mu.Unlock()
+	sm.RegisterViolation(9)
+	sm.RegisterBan(9)
+	if err := sm.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewStatsManager(legacy, db)
+	u := reloaded.Data.Users[7]
+	if u == nil || u.MsgCount != 41 || u.Username != "ann" {
+		t.Fatalf("user stats not persisted: %+v", u)
+	}
+	if reloaded.Data.BannedUsers != 2 || reloaded.Data.DeletedMessages != 1 {
+		t.Fatalf("counters not persisted: %+v", reloaded.Data)
+	}
+	if _, ok := reloaded.Data.Violations[9]; ok {
+		t.Fatal("violations must be cleared after ban")
+	}
+	if reloaded.Data.ActivityLog["2024-03-08"] != 42 || reloaded.Data.Posts[15].CommentCount != 2 {
+		t.Fatalf("activity or posts not persisted: %+v", reloaded.Data)
+	}
+}
+
+func TestGameStatsImportAndFlush(t *testing.T) {
+	db := openTestStatsDB(t)
+	oldPath := gameStatsFilePath
+	gameStatsFilePath = filepath.Join(t.TempDir(), "gamestats.json")
+	t.Cleanup(func() { gameStatsFilePath = oldPath })
+	raw := `{"leaderboard": {"1": 3}, "player_names": {"1": "@alice"},
+		"history": [{"date": "01.01 10:00", "answer": "Кюри", "winner_id": 1}]}`
+	if err := os.WriteFile(gameStatsFilePath, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gm := InitGame(offlineJudge{}, db)
+	if gm.Stats.Leaderboard[1] != 3 {
+		t.Fatalf("legacy leaderboard not imported: %+v", gm.Stats)
+	}
+	startTestGame(gm, -100, "Ада Лавлейс")
+	if win, _, _ := gm.CheckGuess(-100, "Ада Лавлейс", &tele.User{ID: 1, Username: "alice"}); !win {
+		t.Fatal("expected a win")
+	}
+	if err := gm.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := InitGame(offlineJudge{}, db)
+	if reloaded.Stats.Leaderboard[1] != 4 || reloaded.Stats.ChatLeaderboard[-100][1] != 1 {
+		t.Fatalf("scores not persisted: %+v", reloaded.Stats)
+	}
+	if len(reloaded.Stats.History) != 2 {
+		t.Fatalf("expected 2 riddles in history, got %d", len(reloaded.Stats.History))
+	}
+}
+
+func TestParseStatsPeriod(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 4, 0, 0, time.UTC)
+	cases := []struct {
+		arg      string
+		from, to string
+		days     int
+	}{
+		{"", "2024-03-04", "2024-03-10", 7},
+		{"день", "2024-03-10", "2024-03-10", 1},
+		{"month", "2024-02-10", "2024-03-10", 30},
+		{"14d", "2024-02-26", "2024-03-10", 14},
+	}
+	for _, tc := range cases {
+		p, err := parseStatsPeriod(tc.arg, now)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.arg, err)
+		}
+		if p.FromKey() != tc.from || p.ToKey() != tc.to || p.Days != tc.days {
+			t.Fatalf("%q: got %s..%s (%d)", tc.arg, p.FromKey(), p.ToKey(), p.Days)
+		}
+	}
+	if prev := (statsPeriod{From: now, Days: 7}).Previous(); prev.ToKey() != "2024-03-09" {
+		t.Fatalf("previous period must end right before the current one, got %s", prev.ToKey())
+	}
+	if _, err := parseStatsPeriod("вчера-ish", now); err == nil {
+		t.Fatal("expected an error for an unknown period")
+	}
+}
+
+func TestStatsBucketsFlushAndPrune(t *testing.T) {
+	db := openTestStatsDB(t)
+	sm := NewStatsManager(filepath.Join(t.TempDir(), "none.json"), db)
+	now := time.Now()
+
+	// Два сброса подряд: значения в БД должны складываться, а не перезаписываться
+	for i := 0; i < 2; i++ {
+		sm.Mu.Lock()
+		sm.trackBucketMessage(7, 3, i == 1, now)
+		sm.trackBucketReaction(7, now)
+		sm.trackBucketMessage(8, 1, false, now.AddDate(0, 0, -8))
+		sm.Mu.Unlock()
+		if err := sm.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	week, _ := parseStatsPeriod("week", now)
+	s := sm.periodSummary(week)
+	if s.Messages != 2 || s.Words != 6 || s.Reactions != 2 || s.Replies != 1 || s.ActiveUsers != 1 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	if prev := sm.periodSummary(week.Previous()); prev.Messages != 2 || prev.ActiveUsers != 1 {
+		t.Fatalf("unexpected previous summary: %+v", prev)
+	}
+	grid := sm.periodHeatmap(week)
+	if grid[(int(now.Weekday())+6)%7][now.Hour()] != 2 {
+		t.Fatalf("heatmap cell not filled: %v", grid)
+	}
+	if _, err := sm.GeneratePeriodStatsImage(week); err != nil {
+		t.Fatal(err)
+	}
+
+	pruneStatsBuckets(db, now.Add(userDayRetention).AddDate(0, 0, -7))
+	var left int64
+	db.Model(&UserDayStat{}).Count(&left)
+	if left != 1 {
+		t.Fatalf("expected only the recent bucket to survive pruning, got %d", left)
+	}
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ==========================================
+// РУССКИЙ СТЕММЕР (SNOWBALL)
+// ==========================================
+
+// Реализация алгоритма Snowball для русского языка: отрезает окончания,
+// чтобы "поэтесса" и "поэтессой" попадали в один поисковый терм.
+
+var (
+	ruPerfectiveGerund1 = []string{"вшись", "вши", "в"}
+	ruPerfectiveGerund2 = []string{"ившись", "ывшись", "ивши", "ывши", "ив", "ыв"}
+	ruAdjective         = []string{"ими", "ыми", "его", "ого", "ему", "ому", "ее", "ие", "ые", "ое", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+	ruParticiple1       = []string{"ем", "нн", "вш", "ющ", "щ"}
+	ruParticiple2       = []string{"ивш", "ывш", "ующ"}
+	ruReflexive         = []string{"ся", "сь"}
+	ruVerb1             = []string{"ете", "йте", "ешь", "нно", "ла", "на", "ли", "ем", "ло", "но", "ет", "ют", "ны", "ть", "й", "л", "н"}
+	ruVerb2             = []string{"ейте", "уйте", "ила", "ыла", "ена", "ите", "или", "ыли", "ило", "ыло", "ено", "ует", "уют", "ены", "ить", "ыть", "ишь", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ят", "ит", "ыт", "ую", "ю"}
+	ruNoun              = []string{"иями", "ями", "ами", "ией", "иям", "ием", "иях", "ев", "ов", "ие", "ье", "еи", "ии", "ей", "ой", "ий", "ям", "ем", "ам", "ом", "ах", "ях", "ию", "ью", "ия", "ья", "а", "е", "и", "й", "о", "у", "ы", "ь", "ю", "я"}
+	ruDerivational      = []string{"ость", "ост"}
+	ruSuperlative       = []string{"ейше", "ейш"}
+)
+
+func isRuVowel(r rune) bool {
+	switch r {
+	case 'а', 'е', 'и', 'о', 'у', 'ы', 'э', 'ю', 'я':
+		return true
+	}
+	return false
+}
+
+// stemRussian возвращает основу слова. Нерусские слова возвращаются в нижнем регистре без изменений.
+func stemRussian(word string) string {
+	word = strings.ReplaceAll(strings.ToLower(word), "ё", "е")
+	w := []rune(word)
+	rv, r2 := ruRegions(w)
+	if rv >= len(w) {
+		return word
+	}
+
+	// Шаг 1
+	if n, ok := ruMatchPreceded(w, rv, ruPerfectiveGerund1); ok {
+		w = w[:len(w)-n]
+	} else if n, ok := ruMatch(w, rv, ruPerfectiveGerund2); ok {
+		w = w[:len(w)-n]
+	} else {
+		if n, ok := ruMatch(w, rv, ruReflexive); ok {
+			w = w[:len(w)-n]
+		}
+		if n, ok := ruMatchAdjectival(w, rv); ok {
+			w = w[:len(w)-n]
+		} else if n, ok := ruMatchPreceded(w, rv, ruVerb1); ok {
+			w = w[:len(w)-n]
+		} else if n, ok := ruMatch(w, rv, ruVerb2); ok {
+			w = w[:len(w)-n]
+		} else if n, ok := ruMatch(w, rv, ruNoun); ok {
+			w = w[:len(w)-n]
+		}
+	}
+
+	// Шаг 2
+	if len(w) > rv && w[len(w)-1] == 'и' {
+		w = w[:len(w)-1]
+	}
+
+	// Шаг 3
+	if n, ok := ruMatch(w, r2, ruDerivational); ok {
+		w = w[:len(w)-n]
+	}
+
+	// Шаг 4
+	if ruHasSuffix(w, rv, "нн") {
+		w = w[:len(w)-1]
+	} else if n, ok := ruMatch(w, rv, ruSuperlative); ok {
+		w = w[:len(w)-n]
+		if ruHasSuffix(w, rv, "нн") {
+			w = w[:len(w)-1]
+		}
+	} else if len(w) > rv && w[len(w)-1] == 'ь' {
+		w = w[:len(w)-1]
+	}
+	return string(w)
+}
+
+// ruRegions вычисляет начала областей RV и R2 (в рунах).
+func ruRegions(w []rune) (int, int) {
+	rv := len(w)
+	for i, r := range w {
+		if isRuVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	r1 := len(w)
+	for i := 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r1 = i + 1
+			break
+		}
+	}
+	r2 := len(w)
+	for i := r1 + 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r2 = i + 1
+			break
+		}
+	}
+	return rv, r2
+}
+
+func ruHasSuffix(w []rune, region int, suffix string) bool {
+	s := []rune(suffix)
+	if len(w)-len(s) < region {
+		return false
+	}
+	return string(w[len(w)-len(s):]) == suffix
+}
+
+// ruMatch ищет самое длинное окончание из списка, целиком лежащее в области.
+func ruMatch(w []rune, region int, suffixes []string) (int, bool) {
+	best := 0
+	for _, s := range suffixes {
+		n := len([]rune(s))
+		if n > best && ruHasSuffix(w, region, s) {
+			best = n
+		}
+	}
+	return best, best > 0
+}
+
+// ruMatchPreceded — то же, но окончание должно идти после "а" или "я" (они не удаляются).
+func ruMatchPreceded(w []rune, region int, suffixes []string) (int, bool) {
+	best := 0
+	for _, s := range suffixes {
+		n := len([]rune(s))
+		if n <= best || !ruHasSuffix(w, region, s) {
+			continue
+		}
+		pos := len(w) - n - 1
+		if pos < region || (w[pos] != 'а' && w[pos] != 'я') {
+			continue
+		}
+		best = n
+	}
+	return best, best > 0
+}
+
+func ruMatchAdjectival(w []rune, rv int) (int, bool) {
+	n, ok := ruMatch(w, rv, ruAdjective)
+	if !ok {
+		return 0, false
+	}
+	rest := w[:len(w)-n]
+	if p, ok := ruMatch(rest, rv, ruParticiple2); ok {
+		return n + p, true
+	}
+	if p, ok := ruMatchPreceded(rest, rv, ruParticiple1); ok {
+		return n + p, true
+	}
+	return n, true
+}
+
+// splitSearchWords режет текст на слова (буквы и цифры).
+func splitSearchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// stemText приводит текст к строке основ, разделенных пробелами.
+func stemText(text string) string {
+	words := splitSearchWords(text)
+	out := make([]string, 0, len(words))
+	for _, w := range words {
+		out = append(out, stemRussian(w))
+	}
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,342 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==========================================
+// ТЕГИ: НОРМАЛИЗОВАННОЕ ХРАНЕНИЕ
+// ==========================================
+
+// Источник истины для фильтров и счетчиков — таблицы tags и woman_tags.
+// Колонка Woman.Tags остается денормализованной копией для карточек и экспорта
+// и синхронизируется при каждом сохранении записи.
+
+type Tag struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:64;uniqueIndex"`
+	CreatedAt time.Time
+}
+
+type WomanTag struct {
+	WomanID uint `gorm:"primaryKey;autoIncrement:false"`
+	TagID   uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+type TagAlias struct {
+	Alias     string `gorm:"primaryKey;size:64"`
+	Tag       string `gorm:"size:64;index"`
+	CreatedAt time.Time
+}
+
+var (
+	tagAliasesMu sync.RWMutex
+	tagAliases   = copyTagAliases(defaultTagAliases)
+)
+
+func copyTagAliases(src map[string]string) map[string]string {
+	out := make(map[string]string, len(src))
+	for k, v := range src {
+		out[k] = v
+	}
+	return out
+}
+
+// canonicalTag возвращает каноническое имя тега с учетом алиасов.
+func canonicalTag(tag string) string {
+	tagAliasesMu.RLock()
+	defer tagAliasesMu.RUnlock()
+	if canon, ok := tagAliases[tag]; ok {
+		return canon
+	}
+	return tag
+}
+
+// tagsMigrationMarker — отметка о переносе тегов из JSON-колонки в woman_tags.
+const tagsMigrationMarker = "woman_tags"
+
+// initTags засевает алиасы по умолчанию, переносит теги из JSON-колонки и загружает алиасы в память.
+// Перенос выполняется один раз и отмечается в SchemaMarker: наличие строк в woman_tags
+// ничего не говорит о том, перенесены ли теги остальных записей.
+func (wm *WomanManager) initTags() {
+	var aliasCount int64
+	wm.DB.Model(&TagAlias{}).Count(&aliasCount)
+	if aliasCount == 0 {
+		for alias, tag := range defaultTagAliases {
+			wm.DB.Create(&TagAlias{Alias: alias, Tag: tag})
+		}
+	}
+	wm.reloadTagAliases()
+
+	if wm.schemaVersion(tagsMigrationMarker) >= 1 {
+		return
+	}
+	var withTags int64
+	wm.DB.Model(&Woman{}).Where("tags IS NOT NULL AND tags <> '' AND tags <> '[]'").Count(&withTags)
+	if withTags > 0 {
+		log.Printf("🏷️ Переношу теги %d записей в таблицу woman_tags...", withTags)
+	}
+	var women []Woman
+	err := wm.DB.Select("id", "tags").Where("tags IS NOT NULL AND tags <> '' AND tags <> '[]'").FindInBatches(&women, 200, func(tx *gorm.DB, batch int) error {
+		for i := range women {
+			if err := syncWomanTags(tx, women[i].ID, normalizeTags(women[i].Tags)); err != nil {
+				return fmt.Errorf("ID %d: %w", women[i].ID, err)
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		log.Printf("⚠️ Не удалось перенести теги, повторю при следующем запуске: %v", err)
+		return
+	}
+	if err := wm.setSchemaVersion(tagsMigrationMarker, 1); err != nil {
+		log.Printf("⚠️ Не удалось отметить перенос тегов: %v", err)
+	}
+}
+
+func (wm *WomanManager) reloadTagAliases() {
+	var rows []TagAlias
+	if err := wm.DB.Find(&rows).Error; err != nil {
+		log.Printf("⚠️ Ошибка загрузки алиасов тегов: %v", err)
+		return
+	}
+	m := make(map[string]string, len(rows))
+	for _, r := range rows {
+		m[r.Alias] = r.Tag
+	}
+	tagAliasesMu.Lock()
+	tagAliases = m
+	tagAliasesMu.Unlock()
+}
+
+// syncWomanTags приводит связи записи к списку tags (теги создаются по необходимости).
+func syncWomanTags(db *gorm.DB, womanID uint, tags []string) error {
+	if womanID == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("woman_id = ?", womanID).Delete(&WomanTag{}).Error; err != nil {
+			return err
+		}
+		for _, name := range tags {
+			tag := Tag{Name: name}
+			if err := tx.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+				return err
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&WomanTag{WomanID: womanID, TagID: tag.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// tagFilterSQL — условие "у записи есть тег" для buildSearchQuery и выборок по тегу.
+const tagFilterSQL = "id IN (SELECT woman_tags.woman_id FROM woman_tags JOIN tags ON tags.id = woman_tags.tag_id WHERE tags.name = ?)"
+
+// tagStatsQuery считает записи по тегам через индекс woman_tags.
+func (wm *WomanManager) tagStatsQuery(ids *gorm.DB) []TagStat {
+	q := wm.DB.Table("woman_tags").
+		Select("tags.name AS tag, COUNT(*) AS count").
+		Joins("JOIN tags ON tags.id = woman_tags.tag_id").
+		Group("tags.name").
+		Order("count DESC, tags.name ASC")
+	if ids != nil {
+		q = q.Where("woman_tags.woman_id IN (?)", ids)
+	}
+	var stats []TagStat
+	if err := q.Scan(&stats).Error; err != nil {
+		log.Printf("⚠️ Ошибка подсчета тегов: %v", err)
+	}
+	return stats
+}
+
+// ==========================================
+// УПРАВЛЕНИЕ ТЕГАМИ
+// ==========================================
+
+// womenWithTag возвращает id всех записей (включая неопубликованные) с тегом.
+func (wm *WomanManager) womenWithTag(tag string) []uint {
+	var ids []uint
+	wm.DB.Table("woman_tags").
+		Joins("JOIN tags ON tags.id = woman_tags.tag_id").
+		Where("tags.name = ?", tag).
+		Pluck("woman_tags.woman_id", &ids)
+	return ids
+}
+
+// replaceTagOnCards заменяет тег from на to (или удаляет, если to пуст) во всех карточках
+// и пишет каждое изменение в ChangeLog.
+func (wm *WomanManager) replaceTagOnCards(from, to string, actorID int64) (int, error) {
+	updated := 0
+	for _, id := range wm.womenWithTag(from) {
+		w, err := wm.GetWomanByID(id)
+		if err != nil || w == nil {
+			continue
+		}
+		old := strings.Join(w.Tags, ", ")
+		w.Tags, _ = replaceTag(w.Tags, from, to)
+		if err := wm.UpdateWomanBy(w, actorID, "tags"); err != nil {
+			return updated, err
+		}
+		wm.LogChange(actorID, w.ID, "tags", old, strings.Join(w.Tags, ", "))
+		updated++
+	}
+	return updated, wm.replaceTagInTrash(from, to)
+}
+
+// replaceTagInTrash делает то же с карточками в корзине. Строк в woman_tags у них нет,
+// поэтому без этого восстановление вернуло бы удаленный или слитый тег.
+func (wm *WomanManager) replaceTagInTrash(from, to string) error {
+	var women []Woman
+	err := wm.DB.Unscoped().Select("id", "tags").
+		Where("deleted_at IS NOT NULL AND tags LIKE ?", "%"+from+"%").Find(&women).Error
+	if err != nil {
+		return err
+	}
+	for _, w := range women {
+		next, changed := replaceTag(w.Tags, from, to)
+		if !changed {
+			continue
+		}
+		if err := wm.DB.Unscoped().Model(&Woman{}).Where("id = ?", w.ID).Select("tags").Updates(&Woman{Tags: next}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceTag заменяет тег from на to (или убирает, если to пуст), не допуская повторов.
+func replaceTag(tags []string, from, to string) ([]string, bool) {
+	next := make([]string, 0, len(tags))
+	changed := false
+	for _, t := range tags {
+		if t == from {
+			changed = true
+			if to == "" {
+				continue
+			}
+			t = to
+		}
+		next = append(next, t)
+	}
+	return normalizeTags(next), changed
+}
+
+func (wm *WomanManager) deleteTagRow(name string) {
+	var tag Tag
+	if err := wm.DB.Where("name = ?", name).First(&tag).Error; err != nil {
+		return
+	}
+	wm.DB.Where("tag_id = ?", tag.ID).Delete(&WomanTag{})
+	wm.DB.Delete(&tag)
+}
+
+// RenameTag переименовывает тег во всех карточках. Если новое имя уже занято, теги сливаются.
+func (wm *WomanManager) RenameTag(from, to string, actorID int64) (int, error) {
+	from, to = cleanTagName(from), cleanTagName(to)
+	if from == "" || to == "" || from == to {
+		return 0, fmt.Errorf("неверные имена тегов")
+	}
+	updated, err := wm.replaceTagOnCards(from, to, actorID)
+	if err != nil {
+		return updated, err
+	}
+	wm.deleteTagRow(from)
+	// Алиасы, указывавшие на старое имя, переводим на новое
+	wm.DB.Model(&TagAlias{}).Where("tag = ?", from).Update("tag", to)
+	wm.reloadTagAliases()
+	wm.LogChange(actorID, 0, "tag_rename", from, to)
+	return updated, nil
+}
+
+// MergeTags переносит карточки с тега from на into и оставляет from алиасом into.
+func (wm *WomanManager) MergeTags(from, into string, actorID int64) (int, error) {
+	from, into = cleanTagName(from), cleanTagName(into)
+	if from == "" || into == "" || from == into {
+		return 0, fmt.Errorf("неверные имена тегов")
+	}
+	if err := wm.saveAlias(from, into); err != nil {
+		return 0, err
+	}
+	updated, err := wm.replaceTagOnCards(from, into, actorID)
+	if err != nil {
+		return updated, err
+	}
+	wm.deleteTagRow(from)
+	wm.LogChange(actorID, 0, "tag_merge", from, into)
+	return updated, nil
+}
+
+// AliasTag регистрирует алиас. Если алиас уже используется как самостоятельный тег, он сливается с целевым.
+func (wm *WomanManager) AliasTag(alias, tag string, actorID int64) (int, error) {
+	alias, tag = cleanTagName(alias), cleanTagName(tag)
+	if alias == "" || tag == "" || alias == tag {
+		return 0, fmt.Errorf("неверные имена тегов")
+	}
+	if len(wm.womenWithTag(alias)) > 0 {
+		return wm.MergeTags(alias, tag, actorID)
+	}
+	if err := wm.saveAlias(alias, tag); err != nil {
+		return 0, err
+	}
+	if err := wm.replaceTagInTrash(alias, tag); err != nil {
+		return 0, err
+	}
+	wm.deleteTagRow(alias)
+	wm.LogChange(actorID, 0, "tag_alias", alias, tag)
+	return 0, nil
+}
+
+// DeleteTag снимает тег со всех карточек и удаляет его алиасы.
+func (wm *WomanManager) DeleteTag(name string, actorID int64) (int, error) {
+	name = cleanTagName(name)
+	if name == "" {
+		return 0, fmt.Errorf("пустой тег")
+	}
+	updated, err := wm.replaceTagOnCards(name, "", actorID)
+	if err != nil {
+		return updated, err
+	}
+	wm.deleteTagRow(name)
+	wm.DB.Where("tag = ? OR alias = ?", name, name).Delete(&TagAlias{})
+	wm.reloadTagAliases()
+	wm.LogChange(actorID, 0, "tag_delete", name, "")
+	return updated, nil
+}
+
+func (wm *WomanManager) saveAlias(alias, tag string) error {
+	// Цепочки алиасов не допускаем: всё, что указывало на alias, теперь указывает на tag
+	wm.DB.Model(&TagAlias{}).Where("tag = ?", alias).Update("tag", tag)
+	err := wm.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "alias"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tag"}),
+	}).Create(&TagAlias{Alias: alias, Tag: tag}).Error
+	wm.reloadTagAliases()
+	return err
+}
+
+// ListTagAliases возвращает алиасы, отсортированные по каноническому тегу.
+func (wm *WomanManager) ListTagAliases() []TagAlias {
+	var rows []TagAlias
+	wm.DB.Find(&rows)
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Tag == rows[j].Tag {
+			return rows[i].Alias < rows[j].Alias
+		}
+		return rows[i].Tag < rows[j].Tag
+	})
+	return rows
+}
+
+func cleanTagName(s string) string {
+	return strings.TrimPrefix(strings.TrimSpace(strings.ToLower(s)), "#")
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestWomanManager(t *testing.T) *WomanManager {
+	t.Helper()
+	wm := NewWomanManager(filepath.Join(t.TempDir(), "women.db"))
+	t.Cleanup(func() {
+		_ = wm.CloseDB()
+		tagAliasesMu.Lock()
+		tagAliases = copyTagAliases(defaultTagAliases)
+		tagAliasesMu.Unlock()
+	})
+	return wm
+}
+
+func tagCounts(stats []TagStat) map[string]int {
+	out := map[string]int{}
+	for _, s := range stats {
+		out[s.Tag] = s.Count
+	}
+	return out
+}
+
+func TestTagManagement(t *testing.T) {
+	wm := newTestWomanManager(t)
+	a := &Woman{Name: "Софья Ковалевская", Field: "математика", Tags: []string{"матан", "Наука"}, IsPublished: true}
+	b := &Woman{Name: "Мария Кюри", Field: "физика", Tags: []string{"физика", "химия", "наука"}, IsPublished: true}
+	for _, w := range []*Woman{a, b} {
+		if err := wm.UpdateWoman(w); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	if !reflect.DeepEqual(a.Tags, []string{"математика", "наука"}) {
+		t.Fatalf("aliases not applied: %v", a.Tags)
+	}
+	if got := tagCounts(wm.GetTagStats()); got["наука"] != 2 || got["математика"] != 1 {
+		t.Fatalf("unexpected stats: %v", got)
+	}
+
+	if n, err := wm.RenameTag("наука", "science", 1); err != nil || n != 2 {
+		t.Fatalf("rename: n=%d err=%v", n, err)
+	}
+	if n, err := wm.MergeTags("химия", "физика", 1); err != nil || n != 1 {
+		t.Fatalf("merge: n=%d err=%v", n, err)
+	}
+	if canonicalTag("химия") != "физика" {
+		t.Fatalf("merge must leave an alias")
+	}
+	if _, err := wm.AliasTag("матем", "science", 1); err != nil {
+		t.Fatalf("alias: %v", err)
+	}
+	if canonicalTag("матем") != "science" {
+		t.Fatalf("alias not registered")
+	}
+	if n, err := wm.DeleteTag("математика", 1); err != nil || n != 1 {
+		t.Fatalf("delete: n=%d err=%v", n, err)
+	}
+
+	got, _ := wm.GetWomanByID(b.ID)
+	if !reflect.DeepEqual(got.Tags, []string{"физика", "science"}) {
+		t.Fatalf("card tags not rewritten: %v", got.Tags)
+	}
+	stats := tagCounts(wm.GetTagStatsByFilters(SearchFilters{PublishedOnly: true, Tags: []string{"science"}}))
+	want := map[string]int{"science": 2, "физика": 1}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("filtered stats = %v, want %v", stats, want)
+	}
+	if hist := wm.GetChangeHistory(b.ID, 10); len(hist) != 2 {
+		t.Fatalf("expected 2 history rows, got %d", len(hist))
+	}
+}
+
+func TestInitTagsMigratesJSONTags(t *testing.T) {
+	wm := newTestWomanManager(t)
+	// Старая база: теги только в JSON-колонке, у второй записи тегов нет вовсе
+	legacy := []*Woman{
+		{Name: "Анна Ахматова", Field: "литература", Tags: []string{"поэзия"}, IsPublished: true},
+		{Name: "Мария Митчелл", Field: "астрономия", Tags: []string{}, IsPublished: true},
+	}
+	for _, w := range legacy {
+		if err := wm.DB.Create(w).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	wm.DB.Exec("DELETE FROM woman_tags")
+	wm.DB.Where("name = ?", tagsMigrationMarker).Delete(&SchemaMarker{})
+	if err := wm.CloseDB(); err != nil {
+		t.Fatal(err)
+	}
+	wm.Connect()
+
+	got := tagCounts(wm.GetTagStats())
+	if got["поэзия"] != 1 || got["астрономия"] != 1 {
+		t.Fatalf("JSON tags and auto tags must both reach woman_tags: %v", got)
+	}
+	if wm.schemaVersion(tagsMigrationMarker) != 1 {
+		t.Fatal("migration marker must be stored")
+	}
+}
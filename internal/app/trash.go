@@ -0,0 +1,410 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"gorm.io/gorm"
+)
+
+// ==========================================
+// КОРЗИНА КАРТОЧЕК
+// ==========================================
+
+// DeleteWoman только помечает карточку удаленной (gorm.Model). Кто и почему удалил —
+// в WomanDeletion. Из корзины карточку можно вернуть (/restore) или стереть
+// навсегда (/purge); через TrashRetentionDays дней она стирается сама.
+// При слиянии избранное и просмотры переезжают к оставшейся карточке,
+// а их ID запоминаются, чтобы восстановление вернуло их обратно.
+
+const (
+	cbTrashPrefix             = "trash_"
+	defaultTrashRetentionDays = 30
+	trashPageSize             = 8
+)
+
+type WomanDeletion struct {
+	WomanID        uint `gorm:"primaryKey;autoIncrement:false"`
+	DeletedBy      int64
+	Reason         string
+	MergedInto     uint
+	MovedFavorites []uint `gorm:"serializer:json"`
+	MovedViews     []uint `gorm:"serializer:json"`
+	DeletedAt      time.Time
+}
+
+type trashItem struct {
+	Woman    Woman
+	Deletion WomanDeletion
+}
+
+var errNotInTrash = errors.New("карточки нет в корзине")
+
+func trashRetention() time.Duration {
+	days := config.TrashRetentionDays
+	if days <= 0 {
+		days = defaultTrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// DeleteWoman переносит карточку в корзину.
+func (wm *WomanManager) DeleteWoman(id uint, actorID int64, reason string) error {
+	return wm.deleteWoman(id, WomanDeletion{DeletedBy: actorID, Reason: reason})
+}
+
+func (wm *WomanManager) deleteWoman(id uint, info WomanDeletion) error {
+	err := wm.DB.Delete(&Woman{}, id).Error
+	if err == nil {
+		info.WomanID = id
+		info.DeletedAt = time.Now()
+		if err := wm.DB.Save(&info).Error; err != nil {
+			log.Printf("⚠️ Не удалось записать удаление ID %d: %v", id, err)
+		}
+		wm.DB.Where("woman_id = ?", id).Delete(&WomanTag{})
+		wm.dropFromSearchIndex(id)
+		wm.Mu.Lock()
+		wm.FieldsCache = nil
+		wm.TagsCache = nil
+		wm.Mu.Unlock()
+	}
+	return err
+}
+
+// TrashMerged переносит в корзину карточку, слитую в keepID: ее избранное
+// и просмотры переходят к keepID.
+func (wm *WomanManager) TrashMerged(removeID, keepID uint, actorID int64) error {
+	favs, views, err := moveWomanLinks(wm.DB, removeID, keepID)
+	if err != nil {
+		return err
+	}
+	return wm.deleteWoman(removeID, WomanDeletion{
+		DeletedBy:      actorID,
+		Reason:         fmt.Sprintf("слита в #%d", keepID),
+		MergedInto:     keepID,
+		MovedFavorites: favs,
+		MovedViews:     views,
+	})
+}
+
+// moveWomanLinks переносит избранное и просмотры с карточки from на to одной транзакцией.
+// Избранное, которое у участника уже есть у to, остается на месте.
+func moveWomanLinks(db *gorm.DB, from, to uint) (favs, views []uint, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var rows []UserFavorite
+		if err := tx.Where("woman_id = ?", from).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, f := range rows {
+			var dup int64
+			if err := tx.Model(&UserFavorite{}).Where("user_id = ? AND woman_id = ?", f.UserID, to).Count(&dup).Error; err != nil {
+				return err
+			}
+			if dup == 0 {
+				favs = append(favs, f.ID)
+			}
+		}
+		if len(favs) > 0 {
+			if err := tx.Model(&UserFavorite{}).Where("id IN ?", favs).Update("woman_id", to).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&UserView{}).Where("woman_id = ?", from).Pluck("id", &views).Error; err != nil {
+			return err
+		}
+		if len(views) > 0 {
+			return tx.Model(&UserView{}).Where("id IN ?", views).Update("woman_id", to).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return favs, views, nil
+}
+
+func (wm *WomanManager) getDeletedWoman(id uint) (*Woman, error) {
+	var w Woman
+	if err := wm.DB.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).Limit(1).Find(&w).Error; err != nil {
+		return nil, err
+	}
+	if w.ID == 0 {
+		return nil, errNotInTrash
+	}
+	return &w, nil
+}
+
+// RestoreWoman возвращает карточку из корзины вместе с тегами, поиском,
+// а после слияния — с избранным и просмотрами.
+func (wm *WomanManager) RestoreWoman(id uint, actorID int64) (*Woman, error) {
+	w, err := wm.getDeletedWoman(id)
+	if err != nil {
+		return nil, err
+	}
+	var info WomanDeletion
+	wm.DB.Where("woman_id = ?", id).Limit(1).Find(&info)
+	err = wm.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&Woman{}).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if len(info.MovedFavorites) > 0 {
+			if err := tx.Model(&UserFavorite{}).Where("id IN ?", info.MovedFavorites).Update("woman_id", id).Error; err != nil {
+				return err
+			}
+		}
+		if len(info.MovedViews) > 0 {
+			if err := tx.Model(&UserView{}).Where("id IN ?", info.MovedViews).Update("woman_id", id).Error; err != nil {
+				return err
+			}
+		}
+		if err := syncWomanTags(tx, id, w.Tags); err != nil {
+			return err
+		}
+		return tx.Where("woman_id = ?", id).Delete(&WomanDeletion{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.DeletedAt = gorm.DeletedAt{}
+	wm.syncSearchIndex(w)
+	wm.Mu.Lock()
+	wm.FieldsCache = nil
+	wm.TagsCache = nil
+	wm.Mu.Unlock()
+	wm.LogChange(actorID, id, "restore", info.Reason, "")
+	return w, nil
+}
+
+// PurgeWoman стирает карточку из корзины навсегда вместе со всем, что на нее ссылается.
+func (wm *WomanManager) PurgeWoman(id uint) error {
+	if _, err := wm.getDeletedWoman(id); err != nil {
+		return err
+	}
+	return wm.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&UserFavorite{}, &UserView{}, &UserDelivery{}, &WomanTag{}, &WomanRevision{}, &WomanDeletion{}} {
+			if err := tx.Where("woman_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&Woman{}, id).Error
+	})
+}
+
+func (wm *WomanManager) ListTrash(limit, offset int) ([]trashItem, int64) {
+	var total int64
+	q := wm.DB.Unscoped().Model(&Woman{}).Where("deleted_at IS NOT NULL")
+	q.Count(&total)
+	var women []Woman
+	q.Order("deleted_at desc").Limit(limit).Offset(offset).Find(&women)
+	ids := make([]uint, 0, len(women))
+	for _, w := range women {
+		ids = append(ids, w.ID)
+	}
+	var infos []WomanDeletion
+	if len(ids) > 0 {
+		wm.DB.Where("woman_id IN ?", ids).Find(&infos)
+	}
+	byID := make(map[uint]WomanDeletion, len(infos))
+	for _, d := range infos {
+		byID[d.WomanID] = d
+	}
+	items := make([]trashItem, 0, len(women))
+	for _, w := range women {
+		d, ok := byID[w.ID]
+		if !ok {
+			// Удалена до появления корзины
+			d = WomanDeletion{WomanID: w.ID, DeletedAt: w.DeletedAt.Time}
+		}
+		items = append(items, trashItem{Woman: w, Deletion: d})
+	}
+	return items, total
+}
+
+// PurgeExpiredTrash стирает карточки, пролежавшие в корзине дольше срока хранения.
+// Карточки, удаленные до появления корзины (без WomanDeletion), сами не стираются —
+// их можно только вернуть или стереть вручную.
+func (wm *WomanManager) PurgeExpiredTrash(now time.Time) int {
+	var ids []uint
+	err := wm.DB.Unscoped().Model(&Woman{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", now.Add(-trashRetention())).
+		Where("id IN (?)", wm.DB.Model(&WomanDeletion{}).Select("woman_id")).
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Printf("⚠️ Не удалось найти просроченные карточки в корзине: %v", err)
+		return 0
+	}
+	purged := 0
+	for _, id := range ids {
+		if err := wm.PurgeWoman(id); err != nil {
+			log.Printf("⚠️ Не удалось очистить корзину (ID %d): %v", id, err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		log.Printf("🗑 Корзина: стерто карточек: %d", purged)
+	}
+	return purged
+}
+
+func StartTrashLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		if womanManager != nil {
+			womanManager.PurgeExpiredTrash(time.Now())
+		}
+	}
+}
+
+// ------------------------------------------
+// Бот
+// ------------------------------------------
+
+func buildTrashPage(page int) (string, *tele.ReplyMarkup) {
+	if page < 0 {
+		page = 0
+	}
+	items, total := womanManager.ListTrash(trashPageSize, page*trashPageSize)
+	if total == 0 {
+		return "🗑 Корзина пуста.", nil
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🗑 <b>Корзина</b> (%d, хранится %d дн.)\n\n", total, int(trashRetention().Hours()/24)))
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	for _, it := range items {
+		d := it.Deletion
+		who := "неизвестно"
+		if d.DeletedBy != 0 {
+			who = strconv.FormatInt(d.DeletedBy, 10)
+		}
+		sb.WriteString(fmt.Sprintf("<b>#%d</b> %s\n   удалена %s, 👤 %s", it.Woman.ID, html.EscapeString(it.Woman.Name), d.DeletedAt.Format("02.01.2006 15:04"), who))
+		if d.MergedInto != 0 {
+			sb.WriteString(fmt.Sprintf(", слита в #%d", d.MergedInto))
+		}
+		if d.Reason != "" {
+			sb.WriteString(" — " + html.EscapeString(shorten(d.Reason, 100)))
+		}
+		sb.WriteString("\n")
+		rows = append(rows, m.Row(
+			m.Data(fmt.Sprintf("♻️ #%d", it.Woman.ID), fmt.Sprintf("%srestore_%d", cbTrashPrefix, it.Woman.ID)),
+			m.Data(fmt.Sprintf("🔥 #%d", it.Woman.ID), fmt.Sprintf("%spurge_%d", cbTrashPrefix, it.Woman.ID)),
+		))
+	}
+	var nav []tele.Btn
+	if page > 0 {
+		nav = append(nav, m.Data("⬅️", fmt.Sprintf("%spage_%d", cbTrashPrefix, page-1)))
+	}
+	if int64((page+1)*trashPageSize) < total {
+		nav = append(nav, m.Data("➡️", fmt.Sprintf("%spage_%d", cbTrashPrefix, page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, m.Row(nav...))
+	}
+	m.Inline(rows...)
+	return sb.String(), m
+}
+
+// HandleTrash: /trash [страница]
+func HandleTrash(c tele.Context) error {
+	if c.Sender() == nil || !isStaff(c.Sender().ID) {
+		return nil
+	}
+	page := 0
+	if args := c.Args(); len(args) > 0 {
+		page, _ = strconv.Atoi(args[0])
+		page--
+	}
+	text, menu := buildTrashPage(page)
+	if menu == nil || !hasPermission(c.Sender().ID, PermDelete) {
+		return c.Reply(text, tele.ModeHTML)
+	}
+	return c.Reply(text, menu, tele.ModeHTML)
+}
+
+func HandleRestore(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermDelete) {
+		return nil
+	}
+	args := c.Args()
+	if len(args) != 1 || parseWomanID(args[0]) == 0 {
+		return c.Reply("Используйте: /restore <code>&lt;id&gt;</code>", tele.ModeHTML)
+	}
+	return c.Reply(restoreReply(parseWomanID(args[0]), c.Sender().ID), tele.ModeHTML)
+}
+
+func HandlePurge(c tele.Context) error {
+	if c.Sender() == nil || !hasPermission(c.Sender().ID, PermDelete) {
+		return nil
+	}
+	args := c.Args()
+	if len(args) != 1 || parseWomanID(args[0]) == 0 {
+		return c.Reply("Используйте: /purge <code>&lt;id&gt;</code> — стереть карточку из корзины навсегда", tele.ModeHTML)
+	}
+	return c.Reply(purgeReply(parseWomanID(args[0]), c.Sender().ID), tele.ModeHTML)
+}
+
+func restoreReply(id uint, actorID int64) string {
+	w, err := womanManager.RestoreWoman(id, actorID)
+	if err != nil {
+		return "❌ Не удалось восстановить: " + html.EscapeString(err.Error())
+	}
+	logModAction(actorID, "restore", strconv.FormatUint(uint64(id), 10), w.Name)
+	return fmt.Sprintf("♻️ Карточка #%d «%s» восстановлена.", id, html.EscapeString(w.Name))
+}
+
+func purgeReply(id uint, actorID int64) string {
+	if err := womanManager.PurgeWoman(id); err != nil {
+		return "❌ Не удалось стереть: " + html.EscapeString(err.Error())
+	}
+	logModAction(actorID, "purge", strconv.FormatUint(uint64(id), 10), "")
+	return fmt.Sprintf("🔥 Карточка #%d стерта навсегда.", id)
+}
+
+// handleTrashCallback: trash_page_<n>, trash_restore_<id>, trash_purge_<id> (подтверждение), trash_purgeok_<id>
+func handleTrashCallback(c tele.Context, data string) error {
+	userID := c.Sender().ID
+	if !isStaff(userID) {
+		return c.Respond()
+	}
+	parts := strings.SplitN(strings.TrimPrefix(data, cbTrashPrefix), "_", 2)
+	if len(parts) != 2 {
+		return c.Respond()
+	}
+	n, _ := strconv.Atoi(parts[1])
+	if parts[0] == "page" {
+		text, menu := buildTrashPage(n)
+		if menu == nil || !hasPermission(userID, PermDelete) {
+			return tryEdit(c, text, tele.ModeHTML)
+		}
+		return tryEdit(c, text, menu, tele.ModeHTML)
+	}
+	if !hasPermission(userID, PermDelete) || n <= 0 {
+		return c.Respond(&tele.CallbackResponse{Text: "Нет прав"})
+	}
+	id := uint(n)
+	switch parts[0] {
+	case "restore":
+		c.Respond()
+		return c.Send(restoreReply(id, userID), tele.ModeHTML)
+	case "purge":
+		m := &tele.ReplyMarkup{}
+		m.Inline(m.Row(
+			m.Data("🔥 Стереть навсегда", fmt.Sprintf("%spurgeok_%d", cbTrashPrefix, id)),
+			m.Data("Отмена", fmt.Sprintf("%spage_0", cbTrashPrefix)),
+		))
+		c.Respond()
+		return c.Send(fmt.Sprintf("Стереть карточку #%d без возможности восстановления?", id), m, tele.ModeHTML)
+	case "purgeok":
+		c.Respond()
+		return tryEdit(c, purgeReply(id, userID), tele.ModeHTML)
+	}
+	return c.Respond()
+}
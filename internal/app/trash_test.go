@@ -0,0 +1,137 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrashRestoreAfterMerge(t *testing.T) {
+	wm := newTestWomanManager(t)
+	keep := &Woman{Name: "Ада Лавлейс", Tags: []string{"математика"}, IsPublished: true}
+	dup := &Woman{Name: "Ада Байрон", Tags: []string{"программирование"}, IsPublished: true}
+	for _, w := range []*Woman{keep, dup} {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wm.DB.Create(&UserFavorite{UserID: 10, WomanID: dup.ID})
+	wm.DB.Create(&UserFavorite{UserID: 11, WomanID: dup.ID})
+	wm.DB.Create(&UserFavorite{UserID: 11, WomanID: keep.ID})
+	wm.DB.Create(&UserView{UserID: 10, WomanID: dup.ID})
+
+	if err := wm.TrashMerged(dup.ID, keep.ID, 5); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := wm.GetWomanByID(dup.ID); w != nil && w.ID != 0 {
+		t.Fatal("merged card must be hidden")
+	}
+	var favs, views int64
+	wm.DB.Model(&UserFavorite{}).Where("woman_id = ?", keep.ID).Count(&favs)
+	wm.DB.Model(&UserView{}).Where("woman_id = ?", keep.ID).Count(&views)
+	if favs != 2 || views != 1 { // у 11-го уже была оставшаяся карточка
+		t.Fatalf("links must follow the merge: favs=%d views=%d", favs, views)
+	}
+
+	items, total := wm.ListTrash(10, 0)
+	if total != 1 || items[0].Deletion.DeletedBy != 5 || items[0].Deletion.MergedInto != keep.ID {
+		t.Fatalf("unexpected trash: %+v", items)
+	}
+
+	w, err := wm.RestoreWoman(dup.ID, 5)
+	if err != nil || w.Name != "Ада Байрон" {
+		t.Fatalf("restore: %+v %v", w, err)
+	}
+	wm.DB.Model(&UserFavorite{}).Where("woman_id = ?", dup.ID).Count(&favs)
+	wm.DB.Model(&UserView{}).Where("woman_id = ?", dup.ID).Count(&views)
+	if favs != 2 || views != 1 {
+		t.Fatalf("links must come back: favs=%d views=%d", favs, views)
+	}
+	if ids := wm.womenWithTag("программирование"); len(ids) != 1 {
+		t.Fatalf("tags must be restored: %v", ids)
+	}
+	if _, total := wm.ListTrash(10, 0); total != 0 {
+		t.Fatalf("trash must be empty, got %d", total)
+	}
+	if _, err := wm.RestoreWoman(dup.ID, 5); !errors.Is(err, errNotInTrash) {
+		t.Fatalf("restoring a live card: %v", err)
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	wm := newTestWomanManager(t)
+	old := &Woman{Name: "Старая", IsPublished: true}
+	fresh := &Woman{Name: "Свежая", IsPublished: true}
+	for _, w := range []*Woman{old, fresh} {
+		if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+			t.Fatal(err)
+		}
+		wm.DB.Create(&UserFavorite{UserID: 10, WomanID: w.ID})
+	}
+	if err := wm.PurgeWoman(old.ID); !errors.Is(err, errNotInTrash) {
+		t.Fatalf("live card must not be purged: %v", err)
+	}
+	for _, w := range []*Woman{old, fresh} {
+		if err := wm.DeleteWoman(w.ID, 1, "тест"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wm.DB.Unscoped().Model(&Woman{}).Where("id = ?", old.ID).Update("deleted_at", time.Now().AddDate(0, 0, -defaultTrashRetentionDays-1))
+
+	// Удаленная до появления корзины карточка без WomanDeletion не стирается
+	legacy := &Woman{Name: "Давно удаленная", IsPublished: true}
+	if err := wm.UpdateWomanBy(legacy, 1, "create"); err != nil {
+		t.Fatal(err)
+	}
+	wm.DB.Unscoped().Model(&Woman{}).Where("id = ?", legacy.ID).Update("deleted_at", time.Now().AddDate(-1, 0, 0))
+
+	if n := wm.PurgeExpiredTrash(time.Now()); n != 1 {
+		t.Fatalf("expected one expired card, got %d", n)
+	}
+	var left int64
+	wm.DB.Unscoped().Model(&Woman{}).Where("id = ?", old.ID).Count(&left)
+	if left != 0 {
+		t.Fatal("expired card must be gone")
+	}
+	wm.DB.Model(&UserFavorite{}).Where("woman_id = ?", old.ID).Count(&left)
+	if left != 0 {
+		t.Fatal("favorites of a purged card must be gone")
+	}
+	if _, total := wm.ListTrash(10, 0); total != 2 {
+		t.Fatalf("fresh and legacy cards must stay in trash, got %d", total)
+	}
+}
+
+func TestRestoreKeepsTagChanges(t *testing.T) {
+	wm := newTestWomanManager(t)
+	w := &Woman{Name: "Анна Ахматова", Tags: []string{"поэзия", "серебряный век", "литература"}, IsPublished: true}
+	if err := wm.UpdateWomanBy(w, 1, "create"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wm.DeleteWoman(w.ID, 1, "тест"); err != nil {
+		t.Fatal(err)
+	}
+	// Теги меняются, пока карточка в корзине
+	if _, err := wm.DeleteTag("поэзия", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wm.RenameTag("серебряный век", "модернизм", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := wm.RestoreWoman(w.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Tags, []string{"модернизм", "литература"}) {
+		t.Fatalf("restored card must follow tag changes: %v", restored.Tags)
+	}
+	got := tagCounts(wm.GetTagStats())
+	if _, ok := got["поэзия"]; ok {
+		t.Fatalf("deleted tag must not come back: %v", got)
+	}
+	if got["модернизм"] != 1 || got["серебряный век"] != 0 {
+		t.Fatalf("renamed tag must stay renamed: %v", got)
+	}
+}
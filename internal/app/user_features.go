@@ -75,6 +75,13 @@ func (wm *WomanManager) TrackView(userID int64, womanID uint) {
 	}
 }
 
+func (wm *WomanManager) TrackDelivery(userID int64, womanID uint) {
+	d := UserDelivery{UserID: userID, WomanID: womanID}
+	if err := wm.DB.Create(&d).Error; err != nil {
+		log.Printf("⚠️ Не удалось сохранить доставку карточки: %v", err)
+	}
+}
+
 func (wm *WomanManager) GetRecentViews(userID int64, limit int) []uint {
 	if limit <= 0 {
 		limit = 20
@@ -134,12 +141,17 @@ func (wm *WomanManager) UpdateSubscription(sub *UserSubscription) error {
 	return wm.DB.Save(sub).Error
 }
 
+// GetRelatedWomen — похожие по содержанию (TF-IDF), а если их не хватает —
+// карточки с общими тегами или той же сферой.
 func (wm *WomanManager) GetRelatedWomen(w *Woman, limit int) []Woman {
 	if w == nil || limit <= 0 {
 		return nil
 	}
 	candidates := []Woman{}
-	if len(w.Tags) > 0 {
+	for _, r := range wm.RelatedScored(w.ID, limit) {
+		candidates = append(candidates, r.Woman)
+	}
+	if len(candidates) < limit && len(w.Tags) > 0 {
 		tmp := wm.SearchWomenAdvanced(SearchFilters{
 			Tags:          w.Tags,
 			Limit:         limit * 3,
@@ -215,8 +227,8 @@ var keywordTags = map[string]string{
 	"музык":     "музыка",
 }
 
-// Алиасы тегов -> каноническое имя
-var tagAliases = map[string]string{
+// Алиасы тегов по умолчанию -> каноническое имя (засеваются в таблицу tag_aliases)
+var defaultTagAliases = map[string]string{
 	"матан":  "математика",
 	"матем":  "математика",
 	"физ":    "физика",
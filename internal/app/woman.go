@@ -12,7 +12,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/glebarez/sqlite"
 	tele "gopkg.in/telebot.v3"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -57,6 +56,9 @@ type BotSettings struct {
 	ReportTime     string `gorm:"default:'09:15'"`
 	ReportWeekday  int    `gorm:"default:1"`
 	ReportLastRun  time.Time
+	// Сводка теневых правил модерации приходит, только если они есть
+	ShadowDigestTime    string `gorm:"default:'09:45'"`
+	ShadowDigestLastRun time.Time
 }
 
 type BotUser struct {
@@ -73,8 +75,29 @@ type KnownChat struct {
 	UpdatedAt time.Time
 }
 
+// SchemaMarker хранит версии разовых миграций и производных индексов,
+// чтобы не угадывать состояние по содержимому таблиц.
+type SchemaMarker struct {
+	Name      string `gorm:"primaryKey"`
+	Version   int
+	UpdatedAt time.Time
+}
+
+func (wm *WomanManager) schemaVersion(name string) int {
+	var m SchemaMarker
+	if err := wm.DB.Where("name = ?", name).Limit(1).Find(&m).Error; err != nil {
+		return 0
+	}
+	return m.Version
+}
+
+func (wm *WomanManager) setSchemaVersion(name string, version int) error {
+	return wm.DB.Save(&SchemaMarker{Name: name, Version: version}).Error
+}
+
 type WomanManager struct {
 	DB              *gorm.DB
+	Dialect         dbDialect
 	FilePath        string
 	Drafts          map[int64]*Woman
 	Mu              sync.RWMutex
@@ -85,20 +108,28 @@ type WomanManager struct {
 	FieldsCacheTime time.Time
 	TagsCache       []TagStat
 	TagsCacheTime   time.Time
+	ftsEnabled      bool
+	related         *relatedIndex
+	cooc            *coocModel
 }
 
 // ==========================================
 // ИНИЦИАЛИЗАЦИЯ
 // ==========================================
 
-func NewWomanManager(file string) *WomanManager {
+// NewWomanManager принимает DSN основной БД: путь к файлу SQLite или строку подключения Postgres.
+func NewWomanManager(dsn string) *WomanManager {
+	dialect := newDBDialect(dsn)
 	wm := &WomanManager{
-		FilePath:        file,
+		Dialect:         dialect,
 		Drafts:          make(map[int64]*Woman),
 		VerifiedCache:   make(map[int64]bool),
 		ChatCache:       make(map[int64]time.Time),
 		ModeratorsCache: make(map[int64]string),
 	}
+	if sq, ok := dialect.(sqliteDialect); ok {
+		wm.FilePath = sq.path
+	}
 	wm.Connect()
 	wm.startDraftCleanupLoop()
 	return wm
@@ -108,12 +139,13 @@ func (wm *WomanManager) Connect() {
 	wm.Mu.Lock()
 	defer wm.Mu.Unlock()
 
-	if err := os.MkdirAll(filepath.Dir(wm.FilePath), 0755); err != nil {
-		log.Fatalf("❌ Ошибка создания директории БД: %v", err)
+	if wm.FilePath != "" {
+		if err := os.MkdirAll(filepath.Dir(wm.FilePath), 0755); err != nil {
+			log.Fatalf("❌ Ошибка создания директории БД: %v", err)
+		}
 	}
 
-	dsn := fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)", wm.FilePath)
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+	db, err := gorm.Open(wm.Dialect.Open(), &gorm.Config{
 		Logger:      logger.Default.LogMode(logger.Silent),
 		PrepareStmt: true,
 	})
@@ -126,7 +158,7 @@ func (wm *WomanManager) Connect() {
 	sqlDB.SetMaxIdleConns(5)
 	sqlDB.SetConnMaxLifetime(2 * time.Hour)
 
-	if err := db.AutoMigrate(&Woman{}, &BotSettings{}, &BotUser{}, &KnownChat{}, &UserFavorite{}, &UserView{}, &UserSubscription{}, &ChangeLog{}, &BroadcastLog{}, &Moderator{}, &ModAction{}, &Collection{}); err != nil {
+	if err := db.AutoMigrate(&Woman{}, &BotSettings{}, &BotUser{}, &KnownChat{}, &UserFavorite{}, &UserView{}, &UserDelivery{}, &UserSubscription{}, &ChangeLog{}, &BroadcastLog{}, &Moderator{}, &ModAction{}, &Collection{}, &Tag{}, &WomanTag{}, &TagAlias{}, &ModerationPolicyRow{}, &ViolationRecord{}, &ModerationPunishment{}, &ChatModerationProfile{}, &ChatMemberSeen{}, &CaptchaStat{}, &BanAppeal{}, &SpamToken{}, &SpamModelStat{}, &SpamReview{}, &MessageReport{}, &MessageReportVote{}, &ShadowHit{}, &WomanRevision{}, &WomanDeletion{}, &SchemaMarker{}); err != nil {
 		log.Printf("⚠️ Ошибка AutoMigrate: %v", err)
 	}
 
@@ -155,13 +187,19 @@ func (wm *WomanManager) Connect() {
 			settings.ReportWeekday = 1
 			updated = true
 		}
+		if settings.ShadowDigestTime == "" {
+			settings.ShadowDigestTime = "09:45"
+			updated = true
+		}
 		if updated {
 			db.Save(&settings)
 		}
 	}
 
 	wm.DB = db
-	log.Println("🔌 БД подключена (WAL).")
+	wm.related = newRelatedIndex()
+	wm.cooc = nil
+	log.Printf("🔌 БД подключена (%s).", wm.Dialect.Name())
 
 	var users []BotUser
 	db.Where("is_verified = ?", true).Find(&users)
@@ -187,8 +225,12 @@ func (wm *WomanManager) Connect() {
 
 	// Обновляем YearFrom/YearTo для старых записей (лениво, партиями)
 	wm.backfillYearRanges()
+	// Таблицы тегов и алиасы (перенос из JSON-колонки при первом запуске)
+	wm.initTags()
 	// Автоматически проставляем теги для старых записей без тегов
 	wm.backfillTags()
+	// Полнотекстовый индекс строится последним, после всех правок данных
+	wm.ensureSearchIndex()
 }
 
 func (wm *WomanManager) CloseDB() error {
@@ -207,7 +249,14 @@ func (wm *WomanManager) CloseDB() error {
 func (wm *WomanManager) Vacuum() error {
 	wm.Mu.Lock()
 	defer wm.Mu.Unlock()
-	return wm.DB.Exec("VACUUM").Error
+	return wm.Dialect.Vacuum(wm.DB)
+}
+
+// Backup сохраняет копию БД в dest средствами текущего диалекта.
+func (wm *WomanManager) Backup(dest string) error {
+	wm.Mu.Lock()
+	defer wm.Mu.Unlock()
+	return wm.Dialect.Backup(wm.DB, dest)
 }
 
 // ==========================================
@@ -466,6 +515,13 @@ func (wm *WomanManager) SaveDraft(userID int64, isPublished bool) error {
 	normalizeWoman(draft)
 	res := wm.DB.Create(draft)
 	if res.Error == nil {
+		if err := syncWomanTags(wm.DB, draft.ID, draft.Tags); err != nil {
+			log.Printf("⚠️ Не удалось сохранить теги для ID %d: %v", draft.ID, err)
+		}
+		wm.syncSearchIndex(draft)
+		if _, err := recordRevision(wm.DB, draft, userID, "create", time.Now()); err != nil {
+			log.Printf("⚠️ Не удалось сохранить ревизию для ID %d: %v", draft.ID, err)
+		}
 		delete(wm.Drafts, userID)
 		wm.FieldsCache = nil
 		wm.TagsCache = nil
@@ -479,9 +535,17 @@ func (wm *WomanManager) GetPendingSuggestions() []Woman {
 	return women
 }
 
-func (wm *WomanManager) ApproveWoman(id uint) error {
+func (wm *WomanManager) ApproveWoman(id uint, actorID int64) error {
+	ensureBaselineRevision(wm.DB, id)
 	err := wm.DB.Model(&Woman{}).Where("id = ?", id).Update("is_published", true).Error
 	if err == nil {
+		var w Woman
+		if wm.DB.First(&w, id).Error == nil {
+			if _, err := recordRevision(wm.DB, &w, actorID, "approve", time.Now()); err != nil {
+				log.Printf("⚠️ Не удалось сохранить ревизию для ID %d: %v", id, err)
+			}
+			wm.related.update(&w)
+		}
 		wm.Mu.Lock()
 		wm.FieldsCache = nil
 		wm.TagsCache = nil
@@ -504,7 +568,8 @@ func (wm *WomanManager) SearchWomen(query string) []Woman {
 	}
 	q := "%" + query + "%"
 	qLower := "%" + strings.ToLower(query) + "%"
-	wm.DB.Where("is_published = ? AND (name LIKE ? OR name LIKE ?)", true, q, qLower).Limit(10).Find(&women)
+	like := wm.Dialect.Like()
+	wm.DB.Where("is_published = ? AND (name "+like+" ? OR name "+like+" ?)", true, q, qLower).Limit(10).Find(&women)
 	return women
 }
 
@@ -515,20 +580,22 @@ func (wm *WomanManager) GetWomanByID(id uint) (*Woman, error) {
 }
 
 func (wm *WomanManager) UpdateWoman(woman *Woman) error {
-	normalizeWoman(woman)
-	err := wm.DB.Save(woman).Error
-	if err == nil {
-		wm.Mu.Lock()
-		wm.FieldsCache = nil
-		wm.TagsCache = nil
-		wm.Mu.Unlock()
-	}
-	return err
+	return wm.UpdateWomanBy(woman, 0, "update")
 }
 
-func (wm *WomanManager) DeleteWoman(id uint) error {
-	err := wm.DB.Delete(&Woman{}, id).Error
+// UpdateWomanBy сохраняет карточку и записывает ревизию (revisions.go) от имени actorID.
+func (wm *WomanManager) UpdateWomanBy(woman *Woman, actorID int64, action string) error {
+	normalizeWoman(woman)
+	ensureBaselineRevision(wm.DB, woman.ID)
+	err := wm.DB.Save(woman).Error
 	if err == nil {
+		if _, err := recordRevision(wm.DB, woman, actorID, action, time.Now()); err != nil {
+			log.Printf("⚠️ Не удалось сохранить ревизию для ID %d: %v", woman.ID, err)
+		}
+		if err := syncWomanTags(wm.DB, woman.ID, woman.Tags); err != nil {
+			log.Printf("⚠️ Не удалось сохранить теги для ID %d: %v", woman.ID, err)
+		}
+		wm.syncSearchIndex(woman)
 		wm.Mu.Lock()
 		wm.FieldsCache = nil
 		wm.TagsCache = nil
@@ -539,7 +606,7 @@ func (wm *WomanManager) DeleteWoman(id uint) error {
 
 func (wm *WomanManager) GetRandomWoman() *Woman {
 	var woman Woman
-	res := wm.DB.Where("is_published = ?", true).Order("RANDOM()").First(&woman)
+	res := wm.DB.Where("is_published = ?", true).Order(wm.Dialect.RandomOrder()).First(&woman)
 	if res.Error != nil {
 		return nil
 	}
@@ -614,28 +681,7 @@ func (wm *WomanManager) GetTagStats() []TagStat {
 	}
 	wm.Mu.RUnlock()
 
-	var women []Woman
-	wm.DB.Select("id", "tags").Where("is_published = ?", true).Find(&women)
-	counts := map[string]int{}
-	for _, w := range women {
-		for _, t := range w.Tags {
-			t = strings.TrimSpace(strings.ToLower(t))
-			if t == "" {
-				continue
-			}
-			counts[t]++
-		}
-	}
-	var stats []TagStat
-	for tag, cnt := range counts {
-		stats = append(stats, TagStat{Tag: tag, Count: cnt})
-	}
-	sort.Slice(stats, func(i, j int) bool {
-		if stats[i].Count == stats[j].Count {
-			return stats[i].Tag < stats[j].Tag
-		}
-		return stats[i].Count > stats[j].Count
-	})
+	stats := wm.tagStatsQuery(wm.DB.Model(&Woman{}).Select("id").Where("is_published = ?", true))
 
 	wm.Mu.Lock()
 	wm.TagsCache = stats
@@ -645,25 +691,7 @@ func (wm *WomanManager) GetTagStats() []TagStat {
 }
 
 func (wm *WomanManager) GetTagStatsByFilters(f SearchFilters) []TagStat {
-	q := wm.buildSearchQuery(f)
-	var women []Woman
-	q.Select("tags").Find(&women)
-	counts := map[string]int{}
-	for _, w := range women {
-		for _, t := range w.Tags {
-			t = strings.TrimSpace(strings.ToLower(t))
-			if t == "" {
-				continue
-			}
-			counts[t]++
-		}
-	}
-	var stats []TagStat
-	for t, c := range counts {
-		stats = append(stats, TagStat{Tag: t, Count: c})
-	}
-	sort.Slice(stats, func(i, j int) bool { return stats[i].Count > stats[j].Count })
-	return stats
+	return wm.tagStatsQuery(wm.buildSearchQuery(f).Select("id"))
 }
 
 func (wm *WomanManager) GetWomenByTagRandom(tag string, limit int) []Woman {
@@ -675,9 +703,8 @@ func (wm *WomanManager) GetWomenByTagRandom(tag string, limit int) []Woman {
 		return nil
 	}
 	var women []Woman
-	like := "%\"" + tag + "\"%"
-	wm.DB.Where("is_published = ? AND tags LIKE ?", true, like).
-		Order("RANDOM()").Limit(limit).Find(&women)
+	wm.DB.Where("is_published = ?", true).Where(tagFilterSQL, tag).
+		Order(wm.Dialect.RandomOrder()).Limit(limit).Find(&women)
 	return women
 }
 
@@ -686,7 +713,7 @@ func (wm *WomanManager) GetRandomWomen(limit int) []Woman {
 		return nil
 	}
 	var women []Woman
-	wm.DB.Where("is_published = ?", true).Order("RANDOM()").Limit(limit).Find(&women)
+	wm.DB.Where("is_published = ?", true).Order(wm.Dialect.RandomOrder()).Limit(limit).Find(&women)
 	return women
 }
 
@@ -696,7 +723,7 @@ func (wm *WomanManager) GetRandomWomenByField(field string, limit int) []Woman {
 	}
 	var women []Woman
 	wm.DB.Where("is_published = ? AND field = ?", true, strings.TrimSpace(field)).
-		Order("RANDOM()").Limit(limit).Find(&women)
+		Order(wm.Dialect.RandomOrder()).Limit(limit).Find(&women)
 	return women
 }
 
@@ -710,7 +737,7 @@ func (wm *WomanManager) GetWomenByYearRangeRandom(from, to, limit int) []Woman {
 	var women []Woman
 	wm.DB.Where("is_published = ? AND (year_from > 0 OR year_to > 0)", true).
 		Where("year_from <= ? AND year_to >= ?", to, from).
-		Order("RANDOM()").Limit(limit).Find(&women)
+		Order(wm.Dialect.RandomOrder()).Limit(limit).Find(&women)
 	return women
 }
 
@@ -832,18 +859,48 @@ type TagStat struct {
 }
 
 func (wm *WomanManager) SearchWomenAdvanced(f SearchFilters) []Woman {
-	q := wm.buildSearchQuery(f)
 	limit := f.Limit
 	if limit <= 0 {
 		limit = 0
 	} else if limit > 20 {
 		limit = 10
 	}
-	var women []Woman
+	return wm.searchWomen(f, limit, 0)
+}
+
+// SearchWomenPage — страница результатов и общее число совпадений (для API).
+func (wm *WomanManager) SearchWomenPage(f SearchFilters, limit, offset int) ([]Woman, int64) {
+	var total int64
+	wm.buildSearchQuery(f).Count(&total)
+	if total == 0 || int64(offset) >= total {
+		return nil, total
+	}
+	return wm.searchWomen(f, limit, offset), total
+}
+
+// searchWomen сортирует и режет страницу в SQL; при FTS-запросе записи
+// соединяются с индексом и упорядочиваются по bm25.
+func (wm *WomanManager) searchWomen(f SearchFilters, limit, offset int) []Woman {
+	var q *gorm.DB
+	if match := wm.ftsMatch(f.Query); match != "" {
+		rest := f
+		rest.Query = ""
+		q = wm.buildSearchQuery(rest).
+			Select("women.*").
+			Joins("JOIN "+womenFTSTable+" ON "+womenFTSTable+".rowid = women.id").
+			Where(womenFTSTable+" MATCH ?", match).
+			Order(womenFTSRank).Order("women.id desc")
+	} else {
+		q = wm.buildSearchQuery(f).Order("id desc")
+	}
 	if limit > 0 {
 		q = q.Limit(limit)
+		if offset > 0 {
+			q = q.Offset(offset)
+		}
 	}
-	q.Order("id desc").Find(&women)
+	var women []Woman
+	q.Find(&women)
 	return women
 }
 
@@ -853,7 +910,7 @@ func (wm *WomanManager) GetRandomWomenByFilters(f SearchFilters, limit int) []Wo
 	}
 	q := wm.buildSearchQuery(f)
 	var women []Woman
-	q.Order("RANDOM()").Limit(limit).Find(&women)
+	q.Order(wm.Dialect.RandomOrder()).Limit(limit).Find(&women)
 	return women
 }
 
@@ -864,21 +921,22 @@ func (wm *WomanManager) buildSearchQuery(f SearchFilters) *gorm.DB {
 	} else if f.PublishedOnly {
 		q = q.Where("is_published = ?", true)
 	}
-	if f.Query != "" {
+	if match := wm.ftsMatch(f.Query); match != "" {
+		q = q.Where("id IN (SELECT rowid FROM "+womenFTSTable+" WHERE "+womenFTSTable+" MATCH ?)", match)
+	} else if f.Query != "" {
 		like := "%" + f.Query + "%"
-		q = q.Where("name LIKE ? OR info LIKE ?", like, like)
+		q = q.Where("name "+wm.Dialect.Like()+" ? OR info "+wm.Dialect.Like()+" ?", like, like)
 	}
 	if f.Field != "" {
 		like := "%" + f.Field + "%"
-		q = q.Where("field LIKE ?", like)
+		q = q.Where("field "+wm.Dialect.Like()+" ?", like)
 	}
 	if len(f.Tags) > 0 {
 		for _, t := range f.Tags {
 			if t == "" {
 				continue
 			}
-			like := "%\"" + t + "\"%"
-			q = q.Where("tags LIKE ?", like)
+			q = q.Where(tagFilterSQL, t)
 		}
 	}
 	if f.YearFrom != 0 || f.YearTo != 0 {
@@ -928,9 +986,7 @@ func normalizeTags(tags []string) []string {
 		if t == "" || t == "-" {
 			continue
 		}
-		if canon, ok := tagAliases[t]; ok {
-			t = canon
-		}
+		t = canonicalTag(t)
 		if !seen[t] {
 			seen[t] = true
 			out = append(out, t)
@@ -1036,6 +1092,10 @@ func (wm *WomanManager) backfillTags() {
 			}
 			if err := tx.Model(&Woman{}).Where("id = ?", w.ID).Update("tags", string(raw)).Error; err != nil {
 				log.Printf("⚠️ Не удалось обновить теги для ID %d: %v", w.ID, err)
+				continue
+			}
+			if err := syncWomanTags(tx, w.ID, tags); err != nil {
+				log.Printf("⚠️ Не удалось сохранить теги для ID %d: %v", w.ID, err)
 			}
 		}
 		return nil